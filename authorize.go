@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnauthorized - wrapped by the errors of sends and receives of fds WithAuthorizer refused
+var ErrUnauthorized = errors.New("peer not authorized")
+
+// UnauthorizedError - returned by sends and receives of fds WithAuthorizer refused, errors.Is both ErrUnauthorized and
+//                     Err, the error authorize returned (or the one getting the credentials of the peer failed with)
+type UnauthorizedError struct {
+	Peer Credentials
+	Err  error
+}
+
+func (e *UnauthorizedError) Error() string {
+	return fmt.Sprintf("%s: peer (pid %d uid %d gid %d): %s", ErrUnauthorized, e.Peer.Pid, e.Peer.Uid, e.Peer.Gid, e.Err)
+}
+
+// Is - an UnauthorizedError is ErrUnauthorized
+func (e *UnauthorizedError) Is(target error) bool { return target == ErrUnauthorized }
+
+// Cause - the error authorize returned
+func (e *UnauthorizedError) Cause() error { return e.Err }
+
+// Unwrap - the error authorize returned
+func (e *UnauthorizedError) Unwrap() error { return e.Err }
+
+// WithAuthorizer - consult authorize, with the credentials of the peer (SO_PEERCRED, as of when it connected), before
+//                  any fd is sent to or accepted from it, so fds can be refused centrally (say, from uids not on an
+//                  allowlist) rather than by every handler
+//                  a refused send fails without sending anything, a refused receive closes the fds it received (the
+//                  data of the message is consumed), both with an *UnauthorizedError, which errors.Is both
+//                  ErrUnauthorized and the error authorize returned; given to Listen, it applies to every conn accepted
+//                  the credentials of the peer are only known on linux, on every other platform authorize is never
+//                  called and every fd is refused
+func WithAuthorizer(authorize func(peer Credentials) error) Option {
+	return func(o *options) {
+		o.authorize = authorize
+	}
+}
+
+// authorizeFDs - WithAuthorizer, an error if the peer may not be sent or have accepted from it the control messages in
+//                oob
+func (s *UnixConn) authorizeFDs(oob []byte) error {
+	if s.opts.authorize == nil || len(oob) == 0 {
+		return nil
+	}
+	peer, err := s.peerCredentials()
+	if err != nil {
+		return &UnauthorizedError{Err: errors.Wrap(err, "unable to get the credentials of the peer")}
+	}
+	if err := s.opts.authorize(peer); err != nil {
+		return &UnauthorizedError{Peer: peer, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestAuthorizer(t *testing.T) {
+	var allowed bool
+	errNotAllowed := errors.New("not allowed")
+	authorize := func(peer oob.Credentials) error {
+		// A socketpair's peer is this process
+		assert.Equal(t, oob.Credentials{Pid: os.Getpid(), Uid: os.Getuid(), Gid: os.Getgid()}, peer)
+		if !allowed {
+			return errors.Wrapf(errNotAllowed, "uid %d", peer.Uid)
+		}
+		return nil
+	}
+	sender, receiver := newUnixConnPair(t, oob.WithAuthorizer(authorize))
+
+	allowed = true
+	require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, os.NewFile(fd, "").Close())
+
+	allowed = false
+	require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+	_, err = receiver.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrUnauthorized))
+	assert.True(t, errors.Is(err, errNotAllowed), "%+v", err)
+	err = receiver.SendFD(os.Stdin.Fd())
+	assert.True(t, errors.Is(err, oob.ErrUnauthorized))
+	var unauthorized *oob.UnauthorizedError
+	require.True(t, errors.As(err, &unauthorized), "%+v", err)
+	assert.Equal(t, os.Getuid(), unauthorized.Peer.Uid)
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var _ BatchFDTransceiver = (*UnixConn)(nil)
+
+// PartialSendError - returned by SendFDs when it fails part way through a batch
+//                    Sent were queued to the kernel and will be received by the peer, Unsent were not and can be
+//                    retried without double sending any of Sent
+type PartialSendError struct {
+	Sent   []uintptr
+	Unsent []uintptr
+	Err    error
+}
+
+func (e *PartialSendError) Error() string {
+	return fmt.Sprintf("sent %d of %d fds: %s", len(e.Sent), len(e.Sent)+len(e.Unsent), e.Err)
+}
+
+// Cause - the error which stopped the batch
+func (e *PartialSendError) Cause() error { return e.Err }
+
+// Unwrap - the error which stopped the batch
+func (e *PartialSendError) Unwrap() error { return e.Err }
+
+// SendFDs - send fds to the process on the other end of the *net.UnixConn, in as few SCM_RIGHTS messages as the
+//           kernel allows
+//           if sending fails part way through, the error is a *PartialSendError saying exactly which fds were sent
+func (s *UnixConn) SendFDs(fds ...uintptr) error {
+	return s.SendFDsFunc(fds, nil)
+}
+
+// SendFDsFunc - like SendFDs, but calls onSent (if not nil) with the fds of each message as soon as the kernel has
+//               queued it, so the caller can close its copies of those fds even if a later message fails
+func (s *UnixConn) SendFDsFunc(fds []uintptr, onSent func(sent []uintptr)) error {
+	s.checkDuplicateSend(fds...)
+	defer s.opts.profile("SendFDs")()
+	defer s.watch("SendFDs", true)()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	for sent := 0; sent < len(fds); {
+		n := len(fds) - sent
+		if n > maxFDsPerMessage {
+			n = maxFDsPerMessage
+		}
+		rights := make([]int, n)
+		for i := range rights {
+			rights[i] = int(fds[sent+i])
+		}
+		// The rights are attached to the message as a whole, so either all of them were queued or none of them were
+		if _, err := s.sendmsg(nil, syscall.UnixRights(rights...)); err != nil {
+			s.record("SendFDs", err, fds[sent:]...)
+			return &PartialSendError{Sent: fds[:sent], Unsent: fds[sent:], Err: err}
+		}
+		s.record("SendFDs", nil, fds[sent:sent+n]...)
+		if onSent != nil {
+			onSent(fds[sent : sent+n])
+		}
+		sent += n
+	}
+	return nil
+}
+
+// RecvFDMessage - recv every fd of the next SCM_RIGHTS message, however many the peer sent, for when the count is
+//                 not known up front. SendFDs sends up to 253 fds in a single message, so a group of fds (such as
+//                 stdin, stdout and stderr) sent together arrives together
+//                 not available WithPrefetch, which queues fds one at a time and so loses the message boundaries
+//                 if the message received carries no fd, it returns an error errors.Is ErrNoFD
+func (s *UnixConn) RecvFDMessage() ([]uintptr, error) {
+	if s.prefetch != nil {
+		return nil, errors.New("RecvFDMessage is not available WithPrefetch, which does not keep message boundaries")
+	}
+	defer s.opts.profile("RecvFDs")()
+	defer s.watch("RecvFDs", false)()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	rights, err := s.recvRights()
+	if err == nil && len(rights) == 0 {
+		err = errors.Wrap(ErrNoFD, "expected fds but the message carried none")
+	}
+	if err != nil {
+		closeFDs(rights)
+		s.record("RecvFDs", err)
+		return nil, err
+	}
+	fds := make([]uintptr, len(rights))
+	for i, fd := range rights {
+		fds[i] = uintptr(fd)
+		s.recordRecv("RecvFDs", fds[i], nil)
+	}
+	return fds, nil
+}
+
+// FDResult - the outcome for a single fd received by RecvFDResults
+type FDResult struct {
+	// FD - the fd received, 0 if Err is set (in which case it has already been closed)
+	FD  uintptr
+	Err error
+}
+
+// RecvFDs - recv n fds sent with SendFDs (or SendFD) over a *net.UnixConn
+//           if fewer than n arrive, the ones which did are closed and an error is returned
+func (s *UnixConn) RecvFDs(n int) ([]uintptr, error) {
+	results, err := s.RecvFDResults(n, nil)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]uintptr, len(results))
+	for i, result := range results {
+		fds[i] = result.FD
+	}
+	return fds, nil
+}
+
+// RecvFDResults - like RecvFDs, but each fd is passed to check (if not nil) and any fd check rejects is closed and
+//                 has its FDResult.Err set rather than failing the whole batch
+//                 an error is only returned if the batch as a whole could not be received
+func (s *UnixConn) RecvFDResults(n int, check func(fd uintptr) error) ([]FDResult, error) {
+	defer s.opts.profile("RecvFDs")()
+	defer s.watch("RecvFDs", false)()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	var fds []int
+	for len(fds) < n {
+		rights, err := s.nextRights()
+		fds = append(fds, rights...)
+		if err == nil && len(rights) == 0 {
+			err = errors.Errorf("expected %d fds but only %d were received", n, len(fds))
+		}
+		if err != nil {
+			closeFDs(fds)
+			s.record("RecvFDs", err)
+			return nil, err
+		}
+	}
+	if len(fds) != n {
+		closeFDs(fds)
+		err := errors.Errorf("expected %d fds but %d were received", n, len(fds))
+		s.record("RecvFDs", err)
+		return nil, err
+	}
+	results := make([]FDResult, len(fds))
+	for i, fd := range fds {
+		results[i].FD = uintptr(fd)
+		if check != nil {
+			if results[i].Err = check(results[i].FD); results[i].Err != nil {
+				_ = syscall.Close(fd)
+				results[i].FD = 0
+			}
+		}
+		s.recordRecv("RecvFDs", results[i].FD, results[i].Err)
+	}
+	return results, nil
+}
+
+// recvRights - receives the single byte message sent along with an SCM_RIGHTS message and returns its fds
+func (s *UnixConn) recvRights() ([]int, error) {
+	oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+	n, oobn, _, err := s.recvmsg(make([]byte, 1), oob, 0)
+	var fds []int
+	if oobn > 0 {
+		var parseErr error
+		fds, parseErr = parseRights(oob[:oobn])
+		if parseErr != nil && err == nil {
+			err = parseErr
+		}
+	}
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+	return fds, err
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSendFDs(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	// More than fit in one SCM_RIGHTS message
+	fds := make([]uintptr, 300)
+	for i := range fds {
+		fds[i] = r.Fd()
+	}
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendFDs(fds...) }()
+	received, err := receiver.RecvFDs(len(fds))
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.Len(t, received, len(fds))
+	for _, fd := range received {
+		assert.NoError(t, syscall.Close(int(fd)))
+	}
+}
+
+func TestSendFDsPartialFailure(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	// An fd number far above anything the test has open
+	const closed = 1 << 20
+
+	// The first message goes through, the second carries a bad fd
+	fds := make([]uintptr, 260)
+	for i := range fds {
+		fds[i] = r.Fd()
+	}
+	fds[256] = closed
+	sender, receiver := newUnixConnPair(t)
+	err = sender.SendFDs(fds...)
+	require.Error(t, err)
+	partial := &oob.PartialSendError{}
+	require.True(t, errors.As(err, &partial))
+	assert.Equal(t, fds[:253], partial.Sent)
+	assert.Equal(t, fds[253:], partial.Unsent)
+	assert.Equal(t, syscall.EBADF, errors.Cause(err))
+
+	received, err := receiver.RecvFDs(len(partial.Sent))
+	require.NoError(t, err)
+	for _, fd := range received {
+		assert.NoError(t, syscall.Close(int(fd)))
+	}
+}
+
+func TestSendFDsFunc(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	const closed = 1 << 20
+
+	fds := make([]uintptr, 260)
+	for i := range fds {
+		fds[i] = r.Fd()
+	}
+	fds[256] = closed
+	sender, receiver := newUnixConnPair(t)
+	var sent [][]uintptr
+	err = sender.SendFDsFunc(fds, func(fds []uintptr) { sent = append(sent, fds) })
+	require.Error(t, err)
+	// Only the message which made it is reported
+	require.Len(t, sent, 1)
+	assert.Equal(t, fds[:253], sent[0])
+
+	received, err := receiver.RecvFDs(len(sent[0]))
+	require.NoError(t, err)
+	for _, fd := range received {
+		assert.NoError(t, syscall.Close(int(fd)))
+	}
+}
+
+func TestRecvFDResults(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	defer func() { _ = file.Close() }()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFDs(file.Fd(), r.Fd(), file.Fd()))
+	// Only accept regular files
+	results, err := receiver.RecvFDResults(3, func(fd uintptr) error {
+		stat := &syscall.Stat_t{}
+		if err := syscall.Fstat(int(fd), stat); err != nil {
+			return err
+		}
+		if stat.Mode&syscall.S_IFMT != syscall.S_IFREG {
+			return errors.New("not a regular file")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.Zero(t, results[1].FD)
+	assert.NoError(t, results[2].Err)
+	assert.NoError(t, syscall.Close(int(results[0].FD)))
+	assert.NoError(t, syscall.Close(int(results[2].FD)))
+}
+
+func TestRecvFDMessage(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFDs(os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()))
+	require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+
+	fds, err := receiver.RecvFDMessage()
+	require.NoError(t, err)
+	assert.Len(t, fds, 3)
+	fds2, err := receiver.RecvFDMessage()
+	require.NoError(t, err)
+	assert.Len(t, fds2, 1)
+	for _, fd := range append(fds, fds2...) {
+		assert.NoError(t, syscall.Close(int(fd)))
+	}
+
+	// A message without fds is an error
+	_, err = sender.Write([]byte{0})
+	require.NoError(t, err)
+	_, err = receiver.RecvFDMessage()
+	assert.True(t, errors.Is(err, oob.ErrNoFD), "%+v", err)
+
+	// Prefetch loses the message boundaries
+	_, prefetching := newUnixConnPair(t, oob.WithPrefetch(4))
+	_, err = prefetching.RecvFDMessage()
+	assert.Error(t, err)
+}
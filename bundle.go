@@ -0,0 +1,470 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of descriptor recorded in a bundle manifest
+const (
+	KindFile    = "file"
+	KindDir     = "dir"
+	KindSymlink = "symlink"
+	KindSocket  = "socket"
+	KindFifo    = "fifo"
+	KindChar    = "char"
+	KindBlock   = "block"
+)
+
+// Bundle - a labeled set of descriptors with per item metadata which is sent (SendBundle) and received (RecvBundle)
+//          as a unit, the receiver verifies what it got against the manifest before handing any of it over
+type Bundle struct {
+	Items []*BundleItem `json:"items"`
+	// State - application state carried along with the items, by label (see SetState and DecodeState)
+	State map[string]*BundleState `json:"state,omitempty"`
+}
+
+// BundleItem - a labeled descriptor in a Bundle
+type BundleItem struct {
+	Label    string            `json:"label"`
+	Kind     string            `json:"kind"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// SHA256 - hex encoded sha256 of the contents of a regular file, verified by the receiver if set
+	SHA256 string `json:"sha256,omitempty"`
+	// Expires - if set, when the receiver gives up on the item: an item received after then is closed instead of
+	//           being handed over, and one received before then is closed when it comes unless it was claimed (see
+	//           Claim), see AddExpiring
+	Expires *time.Time `json:"expires,omitempty"`
+	// File - the descriptor, owned by the caller of RecvBundle once it returns (once claimed, if it has an expiry)
+	File *os.File `json:"-"`
+	// Err - why the item was rejected by RecvBundleResults, in which case File is nil
+	Err error `json:"-"`
+
+	// expiry - closes a received item with an expiry unless it is claimed first
+	expiry *itemExpiry
+}
+
+// itemExpiry - the timer closing a received item when it expires, unless it was claimed first
+type itemExpiry struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	claimed bool
+	expired bool
+}
+
+// BundleState - an entry of application state in a Bundle, either inline or offloaded into a sealed memfd item
+type BundleState struct {
+	Data []byte `json:"data,omitempty"`
+	// Item - the label of the item holding the state, if it was offloaded
+	Item string `json:"item,omitempty"`
+	// Length - how many bytes of state there are
+	Length int `json:"length"`
+}
+
+// ErrExpired - the Err of a bundle item which was received after it expired
+var ErrExpired = errors.New("bundle item expired before it was received")
+
+// NewBundle - an empty Bundle
+func NewBundle() *Bundle {
+	return &Bundle{}
+}
+
+// Add - adds thing (anything ToFd accepts) to the bundle under label, with optional metadata
+//       the bundle keeps its own dup of the fd of thing, so thing remains the caller's and Close only closes the dup
+func (b *Bundle) Add(label string, thing interface{}, metadata map[string]string) error {
+	_, err := b.add(label, thing, metadata)
+	return err
+}
+
+// AddHashed - like Add, but also records the sha256 of the contents of thing (which must be a regular file) so the
+//             receiver can verify them
+func (b *Bundle) AddHashed(label string, thing interface{}, metadata map[string]string) error {
+	item, err := b.add(label, thing, metadata)
+	if err != nil {
+		return err
+	}
+	if item.Kind != KindFile {
+		b.remove(item)
+		return errors.Errorf("cannot hash %q, it is a %s not a %s", label, item.Kind, KindFile)
+	}
+	item.SHA256, err = hashFile(item.File)
+	if err != nil {
+		b.remove(item)
+		return err
+	}
+	return nil
+}
+
+// AddExpiring - like Add, but if the receiver hasn't received the bundle by expires, it closes the item (reporting it
+//               through its Logger, event ring and Stats) rather than handing it over, with its Err set to ErrExpired,
+//               and if the application hasn't claimed it (Claim) by expires, it is closed then, the same way,
+//               bounding how long a slow consumer can leave it in flight
+func (b *Bundle) AddExpiring(label string, thing interface{}, metadata map[string]string, expires time.Time) error {
+	item, err := b.add(label, thing, metadata)
+	if err != nil {
+		return err
+	}
+	item.Expires = &expires
+	return nil
+}
+
+func (b *Bundle) add(label string, thing interface{}, metadata map[string]string) (*BundleItem, error) {
+	if b.Get(label) != nil {
+		return nil, errors.Errorf("bundle already has an item labeled %q", label)
+	}
+	fd, err := ToFd(thing)
+	if err != nil {
+		return nil, err
+	}
+	// Our own dup, so that neither Close nor the finalizer of File can close an fd thing still owns
+	fd, err = dupFd(fd)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(fd, label)
+	kind, err := fileKind(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	item := &BundleItem{Label: label, Kind: kind, Metadata: metadata, File: file}
+	b.Items = append(b.Items, item)
+	return item, nil
+}
+
+// remove - removes the last item added, item, closing its dup
+func (b *Bundle) remove(item *BundleItem) {
+	b.Items = b.Items[:len(b.Items)-1]
+	_ = item.File.Close()
+}
+
+// Get - the item labeled label, or nil if there isn't one
+func (b *Bundle) Get(label string) *BundleItem {
+	for _, item := range b.Items {
+		if item.Label == label {
+			return item
+		}
+	}
+	return nil
+}
+
+// Claim - the File of a received item, which is no longer closed when the item expires (AddExpiring), or an error
+//         errors.Is ErrExpired if it already was, the item's Err if it was rejected
+func (item *BundleItem) Claim() (*os.File, error) {
+	if item.Err != nil {
+		return nil, item.Err
+	}
+	if item.expiry != nil && !item.expiry.claim() {
+		return nil, errors.Wrapf(ErrExpired, "%q expired at %s before it was claimed", item.Label, item.Expires.Format(time.RFC3339Nano))
+	}
+	return item.File, nil
+}
+
+// claim - stops the timer, false if it already closed the item
+func (e *itemExpiry) claim() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.expired {
+		return false
+	}
+	if !e.claimed {
+		e.claimed = true
+		e.timer.Stop()
+	}
+	return true
+}
+
+// armExpiry - closes item once it expires, unless it was claimed by then, reporting it like an item which expired
+//             before it was received
+func (s *UnixConn) armExpiry(item *BundleItem) {
+	e := &itemExpiry{}
+	item.expiry = e
+	// Held until the timer is set, so that it can't fire before claim can stop it
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.timer = time.AfterFunc(time.Until(*item.Expires), func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.claimed {
+			return
+		}
+		e.expired = true
+		s.opts.logf("oob: closing fd %d of bundle item %q, which expired before it was claimed", item.File.Fd(), item.Label)
+		_ = item.File.Close()
+		s.fdsExpired(1)
+		s.record("RecvBundle", errors.Wrapf(ErrExpired, "%q expired at %s", item.Label, item.Expires.Format(time.RFC3339Nano)))
+	})
+}
+
+// Close - closes the File of every item in the bundle
+func (b *Bundle) Close() error {
+	var err error
+	for _, item := range b.Items {
+		if item.File == nil {
+			continue
+		}
+		if item.expiry != nil && !item.expiry.claim() {
+			// Already closed when it expired
+			continue
+		}
+		if closeErr := item.File.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// SendBundle - sends the manifest of b followed by the fds of its items
+//              b still owns its dups afterwards, close them (b.Close()) once they are no longer needed
+func (s *UnixConn) SendBundle(b *Bundle) (err error) {
+	defer s.opts.profile("SendBundle")()
+	manifest, err := json.Marshal(b)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fds := make([]int, 0, len(b.Items))
+	for _, item := range b.Items {
+		fd, err := ToFd(item.File)
+		if err != nil {
+			return err
+		}
+		fds = append(fds, int(fd))
+		s.checkDuplicateSend(fd)
+	}
+	defer func(fds []int) {
+		items := make([]uintptr, len(fds))
+		for i, fd := range fds {
+			items[i] = uintptr(fd)
+		}
+		s.record("SendBundle", err, items...)
+	}(fds)
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err := s.writeFrame(&frame{typ: frameBundleManifest, payload: manifest}); err != nil {
+		return err
+	}
+	for len(fds) > 0 {
+		n := len(fds)
+		if n > maxFDsPerMessage {
+			n = maxFDsPerMessage
+		}
+		if err := s.writeFrame(&frame{typ: frameBundleFDs, fds: fds[:n]}); err != nil {
+			return err
+		}
+		fds = fds[n:]
+	}
+	return nil
+}
+
+// RecvBundle - receives a bundle sent with SendBundle and verifies that the fds received match its manifest in
+//              count, kind and (where the sender recorded one) content hash
+//              if anything does not match, every fd received is closed and an error is returned
+func (s *UnixConn) RecvBundle() (*Bundle, error) {
+	b, err := s.RecvBundleResults(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range b.Items {
+		if item.Err != nil {
+			_ = b.Close()
+			return nil, item.Err
+		}
+	}
+	return b, nil
+}
+
+// RecvBundleResults - like RecvBundle, but an item which fails verification (or check, if check is not nil) only
+//                     has its fd closed and its Err set, the rest of the bundle is still delivered
+//                     an error is only returned if the bundle as a whole could not be received
+func (s *UnixConn) RecvBundleResults(check func(item *BundleItem) error) (*Bundle, error) {
+	defer s.opts.profile("RecvBundle")()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	f, err := s.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	closeFDs(f.fds)
+	if f.typ != frameBundleManifest {
+		return nil, errors.Errorf("received unexpected frame type %d while waiting for a bundle manifest", f.typ)
+	}
+	b := &Bundle{}
+	if err = json.Unmarshal(f.payload, b); err != nil {
+		return nil, errors.Wrap(err, "received malformed bundle manifest")
+	}
+	if err = b.validate(); err != nil {
+		s.discardBundleFDs(len(b.Items))
+		return nil, errors.Wrap(err, "received malformed bundle manifest")
+	}
+	if err = s.opts.checkPendingFDs(len(b.Items)); err != nil {
+		s.discardBundleFDs(len(b.Items))
+		return nil, errors.Wrap(err, "refused bundle")
+	}
+
+	var fds []int
+	for len(fds) < len(b.Items) {
+		f, err = s.readFrame()
+		if err != nil {
+			closeFDs(fds)
+			return nil, err
+		}
+		fds = append(fds, f.fds...)
+		if f.typ != frameBundleFDs || len(f.fds) == 0 {
+			closeFDs(fds)
+			return nil, errors.Errorf("bundle manifest lists %d items but only %d fds were received", len(b.Items), len(fds))
+		}
+		if len(fds) > len(b.Items) {
+			break
+		}
+	}
+	if len(fds) != len(b.Items) {
+		closeFDs(fds)
+		return nil, errors.Errorf("bundle manifest lists %d items but %d fds were received", len(b.Items), len(fds))
+	}
+	for i, item := range b.Items {
+		item.File = os.NewFile(uintptr(fds[i]), item.Label)
+	}
+	now := time.Now()
+	for _, item := range b.Items {
+		item.Err = item.verify()
+		if item.Err == nil && item.Expires != nil && now.After(*item.Expires) {
+			item.Err = errors.Wrapf(ErrExpired, "%q expired at %s", item.Label, item.Expires.Format(time.RFC3339Nano))
+			s.opts.logf("oob: closing fd %d of bundle item %q, which expired %s before it was received", item.File.Fd(), item.Label, now.Sub(*item.Expires))
+			s.fdsExpired(1)
+		}
+		if item.Err == nil && check != nil {
+			item.Err = check(item)
+		}
+		if item.Err != nil {
+			_ = item.File.Close()
+			item.File = nil
+			s.record("RecvBundle", item.Err)
+			continue
+		}
+		s.record("RecvBundle", nil, item.File.Fd())
+		if item.Expires != nil {
+			s.armExpiry(item)
+		}
+	}
+	return b, nil
+}
+
+// validate - an error if a received manifest has items or state the rest of RecvBundle can't use
+func (b *Bundle) validate() error {
+	for i, item := range b.Items {
+		if item == nil {
+			return errors.Errorf("item %d is null", i)
+		}
+	}
+	for label, state := range b.State {
+		if state == nil {
+			return errors.Errorf("state %q is null", label)
+		}
+	}
+	return nil
+}
+
+// discardBundleFDs - reads and closes the fds of a refused bundle with n items, so the frames after it can still be
+//                    received, leaving any other frame for the next readFrame
+func (s *UnixConn) discardBundleFDs(n int) {
+	for n > 0 {
+		f, err := s.readFrame()
+		if err != nil {
+			return
+		}
+		if f.typ != frameBundleFDs || len(f.fds) == 0 {
+			s.pending = append([]*frame{f}, s.pending...)
+			return
+		}
+		closeFDs(f.fds)
+		n -= len(f.fds)
+	}
+}
+
+func (item *BundleItem) verify() error {
+	kind, err := fileKind(item.File)
+	if err != nil {
+		return err
+	}
+	if kind != item.Kind {
+		return errors.Errorf("bundle item %q should be a %s but a %s was received", item.Label, item.Kind, kind)
+	}
+	if item.SHA256 == "" {
+		return nil
+	}
+	if kind != KindFile {
+		return errors.Errorf("bundle item %q has a hash but is a %s", item.Label, kind)
+	}
+	sum, err := hashFile(item.File)
+	if err != nil {
+		return err
+	}
+	if sum != item.SHA256 {
+		return errors.Errorf("bundle item %q has sha256 %s but the manifest says %s", item.Label, sum, item.SHA256)
+	}
+	return nil
+}
+
+// hashFile - hex encoded sha256 of the contents of file, read with ReadAt so the offset of file is left alone
+func hashFile(file *os.File) (string, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, fi.Size())); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileKind(file *os.File) (string, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	return modeKind(fi.Mode()), nil
+}
+
+func modeKind(mode fs.FileMode) string {
+	switch mode.Type() {
+	case fs.ModeDir:
+		return KindDir
+	case fs.ModeSymlink:
+		return KindSymlink
+	case fs.ModeSocket:
+		return KindSocket
+	case fs.ModeNamedPipe:
+		return KindFifo
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return KindChar
+	case fs.ModeDevice:
+		return KindBlock
+	}
+	return KindFile
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestBundle(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	_, err = file.WriteString("contents")
+	require.NoError(t, err)
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	b := oob.NewBundle()
+	require.NoError(t, b.AddHashed("config", file, map[string]string{"version": "1"}))
+	require.NoError(t, b.Add("pipe", r, nil))
+	require.Error(t, b.Add("pipe", w, nil))
+	require.Error(t, b.AddHashed("not-a-file", w, nil))
+	defer func() { _ = b.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendBundle(b) }()
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	defer func() { _ = received.Close() }()
+
+	require.Len(t, received.Items, 2)
+	config := received.Get("config")
+	require.NotNil(t, config)
+	assert.Equal(t, oob.KindFile, config.Kind)
+	assert.Equal(t, "1", config.Metadata["version"])
+	assert.Equal(t, oob.KindFifo, received.Get("pipe").Kind)
+
+	_, err = w.WriteString("hello")
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = received.Get("pipe").File.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestBundleHashMismatch(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	_, err = file.WriteString("contents")
+	require.NoError(t, err)
+
+	b := oob.NewBundle()
+	require.NoError(t, b.AddHashed("config", file, nil))
+	defer func() { _ = b.Close() }()
+	_, err = file.WriteString(" changed after hashing")
+	require.NoError(t, err)
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendBundle(b) }()
+	_, err = receiver.RecvBundle()
+	require.Error(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func TestRecvBundleResults(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	_, err = file.WriteString("contents")
+	require.NoError(t, err)
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = w.Close() }()
+
+	b := oob.NewBundle()
+	require.NoError(t, b.AddHashed("config", file, nil))
+	require.NoError(t, b.Add("pipe", r, nil))
+	defer func() { _ = b.Close() }()
+	_, err = file.WriteString(" changed after hashing")
+	require.NoError(t, err)
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendBundle(b) }()
+	received, err := receiver.RecvBundleResults(nil)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	defer func() { _ = received.Close() }()
+
+	require.Len(t, received.Items, 2)
+	assert.Error(t, received.Get("config").Err)
+	assert.Nil(t, received.Get("config").File)
+	assert.NoError(t, received.Get("pipe").Err)
+	assert.NotNil(t, received.Get("pipe").File)
+}
+
+func TestBundleOwnsDups(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	defer func() { _ = file.Close() }()
+	conn := CreatTestConn(t)
+	defer func() { _ = conn.Close() }()
+
+	b := oob.NewBundle()
+	require.NoError(t, b.Add("file", file, nil))
+	require.NoError(t, b.Add("conn", conn, nil))
+	require.NoError(t, b.Close())
+
+	// Closing the bundle closed its dups, not the caller's file and conn
+	_, err = file.WriteString("still open")
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("still open"))
+	assert.NoError(t, err)
+}
+
+func TestSendBundleFunc(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	b := oob.NewBundle()
+	require.NoError(t, b.Add("pipe", r, nil))
+
+	sender, receiver := newUnixConnPair(t)
+	called := 0
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- sender.SendBundleFunc(b, func() {
+			called++
+			assert.NoError(t, b.Close())
+		})
+	}()
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, 1, called)
+	require.NoError(t, received.Close())
+
+	_ = sender.Close()
+	assert.Error(t, sender.SendBundleFunc(oob.NewBundle(), func() { called++ }))
+	assert.Equal(t, 1, called)
+}
+
+func TestBundleExpiry(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	require.NoError(t, b.AddExpiring("stale", f, nil, time.Now().Add(-time.Second)))
+	require.NoError(t, b.AddExpiring("fresh", f, nil, time.Now().Add(time.Hour)))
+
+	logs := &syncBuffer{}
+	sender, receiver := newUnixConnPair(t, oob.WithLogger(log.New(logs, "", 0)))
+	require.NoError(t, sender.SendBundle(b))
+	received, err := receiver.RecvBundleResults(nil)
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+
+	stale := received.Get("stale")
+	assert.True(t, errors.Is(stale.Err, oob.ErrExpired), "%+v", stale.Err)
+	assert.Nil(t, stale.File)
+	assert.Contains(t, logs.String(), `"stale", which expired`)
+	fresh := received.Get("fresh")
+	require.NoError(t, fresh.Err)
+	assert.NotNil(t, fresh.File)
+	assert.EqualValues(t, 1, receiver.Stats().FDsExpired)
+}
+
+func TestBundleExpiresUnclaimed(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	expires := time.Now().Add(100 * time.Millisecond)
+	require.NoError(t, b.AddExpiring("unclaimed", f, nil, expires))
+	require.NoError(t, b.AddExpiring("claimed", f, nil, expires))
+
+	logs := &syncBuffer{}
+	sender, receiver := newUnixConnPair(t, oob.WithLogger(log.New(logs, "", 0)))
+	require.NoError(t, sender.SendBundle(b))
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	claimed, err := received.Get("claimed").Claim()
+	require.NoError(t, err)
+
+	// Only the item nobody claimed is closed once they expire
+	assert.Eventually(t, func() bool { return receiver.Stats().FDsExpired == 1 }, 5*time.Second, 10*time.Millisecond)
+	_, err = received.Get("unclaimed").Claim()
+	assert.True(t, errors.Is(err, oob.ErrExpired), "%+v", err)
+	assert.Contains(t, logs.String(), `"unclaimed", which expired before it was claimed`)
+	_, err = claimed.Stat()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// The layout of a Chan's memfd: a header of a Mutex guarding the rest, the head and tail (counting every element ever
+// received and sent), the capacity, the element size and whether it's closed, followed by capacity elements
+const (
+	chanHead       = 4
+	chanTail       = 8
+	chanCapacity   = 12
+	chanElemSize   = 16
+	chanClosed     = 20
+	chanHeaderSize = 64
+)
+
+// ErrChanClosed - returned by Chan.Send once the Chan is closed, and by Chan.Recv once it is also empty
+var ErrChanClosed = errors.New("chan is closed")
+
+// Chan - a buffered channel of fixed size values between processes, approximating a Go channel: a ring of elements
+//        in a memfd guarded by a Mutex, with an eventfd doorbell each for "not empty" and "not full"
+//        values are encoded with encoding/binary, so must be fixed size (see binary.Size), such as a struct of
+//        numbers and arrays
+//        create it with NewChan, send it to the peer with UnixConn.SendChan and receive it there with RecvChan, then
+//        either end (or both) can Send and Recv
+type Chan struct {
+	mapped   *Mapped
+	mu       *Mutex
+	fds      [3]int // memfd, notEmpty, notFull
+	elemSize int
+	capacity int
+}
+
+// NewChan - a Chan of capacity elements of the type of elem (unbuffered Chans aren't supported)
+func NewChan(elem interface{}, capacity int) (*Chan, error) {
+	elemSize := binary.Size(elem)
+	if elemSize <= 0 {
+		return nil, errors.Errorf("%T is not a fixed size type encoding/binary can encode", elem)
+	}
+	if capacity < 1 {
+		return nil, errors.Errorf("a Chan needs a capacity of at least 1, not %d", capacity)
+	}
+	var fds [3]int
+	var err error
+	defer func() {
+		if err != nil {
+			closeFDs(fds[:])
+		}
+	}()
+	if fds[0], err = unix.MemfdCreate("oob-chan", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING); err != nil {
+		return nil, errors.Wrap(err, "memfd_create")
+	}
+	for i := 1; i < len(fds); i++ {
+		if fds[i], err = unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK); err != nil {
+			return nil, errors.Wrap(err, "eventfd")
+		}
+	}
+	if err = MemfdResize(uintptr(fds[0]), int64(chanHeaderSize+elemSize*capacity)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, chanHeaderSize)
+	binary.LittleEndian.PutUint32(header[chanCapacity:], uint32(capacity))
+	binary.LittleEndian.PutUint32(header[chanElemSize:], uint32(elemSize))
+	if _, err = unix.Pwrite(fds[0], header, 0); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// The size can never change under the peer's mapping
+	if err = MemfdAddSeals(uintptr(fds[0]), SealShrink|SealGrow|SealSeal); err != nil {
+		return nil, err
+	}
+	c, err := openChan(fds)
+	return c, err
+}
+
+// SendChan - send c to the process on the other end of the *net.UnixConn, which receives it with RecvChan
+func (s *UnixConn) SendChan(c *Chan) error {
+	return s.SendFDs(uintptr(c.fds[0]), uintptr(c.fds[1]), uintptr(c.fds[2]))
+}
+
+// RecvChan - recv a Chan sent with SendChan over a *net.UnixConn
+func (s *UnixConn) RecvChan() (*Chan, error) {
+	received, err := s.RecvFDs(3)
+	if err != nil {
+		return nil, err
+	}
+	fds := [3]int{int(received[0]), int(received[1]), int(received[2])}
+	c, err := openChan(fds)
+	if err != nil {
+		closeFDs(fds[:])
+		return nil, err
+	}
+	return c, nil
+}
+
+// openChan - maps the Chan in fds, checking its header against the size of the memfd
+func openChan(fds [3]int) (*Chan, error) {
+	mapped, err := Mmap(uintptr(fds[0]), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	c := &Chan{mapped: mapped, fds: fds}
+	c.capacity, c.elemSize = int(c.get(chanCapacity)), int(c.get(chanElemSize))
+	if c.capacity < 1 || c.elemSize < 1 || chanHeaderSize+c.capacity*c.elemSize != mapped.Len() {
+		_ = mapped.Close()
+		return nil, errors.Errorf("a %d byte memfd can't hold a Chan of %d %d byte elements", mapped.Len(), c.capacity, c.elemSize)
+	}
+	if c.mu, err = NewMutex(mapped, 0); err != nil {
+		_ = mapped.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Send - sends v, which must encode to the Chan's element size, waiting for room until ctx is done
+func (c *Chan) Send(ctx context.Context, v interface{}) error {
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+		return errors.WithStack(err)
+	}
+	if buf.Len() != c.elemSize {
+		return errors.Errorf("%T encodes to %d bytes, the Chan's elements are %d bytes", v, buf.Len(), c.elemSize)
+	}
+	for {
+		sent, err := c.trySend(buf.Bytes())
+		if sent || err != nil {
+			return err
+		}
+		if waitErr := c.wait(ctx, c.fds[2]); waitErr != nil {
+			return waitErr
+		}
+	}
+}
+
+// Recv - receives into v (a pointer, as for binary.Read), waiting for something to receive until ctx is done
+//        once the Chan is closed the elements still in it are received, and then ErrChanClosed is returned
+func (c *Chan) Recv(ctx context.Context, v interface{}) error {
+	buf := make([]byte, c.elemSize)
+	for {
+		received, err := c.tryRecv(buf)
+		if err != nil {
+			return err
+		}
+		if received {
+			return errors.WithStack(binary.Read(bytes.NewReader(buf), binary.LittleEndian, v))
+		}
+		if waitErr := c.wait(ctx, c.fds[1]); waitErr != nil {
+			return waitErr
+		}
+	}
+}
+
+// CloseSend - closes the Chan for both ends, as close() does a Go channel
+func (c *Chan) CloseSend() error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	c.put(chanClosed, 1)
+	if err := c.mu.Unlock(); err != nil {
+		return err
+	}
+	// Wake everyone, waking the next in turn as they see it's closed
+	ring(c.fds[1])
+	ring(c.fds[2])
+	return nil
+}
+
+// Close - releases this process's mapping and fds of the Chan, without closing it for the peer (see CloseSend)
+func (c *Chan) Close() error {
+	err := c.mapped.Close()
+	closeFDs(c.fds[:])
+	return err
+}
+
+func (c *Chan) trySend(elem []byte) (bool, error) {
+	if err := c.lock(); err != nil {
+		return false, err
+	}
+	head, tail := c.get(chanHead), c.get(chanTail)
+	switch {
+	case c.get(chanClosed) != 0:
+		_ = c.mu.Unlock()
+		ring(c.fds[2])
+		return false, ErrChanClosed
+	case int(tail-head) >= c.capacity:
+		return false, c.mu.Unlock()
+	}
+	if _, err := c.mapped.WriteAt(elem, c.slot(tail)); err != nil {
+		_ = c.mu.Unlock()
+		return false, err
+	}
+	c.put(chanTail, tail+1)
+	if err := c.mu.Unlock(); err != nil {
+		return false, err
+	}
+	ring(c.fds[1])
+	// The doorbell only wakes one waiting sender, which wakes the next if there is still room
+	if int(tail+1-head) < c.capacity {
+		ring(c.fds[2])
+	}
+	return true, nil
+}
+
+func (c *Chan) tryRecv(elem []byte) (bool, error) {
+	if err := c.lock(); err != nil {
+		return false, err
+	}
+	head, tail := c.get(chanHead), c.get(chanTail)
+	if head == tail {
+		closed := c.get(chanClosed) != 0
+		if err := c.mu.Unlock(); err != nil {
+			return false, err
+		}
+		if closed {
+			ring(c.fds[1])
+			return false, ErrChanClosed
+		}
+		return false, nil
+	}
+	if _, err := c.mapped.ReadAt(elem, c.slot(head)); err != nil {
+		_ = c.mu.Unlock()
+		return false, err
+	}
+	c.put(chanHead, head+1)
+	if err := c.mu.Unlock(); err != nil {
+		return false, err
+	}
+	ring(c.fds[2])
+	// The doorbell only wakes one waiting receiver, which wakes the next if there is still more to receive
+	if head+1 != tail {
+		ring(c.fds[1])
+	}
+	return true, nil
+}
+
+// lock - locks the Chan's Mutex, a peer which died holding it died between complete updates of the ring, as every
+//        update is a single store, so carries on regardless
+func (c *Chan) lock() error {
+	if err := c.mu.Lock(); err != nil && err != ErrOwnerDied {
+		return err
+	}
+	return nil
+}
+
+func (c *Chan) slot(n uint32) int64 {
+	return int64(chanHeaderSize + int(n%uint32(c.capacity))*c.elemSize)
+}
+
+func (c *Chan) get(off int64) uint32 {
+	buf := make([]byte, 4)
+	_, _ = c.mapped.ReadAt(buf, off)
+	return binary.LittleEndian.Uint32(buf)
+}
+
+func (c *Chan) put(off int64, v uint32) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	_, _ = c.mapped.WriteAt(buf, off)
+}
+
+// wait - waits for the doorbell fd to ring (or sharedPollInterval, in case of a doorbell rung for a waiter which then
+//        didn't need it) and clears it, unless ctx is done
+func (c *Chan) wait(ctx context.Context, fd int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	if _, err := unix.Poll(fds, int(sharedPollInterval.Milliseconds())); err != nil && err != unix.EINTR {
+		return errors.WithStack(err)
+	}
+	buf := make([]byte, 8)
+	_, _ = unix.Read(fd, buf)
+	return ctx.Err()
+}
+
+// ring - rings the doorbell fd, adding 1 (a native endian uint64) to the eventfd's counter
+func ring(fd int) {
+	one := uint64(1)
+	_, _ = unix.Write(fd, (*[8]byte)(unsafe.Pointer(&one))[:]) // #nosec G103
+}
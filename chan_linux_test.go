@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+type chanElem struct {
+	Seq     uint64
+	Payload [16]byte
+}
+
+func TestChan(t *testing.T) {
+	c, err := oob.NewChan(chanElem{}, 4)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendChan(c))
+	peer, err := receiver.RecvChan()
+	require.NoError(t, err)
+	defer func() { _ = peer.Close() }()
+
+	// More than fits, so the sender has to wait on the receiver
+	ctx := context.Background()
+	const n = 1000
+	done := make(chan error, 1)
+	go func() {
+		for i := uint64(0); i < n; i++ {
+			elem := chanElem{Seq: i}
+			copy(elem.Payload[:], "payload")
+			if sendErr := c.Send(ctx, elem); sendErr != nil {
+				done <- sendErr
+				return
+			}
+		}
+		done <- c.CloseSend()
+	}()
+	for i := uint64(0); i < n; i++ {
+		var elem chanElem
+		require.NoError(t, peer.Recv(ctx, &elem))
+		require.Equal(t, i, elem.Seq)
+		require.Equal(t, "payload", string(elem.Payload[:7]))
+	}
+	require.NoError(t, <-done)
+	var elem chanElem
+	assert.Equal(t, oob.ErrChanClosed, peer.Recv(ctx, &elem))
+	assert.Equal(t, oob.ErrChanClosed, peer.Send(ctx, elem))
+}
+
+func TestChanWaits(t *testing.T) {
+	c, err := oob.NewChan(uint32(0), 1)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	// Nothing to receive
+	var v uint32
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.Recv(ctx, &v))
+
+	// No room to send
+	require.NoError(t, c.Send(context.Background(), uint32(1)))
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.Send(ctx, uint32(2)))
+
+	// A waiting receiver is woken promptly
+	require.NoError(t, c.Recv(context.Background(), &v))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = c.Send(context.Background(), uint32(3))
+	}()
+	start := time.Now()
+	require.NoError(t, c.Recv(context.Background(), &v))
+	assert.Equal(t, uint32(3), v)
+	assert.Less(t, int64(time.Since(start)), int64(80*time.Millisecond))
+
+	// Wrong sizes and types
+	assert.Error(t, c.Send(context.Background(), uint64(4)))
+	_, err = oob.NewChan("strings aren't fixed size", 1)
+	assert.Error(t, err)
+	_, err = oob.NewChan(uint32(0), 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+const checksumLen = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// WithChecksums - end every frame payload (bundle manifests, tree entries, ...) with a CRC32C of the frame, so that
+//                 corruption by a buggy relay (or by hand crafted frames) fails the receive instead of silently
+//                 corrupting handoff state, receivers always verify checksums, only senders need the option
+func WithChecksums() Option {
+	return func(o *options) {
+		o.checksums = true
+	}
+}
+
+// addChecksum - f with the CRC32C of its type, flags, fd count and payload appended to its payload, if WithChecksums
+func (s *UnixConn) addChecksum(f *frame) *frame {
+	if !s.opts.checksums {
+		return f
+	}
+	sealed := &frame{typ: f.typ, flags: f.flags | frameFlagChecksum, fds: f.fds}
+	sealed.payload = make([]byte, len(f.payload), len(f.payload)+checksumLen)
+	copy(sealed.payload, f.payload)
+	sealed.payload = sealed.payload[:len(f.payload)+checksumLen]
+	binary.LittleEndian.PutUint32(sealed.payload[len(f.payload):], frameChecksum(sealed.typ, sealed.flags, len(f.fds), f.payload))
+	return sealed
+}
+
+// verifyChecksum - checks the checksum of a received frame, if it has one, and strips it from the payload
+func verifyChecksum(f *frame) error {
+	if f.flags&frameFlagChecksum == 0 {
+		return nil
+	}
+	if len(f.payload) < checksumLen {
+		return errors.Errorf("received a checksummed frame with a %d byte payload", len(f.payload))
+	}
+	payload := f.payload[:len(f.payload)-checksumLen]
+	want := binary.LittleEndian.Uint32(f.payload[len(payload):])
+	if got := frameChecksum(f.typ, f.flags, len(f.fds), payload); got != want {
+		return errors.Errorf("received a frame of type %d with %d fds whose checksum is %08x but should be %08x, it was corrupted on the way",
+			f.typ, len(f.fds), got, want)
+	}
+	f.payload = payload
+	f.flags &^= frameFlagChecksum
+	return nil
+}
+
+func frameChecksum(typ frameType, flags uint8, nfds int, payload []byte) uint32 {
+	header := []byte{byte(typ), flags, 0, 0}
+	binary.LittleEndian.PutUint16(header[2:], uint16(nfds))
+	return crc32.Update(crc32.Checksum(header, castagnoli), castagnoli, payload)
+}
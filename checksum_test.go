@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestChecksums(t *testing.T) {
+	opts := []oob.Option{oob.WithChecksums(), oob.WithCompression(1024)}
+	a, b := newConnPairWithOptions(t, opts, opts)
+	state := strings.Repeat("checksummed ", 1024)
+	assert.Equal(t, state, exchangeBundles(t, a, b, state))
+
+	// Only the sender needs the option
+	a, b = newConnPairWithOptions(t, []oob.Option{oob.WithChecksums()}, nil)
+	assert.Equal(t, state, exchangeBundles(t, a, b, state))
+}
+
+func TestChecksumsDetectCorruption(t *testing.T) {
+	// sender -> relay -> receiver, where the relay flips a bit of the payload
+	newRawPair := func() (*oob.UnixConn, *net.UnixConn) {
+		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		require.NoError(t, err)
+		var conns [2]*net.UnixConn
+		for i, fd := range fds {
+			file := os.NewFile(uintptr(fd), "socketpair")
+			conn, connErr := net.FileConn(file)
+			require.NoError(t, connErr)
+			_ = file.Close()
+			conns[i] = conn.(*net.UnixConn)
+		}
+		t.Cleanup(func() {
+			_ = conns[0].Close()
+			_ = conns[1].Close()
+		})
+		return oob.NewUnixConn(conns[0], oob.WithChecksums()), conns[1]
+	}
+	sender, relayIn := newRawPair()
+	receiver, relayOut := newRawPair()
+	go func() {
+		// A ping: 8 byte header, 8 byte nonce, 4 byte checksum
+		buf := make([]byte, 20)
+		if _, err := io.ReadFull(relayIn, buf); err != nil {
+			return
+		}
+		buf[9] ^= 1
+		_, _ = relayOut.Write(buf)
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := receiver.RecvBundle()
+		errCh <- err
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, sender.Ping(ctx))
+	err := <-errCh
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "corrupted")
+}
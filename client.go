@@ -0,0 +1,189 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReplayMetadataKey - the metadata a Client sets on every bundle item it sends: how many times it had reconnected
+//                     when it sent it ("0" the first time), so a broker can tell a replay of a descriptor it already
+//                     has (the same label) from a new one
+const ReplayMetadataKey = "oob.replay"
+
+// defaultClientRetryInterval - how long a Client waits between attempts to reach its broker, unless RetryInterval
+//                              says otherwise
+const defaultClientRetryInterval = 100 * time.Millisecond
+
+// Client - a connection to a broker which is redialed whenever the broker has gone away (restarted, ...), each time
+//          re-sending every descriptor Registered with it, as one bundle labeled with their ids, so that a transient
+//          broker restart needs no recovery code in the application
+type Client struct {
+	Network string
+	Address string
+	// Dialer - dials the broker, and its Options are those of the conns
+	Dialer Dialer
+	// RetryInterval - how long to wait between attempts to reach the broker, 100ms if zero
+	RetryInterval time.Duration
+
+	mu   sync.Mutex
+	conn *UnixConn
+	// reconnects - how many times conn has been replaced, the ReplayMetadataKey of what is sent
+	reconnects int
+	// registry - the descriptors to replay, labeled with their ids
+	registry Bundle
+	closed   bool
+}
+
+// Conn - the conn to the broker, redialing (and replaying the Registered descriptors) until ctx is done if there is
+//        none yet or the broker has hung up on it
+func (c *Client) Conn(ctx context.Context) (*UnixConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connLocked(ctx)
+}
+
+// Register - sends fd (anything ToFd accepts) to the broker in a bundle item labeled id, with metadata, and keeps a
+//            dup of it to send again after every reconnect until Unregister
+//            if the send fails fd stays registered, so the broker still gets it once it is back
+func (c *Client) Register(ctx context.Context, id string, fd interface{}, metadata map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conn, err := c.connLocked(ctx)
+	if err != nil {
+		return err
+	}
+	withReplay := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		withReplay[k] = v
+	}
+	item, err := c.registry.add(id, fd, withReplay)
+	if err != nil {
+		return err
+	}
+	return c.sendLocked(conn, &Bundle{Items: []*BundleItem{item}})
+}
+
+// Unregister - stops replaying the descriptor registered as id, closing its dup
+func (c *Client) Unregister(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, item := range c.registry.Items {
+		if item.Label == id {
+			c.registry.Items = append(c.registry.Items[:i], c.registry.Items[i+1:]...)
+			_ = item.File.Close()
+			return
+		}
+	}
+}
+
+// Close - closes the conn and every registered dup
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+		c.conn = nil
+	}
+	_ = c.registry.Close()
+	c.registry.Items = nil
+	return err
+}
+
+func (c *Client) connLocked(ctx context.Context) (*UnixConn, error) {
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+	if c.conn != nil {
+		if !c.conn.hungUp() {
+			return c.conn, nil
+		}
+		_ = c.conn.Close()
+		c.conn = nil
+		c.reconnects++
+	}
+	retryInterval := c.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = defaultClientRetryInterval
+	}
+	for {
+		conn, err := c.dial(ctx)
+		if err == nil && len(c.registry.Items) > 0 {
+			if err = c.sendLocked(conn, &c.registry); err != nil {
+				_ = conn.Close()
+				c.reconnects++
+			}
+		}
+		if err == nil {
+			c.conn = conn
+			return conn, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "unable to reach %s: %s", c.Address, err)
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*UnixConn, error) {
+	conn, err := c.Dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	unixConn, ok := conn.(*UnixConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.Errorf("%s %s is not a unix socket", c.Network, c.Address)
+	}
+	return unixConn, nil
+}
+
+// sendLocked - sends b, every item marked with the current ReplayMetadataKey
+func (c *Client) sendLocked(conn *UnixConn, b *Bundle) error {
+	for _, item := range b.Items {
+		item.Metadata[ReplayMetadataKey] = strconv.Itoa(c.reconnects)
+	}
+	return conn.SendBundle(b)
+}
+
+// hungUp - whether the peer has closed its end of the conn, found without receiving anything, false while another
+//          goroutine is receiving
+func (s *UnixConn) hungUp() bool {
+	if !s.recvMu.TryLock() {
+		return false
+	}
+	defer s.recvMu.Unlock()
+	readable, err := s.waitReadable(0)
+	if err != nil || !readable {
+		return err != nil
+	}
+	n, _, _, err := s.recvmsg(make([]byte, 1), nil, syscall.MSG_PEEK)
+	return err != nil || n == 0
+}
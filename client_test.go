@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestClientReplay(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "broker")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	client := &oob.Client{Network: "unix", Address: address, RetryInterval: 10 * time.Millisecond}
+	defer func() { _ = client.Close() }()
+
+	// Nothing is listening yet, so Register keeps redialing until the broker comes up
+	registered := make(chan error, 1)
+	go func() { registered <- client.Register(ctx, "a", f, map[string]string{"purpose": "test"}) }()
+	time.Sleep(50 * time.Millisecond)
+	listener, err := oob.Listen("unix", address)
+	require.NoError(t, err)
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	require.NoError(t, <-registered)
+	b := recvBundle(t, conn)
+	require.Len(t, b.Items, 1)
+	assert.Equal(t, "a", b.Items[0].Label)
+	assert.Equal(t, "0", b.Items[0].Metadata[oob.ReplayMetadataKey])
+
+	require.NoError(t, client.Register(ctx, "b", f, nil))
+	assert.Equal(t, "b", recvBundle(t, conn).Items[0].Label)
+	client.Unregister("b")
+
+	// The broker restarts, and gets back what is still registered
+	require.NoError(t, conn.Close())
+	require.NoError(t, listener.Close())
+	listener, err = oob.Listen("unix", address)
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	_, err = client.Conn(ctx)
+	require.NoError(t, err)
+	conn, err = listener.Accept()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	b = recvBundle(t, conn)
+	require.Len(t, b.Items, 1)
+	assert.Equal(t, "a", b.Items[0].Label)
+	assert.Equal(t, "test", b.Items[0].Metadata["purpose"])
+	assert.Equal(t, "1", b.Items[0].Metadata[oob.ReplayMetadataKey])
+}
+
+func recvBundle(t *testing.T, conn net.Conn) *oob.Bundle {
+	b, err := conn.(*oob.UnixConn).RecvBundle()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"syscall"
+)
+
+// WithInheritableFDs - receive fds without close on exec, so they are inherited by child processes the receiver
+//                      starts, rather than (by default) atomically marked close on exec as they are received
+//                      (MSG_CMSG_CLOEXEC, or straight afterwards on platforms without it, such as darwin), so they
+//                      don't silently leak into every child
+func WithInheritableFDs() Option {
+	return func(o *options) {
+		o.inheritableFDs = true
+	}
+}
+
+// closeOnExecRights - marks every fd in the SCM_RIGHTS of oob close on exec, where recvmsg can't
+func closeOnExecRights(oob []byte) {
+	fds, _ := parseRights(oob)
+	for _, fd := range fds {
+		syscall.CloseOnExec(fd)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/edwarnicke/oob"
+)
+
+// closeOnExec - whether fd is marked close on exec
+func closeOnExec(t *testing.T, fd uintptr) bool {
+	flags, err := unix.FcntlInt(fd, unix.F_GETFD, 0)
+	require.NoError(t, err)
+	return flags&unix.FD_CLOEXEC != 0
+}
+
+func TestRecvCloseOnExec(t *testing.T) {
+	// An fd without close on exec, which it mustn't pass on
+	fd, err := unix.Dup(int(os.Stdin.Fd()))
+	require.NoError(t, err)
+	defer func() { _ = unix.Close(fd) }()
+	require.False(t, closeOnExec(t, uintptr(fd)))
+
+	for name, tc := range map[string]struct {
+		opts []oob.Option
+		want bool
+	}{
+		"default":     {want: true},
+		"inheritable": {opts: []oob.Option{oob.WithInheritableFDs()}, want: false},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			sender, receiver := newUnixConnPair(t, tc.opts...)
+			require.NoError(t, sender.SendFD(uintptr(fd)))
+			require.NoError(t, sender.SendFDs(uintptr(fd), uintptr(fd)))
+			received, err := receiver.RecvFD()
+			require.NoError(t, err)
+			batch, err := receiver.RecvFDs(2)
+			require.NoError(t, err)
+			for _, r := range append(batch, received) {
+				assert.Equal(t, tc.want, closeOnExec(t, r))
+				assert.NoError(t, unix.Close(int(r)))
+			}
+		})
+	}
+}
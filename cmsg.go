@@ -0,0 +1,67 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SendCmsg - sends p along with the raw control messages oob (any mix of SCM_RIGHTS, as built by syscall.UnixRights,
+//            and other types, concatenated), for wire protocols oob has no API of its own for, though unix sockets
+//            only carry the types the kernel knows (SCM_RIGHTS, SCM_CREDENTIALS on linux, SCM_CREDS on the BSDs)
+//            it goes through the same path as SendFD, so deadlines, retries and Stats apply
+func (s *UnixConn) SendCmsg(p, oob []byte) (err error) {
+	defer s.opts.profile("SendCmsg")()
+	defer s.watch("SendCmsg", true)()
+	defer func() { s.record("SendCmsg", err) }()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	n, err := s.sendmsg(p, oob)
+	if err != nil {
+		return err
+	}
+	// The control messages went with the first byte, a stream socket may take the rest separately
+	for n < len(p) {
+		m, err := s.UnixConn.Write(p[n:])
+		if err != nil {
+			return err
+		}
+		n += m
+	}
+	return nil
+}
+
+// RecvCmsg - receives a single message into p and its raw control messages into oob, returning how much of each was
+//            filled, and the recvmsg flags, for syscall.ParseSocketControlMessage to take apart
+//            the fds of any SCM_RIGHTS in it are the caller's to close (they are close on exec unless
+//            WithInheritableFDs), a message with more control messages than fit in oob is discarded (closing its fds)
+//            and an error wrapping ErrControlTruncated returned
+//            WithStrict refuses control messages other than SCM_RIGHTS here too
+func (s *UnixConn) RecvCmsg(p, oob []byte) (n, oobn, recvflags int, err error) {
+	defer s.opts.profile("RecvCmsg")()
+	defer s.watch("RecvCmsg", false)()
+	defer func() { s.record("RecvCmsg", err) }()
+	if s.prefetch != nil {
+		return 0, 0, 0, errors.New("RecvCmsg cannot be used WithPrefetch, the prefetcher does not keep control messages")
+	}
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	return s.recvmsg(p, oob, 0)
+}
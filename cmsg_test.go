@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCmsg(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+
+	oob := syscall.UnixRights(int(os.Stdin.Fd()), int(os.Stdout.Fd()), int(os.Stderr.Fd()))
+	require.NoError(t, sender.SendCmsg([]byte("hello"), oob))
+
+	p := make([]byte, 16)
+	buf := make([]byte, 2*len(oob))
+	n, oobn, _, err := receiver.RecvCmsg(p, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(p[:n]))
+	msgs, err := syscall.ParseSocketControlMessage(buf[:oobn])
+	require.NoError(t, err)
+	var fds []int
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		require.NoError(t, err)
+		fds = append(fds, rights...)
+	}
+	assert.Len(t, fds, 3)
+	for _, fd := range fds {
+		require.NoError(t, syscall.Close(fd))
+	}
+}
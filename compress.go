@@ -0,0 +1,236 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxDecompressedLen - the largest payload a compressed frame may decompress to, so a decompression bomb can't make
+//                      the receiver allocate without bound
+const maxDecompressedLen = 1 << 30
+
+// Codec - a compression algorithm for WithCompression, Deflate is built in, others (zstd, snappy, ...) can be
+//         plugged in from third party packages without oob depending on them
+type Codec struct {
+	// Name - identifies the codec to the peer, which compresses with it only if it has a Codec of the same name too
+	Name string
+	// Compress - the compressed form of src
+	Compress func(src []byte) ([]byte, error)
+	// Decompress - the decompressed form of src, failing rather than returning more than maxLen bytes
+	Decompress func(src []byte, maxLen int) ([]byte, error)
+}
+
+// Deflate - compress/flate at its default level
+var Deflate = Codec{
+	Name: "deflate",
+	Compress: func(src []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if _, err = w.Write(src); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err = w.Close(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return buf.Bytes(), nil
+	},
+	Decompress: func(src []byte, maxLen int) ([]byte, error) {
+		r := flate.NewReader(bytes.NewReader(src))
+		defer func() { _ = r.Close() }()
+		dst, err := ioutil.ReadAll(io.LimitReader(r, int64(maxLen)+1))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if len(dst) > maxLen {
+			return nil, errors.Errorf("decompresses to more than %d bytes", maxLen)
+		}
+		return dst, nil
+	},
+}
+
+type compression struct {
+	minLen int
+	codecs []Codec
+}
+
+// WithCompression - compress frame payloads (bundle manifests, tree entries, ...) of at least minLen bytes, never the
+//                   fds, with the first of codecs (Deflate if none are given) which the peer can decompress too
+//                   each end advertises the codecs it can decompress as soon as it is wrapped (so only use it with
+//                   peers which speak oob frames), and payloads are only compressed once the peer's advertisement has
+//                   arrived, so a peer without the option (or with different codecs) is sent uncompressed payloads
+func WithCompression(minLen int, codecs ...Codec) Option {
+	if len(codecs) == 0 {
+		codecs = []Codec{Deflate}
+	}
+	return func(o *options) {
+		o.compression = &compression{minLen: minLen, codecs: codecs}
+	}
+}
+
+// codecs - the negotiation of compression on a connection
+type codecs struct {
+	mu sync.Mutex
+	// advertised - whether our codecs have been sent to the peer, guarded by the UnixConn's sendMu
+	advertised bool
+	// peer - the names of the codecs the peer advertised
+	peer map[string]bool
+}
+
+func (c *codecs) setPeer(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peer = make(map[string]bool, len(names))
+	for _, name := range names {
+		c.peer[name] = true
+	}
+}
+
+func (c *codecs) known() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peer != nil
+}
+
+func (c *codecs) peerHas(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peer[name]
+}
+
+// compress - returns f with its payload compressed if it is big enough and the peer has one of our codecs (or f
+//            unchanged), callers must hold s.sendMu
+func (s *UnixConn) compress(f *frame) (*frame, error) {
+	c := s.opts.compression
+	if c == nil || f.typ == frameCodecs || f.typ == framePing || f.typ == framePong {
+		return f, nil
+	}
+	if !s.codecs.advertised {
+		if err := s.advertiseCodecs(); err != nil {
+			return nil, err
+		}
+	}
+	if !s.codecs.known() {
+		s.pullCodecs()
+	}
+	if len(f.payload) < c.minLen || len(f.payload) == 0 {
+		return f, nil
+	}
+	for i := range c.codecs {
+		codec := &c.codecs[i]
+		if !s.codecs.peerHas(codec.Name) {
+			continue
+		}
+		compressed, err := codec.Compress(f.payload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compressing with %s", codec.Name)
+		}
+		// | name length uint8 | name | uncompressed length uint32 | compressed payload |
+		payload := make([]byte, 1+len(codec.Name)+4+len(compressed))
+		if len(payload) >= len(f.payload) {
+			return f, nil
+		}
+		payload[0] = byte(len(codec.Name))
+		copy(payload[1:], codec.Name)
+		binary.LittleEndian.PutUint32(payload[1+len(codec.Name):], uint32(len(f.payload)))
+		copy(payload[1+len(codec.Name)+4:], compressed)
+		return &frame{typ: f.typ, flags: f.flags | frameFlagCompressed, payload: payload, fds: f.fds}, nil
+	}
+	return f, nil
+}
+
+// advertiseCodecs - sends the peer the names of the codecs we can decompress, callers must hold s.sendMu
+func (s *UnixConn) advertiseCodecs() error {
+	c := s.opts.compression
+	names := make([]string, len(c.codecs))
+	for i := range c.codecs {
+		names[i] = c.codecs[i].Name
+	}
+	if err := s.writeFrame(&frame{typ: frameCodecs, payload: []byte(strings.Join(names, "\n"))}); err != nil {
+		return err
+	}
+	s.codecs.advertised = true
+	return nil
+}
+
+// pullCodecs - handles the peer's advertisement if it is what's next to be received, without receiving anything
+//              else, so the very first frame sent can already be compressed, callers must hold s.sendMu
+func (s *UnixConn) pullCodecs() {
+	if !s.recvMu.TryLock() {
+		return
+	}
+	defer s.recvMu.Unlock()
+	if len(s.pending) > 0 {
+		return
+	}
+	if typ, ok := s.peekFrameType(); !ok || typ != frameCodecs {
+		return
+	}
+	f, err := s.readAnyFrame()
+	if err != nil {
+		s.opts.logf("oob: unable to receive the peer's codecs: %s", err)
+		return
+	}
+	_, _ = s.handleControlFrame(f)
+}
+
+// decompress - decompresses the payload of a received frame in place, if it is compressed
+func (s *UnixConn) decompress(f *frame) error {
+	if f.flags&frameFlagCompressed == 0 {
+		return nil
+	}
+	f.flags &^= frameFlagCompressed
+	if len(f.payload) < 1 || len(f.payload) < 1+int(f.payload[0])+4 {
+		return errors.Errorf("received a compressed frame with a malformed %d byte payload", len(f.payload))
+	}
+	name := string(f.payload[1 : 1+f.payload[0]])
+	length := binary.LittleEndian.Uint32(f.payload[1+len(name):])
+	if length > maxDecompressedLen {
+		return errors.Errorf("received a compressed frame announcing %d bytes, the limit is %d", length, maxDecompressedLen)
+	}
+	var codec *Codec
+	if c := s.opts.compression; c != nil {
+		for i := range c.codecs {
+			if c.codecs[i].Name == name {
+				codec = &c.codecs[i]
+			}
+		}
+	}
+	if codec == nil {
+		return errors.Errorf("received a frame compressed with %q, which was never advertised", name)
+	}
+	payload, err := codec.Decompress(f.payload[1+len(name)+4:], int(length))
+	if err != nil {
+		return errors.Wrapf(err, "decompressing with %s", name)
+	}
+	if len(payload) != int(length) {
+		return errors.Errorf("received a compressed frame announcing %d bytes which decompressed to %d", length, len(payload))
+	}
+	f.payload = payload
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// newConnPairWithOptions - a connected pair of UnixConns, each with its own options
+func newConnPairWithOptions(t *testing.T, aOpts, bOpts []oob.Option) (a, b *oob.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	var conns [2]*oob.UnixConn
+	for i, opts := range [][]oob.Option{aOpts, bOpts} {
+		file := os.NewFile(uintptr(fds[i]), "socketpair")
+		conn, connErr := net.FileConn(file)
+		require.NoError(t, connErr)
+		_ = file.Close()
+		conns[i] = oob.NewUnixConn(conn.(*net.UnixConn), opts...)
+	}
+	t.Cleanup(func() {
+		_ = conns[0].Close()
+		_ = conns[1].Close()
+	})
+	return conns[0], conns[1]
+}
+
+// exchangeBundles - sends a bundle carrying state from a to b and back again, returning the state b received
+func exchangeBundles(t *testing.T, a, b *oob.UnixConn, state string) string {
+	var received string
+	for _, pair := range [][2]*oob.UnixConn{{a, b}, {b, a}} {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		bundle := oob.NewBundle()
+		require.NoError(t, bundle.Add("pipe", r, map[string]string{"state": state}))
+		errCh := make(chan error, 1)
+		go func(sender *oob.UnixConn) { errCh <- sender.SendBundle(bundle) }(pair[0])
+		got, err := pair[1].RecvBundle()
+		require.NoError(t, err)
+		require.NoError(t, <-errCh)
+		require.NoError(t, r.Close())
+		received = got.Get("pipe").Metadata["state"]
+		require.NoError(t, got.Close())
+	}
+	return received
+}
+
+func TestCompression(t *testing.T) {
+	state := strings.Repeat("compressible ", 2<<20)
+
+	// Both ends compress, and a manifest too big for a frame fits once compressed
+	a, b := newConnPairWithOptions(t, []oob.Option{oob.WithCompression(1024)}, []oob.Option{oob.WithCompression(1024)})
+	assert.Equal(t, state, exchangeBundles(t, a, b, state))
+	assert.Equal(t, state, exchangeBundles(t, a, b, state))
+
+	// Only one end has the option, so nothing is compressed and the too big manifest fails
+	a, b = newConnPairWithOptions(t, []oob.Option{oob.WithCompression(1024)}, nil)
+	assert.Equal(t, "small", exchangeBundles(t, a, b, "small"))
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	require.NoError(t, w.Close())
+	bundle := oob.NewBundle()
+	require.NoError(t, bundle.Add("pipe", r, map[string]string{"state": state}))
+	assert.Error(t, a.SendBundle(bundle))
+}
+
+func TestCompressionCustomCodec(t *testing.T) {
+	compressed := 0
+	reverse := oob.Codec{
+		Name: "test",
+		Compress: func(src []byte) ([]byte, error) {
+			compressed++
+			return oob.Deflate.Compress(src)
+		},
+		Decompress: oob.Deflate.Decompress,
+	}
+	// The first codec both ends have is used
+	a, b := newConnPairWithOptions(t,
+		[]oob.Option{oob.WithCompression(0, reverse, oob.Deflate)},
+		[]oob.Option{oob.WithCompression(0, oob.Deflate, reverse)})
+	state := strings.Repeat("x", 4096)
+	assert.Equal(t, state, exchangeBundles(t, a, b, state))
+	assert.Greater(t, compressed, 0)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SendFDContext - SendFD, giving up when ctx is done: ctx's deadline becomes the write deadline of the conn for the
+//                 duration of the call (clearing it afterwards) and ctx being canceled interrupts the send
+//                 WithSendQueue it only bounds the wait for room in the queue
+func (s *UnixConn) SendFDContext(ctx context.Context, fd uintptr) error {
+	return withContext(ctx, s.SetWriteDeadline, func() error {
+		return s.SendFD(fd)
+	})
+}
+
+// RecvFDContext - RecvFD, giving up when ctx is done, rather than blocking forever on a peer which never sends: ctx's
+//                 deadline becomes the read deadline of the conn for the duration of the call (clearing it
+//                 afterwards) and ctx being canceled interrupts the receive
+//                 WithPrefetch it waits for the next prefetched fd until ctx is done instead
+func (s *UnixConn) RecvFDContext(ctx context.Context) (fd uintptr, err error) {
+	if s.prefetch != nil {
+		defer s.opts.profile("RecvFD")()
+		defer func() { s.recordRecv("RecvFD", fd, err) }()
+		return s.prefetch.nextContext(ctx)
+	}
+	err = withContext(ctx, s.SetReadDeadline, func() error {
+		fd, err = s.RecvFD()
+		return err
+	})
+	return fd, err
+}
+
+// ReceivedFD - an fd received by the loop FDs runs, or the error which ended it
+type ReceivedFD struct {
+	FD  uintptr
+	Err error
+}
+
+// FDs - runs RecvFDContext in a loop in the background until ctx is done, delivering each fd received on the
+//       returned channel, so that fds arriving can be selected on alongside other events
+//       the first error (ErrNoFD, the peer hanging up, ...) is delivered too, and ends the loop, the channel is
+//       closed once the loop has ended, and an fd received as ctx is done is closed rather than delivered
+//       nothing else may receive on the conn until then
+func (s *UnixConn) FDs(ctx context.Context) <-chan ReceivedFD {
+	received := make(chan ReceivedFD)
+	goLabeled("fds", func() {
+		defer close(received)
+		for {
+			fd, err := s.RecvFDContext(ctx)
+			if ctx.Err() != nil {
+				if err == nil {
+					_ = syscall.Close(int(fd))
+				}
+				return
+			}
+			select {
+			case received <- ReceivedFD{FD: fd, Err: err}:
+			case <-ctx.Done():
+				if err == nil {
+					_ = syscall.Close(int(fd))
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+	return received
+}
+
+// longAgo - a deadline in the past, which interrupts a read or write in progress
+var longAgo = time.Unix(1, 0)
+
+// withContext - runs f with ctx's deadline (if any) set by setDeadline, moving it into the past to interrupt f if ctx
+//               is canceled first and clearing it afterwards, returning ctx's error if f failed because ctx was done
+func withContext(ctx context.Context, setDeadline func(time.Time) error, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if err := setDeadline(deadline); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = setDeadline(time.Time{}) }()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = setDeadline(longAgo)
+		case <-done:
+		}
+	}()
+	err := f()
+	close(done)
+	<-stopped
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return errors.Wrap(ctxErr, err.Error())
+	}
+	// The deadline of the conn can pass a moment before ctx notices its own
+	if hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+		return errors.Wrap(context.DeadlineExceeded, err.Error())
+	}
+	return err
+}
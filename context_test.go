@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestRecvFDContext(t *testing.T) {
+	for name, opts := range map[string][]oob.Option{
+		"direct":   nil,
+		"prefetch": {oob.WithPrefetch(2)},
+	} {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			sender, receiver := newUnixConnPair(t, opts...)
+
+			// The peer never sends
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := receiver.RecvFDContext(ctx)
+			assert.True(t, errors.Is(err, context.DeadlineExceeded), "%+v", err)
+
+			ctx, cancel = context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			_, err = receiver.RecvFDContext(ctx)
+			assert.True(t, errors.Is(err, context.Canceled), "%+v", err)
+
+			// Neither left a deadline behind
+			time.Sleep(10 * time.Millisecond)
+			require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+			fd, err := receiver.RecvFDContext(context.Background())
+			require.NoError(t, err)
+			assert.NoError(t, syscall.Close(int(fd)))
+		})
+	}
+}
+
+func TestSendFDContext(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, errors.Is(sender.SendFDContext(ctx, os.Stdin.Fd()), context.Canceled))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, sender.SendFDContext(ctx, os.Stdin.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	assert.NoError(t, syscall.Close(int(fd)))
+}
+
+func TestFDs(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	fds := receiver.FDs(ctx)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+		select {
+		case received := <-fds:
+			require.NoError(t, received.Err)
+			assert.NoError(t, syscall.Close(int(received.FD)))
+		case <-time.After(time.Second):
+			t.Fatal("no fd was delivered")
+		}
+	}
+
+	// Canceling ctx ends the loop
+	cancel()
+	_, ok := <-fds
+	assert.False(t, ok)
+
+	// As does an error, which is delivered
+	fds = receiver.FDs(context.Background())
+	require.NoError(t, sender.Close())
+	received := <-fds
+	assert.Error(t, received.Err)
+	_, ok = <-fds
+	assert.False(t, ok)
+}
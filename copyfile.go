@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"os"
+)
+
+// CopyFileRange - copy n bytes from src (usually a received file) at its current offset to dst at its current offset
+//                 without copying them through userspace, for receivers which must persist a passed file's contents
+//                 to their own filesystem
+//                 if all of src is being copied into an empty dst it is reflinked (FICLONE) where the filesystem allows
+//                 it, otherwise copy_file_range(2) is used, falling back to read/write where neither is possible
+//                 (across filesystems on older kernels, off linux, ...)
+//                 like io.CopyN it returns io.EOF if src reaches its end before n bytes were copied
+func CopyFileRange(dst, src *os.File, n int64) (int64, error) {
+	dstFd, err := ToFd(dst)
+	if err != nil {
+		return 0, err
+	}
+	srcFd, err := ToFd(src)
+	if err != nil {
+		return 0, err
+	}
+	return copyFileRange(int(dstFd), int(srcFd), n)
+}
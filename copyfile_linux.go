@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxCopyFileRangeChunk - the most bytes asked of a single copy_file_range(2), which the kernel caps anyway
+const maxCopyFileRangeChunk = 1 << 30
+
+// copyFileRange - reflinks srcFd into dstFd if it can, otherwise copies n bytes with copy_file_range(2), falling back
+//                 to read/write if the kernel can't copy between them
+func copyFileRange(dstFd, srcFd int, n int64) (int64, error) {
+	if cloned, ok, err := clone(dstFd, srcFd, n); ok {
+		return cloned, err
+	}
+	var written int64
+	for written < n {
+		chunk := n - written
+		if chunk > maxCopyFileRangeChunk {
+			chunk = maxCopyFileRangeChunk
+		}
+		m, err := unix.CopyFileRange(srcFd, nil, dstFd, nil, int(chunk), 0)
+		switch {
+		case written == 0 && (err == unix.EXDEV || err == unix.ENOSYS || err == unix.EINVAL || err == unix.EOPNOTSUPP):
+			return copyN(dstFd, srcFd, n)
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return written, err
+		case m == 0:
+			return written, io.EOF
+		}
+		written += int64(m)
+	}
+	return written, nil
+}
+
+// clone - reflinks all of srcFd into dstFd with FICLONE, if srcFd is at its start, dstFd is empty and n covers all of
+//         srcFd, leaving both at the end as a copy would, ok is false if it didn't (or couldn't)
+func clone(dstFd, srcFd int, n int64) (cloned int64, ok bool, err error) {
+	var src, dst unix.Stat_t
+	if unix.Fstat(srcFd, &src) != nil || unix.Fstat(dstFd, &dst) != nil {
+		return 0, false, nil
+	}
+	if src.Mode&unix.S_IFMT != unix.S_IFREG || src.Size == 0 || src.Size > n || dst.Size != 0 {
+		return 0, false, nil
+	}
+	if off, seekErr := unix.Seek(srcFd, 0, io.SeekCurrent); seekErr != nil || off != 0 {
+		return 0, false, nil
+	}
+	if unix.IoctlFileClone(dstFd, srcFd) != nil {
+		return 0, false, nil
+	}
+	for _, fd := range []int{srcFd, dstFd} {
+		if _, err = unix.Seek(fd, src.Size, io.SeekStart); err != nil {
+			return 0, true, err
+		}
+	}
+	if src.Size < n {
+		return src.Size, true, io.EOF
+	}
+	return src.Size, true, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestCopyFileRange(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "src"), data, 0o600))
+
+	// Receive the file as a peer would have passed it
+	sender, receiver := newUnixConnPair(t)
+	file, err := os.Open(filepath.Join(dir, "src"))
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFile(file))
+	require.NoError(t, file.Close())
+	src, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = src.Close() }()
+
+	// All of it into an empty file (reflinked where the filesystem can)
+	dst, err := os.Create(filepath.Join(dir, "whole"))
+	require.NoError(t, err)
+	defer func() { _ = dst.Close() }()
+	n, err := oob.CopyFileRange(dst, src, int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	contents, err := ioutil.ReadFile(dst.Name())
+	require.NoError(t, err)
+	assert.Equal(t, data, contents)
+
+	// Part of it, from the current offsets, running into the end of src
+	_, err = src.Seek(int64(len(data)-100), io.SeekStart)
+	require.NoError(t, err)
+	part, err := os.Create(filepath.Join(dir, "part"))
+	require.NoError(t, err)
+	defer func() { _ = part.Close() }()
+	_, err = part.Write([]byte("prefix"))
+	require.NoError(t, err)
+	n, err = oob.CopyFileRange(part, src, 200)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, int64(100), n)
+	contents, err = ioutil.ReadFile(part.Name())
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("prefix"), data[len(data)-100:]...), contents)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oob
+
+// Credentials - the pid, uid and gid of the sender of a message (SCM_CREDENTIALS), checked by the kernel, which only
+//               lets a process claim credentials other than its own if it is privileged (CAP_SYS_ADMIN, CAP_SETUID,
+//               CAP_SETGID), or of the peer of a conn (SO_PEERCRED), WithAuthorizer
+type Credentials struct {
+	Pid int
+	Uid int
+	Gid int
+}
+
+// WithPassCredentials - have the kernel attach the credentials of the sender to every message received on the conn
+//                       (SO_PASSCRED), for RecvFDsWithCredentials to return, so receivers can make trust decisions
+//                       per message rather than per connection, linux only
+//                       the credentials are taken out of what every other receive sees, so they need no room for them
+func WithPassCredentials() Option {
+	return func(o *options) {
+		o.passCredentials = true
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oob
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// SendFDsWithCredentials - SendFDsWithData, with creds attached (SCM_CREDENTIALS), the process's own if nil, for a
+//                          receiver WithPassCredentials (which gets the sender's own credentials even if none are
+//                          attached), at most 253 fds
+func (s *UnixConn) SendFDsWithCredentials(p []byte, creds *Credentials, fds ...uintptr) error {
+	s.checkDuplicateSend(fds...)
+	if len(fds) > maxFDsPerMessage {
+		return errors.Errorf("cannot send %d fds in one message, the limit is %d", len(fds), maxFDsPerMessage)
+	}
+	if creds == nil {
+		creds = &Credentials{Pid: os.Getpid(), Uid: os.Getuid(), Gid: os.Getgid()}
+	}
+	oob := unix.UnixCredentials(&unix.Ucred{Pid: int32(creds.Pid), Uid: uint32(creds.Uid), Gid: uint32(creds.Gid)})
+	if len(fds) > 0 {
+		rights := make([]int, len(fds))
+		for i, fd := range fds {
+			rights[i] = int(fd)
+		}
+		oob = append(oob, syscall.UnixRights(rights...)...)
+	}
+	return s.SendCmsg(p, oob)
+}
+
+// RecvFDsWithCredentials - RecvFDsWithData, also returning the credentials of the sender of the message, on a conn
+//                          WithPassCredentials
+func (s *UnixConn) RecvFDsWithCredentials(p []byte, maxFDs int) (n int, fds []uintptr, creds *Credentials, err error) {
+	if !s.opts.passCredentials {
+		return 0, nil, nil, errors.New("RecvFDsWithCredentials needs a conn WithPassCredentials")
+	}
+	defer s.opts.profile("RecvFDsWithCredentials")()
+	defer s.watch("RecvFDsWithCredentials", false)()
+	defer func() { s.record("RecvFDsWithCredentials", err, fds...) }()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	s.credentials = nil
+	if n, fds, err = s.recvFDsWithData(p, maxFDs); err != nil {
+		return 0, nil, nil, err
+	}
+	if s.credentials == nil {
+		closeUintptrs(fds)
+		return 0, nil, nil, errors.New("received a message without the credentials of its sender")
+	}
+	return n, fds, s.credentials, nil
+}
+
+// takeCredentials - copies the control messages of received into oob, other than the SCM_CREDENTIALS
+//                   WithPassCredentials has the kernel add, which are kept for RecvFDsWithCredentials instead,
+//                   returning how much of oob was filled
+func (s *UnixConn) takeCredentials(oob, received []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(received)
+	if err != nil {
+		return copy(oob, received)
+	}
+	var kept []byte
+	for i := range msgs {
+		if msgs[i].Header.Level == syscall.SOL_SOCKET && msgs[i].Header.Type == syscall.SCM_CREDENTIALS {
+			if cred, err := syscall.ParseUnixCredentials(&msgs[i]); err == nil {
+				s.credentials = &Credentials{Pid: int(cred.Pid), Uid: int(cred.Uid), Gid: int(cred.Gid)}
+			}
+			continue
+		}
+		kept = appendCmsg(kept, &msgs[i])
+	}
+	return copy(oob, kept)
+}
+
+// appendCmsg - appends msg, encoded as a control message, to oob
+func appendCmsg(oob []byte, msg *syscall.SocketControlMessage) []byte {
+	b := make([]byte, syscall.CmsgSpace(len(msg.Data)))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = msg.Header.Level
+	h.Type = msg.Header.Type
+	h.SetLen(syscall.CmsgLen(len(msg.Data)))
+	copy(b[syscall.CmsgLen(0):], msg.Data)
+	return append(oob, b...)
+}
+
+// startPassCredentials - sets SO_PASSCRED on conn, WithPassCredentials
+func (s *UnixConn) startPassCredentials(conn *net.UnixConn) {
+	rawConn, err := conn.SyscallConn()
+	if err == nil {
+		_ = rawConn.Control(func(fd uintptr) { err = passCredentials(int(fd)) })
+	}
+	if err != nil {
+		s.opts.logf("oob: not passing credentials: %s", err)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestCredentials(t *testing.T) {
+	sender, receiver := newUnixConnPair(t, oob.WithPassCredentials())
+
+	require.NoError(t, sender.SendFDsWithCredentials([]byte("hello"), nil, os.Stdin.Fd()))
+	p := make([]byte, 16)
+	n, fds, creds, err := receiver.RecvFDsWithCredentials(p, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(p[:n]))
+	require.Len(t, fds, 1)
+	require.NoError(t, os.NewFile(fds[0], "").Close())
+	assert.Equal(t, &oob.Credentials{Pid: os.Getpid(), Uid: os.Getuid(), Gid: os.Getgid()}, creds)
+
+	// The kernel attaches the sender's credentials even when it attaches none itself
+	require.NoError(t, sender.SendFD(os.Stdout.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, os.NewFile(fd, "").Close())
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package oob
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// SendFDsWithCredentials - attaching credentials (SCM_CREDENTIALS) is only supported on linux
+func (s *UnixConn) SendFDsWithCredentials(p []byte, creds *Credentials, fds ...uintptr) error {
+	return errors.New("sending credentials is only supported on linux")
+}
+
+// RecvFDsWithCredentials - receiving credentials (SCM_CREDENTIALS) is only supported on linux
+func (s *UnixConn) RecvFDsWithCredentials(p []byte, maxFDs int) (n int, fds []uintptr, creds *Credentials, err error) {
+	return 0, nil, nil, errors.New("receiving credentials is only supported on linux")
+}
+
+// takeCredentials - there are no credentials to take out of received here
+func (s *UnixConn) takeCredentials(oob, received []byte) int {
+	return copy(oob, received)
+}
+
+// startPassCredentials - the kernel only passes credentials on linux
+func (s *UnixConn) startPassCredentials(conn *net.UnixConn) {}
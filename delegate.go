@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// SendUnixConn - send the connected socket of c to the process on the other end of the *net.UnixConn, which receives
+//                it as a working *UnixConn with RecvUnixConn, so control channels can be delegated between processes
+//                anything c has queued to send is flushed first, and c must not be holding anything received but
+//                not yet handed over (prefetched fds, frames set aside by Ping) or be in the middle of a receive,
+//                which would be lost to the receiver
+//                the caller keeps its copy of c, and should usually close it once it is sent
+func (s *UnixConn) SendUnixConn(c *UnixConn) error {
+	defer s.opts.profile("SendUnixConn")()
+	if err := c.Flush(); err != nil {
+		return errors.Wrap(err, "unable to flush the conn before sending it")
+	}
+	if !c.recvMu.TryLock() {
+		return errors.New("cannot send a conn which is being received on")
+	}
+	defer c.recvMu.Unlock()
+	if len(c.pending) > 0 {
+		return errors.Errorf("cannot send a conn holding %d received frames which would be lost", len(c.pending))
+	}
+	if c.prefetch != nil && c.prefetch.len() > 0 {
+		return errors.Errorf("cannot send a conn holding %d prefetched fds which would be lost", c.prefetch.len())
+	}
+	fd, err := ToFd(c.UnixConn)
+	if err != nil {
+		return err
+	}
+	return s.SendFD(fd)
+}
+
+// RecvUnixConn - recv a conn sent with SendUnixConn, as a *UnixConn with the options of the conn it came over
+//                nothing the sender learned from the peer (such as the codecs it advertised) is carried over
+func (s *UnixConn) RecvUnixConn() (*UnixConn, error) {
+	defer s.opts.profile("RecvUnixConn")()
+	file, err := s.RecvFile()
+	if err != nil {
+		return nil, err
+	}
+	// net.FileConn makes its own dup
+	defer func() { _ = file.Close() }()
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "received fd is not a connection")
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.Errorf("received a %s connection rather than a unix one", conn.LocalAddr().Network())
+	}
+	return NewUnixConn(unixConn, s.opts.all...), nil
+}
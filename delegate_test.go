@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSendUnixConn(t *testing.T) {
+	// A control channel between a broker and a worker, delegated to a third process over another conn
+	broker, worker := newUnixConnPair(t)
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendUnixConn(worker))
+	delegated, err := receiver.RecvUnixConn()
+	require.NoError(t, err)
+	defer func() { _ = delegated.Close() }()
+	require.NoError(t, worker.Close())
+
+	// The delegated conn is a working oob.UnixConn in both directions
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	require.NoError(t, broker.SendFile(f))
+	received, err := delegated.RecvFile()
+	require.NoError(t, err)
+	require.NoError(t, received.Close())
+
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	require.NoError(t, b.Add("null", f, nil))
+	require.NoError(t, delegated.SendBundle(b))
+	rb, err := broker.RecvBundle()
+	require.NoError(t, err)
+	require.NoError(t, rb.Close())
+}
+
+func TestSendUnixConnRefusesPendingFDs(t *testing.T) {
+	broker, worker := newUnixConnPair(t, oob.WithPrefetch(4))
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	require.NoError(t, broker.SendFile(f))
+	require.Eventually(t, func() bool {
+		depths, err := worker.QueueDepths()
+		return err == nil && depths.Prefetched == 1
+	}, time.Second, 10*time.Millisecond)
+
+	sender, _ := newUnixConnPair(t)
+	assert.Error(t, sender.SendUnixConn(worker))
+}
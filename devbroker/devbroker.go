@@ -0,0 +1,197 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+// Package devbroker - the privileged open, unprivileged use split for devices such as /dev/net/tun, /dev/vhost-net and
+//                     /dev/vfio: a client asks a Broker for a device by well-known name and capability set over an
+//                     oob.UnixConn, and the Broker opens and configures it and sends it back along with the
+//                     configuration it applied
+package devbroker
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/edwarnicke/oob"
+)
+
+// Well-known device names
+const (
+	Tun      = "tun"
+	VhostNet = "vhost-net"
+	VFIO     = "vfio"
+)
+
+// maxMessageLen - the largest request or response either side accepts
+const maxMessageLen = 64 << 10
+
+// Request - what a client asks a Broker for
+type Request struct {
+	// Device - the well-known name of the device, such as Tun
+	Device string `json:"device"`
+	// Capabilities - what the client needs of the device (for Tun: "tap", "multi_queue", "vnet_hdr"), each must be
+	//                allowed by the Broker
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Config - device specific settings, such as the "name" of a Tun interface or the "group" of VFIO
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// response - what a Broker answers a Request with, along with the device unless Error is set
+type response struct {
+	Error  string            `json:"error,omitempty"`
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// Opener - opens and configures the device asked for by req, returning it along with the configuration it applied
+type Opener func(req *Request) (*os.File, map[string]string, error)
+
+// Device - a device a Broker hands out
+type Device struct {
+	// Open - opens the device
+	Open Opener
+	// Capabilities - the capabilities clients may ask for, any other is refused
+	Capabilities []string
+}
+
+// Broker - the privileged side, opening the Devices clients ask for by name
+type Broker struct {
+	Devices map[string]*Device
+	// Allow - if set, called with each request (and the conn it came over, to check the peer) before it is served,
+	//         an error refuses it
+	Allow func(conn *oob.UnixConn, req *Request) error
+}
+
+// NewBroker - a Broker handing out devices, any of Tun, VhostNet and VFIO with their default Openers, allowing
+//             every capability they support
+func NewBroker(devices ...string) (*Broker, error) {
+	b := &Broker{Devices: make(map[string]*Device)}
+	for _, name := range devices {
+		device, ok := defaultDevices[name]
+		if !ok {
+			return nil, errors.Errorf("no default device %q", name)
+		}
+		b.Devices[name] = device
+	}
+	return b, nil
+}
+
+// Serve - answers the requests arriving on conn until it is closed, returning nil when the client hangs up
+//         a request which can't be served is answered with its error, which the client returns from Open
+func (b *Broker) Serve(conn *oob.UnixConn) error {
+	for {
+		p, fds, err := conn.RecvLengthPrefixed(maxMessageLen, 0)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		closeAll(fds)
+		req := &Request{}
+		if err := json.Unmarshal(p, req); err != nil {
+			return errors.Wrap(err, "received malformed device request")
+		}
+		file, config, err := b.open(conn, req)
+		if err != nil {
+			if err := respond(conn, &response{Error: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		err = respond(conn, &response{Config: config}, file.Fd())
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// open - checks req against the Devices and Allow, and opens the device
+func (b *Broker) open(conn *oob.UnixConn, req *Request) (*os.File, map[string]string, error) {
+	device, ok := b.Devices[req.Device]
+	if !ok {
+		return nil, nil, errors.Errorf("device %q is not available", req.Device)
+	}
+	for _, capability := range req.Capabilities {
+		if !contains(device.Capabilities, capability) {
+			return nil, nil, errors.Errorf("capability %q of device %q is not allowed", capability, req.Device)
+		}
+	}
+	if b.Allow != nil {
+		if err := b.Allow(conn, req); err != nil {
+			return nil, nil, err
+		}
+	}
+	return device.Open(req)
+}
+
+// Open - asks the Broker on the other end of conn for the device req describes, returning it along with the
+//        configuration the Broker applied
+func Open(conn *oob.UnixConn, req *Request) (*os.File, map[string]string, error) {
+	p, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if err = conn.SendLengthPrefixed(p); err != nil {
+		return nil, nil, err
+	}
+	p, fds, err := conn.RecvLengthPrefixed(maxMessageLen, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &response{}
+	if err = json.Unmarshal(p, resp); err != nil {
+		closeAll(fds)
+		return nil, nil, errors.Wrap(err, "received malformed device response")
+	}
+	if resp.Error != "" {
+		closeAll(fds)
+		return nil, nil, errors.Errorf("broker refused %s: %s", req.Device, resp.Error)
+	}
+	if len(fds) != 1 {
+		closeAll(fds)
+		return nil, nil, errors.Errorf("broker sent %d fds for %s", len(fds), req.Device)
+	}
+	return os.NewFile(fds[0], req.Device), resp.Config, nil
+}
+
+func respond(conn *oob.UnixConn, resp *response, fds ...uintptr) error {
+	p, err := json.Marshal(resp)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return conn.SendLengthPrefixed(p, fds...)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func closeAll(fds []uintptr) {
+	for _, fd := range fds {
+		_ = os.NewFile(fd, "").Close()
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package devbroker_test
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+	"github.com/edwarnicke/oob/devbroker"
+)
+
+func newConnPair(t *testing.T) (client, broker *oob.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	var conns [2]*oob.UnixConn
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "pair")
+		conn, err := net.FileConn(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		conns[i] = oob.NewUnixConn(conn.(*net.UnixConn))
+		t.Cleanup(func() { _ = conns[i].Close() })
+	}
+	return conns[0], conns[1]
+}
+
+func serve(t *testing.T, b *devbroker.Broker) *oob.UnixConn {
+	client, broker := newConnPair(t)
+	done := make(chan error, 1)
+	go func() { done <- b.Serve(broker) }()
+	t.Cleanup(func() {
+		_ = client.Close()
+		assert.NoError(t, <-done)
+	})
+	return client
+}
+
+func TestBroker(t *testing.T) {
+	b := &devbroker.Broker{Devices: map[string]*devbroker.Device{
+		"null": {
+			Capabilities: []string{"read"},
+			Open: func(req *devbroker.Request) (*os.File, map[string]string, error) {
+				f, err := os.Open(os.DevNull)
+				return f, map[string]string{"path": os.DevNull, "mode": req.Config["mode"]}, err
+			},
+		},
+	}}
+	b.Allow = func(conn *oob.UnixConn, req *devbroker.Request) error {
+		if req.Config["when"] == "today" {
+			return errors.New("not today")
+		}
+		return nil
+	}
+	client := serve(t, b)
+
+	f, config, err := devbroker.Open(client, &devbroker.Request{Device: "null", Capabilities: []string{"read"}, Config: map[string]string{"mode": "ro"}})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, map[string]string{"path": os.DevNull, "mode": "ro"}, config)
+
+	// Refusals are answered, and the conn carries on
+	_, _, err = devbroker.Open(client, &devbroker.Request{Device: "missing"})
+	assert.Error(t, err)
+	_, _, err = devbroker.Open(client, &devbroker.Request{Device: "null", Capabilities: []string{"write"}})
+	assert.Error(t, err)
+	_, _, err = devbroker.Open(client, &devbroker.Request{Device: "null", Config: map[string]string{"when": "today"}})
+	assert.Contains(t, err.Error(), "not today")
+}
+
+func TestBrokerTun(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("tun is a linux device")
+	}
+	b, err := devbroker.NewBroker(devbroker.Tun)
+	require.NoError(t, err)
+	client := serve(t, b)
+
+	f, config, err := devbroker.Open(client, &devbroker.Request{Device: devbroker.Tun, Capabilities: []string{"tap"}, Config: map[string]string{"name": "oobtest%d"}})
+	if err != nil {
+		t.Skipf("unable to create a tap interface here: %s", err)
+	}
+	defer func() { _ = f.Close() }()
+	assert.True(t, strings.HasPrefix(config["name"], "oobtest"), config["name"])
+
+	_, err = devbroker.NewBroker("floppy")
+	assert.Error(t, err)
+}
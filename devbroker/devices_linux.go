@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devbroker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// defaultDevices - the Devices NewBroker can hand out, and what they support
+var defaultDevices = map[string]*Device{
+	Tun:      {Open: OpenTun, Capabilities: []string{"tap", "multi_queue", "vnet_hdr"}},
+	VhostNet: {Open: OpenVhostNet},
+	VFIO:     {Open: OpenVFIO},
+}
+
+// OpenTun - opens /dev/net/tun and attaches it to the interface Config["name"] (or a new one if empty, "tun%d" style
+//           patterns are allowed), as a tun device, or a tap device with the "tap" capability, with IFF_NO_PI and
+//           IFF_MULTI_QUEUE and IFF_VNET_HDR for the "multi_queue" and "vnet_hdr" capabilities
+//           the config sent back has the "name" of the interface as the kernel named it
+func OpenTun(req *Request) (*os.File, map[string]string, error) {
+	flags := uint16(unix.IFF_TUN | unix.IFF_NO_PI)
+	for _, capability := range req.Capabilities {
+		switch capability {
+		case "tap":
+			flags = flags&^unix.IFF_TUN | unix.IFF_TAP
+		case "multi_queue":
+			flags |= unix.IFF_MULTI_QUEUE
+		case "vnet_hdr":
+			flags |= unix.IFF_VNET_HDR
+		default:
+			return nil, nil, errors.Errorf("tun has no capability %q", capability)
+		}
+	}
+	ifr, err := unix.NewIfreq(req.Config["name"])
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	ifr.SetUint16(flags)
+	file, err := openDevice("/dev/net/tun")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unix.IoctlIfreq(int(file.Fd()), unix.TUNSETIFF, ifr); err != nil {
+		_ = file.Close()
+		return nil, nil, errors.Wrap(err, "TUNSETIFF")
+	}
+	config := map[string]string{"name": ifr.Name(), "flags": strconv.FormatUint(uint64(flags), 10)}
+	return file, config, nil
+}
+
+// OpenVhostNet - opens /dev/vhost-net, which the client then sets itself as the owner of (VHOST_SET_OWNER binds it to
+//                the calling process, so the broker must not)
+func OpenVhostNet(req *Request) (*os.File, map[string]string, error) {
+	file, err := openDevice("/dev/vhost-net")
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, map[string]string{"path": "/dev/vhost-net"}, nil
+}
+
+// OpenVFIO - opens the VFIO group Config["group"] (/dev/vfio/<group>), or the VFIO container (/dev/vfio/vfio) if no
+//            group is given
+func OpenVFIO(req *Request) (*os.File, map[string]string, error) {
+	path := "/dev/vfio/vfio"
+	if group := req.Config["group"]; group != "" {
+		if _, err := strconv.ParseUint(group, 10, 32); err != nil {
+			return nil, nil, errors.Errorf("vfio group %q is not a number", group)
+		}
+		path = filepath.Join("/dev/vfio", group)
+	}
+	file, err := openDevice(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, map[string]string{"path": path}, nil
+}
+
+// openDevice - opens the character device at path read write
+func openDevice(path string) (*os.File, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %s", path)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
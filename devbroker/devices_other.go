@@ -0,0 +1,38 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package devbroker
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// defaultDevices - tun, vhost-net and vfio are linux devices, elsewhere Devices must be given their own Openers
+var defaultDevices = map[string]*Device{
+	Tun:      {Open: unsupported},
+	VhostNet: {Open: unsupported},
+	VFIO:     {Open: unsupported},
+}
+
+// unsupported - an Opener for the linux devices
+func unsupported(req *Request) (*os.File, map[string]string, error) {
+	return nil, nil, errors.Errorf("device %q is only available on linux", req.Device)
+}
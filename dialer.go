@@ -8,6 +8,8 @@ import (
 // Dialer - wrapper around *net.Dialer that wraps net.UnixConn in oob.UnixConn
 type Dialer struct {
 	*net.Dialer
+	// Options - applied to every oob.UnixConn returned
+	Options []Option
 }
 
 // Dial - wraps *net.Dialer.Dial such that net.UnixConn is returned as oob.UnixConn
@@ -18,7 +20,7 @@ func (d *Dialer) Dial(network, address string) (net.Conn, error) {
 	}
 	conn, err := dialer.Dial(network, address)
 	if unixConn, ok := conn.(*net.UnixConn); ok && err == nil {
-		return NewUnixConn(unixConn), nil
+		return NewUnixConn(unixConn, d.Options...), nil
 	}
 	return conn, err
 }
@@ -31,7 +33,7 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	}
 	conn, err := dialer.DialContext(ctx, network, address)
 	if unixConn, ok := conn.(*net.UnixConn); ok && err == nil {
-		return NewUnixConn(unixConn), nil
+		return NewUnixConn(unixConn, d.Options...), nil
 	}
 	return conn, err
 }
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"net"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// DialInNS - like Dial, but dials from inside the namespace nsfd (a network or mount namespace fd, such as an open
+//            /proc/<pid>/ns/net of a container) so that sockets which only exist in that namespace can be reached
+//            The dial happens on a locked OS thread which is returned to its original network namespace afterwards.
+//            Entering a mount namespace requires unsharing the thread's filesystem attributes, which can't be undone,
+//            so in that case the thread is thrown away instead of being handed back to the Go scheduler.
+func (d *Dialer) DialInNS(nsfd uintptr, network, address string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	nstype, err := unix.IoctlRetInt(int(nsfd), unix.NS_GET_NSTYPE)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fd %d is not a namespace", nsfd)
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		// Never unlocked unless the thread makes it back to where it started, so a thread left in the wrong namespace
+		// exits along with this goroutine
+		runtime.LockOSThread()
+		var origNS int
+		switch nstype {
+		case unix.CLONE_NEWNET:
+			origNS, err = unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+			if err != nil {
+				resultCh <- result{err: errors.Wrap(err, "unable to open current network namespace")}
+				return
+			}
+			defer func() { _ = unix.Close(origNS) }()
+		case unix.CLONE_NEWNS:
+			if err = unix.Unshare(unix.CLONE_FS); err != nil {
+				resultCh <- result{err: errors.Wrap(err, "unable to unshare filesystem attributes")}
+				return
+			}
+			origNS = -1
+		default:
+			resultCh <- result{err: errors.Errorf("fd %d is neither a network nor a mount namespace", nsfd)}
+			return
+		}
+		if err = unix.Setns(int(nsfd), nstype); err != nil {
+			resultCh <- result{err: errors.Wrapf(err, "unable to enter namespace fd %d", nsfd)}
+			return
+		}
+		conn, err := dialer.Dial(network, address)
+		if origNS >= 0 && unix.Setns(origNS, unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+		resultCh <- result{conn: conn, err: err}
+	}()
+	r := <-resultCh
+	if unixConn, ok := r.conn.(*net.UnixConn); ok && r.err == nil {
+		return NewUnixConn(unixConn, d.Options...), nil
+	}
+	return r.conn, r.err
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestDialInNS(t *testing.T) {
+	// Listen on an abstract socket (which are per network namespace) in a brand new network namespace
+	type result struct {
+		nsfd     int
+		listener net.Listener
+		err      error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		// The thread is left in the new namespace, so never unlock it and let it exit with the goroutine
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		nsfd, err := unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		listener, err := net.Listen("unix", "@oob_test_dial_in_ns")
+		resultCh <- result{nsfd: nsfd, listener: listener, err: err}
+	}()
+	r := <-resultCh
+	if r.err == unix.EPERM {
+		t.Skip("creating a network namespace requires CAP_SYS_ADMIN")
+	}
+	require.NoError(t, r.err)
+	defer func() { _ = unix.Close(r.nsfd) }()
+	defer func() { _ = r.listener.Close() }()
+	go func() {
+		conn, err := r.listener.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	dialer := &oob.Dialer{}
+	_, err := dialer.Dial("unix", "@oob_test_dial_in_ns")
+	require.Error(t, err, "the socket should only be reachable from inside the namespace")
+	conn, err := dialer.DialInNS(uintptr(r.nsfd), "unix", "@oob_test_dial_in_ns")
+	require.NoError(t, err)
+	assert.IsType(t, &oob.UnixConn{}, conn)
+	assert.NoError(t, conn.Close())
+
+	_, err = dialer.Dial("unix", "@oob_test_dial_in_ns")
+	require.Error(t, err, "the dialing thread should have returned to its original namespace")
+}
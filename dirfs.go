@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+type dirFS struct {
+	fd uintptr
+}
+
+// DirFS - fs.FS rooted at the directory fd (usually an O_PATH or O_DIRECTORY fd received with RecvFD)
+//         every Open is resolved relative to fd and may not escape it, so no path based access outside of the
+//         directory is ever made: on linux symlinks (and .. through them) must stay beneath fd (openat2 with
+//         RESOLVE_BENEATH), elsewhere (or on kernels without openat2) symlinks are not followed at all
+//         fd must remain open for as long as the returned fs.FS is in use
+func DirFS(fd uintptr) fs.FS {
+	return &dirFS{fd: fd}
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fd, err := openBeneath(int(d.fd), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	file := os.NewFile(uintptr(fd), name)
+	fi, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if fi.IsDir() {
+		return &dirFile{file}, nil
+	}
+	return file, nil
+}
+
+// openNoFollow - opens name relative to dirfd one component at a time, refusing to follow symlinks anywhere along
+//                the way, so the result can't be outside of dirfd (name must be an fs.ValidPath, which has no ..)
+func openNoFollow(dirfd int, name string) (int, error) {
+	parts := strings.Split(name, "/")
+	fd := dirfd
+	for i, part := range parts {
+		flags := unix.O_RDONLY | unix.O_CLOEXEC | unix.O_NOFOLLOW
+		if i < len(parts)-1 {
+			flags |= unix.O_DIRECTORY
+		}
+		next, err := unix.Openat(fd, part, flags, 0)
+		if fd != dirfd {
+			_ = unix.Close(fd)
+		}
+		if err != nil {
+			return -1, err
+		}
+		fd = next
+	}
+	return fd, nil
+}
+
+// dirFile - *os.File for a directory whose entries are stat'd relative to the directory fd rather than by path
+type dirFile struct {
+	*os.File
+}
+
+func (f *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.File.ReadDir(n)
+	for i, entry := range entries {
+		entries[i] = &dirEntry{DirEntry: entry, dir: f.File}
+	}
+	return entries, err
+}
+
+type dirEntry struct {
+	fs.DirEntry
+	dir *os.File
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	stat := &unix.Stat_t{}
+	if err := unix.Fstatat(int(e.dir.Fd()), e.Name(), stat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return nil, &fs.PathError{Op: "fstatat", Path: e.Name(), Err: err}
+	}
+	return &statInfo{name: e.Name(), stat: stat}, nil
+}
+
+// statInfo - fs.FileInfo for a unix.Stat_t
+type statInfo struct {
+	name string
+	stat *unix.Stat_t
+}
+
+func (s *statInfo) Name() string       { return s.name }
+func (s *statInfo) Size() int64        { return s.stat.Size }
+func (s *statInfo) Mode() fs.FileMode  { return toFileMode(uint32(s.stat.Mode)) }
+func (s *statInfo) ModTime() time.Time { return time.Unix(s.stat.Mtim.Unix()) }
+func (s *statInfo) IsDir() bool        { return s.Mode().IsDir() }
+func (s *statInfo) Sys() interface{}   { return s.stat }
+
+// toFileMode - converts the st_mode of a stat(2) to an fs.FileMode the same way the os package does
+func toFileMode(mode uint32) fs.FileMode {
+	fileMode := fs.FileMode(mode & 0o777)
+	switch mode & unix.S_IFMT {
+	case unix.S_IFBLK:
+		fileMode |= fs.ModeDevice
+	case unix.S_IFCHR:
+		fileMode |= fs.ModeDevice | fs.ModeCharDevice
+	case unix.S_IFDIR:
+		fileMode |= fs.ModeDir
+	case unix.S_IFIFO:
+		fileMode |= fs.ModeNamedPipe
+	case unix.S_IFLNK:
+		fileMode |= fs.ModeSymlink
+	case unix.S_IFSOCK:
+		fileMode |= fs.ModeSocket
+	}
+	if mode&unix.S_ISGID != 0 {
+		fileMode |= fs.ModeSetgid
+	}
+	if mode&unix.S_ISUID != 0 {
+		fileMode |= fs.ModeSetuid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		fileMode |= fs.ModeSticky
+	}
+	return fileMode
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// openBeneath - opens name relative to dirfd without letting it (or any symlink in it) resolve outside of dirfd
+func openBeneath(dirfd int, name string) (int, error) {
+	how := &unix.OpenHow{
+		Flags:   unix.O_RDONLY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	}
+	for {
+		fd, err := unix.Openat2(dirfd, name, how)
+		switch err {
+		case unix.EAGAIN, unix.EINTR:
+			// openat2 asks to be retried if a rename raced with the lookup
+			continue
+		case unix.ENOSYS, unix.EPERM:
+			// No openat2 (pre 5.6 kernel, or filtered by seccomp), fall back to not following symlinks at all
+			return openNoFollow(dirfd, name)
+		}
+		return fd, err
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestDirFS(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dirname) }()
+	require.NoError(t, os.Mkdir(filepath.Join(dirname, "sub"), 0o700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirname, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirname, "sub", "b.txt"), []byte("b"), 0o600))
+
+	fd, err := syscall.Open(dirname, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer func() { _ = syscall.Close(fd) }()
+
+	require.NoError(t, fstest.TestFS(oob.DirFS(uintptr(fd)), "a.txt", "sub/b.txt"))
+}
+
+func TestDirFSSymlinkEscape(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dirname) }()
+	outside := filepath.Join(dirname, "outside")
+	root := filepath.Join(dirname, "root")
+	require.NoError(t, os.Mkdir(outside, 0o700))
+	require.NoError(t, os.Mkdir(root, 0o700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "absolute")))
+	require.NoError(t, os.Symlink("../outside", filepath.Join(root, "relative")))
+	require.NoError(t, os.Symlink("../outside/secret", filepath.Join(root, "file")))
+
+	fd, err := syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer func() { _ = syscall.Close(fd) }()
+	fsys := oob.DirFS(uintptr(fd))
+
+	for _, name := range []string{"absolute", "absolute/secret", "relative", "relative/secret", "file"} {
+		file, err := fsys.Open(name)
+		if !assert.Error(t, err, name) {
+			_ = file.Close()
+			continue
+		}
+		assert.IsType(t, &fs.PathError{}, err, name)
+	}
+}
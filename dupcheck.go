@@ -0,0 +1,49 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"sync"
+)
+
+// sentFiles - how many times each file has been sent on a connection, for WithDuplicateSendCheck
+type sentFiles struct {
+	mu    sync.Mutex
+	count map[Identity]int
+}
+
+// checkDuplicateSend - logs a warning the second time (and every doubling after that) a file is sent
+func (s *UnixConn) checkDuplicateSend(fds ...uintptr) {
+	if !s.opts.duplicateSendCheck {
+		return
+	}
+	s.sent.mu.Lock()
+	defer s.sent.mu.Unlock()
+	if s.sent.count == nil {
+		s.sent.count = make(map[Identity]int)
+	}
+	for _, fd := range fds {
+		id, err := fileIdentity(fd)
+		if err != nil {
+			continue
+		}
+		s.sent.count[id]++
+		if n := s.sent.count[id]; n > 1 && n&(n-1) == 0 {
+			s.opts.logf("oob: fd %d (dev %d inode %d%s) has been sent %d times on this connection, is something retrying?", fd, id.Dev, id.Inode, id.Class, n)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestDuplicateSendCheck(t *testing.T) {
+	// Both ends of a pipe are the same file, so use two
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	other, otherW, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = other.Close() }()
+	defer func() { _ = otherW.Close() }()
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	file := os.NewFile(uintptr(fds[0]), "")
+	conn, err := net.FileConn(file)
+	_ = file.Close()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	peer := os.NewFile(uintptr(fds[1]), "")
+	defer func() { _ = peer.Close() }()
+
+	out := &bytes.Buffer{}
+	sender := oob.NewUnixConn(conn.(*net.UnixConn), oob.WithLogger(log.New(out, "", 0)), oob.WithDuplicateSendCheck())
+	require.NoError(t, sender.SendFD(other.Fd()))
+	require.NoError(t, sender.SendFD(r.Fd()))
+	assert.Empty(t, out.String())
+	require.NoError(t, sender.SendFD(r.Fd()))
+	assert.Equal(t, 1, strings.Count(out.String(), "sent 2 times"))
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithEventRing - remember the last n fd events (what was sent or received, its kind and inode, the peer, and any
+//                 error) on the connection, for DebugDump to write out after the fact when a descriptor goes missing
+func WithEventRing(n int) Option {
+	return func(o *options) {
+		o.eventRing = n
+	}
+}
+
+type event struct {
+	time  time.Time
+	op    string
+	fd    uintptr
+	kind  string
+	inode uint64
+	class string
+	err   error
+}
+
+// eventRing - a bounded ring of the most recent events
+type eventRing struct {
+	mu     sync.Mutex
+	events []event
+	next   int
+	full   bool
+}
+
+// record - adds an event for op on each of fds (or a single event without an fd if there are none)
+func (s *UnixConn) record(op string, err error, fds ...uintptr) {
+	if s.opts.eventRing <= 0 {
+		return
+	}
+	now := time.Now()
+	if len(fds) == 0 {
+		s.events.add(s.opts.eventRing, event{time: now, op: op, err: err})
+		return
+	}
+	for _, fd := range fds {
+		e := event{time: now, op: op, fd: fd, err: err}
+		if err == nil {
+			// Whatever we can learn about it, received fds which failed have already been closed
+			e.kind, _ = fdKind(fd)
+			if id, idErr := fileIdentity(fd); idErr == nil {
+				e.inode, e.class = id.Inode, id.Class
+			}
+		}
+		s.events.add(s.opts.eventRing, e)
+	}
+}
+
+// recordRecv - records the outcome of receiving fd, which is not an fd at all if err is set
+func (s *UnixConn) recordRecv(op string, fd uintptr, err error) {
+	if err != nil {
+		s.record(op, err)
+		return
+	}
+	s.record(op, nil, fd)
+}
+
+func (r *eventRing) add(size int, e event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		r.events = make([]event, size)
+	}
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	r.full = r.full || r.next == 0
+}
+
+// DebugDump - writes the events remembered (WithEventRing) on the connection to w, oldest first
+func (s *UnixConn) DebugDump(w io.Writer) error {
+	if s.opts.eventRing <= 0 {
+		_, err := fmt.Fprintln(w, "oob: no events recorded, enable them with WithEventRing")
+		return err
+	}
+	peer := "unknown"
+	if pid, err := s.peerPid(); err == nil {
+		peer = fmt.Sprintf("pid %d", pid)
+	}
+	s.events.mu.Lock()
+	events := append([]event(nil), s.events.events[:s.events.next]...)
+	if s.events.full {
+		events = append(append([]event(nil), s.events.events[s.events.next:]...), events...)
+	}
+	s.events.mu.Unlock()
+
+	if addr := s.RemoteAddr(); addr != nil && addr.String() != "" {
+		peer += " at " + addr.String()
+	}
+	if _, err := fmt.Fprintf(w, "oob: %d events with peer %s\n", len(events), peer); err != nil {
+		return err
+	}
+	for _, e := range events {
+		line := fmt.Sprintf("%s %s", e.time.Format(time.RFC3339Nano), e.op)
+		if e.fd != 0 || e.kind != "" {
+			line += fmt.Sprintf(" fd=%d kind=%s inode=%d", e.fd, e.kind, e.inode)
+			if e.class != "" {
+				line += fmt.Sprintf(" class=%s", e.class)
+			}
+		}
+		if e.err != nil {
+			line += fmt.Sprintf(" err=%q", e.err.Error())
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
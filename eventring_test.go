@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestDebugDump(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	inode, err := oob.ToInode(r)
+	require.NoError(t, err)
+
+	sender, receiver := newUnixConnPair(t, oob.WithEventRing(3))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sender.SendFD(r.Fd()))
+	}
+	for i := 0; i < 4; i++ {
+		fd, err := receiver.RecvFD()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+	require.NoError(t, sender.Close())
+	_, err = receiver.RecvFD()
+	require.Error(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, receiver.DebugDump(buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// The header, then only the last 3 events
+	require.Len(t, lines, 4, buf.String())
+	if runtime.GOOS == "linux" {
+		assert.Contains(t, lines[0], fmt.Sprintf("pid %d", os.Getpid()))
+	}
+	assert.Contains(t, lines[1], "RecvFD fd=")
+	assert.Contains(t, lines[1], fmt.Sprintf("kind=%s inode=%d", oob.KindFifo, inode))
+	assert.Contains(t, lines[3], "RecvFD err=")
+
+	buf.Reset()
+	_, plain := newUnixConnPair(t)
+	require.NoError(t, plain.DebugDump(buf))
+	assert.Contains(t, buf.String(), "WithEventRing")
+}
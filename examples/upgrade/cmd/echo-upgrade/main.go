@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+// echo-upgrade - runs the upgrade example: the first run listens on -listen and -control, every later run (of the same
+// or a newer binary) takes over from the one already running, which exits once its connections are done
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/edwarnicke/oob/examples/upgrade"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:7777", "tcp address to echo on")
+	control := flag.String("control", "/tmp/echo-upgrade.sock", "unix socket a newer version takes over through")
+	registry := flag.String("registry", "", "unix socket of a broker to register the listener with, if any")
+	flag.Parse()
+
+	var opts []upgrade.Option
+	if *registry != "" {
+		opts = append(opts, upgrade.WithRegistry(*registry))
+	}
+	srv, err := upgrade.Upgrade(*control, opts...)
+	if err != nil {
+		log.Printf("not upgrading (%s), starting afresh", err)
+		if srv, err = upgrade.Start("tcp", *listen, *control, opts...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Under systemd (Type=notify, NotifyAccess=all, FileDescriptorStoreMax=1) the serving version is the main process
+	// of the service, and a restart after every version died starts afresh with the listener it stored
+	log.Printf("pid %d echoing on %s", os.Getpid(), srv.Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-srv.HandedOver():
+		log.Printf("pid %d handed over, finishing %d connections", os.Getpid(), srv.Served())
+	case sig := <-signals:
+		log.Printf("pid %d received %s, finishing its connections", os.Getpid(), sig)
+		_ = srv.Close()
+	}
+	srv.Wait()
+}
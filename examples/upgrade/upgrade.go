@@ -0,0 +1,460 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+// Package upgrade - a reference zero downtime echo server, which upgrades itself in place: the new version dials the
+// control socket of the running one, takes over its listener (and the connections waiting on it) with oob's
+// negotiated takeover, then takes over the control socket too, so it can be upgraded in turn, while the old version
+// finishes serving the connections it already had before it exits
+// Whichever version is serving tells its supervisor (systemd, or anything listening on $NOTIFY_SOCKET) that it is
+// the main process and parks the listener in the supervisor's fd store, from which Start picks it up again should
+// every version die, and, WithRegistry, registers the listener with a broker through an oob.Client
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/edwarnicke/oob"
+)
+
+// controlAck - written by the new version once it has both listeners, after which the old one lets go of them
+const controlAck = 'K'
+
+// FDName - the name the listener is stored under in the supervisor's fd store, and its label in the registry
+const FDName = "echo"
+
+// listenFDsStart - SD_LISTEN_FDS_START, the first fd a supervisor passes (LISTEN_FDS)
+const listenFDsStart = 3
+
+// registryCheckInterval - how often a server checks that the broker it registered with is still there, registering
+//                         its listener again if the broker restarted
+const registryCheckInterval = time.Second
+
+// Option - configures the optional parts of a Server, for Start and Upgrade
+type Option func(*options)
+
+type options struct {
+	// registry - the unix socket of the broker to register the listener with, none if empty
+	registry string
+}
+
+// WithRegistry - registers the listener, labeled FDName, with the broker listening on the unix socket registry for
+//                as long as this version serves it, through an oob.Client which registers it again whenever the broker
+//                restarts
+func WithRegistry(registry string) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// DefaultTimeouts - the TakeoverTimeouts Start and Upgrade use, the ack of the control socket is bounded by Confirm
+var DefaultTimeouts = oob.TakeoverTimeouts{
+	Prepare:  5 * time.Second,
+	Transfer: 5 * time.Second,
+	Confirm:  5 * time.Second,
+	Release:  5 * time.Second,
+}
+
+// Server - an echo server, with a control socket through which a newer version takes it over
+type Server struct {
+	listener net.Listener
+	control  net.Listener
+	timeouts oob.TakeoverTimeouts
+	opts     options
+
+	// accepting - the accept loop of listener, which is paused (by a deadline in the past) during a takeover
+	accepting sync.WaitGroup
+	paused    int32
+	conns     sync.WaitGroup
+	served    int64
+	// registering - the registration of the listener with the broker, WithRegistry
+	registering sync.WaitGroup
+
+	handedOver chan struct{}
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+// Start - starts the first version: listens on address (unless the supervisor passed the listener a previous version
+//         stored with it, which is served instead) and on the unix socket control, and serves
+func Start(network, address, control string, opts ...Option) (*Server, error) {
+	listener, err := supervisedListener()
+	if err != nil {
+		return nil, err
+	}
+	if listener == nil {
+		if listener, err = net.Listen(network, address); err != nil {
+			return nil, errors.Wrapf(err, "unable to listen on %s %s", network, address)
+		}
+	}
+	controlListener, err := oob.Listen("unix", control)
+	if err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrapf(err, "unable to listen on control socket %s", control)
+	}
+	return newServer(listener, controlListener, nil, DefaultTimeouts, opts...), nil
+}
+
+// Upgrade - starts a new version by taking over from the one whose control socket is control, serving the
+//           connections which were waiting on its listener before accepting any more
+//           if it fails the old version carries on serving, and nothing is left running here but the echoing of
+//           any connections which were already taken over (the old version has let go of those), until they finish
+func Upgrade(control string, opts ...Option) (*Server, error) {
+	conn, err := net.Dial("unix", control)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to dial control socket %s", control)
+	}
+	c := oob.NewUnixConn(conn.(*net.UnixConn))
+	defer func() { _ = c.Close() }()
+
+	listener, conns, err := c.AcceptTakeover(DefaultTimeouts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to take over the listener")
+	}
+	// giveBack - leaves the listener to the old version, which resumes accepting on it, but not the connections taken
+	//            over, which are ours alone now
+	giveBack := func() {
+		_ = listener.Close()
+		for _, conn := range conns {
+			go func(conn net.Conn) { _ = Echo(conn) }(conn)
+		}
+	}
+	controlListener, queued, err := c.RecvListenerHandoff()
+	if err != nil {
+		giveBack()
+		return nil, errors.Wrap(err, "unable to take over the control socket")
+	}
+	// Anything queued on the control socket is another version trying to upgrade at the same time, which loses
+	for _, conn := range queued {
+		_ = conn.Close()
+	}
+	if err = withWriteDeadline(c, DefaultTimeouts.Confirm, func() error {
+		_, err := c.Write([]byte{controlAck})
+		return err
+	}); err != nil {
+		giveBack()
+		_ = controlListener.Close()
+		return nil, errors.Wrap(err, "unable to acknowledge the control socket")
+	}
+	return newServer(listener, controlListener, conns, DefaultTimeouts, opts...), nil
+}
+
+// newServer - serves conns, then listener, and the control socket
+func newServer(listener, control net.Listener, conns []net.Conn, timeouts oob.TakeoverTimeouts, opts ...Option) *Server {
+	s := &Server{
+		listener:   listener,
+		control:    control,
+		timeouts:   timeouts,
+		handedOver: make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	for _, conn := range conns {
+		s.serve(conn)
+	}
+	s.startAccepting()
+	go s.serveControl()
+	// A supervisor which can't be told is no reason not to serve, it only misses out on the fd store
+	_ = s.notifySupervisor()
+	if s.opts.registry != "" {
+		// Our own dup of the listener to register, which Close can't pull from under the registration
+		if listener, err := oob.DupFile(s.listener); err == nil {
+			s.registering.Add(1)
+			go s.register(listener)
+		}
+	}
+	return s
+}
+
+// Addr - the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Served - how many connections this version has served (or is serving)
+func (s *Server) Served() int64 {
+	return atomic.LoadInt64(&s.served)
+}
+
+// HandedOver - closed once a newer version has taken over, after which this one only finishes its connections
+func (s *Server) HandedOver() <-chan struct{} {
+	return s.handedOver
+}
+
+// Wait - waits for the server to stop accepting (handed over or closed) and every connection it served to finish
+func (s *Server) Wait() {
+	select {
+	case <-s.handedOver:
+	case <-s.closed:
+	}
+	s.accepting.Wait()
+	s.conns.Wait()
+	s.registering.Wait()
+}
+
+// Close - stops accepting and closes both listeners, connections being served are left to finish (see Wait)
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.listener.Close()
+		if controlErr := s.control.Close(); err == nil {
+			err = controlErr
+		}
+	})
+	return err
+}
+
+// Echo - writes back everything read from conn until EOF, then closes it
+func Echo(conn net.Conn) error {
+	defer func() { _ = conn.Close() }()
+	_, err := io.Copy(conn, conn)
+	return err
+}
+
+// serve - echoes conn on its own goroutine
+func (s *Server) serve(conn net.Conn) {
+	atomic.AddInt64(&s.served, 1)
+	s.conns.Add(1)
+	go func() {
+		defer s.conns.Done()
+		_ = Echo(conn)
+	}()
+}
+
+// startAccepting - runs the accept loop until the listener is closed or the loop is paused
+func (s *Server) startAccepting() {
+	s.accepting.Add(1)
+	go func() {
+		defer s.accepting.Done()
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				if atomic.LoadInt32(&s.paused) == 0 {
+					var netErr net.Error
+					if errors.As(err, &netErr) && netErr.Timeout() {
+						continue
+					}
+				}
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+}
+
+// pause - stops the accept loop, leaving new connections in the accept queue, for a takeover
+func (s *Server) pause() error {
+	atomic.StoreInt32(&s.paused, 1)
+	if err := setDeadline(s.listener, time.Unix(1, 0)); err != nil {
+		atomic.StoreInt32(&s.paused, 0)
+		return err
+	}
+	s.accepting.Wait()
+	return nil
+}
+
+// resume - restarts the accept loop after a takeover failed
+func (s *Server) resume() {
+	_ = setDeadline(s.listener, time.Time{})
+	atomic.StoreInt32(&s.paused, 0)
+	s.startAccepting()
+}
+
+// serveControl - handles one upgrade at a time until this version has been taken over or is closed
+func (s *Server) serveControl() {
+	for {
+		conn, err := s.control.Accept()
+		if err != nil {
+			return
+		}
+		c, ok := conn.(*oob.UnixConn)
+		if !ok {
+			_ = conn.Close()
+			continue
+		}
+		handedOver := s.handOver(c)
+		_ = c.Close()
+		if handedOver {
+			close(s.handedOver)
+			return
+		}
+	}
+}
+
+// handOver - hands both listeners over to the new version on the other end of c, returning whether it took them
+func (s *Server) handOver(c *oob.UnixConn) bool {
+	if err := s.pause(); err != nil {
+		return false
+	}
+	if err := c.OfferTakeover(s.listener, s.timeouts); err != nil {
+		// The connections taken off the accept queue for the new version are given back, and are still ours to serve
+		var handoffErr *oob.HandoffError
+		if errors.As(err, &handoffErr) {
+			for _, conn := range handoffErr.Conns {
+				s.serve(conn)
+			}
+		}
+		s.resume()
+		return false
+	}
+	// The new version has the listener, but isn't using it until it has the control socket as well, so until then
+	// this version still has its own copy to fall back on
+	if err := c.SendListenerHandoff(s.control); err != nil {
+		s.resume()
+		return false
+	}
+	ack := make([]byte, 1)
+	if err := withReadDeadline(c, s.timeouts.Confirm, func() error {
+		_, err := io.ReadFull(c, ack)
+		return err
+	}); err != nil || ack[0] != controlAck {
+		s.resume()
+		return false
+	}
+	_ = s.listener.Close()
+	_ = s.control.Close()
+	return true
+}
+
+// notifySupervisor - tells the supervisor this version is its main process, and stores the listener with it in place
+//                    of the one a previous version stored
+func (s *Server) notifySupervisor() error {
+	fd, err := oob.ToFd(s.listener)
+	if err != nil {
+		return err
+	}
+	if _, err = oob.SdNotify("FDSTOREREMOVE=1\nFDNAME=" + FDName); err != nil {
+		return err
+	}
+	_, err = oob.SdNotifyWithFDs(fmt.Sprintf("FDSTORE=1\nFDNAME=%s\nMAINPID=%d\nREADY=1", FDName, os.Getpid()), fd)
+	return err
+}
+
+// supervisedListener - the listener named FDName the supervisor passed us (LISTEN_FDS), which a previous version
+//                      stored with it, nil if there is none
+func supervisedListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// Like sd_listen_fds(1), so that our children don't think these are meant for them
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+	for i := 0; i < n && i < len(names); i++ {
+		if names[i] != FDName {
+			continue
+		}
+		file := os.NewFile(uintptr(listenFDsStart+i), FDName)
+		listener, err := net.FileListener(file)
+		// net.FileListener has its own dup of the fd
+		_ = file.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "fd %d passed as %s is not a listener", listenFDsStart+i, FDName)
+		}
+		return listener, nil
+	}
+	return nil, nil
+}
+
+// register - registers listener (a dup of the one served, which it closes) with the broker, and keeps it registered
+//            across restarts of the broker, until this version is handed over or closed
+func (s *Server) register(listener *os.File) {
+	defer s.registering.Done()
+	defer func() { _ = listener.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.handedOver:
+		case <-s.closed:
+		}
+		cancel()
+	}()
+	client := &oob.Client{Network: "unix", Address: s.opts.registry}
+	defer func() { _ = client.Close() }()
+	metadata := map[string]string{"addr": s.listener.Addr().String(), "pid": strconv.Itoa(os.Getpid())}
+	if err := client.Register(ctx, FDName, listener, metadata); err != nil && ctx.Err() != nil {
+		return
+	}
+	// The client only redials (registering the listener again) when asked for its conn
+	ticker := time.NewTicker(registryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = client.Conn(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deadliner - a listener which can be given an accept deadline, such as *net.TCPListener and *net.UnixListener
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// setDeadline - sets the accept deadline of listener, or of the listener it wraps (Unwrap)
+func setDeadline(listener net.Listener, t time.Time) error {
+	var inner interface{} = listener
+	for inner != nil {
+		if d, ok := inner.(deadliner); ok {
+			return d.SetDeadline(t)
+		}
+		unwrapper, ok := inner.(interface{ Unwrap() interface{} })
+		if !ok {
+			break
+		}
+		inner = unwrapper.Unwrap()
+	}
+	return errors.Errorf("listener %T has no accept deadline", listener)
+}
+
+// withReadDeadline - runs f with a read deadline timeout from now on conn, clearing it again afterwards
+func withReadDeadline(conn net.Conn, timeout time.Duration, f func() error) error {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	return f()
+}
+
+// withWriteDeadline - runs f with a write deadline timeout from now on conn, clearing it again afterwards
+func withWriteDeadline(conn net.Conn, timeout time.Duration, f func() error) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = conn.SetWriteDeadline(time.Time{}) }()
+	return f()
+}
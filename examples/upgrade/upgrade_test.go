@@ -0,0 +1,298 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package upgrade_test
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+	"github.com/edwarnicke/oob/examples/upgrade"
+)
+
+// echo - sends line on conn and returns what comes back
+func echo(t *testing.T, conn net.Conn, line string) string {
+	_, err := conn.Write([]byte(line + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	return reply[:len(reply)-1]
+}
+
+func TestUpgrade(t *testing.T) {
+	control := filepath.Join(t.TempDir(), "control.sock")
+	old, err := upgrade.Start("tcp", "127.0.0.1:0", control)
+	require.NoError(t, err)
+	defer func() { _ = old.Close() }()
+	addr := old.Addr().String()
+
+	before, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	assert.Equal(t, "before", echo(t, before, "before"))
+
+	next, err := upgrade.Upgrade(control)
+	require.NoError(t, err)
+	defer func() { _ = next.Close() }()
+	<-old.HandedOver()
+	assert.Equal(t, addr, next.Addr().String())
+
+	// The old version finishes what it had, the new one serves everything after
+	assert.Equal(t, "still", echo(t, before, "still"))
+	after, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	assert.Equal(t, "after", echo(t, after, "after"))
+	require.NoError(t, after.Close())
+	assert.EqualValues(t, 1, old.Served())
+	assert.EqualValues(t, 1, next.Served())
+
+	waited := make(chan struct{})
+	go func() {
+		old.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("the old version stopped before its connection was done")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, before.Close())
+	<-waited
+
+	// The control socket came along, so the new version can be upgraded in turn
+	newest, err := upgrade.Upgrade(control)
+	require.NoError(t, err)
+	defer func() { _ = newest.Close() }()
+	<-next.HandedOver()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	assert.Equal(t, "newest", echo(t, conn, "newest"))
+	require.NoError(t, conn.Close())
+	assert.EqualValues(t, 1, newest.Served())
+}
+
+func TestUpgradeNothingRunning(t *testing.T) {
+	_, err := upgrade.Upgrade(filepath.Join(t.TempDir(), "control.sock"))
+	assert.Error(t, err)
+}
+
+// upgradeEnv - set in the environment of the child TestUpgradeProcessChild runs in, to the control socket
+const upgradeEnv = "OOB_TEST_UPGRADE_CONTROL"
+
+// TestUpgradeProcessChild - runs only in the child started by TestUpgradeProcess, playing the new version: it takes
+//                           over, serves one connection and exits
+func TestUpgradeProcessChild(t *testing.T) {
+	control, ok := os.LookupEnv(upgradeEnv)
+	if !ok {
+		t.Skip("only runs as a child of TestUpgradeProcess")
+	}
+	srv, err := upgrade.Upgrade(control)
+	require.NoError(t, err)
+	for deadline := time.Now().Add(10 * time.Second); srv.Served() == 0; time.Sleep(10 * time.Millisecond) {
+		require.True(t, time.Now().Before(deadline), "served nothing")
+	}
+	require.NoError(t, srv.Close())
+	srv.Wait()
+}
+
+func TestUpgradeProcess(t *testing.T) {
+	control := filepath.Join(t.TempDir(), "control.sock")
+	old, err := upgrade.Start("tcp", "127.0.0.1:0", control)
+	require.NoError(t, err)
+	defer func() { _ = old.Close() }()
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestUpgradeProcessChild$", "-test.v")
+	cmd.Env = append(os.Environ(), upgradeEnv+"="+control)
+	output := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = output, output
+	require.NoError(t, cmd.Start())
+	select {
+	case <-old.HandedOver():
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		t.Fatalf("no takeover: %s", output)
+	}
+	old.Wait()
+
+	// Only the new process is listening now
+	conn, err := net.Dial("tcp", old.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "upgraded", echo(t, conn, "upgraded"))
+	require.NoError(t, conn.Close())
+	require.NoError(t, cmd.Wait(), "%s", output)
+	assert.EqualValues(t, 0, old.Served())
+}
+
+// registration - a listener registered with the broker of TestUpgradeRegistry
+type registration struct {
+	addr string
+	// done - closed once the conn it was registered on is closed
+	done chan struct{}
+}
+
+func TestUpgradeRegistry(t *testing.T) {
+	dir := t.TempDir()
+	broker, err := oob.Listen("unix", filepath.Join(dir, "broker.sock"))
+	require.NoError(t, err)
+	defer func() { _ = broker.Close() }()
+	registrations := make(chan registration, 4)
+	go func() {
+		for {
+			conn, err := broker.Accept()
+			if err != nil {
+				return
+			}
+			go func(c *oob.UnixConn) {
+				defer func() { _ = c.Close() }()
+				var done chan struct{}
+				for {
+					b, err := c.RecvBundle()
+					if err != nil {
+						if done != nil {
+							close(done)
+						}
+						return
+					}
+					item := b.Get(upgrade.FDName)
+					if item != nil && done == nil {
+						listener, listenerErr := net.FileListener(item.File)
+						if assert.NoError(t, listenerErr) {
+							done = make(chan struct{})
+							registrations <- registration{addr: listener.Addr().String(), done: done}
+							_ = listener.Close()
+						}
+					}
+					_ = b.Close()
+				}
+			}(conn.(*oob.UnixConn))
+		}
+	}()
+
+	control := filepath.Join(dir, "control.sock")
+	old, err := upgrade.Start("tcp", "127.0.0.1:0", control, upgrade.WithRegistry(broker.Addr().String()))
+	require.NoError(t, err)
+	defer func() { _ = old.Close() }()
+	first := <-registrations
+	assert.Equal(t, old.Addr().String(), first.addr)
+
+	// The new version registers the listener it took over, the old one goes away
+	next, err := upgrade.Upgrade(control, upgrade.WithRegistry(broker.Addr().String()))
+	require.NoError(t, err)
+	defer func() { _ = next.Close() }()
+	second := <-registrations
+	assert.Equal(t, old.Addr().String(), second.addr)
+	<-old.HandedOver()
+	old.Wait()
+	select {
+	case <-first.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the old version is still registered")
+	}
+}
+
+// supervisorEnv - set in the environment of the child TestSupervisorRestartChild runs in, to the address the
+//                 listener it was passed should have
+const supervisorEnv = "OOB_TEST_SUPERVISOR_ADDR"
+
+func TestUpgradeSupervisor(t *testing.T) {
+	dir := t.TempDir()
+	supervisor, err := oob.ListenNotify(filepath.Join(dir, "notify.sock"))
+	require.NoError(t, err)
+	defer func() { _ = supervisor.Close() }()
+	t.Setenv("NOTIFY_SOCKET", supervisor.LocalAddr().String())
+
+	// expectStored - the supervisor is told the server is the main process, and stores its listener
+	expectStored := func(srv *upgrade.Server) *os.File {
+		require.NoError(t, supervisor.SetReadDeadline(time.Now().Add(5*time.Second)))
+		removed, err := supervisor.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "1", removed.Fields["FDSTOREREMOVE"])
+		stored, err := supervisor.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "1", stored.Fields["FDSTORE"])
+		assert.Equal(t, upgrade.FDName, stored.Fields["FDNAME"])
+		assert.Equal(t, strconv.Itoa(os.Getpid()), stored.Fields["MAINPID"])
+		assert.Equal(t, "1", stored.Fields["READY"])
+		require.Len(t, stored.Files, 1)
+		listener, err := net.FileListener(stored.Files[0])
+		require.NoError(t, err)
+		assert.Equal(t, srv.Addr().String(), listener.Addr().String())
+		_ = listener.Close()
+		return stored.Files[0]
+	}
+
+	control := filepath.Join(dir, "control.sock")
+	old, err := upgrade.Start("tcp", "127.0.0.1:0", control)
+	require.NoError(t, err)
+	defer func() { _ = old.Close() }()
+	_ = expectStored(old).Close()
+	next, err := upgrade.Upgrade(control)
+	require.NoError(t, err)
+	<-old.HandedOver()
+	stored := expectStored(next)
+	defer func() { _ = stored.Close() }()
+
+	// Every version dies, and the supervisor restarts the service with the listener it stored
+	require.NoError(t, next.Close())
+	next.Wait()
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestSupervisorRestartChild$", "-test.v")
+	cmd.Env = append(os.Environ(), supervisorEnv+"="+next.Addr().String(), "LISTEN_FDS=1",
+		"LISTEN_FDNAMES="+upgrade.FDName)
+	cmd.ExtraFiles = []*os.File{stored}
+	output := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = output, output
+	require.NoError(t, cmd.Start())
+	conn, err := net.Dial("tcp", next.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "restarted", echo(t, conn, "restarted"))
+	require.NoError(t, conn.Close())
+	require.NoError(t, cmd.Wait(), "%s", output)
+}
+
+// TestSupervisorRestartChild - runs only in the child started by TestUpgradeSupervisor, playing the version a
+//                              supervisor restarts: it starts with the listener passed to it, serves one connection
+//                              and exits
+func TestSupervisorRestartChild(t *testing.T) {
+	addr, ok := os.LookupEnv(supervisorEnv)
+	if !ok {
+		t.Skip("only runs as a child of TestUpgradeSupervisor")
+	}
+	// What the supervisor would have set, had it forked us itself
+	require.NoError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())))
+	srv, err := upgrade.Start("tcp", "127.0.0.1:0", filepath.Join(t.TempDir(), "control.sock"))
+	require.NoError(t, err)
+	assert.Equal(t, addr, srv.Addr().String())
+	for deadline := time.Now().Add(10 * time.Second); srv.Served() == 0; time.Sleep(10 * time.Millisecond) {
+		require.True(t, time.Now().Before(deadline), "served nothing")
+	}
+	require.NoError(t, srv.Close())
+	srv.Wait()
+}
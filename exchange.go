@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+)
+
+// The outcomes of receiving the peer's half of an exchange, sent as the payloads of exchange frames
+const (
+	exchangeAck  = "ack"
+	exchangeNack = "nack"
+)
+
+// exchangeLabel - the label of the fd ExchangeFD sends
+const exchangeLabel = "fd"
+
+// ErrExchangeFailed - returned by Exchange when the peer couldn't receive what was sent to it, in which case what the
+//                     peer sent (if anything) has been closed too
+var ErrExchangeFailed = errors.New("peer failed to receive its half of the exchange")
+
+// Exchange - sends b to the peer while receiving the bundle the peer sends with its own call to Exchange, for
+//            symmetric setup (say each side sending the other an eventfd), in one round trip
+//            each side tells the other whether it received the peer's half, and only hands it over once the peer
+//            says it received its own, so either both sides get the other's bundle or neither does (short of the
+//            conn failing between the two acknowledgements)
+//            if b can't be sent the conn is closed, as the peer may be waiting on a bundle which is never going to
+//            arrive (or arrive whole), so that its own call returns an error rather than waiting forever
+//            b still owns its dups afterwards, close them (b.Close()) once they are no longer needed
+func (s *UnixConn) Exchange(b *Bundle) (*Bundle, error) {
+	defer s.opts.profile("Exchange")()
+	sent := make(chan error, 1)
+	go func() { sent <- s.SendBundle(b) }()
+	received, recvErr := s.RecvBundle()
+	if sendErr := <-sent; sendErr != nil {
+		if received != nil {
+			_ = received.Close()
+		}
+		_ = s.Close()
+		return nil, sendErr
+	}
+
+	outcome := exchangeAck
+	if recvErr != nil {
+		outcome = exchangeNack
+	}
+	s.sendMu.Lock()
+	err := s.writeFrame(&frame{typ: frameExchange, payload: []byte(outcome)})
+	s.sendMu.Unlock()
+	if err == nil {
+		err = recvErr
+	}
+	if err == nil {
+		err = s.expectExchangeAck()
+	}
+	if err != nil {
+		if received != nil {
+			_ = received.Close()
+		}
+		return nil, err
+	}
+	return received, nil
+}
+
+// ExchangeFD - Exchange of a single fd, returning the fd the peer sent with its own call to ExchangeFD
+func (s *UnixConn) ExchangeFD(fd uintptr) (uintptr, error) {
+	b := NewBundle()
+	defer func() { _ = b.Close() }()
+	if err := b.Add(exchangeLabel, fd, nil); err != nil {
+		return 0, err
+	}
+	received, err := s.Exchange(b)
+	if err != nil {
+		return 0, err
+	}
+	item := received.Get(exchangeLabel)
+	if item == nil || len(received.Items) != 1 {
+		_ = received.Close()
+		return 0, errors.New("peer exchanged something other than a single fd")
+	}
+	// Hand the fd over without the finalizer of its *os.File closing it
+	newFd, err := dupFd(item.File.Fd())
+	_ = received.Close()
+	return newFd, err
+}
+
+// expectExchangeAck - waits for the peer to say whether it received its half of the exchange
+func (s *UnixConn) expectExchangeAck() error {
+	s.recvMu.Lock()
+	f, err := s.readFrame()
+	s.recvMu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "exchange failed waiting for the peer's acknowledgement")
+	}
+	closeFDs(f.fds)
+	switch {
+	case f.typ != frameExchange:
+		return errors.Errorf("received unexpected frame type %d while waiting for the peer's acknowledgement", f.typ)
+	case string(f.payload) != exchangeAck:
+		return ErrExchangeFailed
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestExchangeFD(t *testing.T) {
+	a, b := newUnixConnPair(t)
+	aFile, bFile, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = aFile.Close() }()
+	defer func() { _ = bFile.Close() }()
+
+	type result struct {
+		fd  uintptr
+		err error
+	}
+	bResult := make(chan result, 1)
+	go func() {
+		fd, err := b.ExchangeFD(bFile.Fd())
+		bResult <- result{fd, err}
+	}()
+	fromB, err := a.ExchangeFD(aFile.Fd())
+	require.NoError(t, err)
+	fromA := <-bResult
+	require.NoError(t, fromA.err)
+
+	same, err := oob.SameFile(fromB, bFile)
+	require.NoError(t, err)
+	assert.True(t, same)
+	same, err = oob.SameFile(fromA.fd, aFile)
+	require.NoError(t, err)
+	assert.True(t, same)
+	require.NoError(t, os.NewFile(fromB, "fromB").Close())
+	require.NoError(t, os.NewFile(fromA.fd, "fromA").Close())
+}
+
+func TestExchangeNeitherSide(t *testing.T) {
+	// b refuses bundles of more than one fd, so a's half can't be received
+	a, b := newUnixConnPair(t, oob.WithMaxPendingFDsPerConn(1))
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	aHalf := oob.NewBundle()
+	defer func() { _ = aHalf.Close() }()
+	require.NoError(t, aHalf.Add("one", f, nil))
+	require.NoError(t, aHalf.Add("two", f, nil))
+	bHalf := oob.NewBundle()
+	defer func() { _ = bHalf.Close() }()
+	require.NoError(t, bHalf.Add("one", f, nil))
+
+	bErr := make(chan error, 1)
+	go func() {
+		_, err := b.Exchange(bHalf)
+		bErr <- err
+	}()
+	received, err := a.Exchange(aHalf)
+	assert.Nil(t, received)
+	assert.True(t, errors.Is(err, oob.ErrExchangeFailed), "%+v", err)
+	assert.Error(t, <-bErr)
+}
+
+func TestExchangeSendFails(t *testing.T) {
+	// b may send no fds, so its half never reaches a
+	a, b := newUnixConnPair(t, oob.WithAuthorizer(func(oob.Credentials) error { return errors.New("refused") }))
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	aHalf := oob.NewBundle()
+	defer func() { _ = aHalf.Close() }()
+	require.NoError(t, aHalf.Add("one", f, nil))
+	bHalf := oob.NewBundle()
+	defer func() { _ = bHalf.Close() }()
+	require.NoError(t, bHalf.Add("one", f, nil))
+
+	aErr := make(chan error, 1)
+	go func() {
+		_, err := a.Exchange(aHalf)
+		aErr <- err
+	}()
+	_, err = b.Exchange(bHalf)
+	assert.True(t, errors.Is(err, oob.ErrUnauthorized), "%+v", err)
+	// a isn't left waiting for the half b couldn't send
+	select {
+	case err = <-aErr:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a is still waiting for b's half")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultInjection - faults for WithFaultInjection to inject into every sendmsg and recvmsg on a connection, each
+//                  probability is between 0 (never) and 1 (always)
+type FaultInjection struct {
+	// Delay - how long to sleep before each sendmsg and recvmsg
+	Delay time.Duration
+	// DropRights - the probability that a send goes out without its fds, as if a relay dropped the control message
+	DropRights float64
+	// TruncateRights - the probability that a receive is given no room for fds, so the kernel truncates the control
+	//                  message (MSG_CTRUNC) and the fds are lost
+	TruncateRights float64
+	// EINTR - the probability that an attempt at sendmsg or recvmsg is interrupted (EINTR) instead of being made,
+	//         which oob retries as it does real interruptions, so it must be below 1
+	EINTR float64
+	// TooManyRefs - the probability that an attempt at sendmsg fails with ETOOMANYREFS, as if too many fds were in
+	//               flight, which is otherwise hard to provoke (it can't be, as root)
+	TooManyRefs float64
+	// Seed - seeds the random choices, so a failing run can be reproduced
+	Seed int64
+}
+
+// WithFaultInjection - inject faults into the sends and receives of the connection, for chaos testing code built on
+//                      oob (handoffs in particular) without patching the library, never use it in production
+func WithFaultInjection(faults FaultInjection) Option {
+	return func(o *options) {
+		o.faults = &faultInjector{FaultInjection: faults, rand: rand.New(rand.NewSource(faults.Seed))} // #nosec G404
+	}
+}
+
+type faultInjector struct {
+	FaultInjection
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// chance - true with probability p
+func (f *faultInjector) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < p
+}
+
+// beforeSend - injects faults into a sendmsg of p and oob, returning what to send instead or an error to fail with
+func (f *faultInjector) beforeSend(p, oob []byte) ([]byte, []byte, error) {
+	if f == nil {
+		return p, oob, nil
+	}
+	time.Sleep(f.Delay)
+	if f.chance(f.EINTR) {
+		return nil, nil, syscall.EINTR
+	}
+	if len(oob) > 0 && f.chance(f.TooManyRefs) {
+		return nil, nil, syscall.ETOOMANYREFS
+	}
+	if len(oob) > 0 && f.chance(f.DropRights) {
+		if len(p) == 0 {
+			// The byte the fds would have been sent with
+			p = []byte{0}
+		}
+		oob = nil
+	}
+	return p, oob, nil
+}
+
+// beforeRecv - injects faults into a recvmsg into oob, returning the control buffer to use instead or an error to
+//              fail with
+func (f *faultInjector) beforeRecv(oob []byte) ([]byte, error) {
+	if f == nil {
+		return oob, nil
+	}
+	time.Sleep(f.Delay)
+	if f.chance(f.EINTR) {
+		return nil, syscall.EINTR
+	}
+	if len(oob) > 0 && f.chance(f.TruncateRights) {
+		oob = oob[:RightsBufferSize(0)]
+	}
+	return oob, nil
+}
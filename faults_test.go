@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestFaultInjection(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	// Interrupted sends and receives are retried, the caller never sees EINTR
+	eintrSender, eintr := newUnixConnPair(t, oob.WithFaultInjection(oob.FaultInjection{EINTR: 0.9, Seed: 1}))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, eintr.SendFD(r.Fd()))
+		fd, err := eintrSender.RecvFD()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Close(int(fd)))
+		require.NoError(t, eintrSender.SendFD(r.Fd()))
+		fd, err = eintr.RecvFD()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+
+	// Dropped control messages arrive as plain data
+	receiver, dropper := newUnixConnPair(t, oob.WithFaultInjection(oob.FaultInjection{DropRights: 1}))
+	require.NoError(t, dropper.SendFD(r.Fd()))
+	_, err = receiver.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrNoFD), "%+v", err)
+	// As before ErrNoFD
+	assert.True(t, errors.Is(err, syscall.EINVAL), "%+v", err)
+
+	// Truncated control messages lose their fds, without leaking them
+	sender, truncated := newUnixConnPair(t, oob.WithFaultInjection(oob.FaultInjection{TruncateRights: 1}))
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFDs(r.Fd(), w.Fd()))
+	_, err = truncated.RecvFDs(2)
+	assert.Error(t, err)
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs, after.OpenFDs)
+
+	// Delays
+	receiver, delayed := newUnixConnPair(t, oob.WithFaultInjection(oob.FaultInjection{Delay: 50 * time.Millisecond}))
+	start := time.Now()
+	require.NoError(t, delayed.SendFD(r.Fd()))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+}
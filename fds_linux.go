@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// openFDs - every fd open in this process, from /proc/self/fd
+func openFDs() ([]uintptr, error) {
+	fis, err := ioutil.ReadDir("/proc/self/fd/")
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]uintptr, 0, len(fis))
+	for _, fi := range fis {
+		// You may be asking yourself... why not just use fi.Sys().(*syscall.Stat_t).Ino, nil
+		// The answer is because /proc/self/fd/${fd} is a *link* to the file, with its own distinct Inode
+		fd64, err := strconv.ParseUint(fi.Name(), 10, 64)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		fds = append(fds, uintptr(fd64))
+	}
+	return fds, nil
+}
+
+func fdName(fd uintptr) string {
+	return fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), fd)
+}
+
+// fdPath - the /proc link target of fd, "" if it can't be read
+func fdPath(fd uintptr) string {
+	target, err := os.Readlink(fdName(fd))
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// anonInodeClass - the /proc link target of fd (such as "anon_inode:[eventfd]") if it is on an anonymous inode
+//                  filesystem, otherwise ""
+func anonInodeClass(fd uintptr) string {
+	if target := fdPath(fd); strings.HasPrefix(target, "anon_inode:") {
+		return target
+	}
+	return ""
+}
+
+// maxAncillaryBytes - net.core.optmem_max, the largest control message the kernel will accept, 0 if unknown
+func maxAncillaryBytes() int {
+	buf, err := ioutil.ReadFile("/proc/sys/net/core/optmem_max")
+	if err != nil {
+		return 0
+	}
+	optmem, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return 0
+	}
+	return optmem
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package oob
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// maxFDScan - the most fds openFDs will probe when RLIMIT_NOFILE is unlimited (or absurdly large)
+const maxFDScan = 1 << 16
+
+// openFDs - every fd open in this process
+//           the BSDs and darwin have no /proc/self/fd, so probe every fd below RLIMIT_NOFILE with fstat
+func openFDs() ([]uintptr, error) {
+	limit := &syscall.Rlimit{}
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, limit); err != nil {
+		return nil, err
+	}
+	n := uint64(limit.Cur)
+	if n > maxFDScan {
+		n = maxFDScan
+	}
+	var fds []uintptr
+	stat := &syscall.Stat_t{}
+	for fd := uint64(0); fd < n; fd++ {
+		if err := syscall.Fstat(int(fd), stat); err == nil {
+			fds = append(fds, uintptr(fd))
+		}
+	}
+	return fds, nil
+}
+
+func fdName(fd uintptr) string {
+	return fmt.Sprintf("/dev/fd/%d", fd)
+}
+
+// fdPath - without /proc there is no link target to read
+func fdPath(fd uintptr) string {
+	return ""
+}
+
+// anonInodeClass - without /proc there is no telling anonymous inodes apart
+func anonInodeClass(fd uintptr) string {
+	return ""
+}
+
+// maxAncillaryBytes - the largest control message the kernel will accept, 0 if unknown
+func maxAncillaryBytes() int {
+	return 0
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+// Frames are how the protocols layered on top of UnixConn (trees, bundles, ...) move bytes and fds together.
+// A frame is a single sendmsg(2) of a little endian header followed by the payload, with the fds of the frame
+// attached as SCM_RIGHTS:
+//
+//   | type uint8 | flags uint8 | nfds uint16 | length uint32 | payload (length bytes) |
+//
+// The receiver only ever reads exactly the bytes of one frame at a time, so the fds always arrive with the
+// header of the frame they were sent with.
+//
+// Every integer in a frame header or in the payloads built on top of frames is explicitly little endian (or text,
+// like the JSON of bundle manifests), never host order, so peers of different endianness interoperate.
+//
+// Windows has no SCM_RIGHTS, so there the sender duplicates each fd (handle) straight into the peer process instead,
+// and the values of the duplicates follow the header in band, 8 bytes each, before the payload:
+//
+//   | type uint8 | flags uint8 | nfds uint16 | length uint32 | handles (nfds * uint64) | payload (length bytes) |
+
+type frameType uint8
+
+const (
+	frameTreeEntry frameType = iota + 1
+	frameTreeEnd
+	frameBundleManifest
+	frameBundleFDs
+	framePing
+	framePong
+	frameCodecs
+	frameShutdown
+	frameTakeover
+	frameExchange
+	frameNamedFDs
+	frameTreeAbort
+)
+
+const (
+	// frameFlagMemfd - the frame's payload was offloaded into a sealed memfd, which is the last fd of the frame, and
+	//                  what is sent in band is only the length of the payload (uint64)
+	frameFlagMemfd uint8 = 1 << 0
+	// frameFlagCompressed - the frame's payload was compressed with a Codec the peer advertised, see WithCompression
+	frameFlagCompressed uint8 = 1 << 1
+	// frameFlagChecksum - the frame's payload ends with the CRC32C of the frame, see WithChecksums
+	frameFlagChecksum uint8 = 1 << 2
+)
+
+const (
+	frameHeaderLen = 8
+	// maxFrameLen - the largest payload a frame may carry, so a malformed (or malicious) header can't make the
+	//               receiver allocate up to 4GiB
+	maxFrameLen = 16 << 20
+	// maxFDsPerMessage - SCM_MAX_FD, the most fds the kernel will accept in a single SCM_RIGHTS message, and the
+	//                    most fds in a frame on every platform
+	maxFDsPerMessage = 253
+)
+
+type frame struct {
+	typ     frameType
+	flags   uint8
+	payload []byte
+	fds     []int
+}
+
+// readFrame - receives the next frame, callers must hold s.recvMu for as long as their frames need to stay together
+//             pings and pongs are handled along the way and never returned
+func (s *UnixConn) readFrame() (*frame, error) {
+	if len(s.pending) > 0 {
+		f := s.pending[0]
+		s.pending = s.pending[1:]
+		return f, nil
+	}
+	for {
+		f, err := s.readAnyFrame()
+		if err != nil {
+			return nil, err
+		}
+		if handled, err := s.handleControlFrame(f); handled {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return f, nil
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// TestFrameWireFormat - the frame header must be little endian on every platform, so check it byte by byte
+func TestFrameWireFormat(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendBundle(oob.NewBundle()) }()
+
+	manifest := `{"items":null}`
+	buf := make([]byte, 8+len(manifest))
+	_, err := io.ReadFull(receiver, buf)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	// type 3 (bundle manifest), flags 0, nfds 0, length
+	assert.Equal(t, []byte{3, 0, 0, 0, byte(len(manifest)), 0, 0, 0}, buf[:8])
+	assert.Equal(t, manifest, string(buf[8:]))
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	// A bundle manifest header announcing a 4GiB payload
+	_, err := sender.Write([]byte{3, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+	require.NoError(t, err)
+	_, err = receiver.RecvBundle()
+	assert.Error(t, err)
+}
+
+func TestMalformedBundleManifest(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	// A bundle manifest whose only item is null
+	manifest := `{"items":[null]}`
+	_, err := sender.Write(append([]byte{3, 0, 0, 0, byte(len(manifest)), 0, 0, 0}, manifest...))
+	require.NoError(t, err)
+	require.NoError(t, sender.CloseWrite())
+	_, err = receiver.RecvBundle()
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"encoding/binary"
+	"io"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// writeFrame - sends f, callers must hold s.sendMu for as long as their frames need to stay together
+func (s *UnixConn) writeFrame(f *frame) error {
+	defer s.watch("writeFrame", true)()
+	f, err := s.compress(f)
+	if err != nil {
+		return err
+	}
+	f = s.addChecksum(f)
+	inline := f
+	if f, err = s.offload(f); err != nil {
+		return err
+	}
+	if f != inline {
+		defer closeFDs(f.fds[len(f.fds)-1:])
+	}
+	if len(f.fds) > maxFDsPerMessage {
+		return errors.Errorf("cannot send %d fds in one frame, the limit is %d", len(f.fds), maxFDsPerMessage)
+	}
+	if len(f.payload) > maxFrameLen {
+		return errors.Errorf("cannot send a %d byte frame, the limit is %d", len(f.payload), maxFrameLen)
+	}
+	buf := make([]byte, frameHeaderLen+len(f.payload))
+	buf[0] = byte(f.typ)
+	buf[1] = f.flags
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(f.fds)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(f.payload)))
+	copy(buf[frameHeaderLen:], f.payload)
+	var rights []byte
+	if len(f.fds) > 0 {
+		rights = syscall.UnixRights(f.fds...)
+	}
+
+	n, err := s.sendmsg(buf, rights)
+	if err != nil {
+		return err
+	}
+	// The fds went with the first byte, if the kernel took less than the whole frame the rest is plain data
+	if n < len(buf) {
+		if _, err := s.UnixConn.Write(buf[n:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAnyFrame - receives the next frame off the socket, whatever its type
+func (s *UnixConn) readAnyFrame() (*frame, error) {
+	defer s.watch("readFrame", false)()
+	readFrame := s.readFrameStream
+	if s.packets {
+		readFrame = s.readFramePacket
+	}
+	header, payload, fds, err := readFrame()
+	if err != nil {
+		closeFDs(fds)
+		return nil, err
+	}
+	f := &frame{
+		typ:     frameType(header[0]),
+		flags:   header[1],
+		payload: payload,
+		fds:     fds,
+	}
+	if nfds := int(binary.LittleEndian.Uint16(header[2:])); nfds != len(f.fds) {
+		closeFDs(f.fds)
+		return nil, errors.Errorf("frame announced %d fds but %d were received", nfds, len(f.fds))
+	}
+	if err = reassemble(f); err != nil {
+		closeFDs(f.fds)
+		return nil, err
+	}
+	if err = verifyChecksum(f); err != nil {
+		closeFDs(f.fds)
+		return nil, err
+	}
+	if err = s.decompress(f); err != nil {
+		closeFDs(f.fds)
+		return nil, err
+	}
+	return f, nil
+}
+
+// peekFrameType - the type of the frame which is next to be received, without receiving anything, false unless its
+//                 whole header has already arrived
+func (s *UnixConn) peekFrameType() (frameType, bool) {
+	if readable, err := s.waitReadable(0); err != nil || !readable {
+		return 0, false
+	}
+	header := make([]byte, frameHeaderLen)
+	n, _, _, err := s.recvmsg(header, nil, syscall.MSG_PEEK)
+	if err != nil || n < frameHeaderLen {
+		return 0, false
+	}
+	return frameType(header[0]), true
+}
+
+// readFrameStream - receives the next frame from a byte stream, its header and then as much again as it announces
+func (s *UnixConn) readFrameStream() (header []byte, payload []byte, fds []int, err error) {
+	header = make([]byte, frameHeaderLen)
+	if fds, err = s.readFull(header, nil); err != nil {
+		return nil, nil, fds, err
+	}
+	length := binary.LittleEndian.Uint32(header[4:])
+	if length > maxFrameLen {
+		return nil, nil, fds, errors.Errorf("received a frame header announcing %d bytes, the limit is %d", length, maxFrameLen)
+	}
+	payload = make([]byte, length)
+	fds, err = s.readFull(payload, fds)
+	return header, payload, fds, err
+}
+
+// readFull - reads exactly len(p) bytes, appending any fds which arrive with them to fds
+func (s *UnixConn) readFull(p []byte, fds []int) ([]int, error) {
+	oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+	for off := 0; off < len(p); {
+		n, oobn, _, err := s.recvmsg(p[off:], oob, 0)
+		if oobn > 0 {
+			rights, parseErr := parseRights(oob[:oobn])
+			fds = append(fds, rights...)
+			if parseErr != nil && err == nil {
+				err = parseErr
+			}
+		}
+		if err != nil {
+			return fds, err
+		}
+		if n == 0 {
+			if off == 0 {
+				return fds, io.EOF
+			}
+			return fds, io.ErrUnexpectedEOF
+		}
+		off += n
+	}
+	return fds, nil
+}
+
+// parseRights - all of the fds in all of the SCM_RIGHTS messages in oob
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for i := range msgs {
+		if msgs[i].Header.Level != syscall.SOL_SOCKET || msgs[i].Header.Type != syscall.SCM_RIGHTS {
+			continue
+		}
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			return fds, err
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
+
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		_ = syscall.Close(fd)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// writeFrame - sends f, duplicating its fds into the peer, callers must hold s.sendMu for as long as their frames need
+//              to stay together
+func (s *UnixConn) writeFrame(f *frame) error {
+	f, err := s.compress(f)
+	if err != nil {
+		return err
+	}
+	f = s.addChecksum(f)
+	if len(f.fds) > maxFDsPerMessage {
+		return errors.Errorf("cannot send %d fds in one frame, the limit is %d", len(f.fds), maxFDsPerMessage)
+	}
+	if len(f.payload) > maxFrameLen {
+		return errors.Errorf("cannot send a %d byte frame, the limit is %d", len(f.payload), maxFrameLen)
+	}
+	buf := make([]byte, frameHeaderLen+handleLen*len(f.fds)+len(f.payload))
+	buf[0] = byte(f.typ)
+	buf[1] = f.flags
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(f.fds)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(f.payload)))
+	copy(buf[frameHeaderLen+handleLen*len(f.fds):], f.payload)
+	if len(f.fds) == 0 {
+		_, err = s.Conn.Write(buf)
+		return err
+	}
+
+	peer, err := s.openPeer()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = windows.CloseHandle(peer) }()
+	self := windows.CurrentProcess()
+	dups := make([]windows.Handle, 0, len(f.fds))
+	// The peer will never learn about the duplicates unless the whole frame is written, so close them in the peer
+	closeDups := func() {
+		for _, dup := range dups {
+			_ = windows.DuplicateHandle(peer, dup, 0, nil, 0, false, windows.DUPLICATE_CLOSE_SOURCE)
+		}
+	}
+	for i, fd := range f.fds {
+		var dup windows.Handle
+		if err := windows.DuplicateHandle(self, windows.Handle(fd), peer, &dup, 0, false, windows.DUPLICATE_SAME_ACCESS); err != nil {
+			closeDups()
+			return errors.Wrapf(err, "unable to duplicate handle %d into the peer", fd)
+		}
+		dups = append(dups, dup)
+		binary.LittleEndian.PutUint64(buf[frameHeaderLen+handleLen*i:], uint64(dup))
+	}
+	if n, err := s.Conn.Write(buf); err != nil {
+		if n < frameHeaderLen+handleLen*len(f.fds) {
+			closeDups()
+		}
+		return err
+	}
+	return nil
+}
+
+// readAnyFrame - receives the next frame off the conn, whatever its type
+func (s *UnixConn) readAnyFrame() (*frame, error) {
+	header := make([]byte, frameHeaderLen)
+	if _, err := io.ReadFull(s.Conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[4:])
+	nfds := int(binary.LittleEndian.Uint16(header[2:]))
+	handles := make([]byte, handleLen*nfds)
+	if _, err := io.ReadFull(s.Conn, handles); err != nil {
+		// Whatever handles did arrive were already duplicated into us
+		closeFDs(parseHandles(handles))
+		return nil, unexpectedEOF(err)
+	}
+	f := &frame{
+		typ:   frameType(header[0]),
+		flags: header[1],
+		fds:   parseHandles(handles),
+	}
+	if length > maxFrameLen || nfds > maxFDsPerMessage {
+		closeFDs(f.fds)
+		return nil, errors.Errorf("received a frame header announcing %d bytes and %d handles, the limits are %d and %d",
+			length, nfds, maxFrameLen, maxFDsPerMessage)
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(s.Conn, f.payload); err != nil {
+		closeFDs(f.fds)
+		return nil, unexpectedEOF(err)
+	}
+	if err := verifyChecksum(f); err != nil {
+		closeFDs(f.fds)
+		return nil, err
+	}
+	if err := s.decompress(f); err != nil {
+		closeFDs(f.fds)
+		return nil, err
+	}
+	return f, nil
+}
+
+// peekFrameType - named pipes and sockets can't be peeked at a frame boundary here, so the peer's codecs are only
+//                 learned as its frames are received
+func (s *UnixConn) peekFrameType() (frameType, bool) {
+	return 0, false
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func parseHandles(b []byte) []int {
+	var fds []int
+	for ; len(b) >= handleLen; b = b[handleLen:] {
+		if h := binary.LittleEndian.Uint64(b); h != 0 {
+			fds = append(fds, int(h))
+		}
+	}
+	return fds
+}
+
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		_ = windows.CloseHandle(windows.Handle(fd))
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// NewFromFD - the *UnixConn (with opts) for fd, such as one inherited through exec.Cmd's ExtraFiles or socket
+//             activation, after checking that it is a connected unix stream (or seqpacket) socket
+//             it takes over fd, which is closed whether or not it succeeds, the conn having its own dup
+func NewFromFD(fd uintptr, opts ...Option) (*UnixConn, error) {
+	file := os.NewFile(fd, fdName(fd))
+	defer func() { _ = file.Close() }()
+	return NewFromFile(file, opts...)
+}
+
+// NewFromFile - the *UnixConn (with opts) for file, after checking that it is a connected unix stream (or
+//               seqpacket) socket, file remains the caller's to close, the conn has its own dup
+func NewFromFile(file *os.File, opts ...Option) (*UnixConn, error) {
+	rawConn, err := file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	if err := rawConn.Control(func(fd uintptr) { err = checkUnixConnFD(fd) }); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to use %s as a connection", file.Name())
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.Errorf("%s is a %s connection rather than a unix one", file.Name(), conn.LocalAddr().Network())
+	}
+	return NewUnixConn(unixConn, opts...), nil
+}
+
+// checkUnixConnFD - an error describing fd unless it is a connected unix stream (or seqpacket) socket
+func checkUnixConnFD(fd uintptr) error {
+	const want = "a connected unix stream socket"
+	if err := checkSocket(fd, fmt.Sprintf("fd %d is", fd), want, false, unix.SOCK_STREAM, unix.SOCK_SEQPACKET); err != nil {
+		return err
+	}
+	if family := socketFamilyName(fd); family != "unix" {
+		return errors.Errorf("fd %d is a %s socket rather than %s", fd, family, want)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestNewFromFD(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	a, err := oob.NewFromFD(uintptr(fds[0]))
+	require.NoError(t, err)
+	defer func() { _ = a.Close() }()
+	peer := os.NewFile(uintptr(fds[1]), "peer")
+	b, err := oob.NewFromFile(peer)
+	require.NoError(t, err)
+	defer func() { _ = b.Close() }()
+	// The file is still the caller's
+	require.NoError(t, peer.Close())
+
+	require.NoError(t, a.SendFD(os.Stdin.Fd()))
+	fd, err := b.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+
+	// Anything else is refused, with a description of what it is
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	_, err = oob.NewFromFile(r)
+	assert.EqualError(t, err, fmt.Sprintf("fd %d is a fifo rather than a connected unix stream socket", r.Fd()))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	file, err := oob.DupFile(listener)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	_, err = oob.NewFromFile(file)
+	assert.EqualError(t, err, fmt.Sprintf("fd %d is a listening inet stream socket rather than a connected unix stream socket", file.Fd()))
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrGroupClosed - returned when receiving into a Group which has been closed
+var ErrGroupClosed = errors.New("fd group is closed")
+
+// Group - a named cleanup group of fds received on a conn, closing the group (or the conn) closes every fd
+//         received under it which the application has not closed itself, so a long lived broker does not leak
+//         the fds of a session which ended without cleaning up after itself
+type Group struct {
+	name string
+	conn *UnixConn
+
+	mu     sync.Mutex
+	fds    map[*FD]struct{}
+	closed bool
+}
+
+// groups - the open Groups of a conn by name
+type groups struct {
+	mu     sync.Mutex
+	byName map[string]*Group
+}
+
+// Group - the open cleanup group called name, created on first use, once closed the next call starts a new one
+func (s *UnixConn) Group(name string) *Group {
+	s.groups.mu.Lock()
+	defer s.groups.mu.Unlock()
+	if g, ok := s.groups.byName[name]; ok {
+		return g
+	}
+	if s.groups.byName == nil {
+		s.groups.byName = make(map[string]*Group)
+	}
+	g := &Group{name: name, conn: s, fds: make(map[*FD]struct{})}
+	s.groups.byName[name] = g
+	return g
+}
+
+// Name - the name of the group
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Len - how many fds received under the group are still open
+func (g *Group) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.fds)
+}
+
+// RecvFD - like RecvManagedFD, with the FD closed when the group is
+func (g *Group) RecvFD() (*FD, error) {
+	fd, err := g.conn.RecvManagedFD()
+	if err != nil {
+		return nil, err
+	}
+	if err := g.add(fd); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+// RecvFDs - like RecvManagedFDs, with the FDs closed when the group is
+func (g *Group) RecvFDs(n int) ([]*FD, error) {
+	fds, err := g.conn.RecvManagedFDs(n)
+	if err != nil {
+		return nil, err
+	}
+	for i, fd := range fds {
+		if err := g.add(fd); err != nil {
+			for _, fd := range fds[i+1:] {
+				_ = fd.Close()
+			}
+			return nil, err
+		}
+	}
+	return fds, nil
+}
+
+// Close - closes every fd of the group which is still open, and removes the group from its conn
+func (g *Group) Close() error {
+	g.conn.groups.mu.Lock()
+	if g.conn.groups.byName[g.name] == g {
+		delete(g.conn.groups.byName, g.name)
+	}
+	g.conn.groups.mu.Unlock()
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return errors.WithStack(ErrGroupClosed)
+	}
+	g.closed = true
+	fds := make([]*FD, 0, len(g.fds))
+	for fd := range g.fds {
+		fds = append(fds, fd)
+	}
+	g.mu.Unlock()
+
+	var err error
+	for _, fd := range fds {
+		if closeErr := fd.Close(); closeErr != nil && err == nil {
+			err = errors.Wrapf(closeErr, "unable to close fd %d of group %q", fd.Fd(), g.name)
+		}
+	}
+	return err
+}
+
+// add - tracks fd until it is closed, closing it straight away if the group already has been
+func (g *Group) add(fd *FD) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		_ = fd.Close()
+		return errors.Wrapf(ErrGroupClosed, "group %q closed while receiving fd %d", g.name, fd.Fd())
+	}
+	g.fds[fd] = struct{}{}
+	release := fd.release
+	fd.release = func() {
+		release()
+		g.mu.Lock()
+		delete(g.fds, fd)
+		g.mu.Unlock()
+	}
+	g.mu.Unlock()
+	return nil
+}
+
+// closeAll - closes every group of the conn, when the conn is closed
+func (gs *groups) closeAll() {
+	gs.mu.Lock()
+	all := make([]*Group, 0, len(gs.byName))
+	for _, g := range gs.byName {
+		all = append(all, g)
+	}
+	gs.mu.Unlock()
+	for _, g := range all {
+		_ = g.Close()
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestGroup(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFile(f))
+	require.NoError(t, sender.SendFDs(f.Fd(), f.Fd()))
+
+	session := receiver.Group("session-42")
+	assert.Same(t, session, receiver.Group("session-42"))
+	assert.Equal(t, "session-42", session.Name())
+	fd, err := session.RecvFD()
+	require.NoError(t, err)
+	fds, err := session.RecvFDs(2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, session.Len())
+	assert.Equal(t, 3, receiver.LiveFDs())
+
+	// Closing an fd itself takes it out of the group
+	require.NoError(t, fd.Close())
+	assert.Equal(t, 2, session.Len())
+
+	// Closing the group closes the rest
+	require.NoError(t, session.Close())
+	assert.Equal(t, 0, session.Len())
+	assert.Equal(t, 0, receiver.LiveFDs())
+	for _, fd := range fds {
+		var stat syscall.Stat_t
+		assert.Equal(t, syscall.EBADF, syscall.Fstat(int(fd.Fd()), &stat))
+	}
+	assert.Error(t, session.Close())
+
+	// The name is free again
+	require.NoError(t, sender.SendFile(f))
+	_, err = session.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrGroupClosed), "%+v", err)
+	assert.NotSame(t, session, receiver.Group("session-42"))
+}
+
+func TestGroupClosedWithConn(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFile(f))
+	require.NoError(t, sender.SendFile(f))
+
+	a, err := receiver.Group("a").RecvFD()
+	require.NoError(t, err)
+	b, err := receiver.Group("b").RecvFD()
+	require.NoError(t, err)
+
+	require.NoError(t, receiver.Close())
+	assert.Equal(t, 0, receiver.LiveFDs())
+	assert.Error(t, a.Close())
+	assert.Error(t, b.Close())
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Bundle labels used by SendListenerHandoff
+const (
+	handoffListenerLabel = "listener"
+	handoffConnPrefix    = "conn/"
+	// handoffDryRunKey - metadata of the listener of a SendListenerHandoffDryRun, so a real receiver refuses it
+	handoffDryRunKey = "oob.dryrun"
+	// handoffDescribePrefix - metadata keys describing an fd as the sender saw it, for RecvListenerHandoffDryRun
+	handoffDescribePrefix = "oob.fd."
+)
+
+// SendListenerHandoff - sends listener along with every connection already waiting in its accept queue, so that no
+//                       client is stranded when the process on the other end takes over accepting
+//                       the caller should stop calling Accept on listener before handing it off, and close listener
+//                       (which the peer keeps open) afterwards, once the handoff succeeds closing it will no longer
+//                       remove its socket file, if it fails listener is left as it was, and any connections already
+//                       taken off its accept queue are given back in a *HandoffError
+func (s *UnixConn) SendListenerHandoff(listener net.Listener) error {
+	defer s.opts.profile("SendListenerHandoff")()
+	return s.sendListenerHandoff(listener, nil, nil)
+}
+
+// SendListenerHandoffWithState - SendListenerHandoff, also carrying application state (sessions, config, ...) by
+//                                label, encoded with codec, for RecvListenerHandoffWithState
+//                                state labeled "listener" is associated with the listener
+func (s *UnixConn) SendListenerHandoffWithState(listener net.Listener, codec StateCodec, state map[string]interface{}) error {
+	defer s.opts.profile("SendListenerHandoffWithState")()
+	return s.sendListenerHandoff(listener, codec, state)
+}
+
+func (s *UnixConn) sendListenerHandoff(listener net.Listener, codec StateCodec, state map[string]interface{}) error {
+	fd, err := ToFd(listener)
+	if err != nil {
+		return err
+	}
+	b := NewBundle()
+	defer func() { _ = b.Close() }()
+	if err = b.Add(handoffListenerLabel, listener, nil); err != nil {
+		return err
+	}
+	for label, v := range state {
+		if err = b.SetState(label, codec, v); err != nil {
+			return err
+		}
+	}
+	if err = drainAcceptQueue(fd, b); err == nil {
+		err = s.SendBundle(b)
+	}
+	if err != nil {
+		if conns := drainedConns(b); len(conns) > 0 {
+			return &HandoffError{Conns: conns, Err: err}
+		}
+		return err
+	}
+	keepSocketFile(listener)
+	return nil
+}
+
+// HandoffError - returned when a handoff fails after connections were taken off the accept queue of the listener,
+//                which can't be put back on it, so Conns gives them back to the caller to serve (or close) rather than
+//                dropping the very clients the handoff exists to keep
+type HandoffError struct {
+	Conns []net.Conn
+	Err   error
+}
+
+func (e *HandoffError) Error() string {
+	return fmt.Sprintf("handoff failed with %d connections taken off the accept queue: %s", len(e.Conns), e.Err)
+}
+
+// Cause - the error which stopped the handoff
+func (e *HandoffError) Cause() error { return e.Err }
+
+// Unwrap - the error which stopped the handoff
+func (e *HandoffError) Unwrap() error { return e.Err }
+
+// drainedConns - the connections drainAcceptQueue put into b, as net.Conns of their own (b still closes its dups)
+func drainedConns(b *Bundle) []net.Conn {
+	var conns []net.Conn
+	for _, item := range b.Items {
+		if !strings.HasPrefix(item.Label, handoffConnPrefix) {
+			continue
+		}
+		if conn, err := net.FileConn(item.File); err == nil {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// drainAcceptQueue - accepts every connection waiting on the listening socket fd into b, without blocking
+func drainAcceptQueue(fd uintptr, b *Bundle) error {
+	for i := 0; ; i++ {
+		// The listener is already non-blocking, so EAGAIN means the queue is drained
+		connFd, sa, err := unix.Accept(int(fd))
+		if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
+			return nil
+		}
+		if err == unix.EINTR || err == unix.ECONNABORTED {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to drain the accept queue")
+		}
+		unix.CloseOnExec(connFd)
+		var metadata map[string]string
+		if remote := sockaddrString(sa); remote != "" {
+			metadata = map[string]string{"remote": remote}
+		}
+		// The bundle keeps its own dup
+		err = b.Add(handoffConnPrefix+strconv.Itoa(i), uintptr(connFd), metadata)
+		_ = unix.Close(connFd)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unlinker - a listener which can be stopped removing its socket file when closed, a *net.UnixListener or a
+//            socketFileListener
+type unlinker interface {
+	SetUnlinkOnClose(unlink bool)
+}
+
+// keepSocketFile - stops listener removing its socket file when closed, once it belongs to the peer
+func keepSocketFile(listener net.Listener) {
+	for i, inner := 0, interface{}(listener); inner != nil && i < maxUnwrapDepth; i, inner = i+1, unwrap(inner) {
+		if l, ok := inner.(unlinker); ok {
+			l.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// RecvListenerHandoff - receives a listener sent with SendListenerHandoff along with the connections which were
+//                       waiting in its accept queue, which should be served before calling Accept on the listener
+//                       Accept on the returned listener (and the returned conns) produce oob.UnixConns for unix sockets
+func (s *UnixConn) RecvListenerHandoff() (net.Listener, []net.Conn, error) {
+	defer s.opts.profile("RecvListenerHandoff")()
+	return s.recvListenerHandoff(nil, nil)
+}
+
+// RecvListenerHandoffWithState - RecvListenerHandoff, also decoding the state sent with SendListenerHandoffWithState
+//                                with codec into the values of state (pointers) by label
+//                                labels the sender sent no state for are left untouched, state for labels not in
+//                                state is ignored
+func (s *UnixConn) RecvListenerHandoffWithState(codec StateCodec, state map[string]interface{}) (net.Listener, []net.Conn, error) {
+	defer s.opts.profile("RecvListenerHandoffWithState")()
+	return s.recvListenerHandoff(codec, state)
+}
+
+func (s *UnixConn) recvListenerHandoff(codec StateCodec, state map[string]interface{}) (net.Listener, []net.Conn, error) {
+	b, err := s.RecvBundle()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = b.Close() }()
+	item := b.Get(handoffListenerLabel)
+	if item == nil {
+		return nil, nil, errors.New("received a handoff without a listener")
+	}
+	if item.Metadata[handoffDryRunKey] != "" {
+		return nil, nil, errors.New("received a dry run handoff, which is for RecvListenerHandoffDryRun")
+	}
+	for label, v := range state {
+		if _, err = b.DecodeState(label, codec, v); err != nil {
+			return nil, nil, err
+		}
+	}
+	listener, err := net.FileListener(item.File)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "received listener is not a listening socket")
+	}
+	conns, err := s.handoffConns(b)
+	if err != nil {
+		_ = listener.Close()
+		return nil, nil, err
+	}
+	return newListener(listener, s.opts.all...), conns, nil
+}
+
+// handoffConns - the connections of a handoff bundle, as UnixConns for unix sockets
+func (s *UnixConn) handoffConns(b *Bundle) ([]net.Conn, error) {
+	var conns []net.Conn
+	for _, item := range b.Items {
+		if !strings.HasPrefix(item.Label, handoffConnPrefix) {
+			continue
+		}
+		conn, err := net.FileConn(item.File)
+		if err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, errors.Wrapf(err, "received %s is not a connection", item.Label)
+		}
+		if unixConn, ok := conn.(*net.UnixConn); ok {
+			conn = NewUnixConn(unixConn, s.opts.all...)
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// HandoffReport - what RecvListenerHandoffDryRun found, Diffs is empty if the handoff would have succeeded
+type HandoffReport struct {
+	// Items - how many fds were received
+	Items int
+	// Diffs - every difference between the fds as the sender described them and as they were received (kinds,
+	//         counts, socket options, identities), one line each
+	Diffs []string
+}
+
+// OK - whether the dry run found no differences
+func (r *HandoffReport) OK() bool {
+	return len(r.Diffs) == 0
+}
+
+// SendListenerHandoffDryRun - rehearses SendListenerHandoff: sends listener, along with a description of it (kind,
+//                             identity, socket options), to a peer calling RecvListenerHandoffDryRun
+//                             unlike the real thing it leaves the accept queue alone, and listener keeps its socket
+//                             file, so it can be run against a live listener ahead of a zero downtime upgrade
+func (s *UnixConn) SendListenerHandoffDryRun(listener net.Listener) error {
+	defer s.opts.profile("SendListenerHandoffDryRun")()
+	fd, err := ToFd(listener)
+	if err != nil {
+		return err
+	}
+	metadata := describeHandoffFD(fd)
+	metadata[handoffDryRunKey] = "true"
+	metadata[handoffDescribePrefix+"items"] = "1"
+	b := NewBundle()
+	defer func() { _ = b.Close() }()
+	if err = b.Add(handoffListenerLabel, listener, metadata); err != nil {
+		return err
+	}
+	return s.SendBundle(b)
+}
+
+// RecvListenerHandoffDryRun - receives a handoff as RecvListenerHandoff would, but only validates it against the
+//                             sender's description, reporting any difference, and closes everything it received
+//                             rather than taking ownership of it
+//                             pair it with SendListenerHandoffDryRun, a real handoff received here is validated too,
+//                             but its listener and queued connections are then closed
+func (s *UnixConn) RecvListenerHandoffDryRun() (*HandoffReport, error) {
+	defer s.opts.profile("RecvListenerHandoffDryRun")()
+	b, err := s.RecvBundle()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = b.Close() }()
+	report := &HandoffReport{Items: len(b.Items)}
+	item := b.Get(handoffListenerLabel)
+	if item == nil {
+		report.Diffs = append(report.Diffs, "no listener was received")
+		return report, nil
+	}
+	if want := item.Metadata[handoffDescribePrefix+"items"]; want != "" && want != strconv.Itoa(len(b.Items)) {
+		report.Diffs = append(report.Diffs, fmt.Sprintf("items: sent %s, received %d", want, len(b.Items)))
+	}
+	if item.Metadata[handoffDryRunKey] == "" {
+		report.Diffs = append(report.Diffs, "received a real handoff, not a dry run")
+	}
+	for _, received := range b.Items {
+		if received.File == nil {
+			report.Diffs = append(report.Diffs, fmt.Sprintf("%s: no fd was received", received.Label))
+			continue
+		}
+		got := describeHandoffFD(received.File.Fd())
+		if received.Kind != got[handoffDescribePrefix+"kind"] {
+			report.Diffs = append(report.Diffs, fmt.Sprintf("%s: kind sent %s, received %s", received.Label, received.Kind, got[handoffDescribePrefix+"kind"]))
+		}
+		var keys []string
+		for key := range received.Metadata {
+			if strings.HasPrefix(key, handoffDescribePrefix) && key != handoffDescribePrefix+"items" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if want := received.Metadata[key]; got[key] != want {
+				report.Diffs = append(report.Diffs, fmt.Sprintf("%s: %s sent %q, received %q", received.Label, strings.TrimPrefix(key, handoffDescribePrefix), want, got[key]))
+			}
+		}
+	}
+	if item.File != nil {
+		// net.FileListener makes a dup of its own, which is closed again (and doesn't remove the socket file)
+		listener, err := net.FileListener(item.File)
+		if err != nil {
+			report.Diffs = append(report.Diffs, fmt.Sprintf("listener: not usable as a listener: %s", err))
+		} else {
+			_ = listener.Close()
+		}
+	}
+	return report, nil
+}
+
+// describeHandoffFD - what RecvListenerHandoffDryRun checks about fd: its kind and identity and, for sockets, the
+//                     socket type and options and the address it is bound to
+func describeHandoffFD(fd uintptr) map[string]string {
+	description := map[string]string{}
+	if kind, err := fdKind(fd); err == nil {
+		description[handoffDescribePrefix+"kind"] = kind
+	}
+	if id, err := fileIdentity(fd); err == nil {
+		description[handoffDescribePrefix+"dev"] = strconv.FormatUint(id.Dev, 10)
+		description[handoffDescribePrefix+"inode"] = strconv.FormatUint(id.Inode, 10)
+	}
+	if description[handoffDescribePrefix+"kind"] != KindSocket {
+		return description
+	}
+	for name, opt := range map[string]int{
+		"type":      unix.SO_TYPE,
+		"listening": unix.SO_ACCEPTCONN,
+		"reuseaddr": unix.SO_REUSEADDR,
+	} {
+		if value, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, opt); err == nil {
+			description[handoffDescribePrefix+name] = strconv.Itoa(value)
+		}
+	}
+	if sa, err := unix.Getsockname(int(fd)); err == nil {
+		description[handoffDescribePrefix+"addr"] = sockaddrString(sa)
+	}
+	return description
+}
+
+// sockaddrString - the address of sa, or "" for unnamed and unknown addresses
+func sockaddrString(sa unix.Sockaddr) string {
+	switch sa := sa.(type) {
+	case *unix.SockaddrUnix:
+		return sa.Name
+	case *unix.SockaddrInet4:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *unix.SockaddrInet6:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	}
+	return ""
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestListenerHandoff(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dirname) }()
+	socketfilename := filepath.Join(dirname, "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+
+	// Two clients waiting in the accept queue
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("unix", socketfilename)
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+		clients = append(clients, client)
+	}
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendListenerHandoff(listener) }()
+	received, conns, err := receiver.RecvListenerHandoff()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	require.NoError(t, listener.Close())
+	defer func() { _ = received.Close() }()
+
+	require.Len(t, conns, 2)
+	for i, conn := range conns {
+		assert.IsType(t, &oob.UnixConn{}, conn)
+		_, err = clients[i].Write([]byte{byte(i)})
+		require.NoError(t, err)
+		buf := make([]byte, 1)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, byte(i), buf[0])
+		_ = conn.Close()
+	}
+
+	// And the listener keeps accepting
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := received.Accept()
+	require.NoError(t, err)
+	assert.IsType(t, &oob.UnixConn{}, conn)
+	_ = conn.Close()
+}
+
+func TestListenerHandoffKeepsSocketFile(t *testing.T) {
+	socketfilename := filepath.Join(t.TempDir(), "socket")
+	// Bound somewhere else and linked into place, so the socket file is removed by oob rather than net
+	listener, err := oob.Listen("unix", socketfilename, oob.WithSocketMode(0o600))
+	require.NoError(t, err)
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendListenerHandoff(listener) }()
+	received, _, err := receiver.RecvListenerHandoff()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	defer func() { _ = received.Close() }()
+
+	// Closing the old process's copy leaves the socket file to the new one
+	require.NoError(t, listener.Close())
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := received.Accept()
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestListenerHandoffFailureKeepsListener(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dirname) }()
+	socketfilename := filepath.Join(dirname, "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, receiver.Close())
+	require.NoError(t, sender.CloseWrite())
+	require.Error(t, sender.SendListenerHandoff(listener))
+
+	// Still ours, so closing it still removes the socket file
+	require.NoError(t, listener.Close())
+	_, err = os.Stat(socketfilename)
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
+
+func TestListenerHandoffFailureReturnsConns(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dirname) }()
+	socketfilename := filepath.Join(dirname, "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, receiver.Close())
+	require.NoError(t, sender.CloseWrite())
+	err = sender.SendListenerHandoff(listener)
+	var handoffErr *oob.HandoffError
+	require.True(t, errors.As(err, &handoffErr), "%v", err)
+
+	// The client taken off the accept queue is given back rather than dropped
+	require.Len(t, handoffErr.Conns, 1)
+	conn := handoffErr.Conns[0]
+	defer func() { _ = conn.Close() }()
+	_, err = client.Write([]byte("x"))
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(buf))
+}
+
+func TestListenerHandoffDryRun(t *testing.T) {
+	socketfilename := filepath.Join(t.TempDir(), "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	// A client waiting in the accept queue is left there
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendListenerHandoffDryRun(listener) }()
+	report, err := receiver.RecvListenerHandoffDryRun()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.True(t, report.OK(), "%v", report.Diffs)
+	assert.Equal(t, 1, report.Items)
+
+	// The sender still has its listener, its socket file and its queued client
+	_, err = os.Stat(socketfilename)
+	require.NoError(t, err)
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	// And a real receiver refuses a dry run
+	go func() { errCh <- sender.SendListenerHandoffDryRun(listener) }()
+	_, _, err = receiver.RecvListenerHandoff()
+	assert.Error(t, err)
+	require.NoError(t, <-errCh)
+}
+
+func TestListenerHandoffDryRunReportsDiffs(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	// Not a listener, and described as something else
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	require.NoError(t, b.Add("listener", f, map[string]string{"oob.dryrun": "true", "oob.fd.inode": "1", "oob.fd.items": "2"}))
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendBundle(b))
+	report, err := receiver.RecvListenerHandoffDryRun()
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Len(t, report.Diffs, 3, "%v", report.Diffs)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Identity - what makes two fds the same file: the device and inode, and, for fds on an anonymous inode filesystem
+//            (eventfds, epoll fds, timerfds, signalfds...) whose inode number is shared by unrelated descriptors, the
+//            class of their /proc link target, such as "anon_inode:[eventfd]"
+//            memfds and pipes have inodes of their own, so need no Class
+type Identity struct {
+	Dev   uint64
+	Inode uint64
+	Class string
+}
+
+// Anonymous - whether the Inode is shared by unrelated descriptors, and so does not identify the file on its own
+func (i Identity) Anonymous() bool {
+	return i.Class != ""
+}
+
+// ToIdentity - Identity of anything which ToFd accepts
+//              an Identity can be passed to ToFd, ToFile and ToConn to find an open fd for it, which unlike an inode
+//              will not turn up an unrelated fd sharing an anonymous inode
+func ToIdentity(thing interface{}) (Identity, error) {
+	fd, err := ToFd(thing)
+	if err != nil {
+		return Identity{}, err
+	}
+	id, err := fileIdentity(fd)
+	if err != nil {
+		return Identity{}, err
+	}
+	return id, nil
+}
+
+// SameFile - whether a and b (anything which ToFd accepts) refer to the same open file description, as a dup or an fd
+//            received from a peer does, rather than merely the same file, as two opens of one path do
+//            on linux this asks kcmp(2), elsewhere (or where kcmp is unavailable) it can only compare Identity, so is
+//            also true for two opens of the same file
+func SameFile(a, b interface{}) (bool, error) {
+	fdA, err := ToFd(a)
+	if err != nil {
+		return false, err
+	}
+	fdB, err := ToFd(b)
+	if err != nil {
+		return false, err
+	}
+	if same, ok := sameFileDescription(fdA, fdB); ok {
+		return same, nil
+	}
+	idA, err := fileIdentity(fdA)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	idB, err := fileIdentity(fdB)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return idA == idB, nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// kcmpFile - KCMP_FILE, comparing the file descriptions behind two fds
+const kcmpFile = 0
+
+// sameFileDescription - whether fds a and b share an open file description, ok is false if kcmp is unavailable (a
+//                       kernel without CONFIG_KCMP, or a seccomp filter refusing it)
+func sameFileDescription(a, b uintptr) (same, ok bool) {
+	pid := uintptr(os.Getpid())
+	r, _, errno := unix.Syscall6(unix.SYS_KCMP, pid, pid, kcmpFile, a, b, 0)
+	if errno != 0 {
+		return false, false
+	}
+	return r == 0, true
+}
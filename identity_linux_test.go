@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestAnonymousInodeIdentity(t *testing.T) {
+	eventfd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	require.NoError(t, err)
+	defer func() { _ = unix.Close(eventfd) }()
+	epollfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	require.NoError(t, err)
+	defer func() { _ = unix.Close(epollfd) }()
+
+	eventID, err := oob.ToIdentity(uintptr(eventfd))
+	require.NoError(t, err)
+	assert.Equal(t, "anon_inode:[eventfd]", eventID.Class)
+	assert.True(t, eventID.Anonymous())
+	epollID, err := oob.ToIdentity(uintptr(epollfd))
+	require.NoError(t, err)
+	assert.Equal(t, "anon_inode:[eventpoll]", epollID.Class)
+	assert.NotEqual(t, eventID, epollID)
+
+	// An Identity finds an fd of its own class, even where the inode number is shared
+	fd, err := oob.ToFd(epollID)
+	require.NoError(t, err)
+	id, err := oob.ToIdentity(fd)
+	require.NoError(t, err)
+	assert.Equal(t, epollID, id)
+
+	// The inode of an anonymous inode alone is ambiguous
+	_, err = oob.ToFd(eventID.Inode)
+	assert.Error(t, err)
+
+	// Files with inodes of their own have no class
+	memfd, err := oob.MemfdCreate("identity")
+	require.NoError(t, err)
+	defer func() { _ = memfd.Close() }()
+	memfdID, err := oob.ToIdentity(memfd)
+	require.NoError(t, err)
+	assert.False(t, memfdID.Anonymous())
+	fd, err = oob.ToFd(memfdID.Inode)
+	require.NoError(t, err)
+	id, err = oob.ToIdentity(fd)
+	require.NoError(t, err)
+	assert.Equal(t, memfdID, id)
+}
+
+func TestSameFile(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	reopened, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = reopened.Close() }()
+	dup, err := unix.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	defer func() { _ = unix.Close(dup) }()
+
+	same, err := oob.SameFile(f, uintptr(dup))
+	require.NoError(t, err)
+	assert.True(t, same)
+
+	// Same inode, but a different open file description
+	same, err = oob.SameFile(f, reopened)
+	require.NoError(t, err)
+	assert.False(t, same)
+
+	// Passing an fd shares its open file description
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFile(f))
+	received, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	same, err = oob.SameFile(f, received)
+	require.NoError(t, err)
+	assert.True(t, same)
+
+	_, err = oob.SameFile(f, "not a file")
+	assert.Error(t, err)
+}
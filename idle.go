@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithIdleTimeout - close the connection once no frame or fd has been sent or received on it for timeout (a receive
+//                   blocked with nothing arriving doesn't count), first closing any fds waiting on this end which
+//                   nothing is receiving, so brokers don't accumulate dead clients and the resources their fds pin.
+//                   Given to Listen (or a Dialer), it reaps every connection accepted (or dialed).
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+type idleReaper struct {
+	timeout time.Duration
+	// last - when the last operation finished, in unix nanoseconds
+	last      int64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (i *idleReaper) touch() {
+	atomic.StoreInt64(&i.last, time.Now().UnixNano())
+}
+
+func (i *idleReaper) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&i.last)))
+}
+
+func (i *idleReaper) close() {
+	i.closeOnce.Do(func() { close(i.done) })
+}
+
+func (s *UnixConn) startIdleReaper(timeout time.Duration) {
+	i := &idleReaper{timeout: timeout, done: make(chan struct{})}
+	i.touch()
+	s.idle = i
+	goLabeled("idle", func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if idle := i.idleFor(now); idle >= timeout {
+					s.opts.logf("oob: closing connection idle for %s", idle.Round(time.Millisecond))
+					s.drainFDs()
+					_ = s.Close()
+					return
+				}
+			case <-i.done:
+				return
+			}
+		}
+	})
+}
+
+// drainFDs - receives and closes whatever is waiting on this end, if nothing else is receiving (whatever is left the
+//            kernel closes along with the socket)
+func (s *UnixConn) drainFDs() {
+	if !s.recvMu.TryLock() {
+		return
+	}
+	defer s.recvMu.Unlock()
+	for _, f := range s.pending {
+		closeFDs(f.fds)
+	}
+	s.pending = nil
+	buf := make([]byte, 4096)
+	oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+	for {
+		if readable, err := s.waitReadable(0); err != nil || !readable {
+			return
+		}
+		n, oobn, _, err := s.recvmsg(buf, oob, 0)
+		if oobn > 0 {
+			fds, _ := parseRights(oob[:oobn])
+			closeFDs(fds)
+		}
+		if err != nil || n == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	logs := &syncBuffer{}
+	listener, err := oob.Listen("unix", filepath.Join(t.TempDir(), "socket"),
+		oob.WithIdleTimeout(100*time.Millisecond), oob.WithLogger(log.New(logs, "", 0)))
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	// A client which sends an fd and then goes quiet
+	client, err := net.Dial("unix", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	server, err := listener.Accept()
+	require.NoError(t, err)
+	defer func() { _ = server.Close() }()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = w.Close() }()
+	require.NoError(t, oob.NewUnixConn(client.(*net.UnixConn)).SendFile(r))
+	require.NoError(t, r.Close())
+
+	// Reaped, and the fd which was never received was closed (so the pipe has no readers left)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = client.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "timeout")
+	_, err = w.Write([]byte("x"))
+	assert.True(t, errors.Is(err, syscall.EPIPE))
+	assert.Eventually(t, logs.contains("closing connection idle"), time.Second, 10*time.Millisecond)
+}
+
+func TestIdleTimeoutActive(t *testing.T) {
+	sender, receiver := newUnixConnPair(t, oob.WithIdleTimeout(100*time.Millisecond))
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	// Busy for three times the timeout
+	for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+		require.NoError(t, sender.SendFD(r.Fd()))
+		fd, recvErr := receiver.RecvFD()
+		require.NoError(t, recvErr)
+		require.NoError(t, syscall.Close(int(fd)))
+		time.Sleep(20 * time.Millisecond)
+	}
+}
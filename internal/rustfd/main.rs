@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rustfd - the peer of TestRustInterop, passing fds over the unix socket on fd 3 as the Rust sendfd crate's
+// send_with_fd and recv_with_fd (with a u32 little endian length prefix) and the passfd crate's send_fd and recv_fd
+// do, using only std so that it builds with a bare rustc (linux, 64 bit)
+use std::os::raw::{c_int, c_void};
+
+#[repr(C)]
+struct IoVec {
+    base: *mut c_void,
+    len: usize,
+}
+
+#[repr(C)]
+struct MsgHdr {
+    name: *mut c_void,
+    namelen: u32,
+    iov: *mut IoVec,
+    iovlen: usize,
+    control: *mut c_void,
+    controllen: usize,
+    flags: c_int,
+}
+
+#[repr(C)]
+struct CmsgHdr {
+    len: usize,
+    level: c_int,
+    typ: c_int,
+}
+
+const SOL_SOCKET: c_int = 1;
+const SCM_RIGHTS: c_int = 1;
+const SOCK: c_int = 3;
+const CMSG_HDR_LEN: usize = std::mem::size_of::<CmsgHdr>();
+
+extern "C" {
+    fn sendmsg(fd: c_int, msg: *const MsgHdr, flags: c_int) -> isize;
+    fn recvmsg(fd: c_int, msg: *mut MsgHdr, flags: c_int) -> isize;
+    fn write(fd: c_int, buf: *const c_void, len: usize) -> isize;
+    fn close(fd: c_int) -> c_int;
+}
+
+// send_with_fd - sendmsg of bytes with fds in one SCM_RIGHTS message
+fn send_with_fd(bytes: &[u8], fds: &[c_int]) {
+    let mut control = vec![0u64; 1 + (CMSG_HDR_LEN + 4 * fds.len() + 7) / 8];
+    let controllen = CMSG_HDR_LEN + 4 * fds.len();
+    unsafe {
+        let cmsg = control.as_mut_ptr() as *mut CmsgHdr;
+        (*cmsg).len = controllen;
+        (*cmsg).level = SOL_SOCKET;
+        (*cmsg).typ = SCM_RIGHTS;
+        let data = (cmsg as *mut u8).add(CMSG_HDR_LEN) as *mut c_int;
+        for (i, fd) in fds.iter().enumerate() {
+            *data.add(i) = *fd;
+        }
+        let mut iov = IoVec { base: bytes.as_ptr() as *mut c_void, len: bytes.len() };
+        let msg = MsgHdr {
+            name: std::ptr::null_mut(),
+            namelen: 0,
+            iov: &mut iov,
+            iovlen: 1,
+            control: control.as_mut_ptr() as *mut c_void,
+            controllen: (controllen + 7) / 8 * 8,
+            flags: 0,
+        };
+        assert_eq!(sendmsg(SOCK, &msg, 0), bytes.len() as isize, "sendmsg");
+    }
+}
+
+// recv_with_fd - recvmsg into bytes, returning how many bytes and the fds which came with them
+fn recv_with_fd(bytes: &mut [u8]) -> (usize, Vec<c_int>) {
+    let mut control = vec![0u64; 32];
+    let mut iov = IoVec { base: bytes.as_mut_ptr() as *mut c_void, len: bytes.len() };
+    let mut msg = MsgHdr {
+        name: std::ptr::null_mut(),
+        namelen: 0,
+        iov: &mut iov,
+        iovlen: 1,
+        control: control.as_mut_ptr() as *mut c_void,
+        controllen: control.len() * 8,
+        flags: 0,
+    };
+    let mut fds = Vec::new();
+    unsafe {
+        let n = recvmsg(SOCK, &mut msg, 0);
+        assert!(n > 0, "recvmsg");
+        if msg.controllen >= CMSG_HDR_LEN {
+            let cmsg = control.as_ptr() as *const CmsgHdr;
+            assert_eq!(((*cmsg).level, (*cmsg).typ), (SOL_SOCKET, SCM_RIGHTS));
+            let data = (cmsg as *const u8).add(CMSG_HDR_LEN) as *const c_int;
+            for i in 0..((*cmsg).len - CMSG_HDR_LEN) / 4 {
+                fds.push(*data.add(i));
+            }
+        }
+        (n as usize, fds)
+    }
+}
+
+fn main() {
+    // Length prefixed: write what came with the pipe into it, then send it back
+    let mut buf = [0u8; 4096];
+    let (n, fds) = recv_with_fd(&mut buf);
+    let len = u32::from_le_bytes([buf[0], buf[1], buf[2], buf[3]]) as usize;
+    assert_eq!(n, 4 + len, "length prefix");
+    assert_eq!(fds.len(), 1);
+    unsafe {
+        assert_eq!(write(fds[0], buf[4..n].as_ptr() as *const c_void, len), len as isize, "write");
+    }
+    let mut reply = (4u32).to_le_bytes().to_vec();
+    reply.extend_from_slice(b"back");
+    send_with_fd(&reply, &fds);
+    unsafe {
+        close(fds[0]);
+    }
+
+    // passfd: one byte carrying one fd, sent straight back
+    let mut byte = [0u8; 1];
+    let (_, fds) = recv_with_fd(&mut byte);
+    assert_eq!(fds.len(), 1);
+    send_with_fd(&[0], &fds);
+}
@@ -14,6 +14,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows
+// +build !windows
+
 // Package oob - Simple out of band file descriptor passing over Unix File Sockets
 // Linux allows the passing of file descriptors out of band over unix file sockets
 // This does not interfere with the normal byte stream passing over the unix file socket
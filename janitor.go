@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"time"
+)
+
+// WithUnclaimedFDTimeout - WithPrefetch, close fds the application hasn't received within timeout of their arrival,
+//                          counting them in Stats (FDsExpired), so a peer spraying fds nobody asks for can't exhaust
+//                          RLIMIT_NOFILE by filling the queue (their credits are returned, so the queue keeps
+//                          draining the socket)
+func WithUnclaimedFDTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.unclaimedFDTimeout = timeout
+	}
+}
+
+// minJanitorInterval - the shortest interval the janitor sweeps the prefetch queue at
+const minJanitorInterval = 10 * time.Millisecond
+
+// startJanitor - sweeps the prefetch queue for fds unclaimed for longer than timeout, until it is closed
+func (s *UnixConn) startJanitor(timeout time.Duration) {
+	interval := timeout / 4
+	if interval < minJanitorInterval {
+		interval = minJanitorInterval
+	}
+	p := s.prefetch
+	goLabeled("janitor", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, ok := p.expire(time.Now().Add(-timeout))
+			if !ok {
+				return
+			}
+			if n > 0 {
+				s.stats.expired(n)
+				s.opts.logf("oob: closed %d fds nobody received within %s", n, timeout)
+			}
+		}
+	})
+}
+
+// expire - closes the fds queued before cutoff, returning their credits and how many there were, ok is false once the
+//          prefetcher is closed
+func (p *prefetcher) expire(cutoff time.Time) (n int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, false
+	}
+	// The queue is in order of arrival, with any error last
+	for n < len(p.queue) && p.queue[n].err == nil && p.queue[n].queued.Before(cutoff) {
+		closeFDs([]int{int(p.queue[n].fd)})
+		n++
+	}
+	if n > 0 {
+		p.queue = p.queue[n:]
+		p.credits += n
+		p.cond.Broadcast()
+	}
+	return n, true
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package oob
+
+/*
+#include <launch.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// LaunchdListeners - the listeners launchd created for the socket named name (the key under Sockets in the
+//                    daemon's plist), retrieved with launch_activate_socket(3)
+//                    Accept() on the returned listeners returns an oob.UnixConn for unix sockets, just like Listen
+func LaunchdListeners(name string) ([]net.Listener, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	var cFds *C.int
+	var cCnt C.size_t
+	if errno := C.launch_activate_socket(cName, &cFds, &cCnt); errno != 0 {
+		return nil, errors.Wrapf(syscall.Errno(errno), "launch_activate_socket(%q) failed", name)
+	}
+	defer C.free(unsafe.Pointer(cFds))
+
+	fds := unsafe.Slice(cFds, int(cCnt))
+	listeners := make([]net.Listener, 0, len(fds))
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			for _, rest := range fds[i+1:] {
+				_ = syscall.Close(int(rest))
+			}
+			return nil, errors.Wrapf(err, "launchd socket %q fd %d is not a listener", name, fd)
+		}
+		listeners = append(listeners, newListener(listener))
+	}
+	return listeners, nil
+}
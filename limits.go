@@ -0,0 +1,204 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"math"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoFileHeadroom - returned by receives WithNoFileLimit when receiving more fds would leave fewer than the margin
+//                     under RLIMIT_NOFILE
+var ErrNoFileHeadroom = errors.New("too few fds left under RLIMIT_NOFILE to receive more")
+
+// openMax - the most the soft RLIMIT_NOFILE can be raised to on darwin (OPEN_MAX), whose hard limit is often unlimited
+//           but refuses to be reached
+const openMax = 10240
+
+// FDLimits - the limits which constrain how many fds can be passed at once and how many more can be received
+type FDLimits struct {
+	// MaxFDsPerMessage - the most fds the kernel will accept in a single SCM_RIGHTS message, measured once per process
+	//                    by sending ever larger messages over a socketpair, since it varies by kernel (SCM_MAX_FD is
+	//                    253 on linux, the BSDs and darwin differ) and by the size of the ancillary buffer allowed
+	//                    SendFDs and SendBundle always send at most 253 per message, which must not exceed it
+	MaxFDsPerMessage int
+	// MaxAncillaryBytes - the largest control message buffer the kernel will accept (net.core.optmem_max), 0 if unknown
+	MaxAncillaryBytes int
+	// NoFileSoft and NoFileHard - the RLIMIT_NOFILE of the process, RLIM_INFINITY if unlimited
+	NoFileSoft uint64
+	NoFileHard uint64
+	// NoFileUnlimited - whether NoFileSoft is RLIM_INFINITY
+	NoFileUnlimited bool
+	// OpenFDs - the number of fds currently open in the process
+	OpenFDs int
+	// Headroom - how many more fds can be opened (or received) before hitting NoFileSoft, math.MaxInt if unlimited
+	Headroom int
+}
+
+// Limits - the current FDLimits of the process and kernel, so that batching code can size batches and brokers can
+//          decide whether to accept more fds rather than hardcoding 253 and hoping for the best
+func Limits() (*FDLimits, error) {
+	limits, err := noFileLimits()
+	if err != nil {
+		return nil, err
+	}
+	limits.MaxFDsPerMessage = probeMaxFDsPerMessage()
+	limits.MaxAncillaryBytes = maxAncillaryBytes()
+	return limits, nil
+}
+
+// noFileLimits - just the RLIMIT_NOFILE parts of FDLimits, which are cheap enough to check before every receive
+func noFileLimits() (*FDLimits, error) {
+	limit := &unix.Rlimit{}
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, limit); err != nil {
+		return nil, err
+	}
+	fds, err := openFDs()
+	if err != nil {
+		return nil, err
+	}
+	limits := &FDLimits{
+		NoFileSoft:      uint64(limit.Cur),
+		NoFileHard:      uint64(limit.Max),
+		NoFileUnlimited: uint64(limit.Cur) == uint64(unix.RLIM_INFINITY),
+		OpenFDs:         len(fds),
+	}
+	switch {
+	case limits.NoFileUnlimited || limits.NoFileSoft > math.MaxInt:
+		limits.Headroom = math.MaxInt
+	case limits.NoFileSoft > uint64(limits.OpenFDs):
+		limits.Headroom = int(limits.NoFileSoft) - limits.OpenFDs
+	}
+	return limits, nil
+}
+
+// RaiseNoFileLimit - raises the soft RLIMIT_NOFILE of the process to its hard limit (or OPEN_MAX, where the hard limit
+//                    can't be reached), as brokers and supervisors receiving many fds want to at startup
+func RaiseNoFileLimit() error {
+	limit := &unix.Rlimit{}
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, limit); err != nil {
+		return errors.WithStack(err)
+	}
+	if limit.Cur == limit.Max {
+		return nil
+	}
+	raised := *limit
+	raised.Cur = raised.Max
+	err := unix.Setrlimit(unix.RLIMIT_NOFILE, &raised)
+	if err == unix.EINVAL && uint64(limit.Cur) < openMax {
+		raised.Cur = openMax
+		err = unix.Setrlimit(unix.RLIMIT_NOFILE, &raised)
+	}
+	return errors.Wrap(err, "unable to raise RLIMIT_NOFILE")
+}
+
+var raiseNoFileLimitOnce sync.Once
+
+// WithNoFileLimit - for receivers (brokers, supervisors): raises RLIMIT_NOFILE to the hard limit (once per process,
+//                   see RaiseNoFileLimit), and refuses to receive with ErrNoFileHeadroom, rather than receiving, when
+//                   the fds a receive could bring would leave fewer than margin fds under the limit, instead of
+//                   failing unpredictably with EMFILE (or losing fds the kernel could not install)
+//                   a refused receive reads nothing, so it can be retried once fds have been closed
+func WithNoFileLimit(margin int) Option {
+	return func(o *options) {
+		raiseNoFileLimitOnce.Do(func() {
+			if err := RaiseNoFileLimit(); err != nil {
+				o.logf("oob: %+v", err)
+			}
+		})
+		o.noFileLimit = true
+		o.noFileMargin = margin
+	}
+}
+
+// checkNoFileHeadroom - ErrNoFileHeadroom if receiving as many fds as fit in oob would leave fewer than the margin
+//                       WithNoFileLimit
+func (o *options) checkNoFileHeadroom(oob []byte) error {
+	if !o.noFileLimit || len(oob) == 0 {
+		return nil
+	}
+	n := (len(oob) - syscall.CmsgSpace(0)) / sizeofFD
+	if n < 1 {
+		n = 1
+	}
+	limits, err := noFileLimits()
+	if err != nil {
+		return err
+	}
+	if limits.Headroom-n < o.noFileMargin {
+		return errors.Wrapf(ErrNoFileHeadroom, "%d of %d fds open, receiving up to %d would leave fewer than %d", limits.OpenFDs, limits.NoFileSoft, n, o.noFileMargin)
+	}
+	return nil
+}
+
+// probeFDsLimit - the largest message probeMaxFDsPerMessage tries, comfortably above every known SCM_MAX_FD
+const probeFDsLimit = 1024
+
+var (
+	maxFDsPerMessageOnce   sync.Once
+	probedMaxFDsPerMessage int
+)
+
+// probeMaxFDsPerMessage - the most fds the kernel accepts in one SCM_RIGHTS message, found by binary search the first
+//                         time it is called, or maxFDsPerMessage if it can't be measured
+func probeMaxFDsPerMessage() int {
+	maxFDsPerMessageOnce.Do(func() {
+		probedMaxFDsPerMessage = maxFDsPerMessage
+		lo, hi := 0, probeFDsLimit
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			ok, err := canSendFDs(mid)
+			if err != nil {
+				return
+			}
+			if ok {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		if lo > 0 {
+			probedMaxFDsPerMessage = lo
+		}
+	})
+	return probedMaxFDsPerMessage
+}
+
+// canSendFDs - whether a message with n fds can be sent, the error is only for failing to set up the probe
+//              the fds are never received, closing the socketpair discards them
+func canSendFDs(n int) (bool, error) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = syscall.Close(pair[0])
+		_ = syscall.Close(pair[1])
+	}()
+	rights := make([]int, n)
+	for i := range rights {
+		rights[i] = pair[1]
+	}
+	return syscall.Sendmsg(pair[0], []byte{0}, syscall.UnixRights(rights...), nil, 0) == nil, nil
+}
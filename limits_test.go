@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestLimits(t *testing.T) {
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Greater(t, before.MaxFDsPerMessage, 0)
+	assert.LessOrEqual(t, before.MaxFDsPerMessage, 253)
+	assert.Greater(t, before.OpenFDs, 0)
+	assert.LessOrEqual(t, before.NoFileSoft, before.NoFileHard)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs+2, after.OpenFDs)
+	assert.Equal(t, before.Headroom-2, after.Headroom)
+}
+
+func TestLimitsMaxFDsPerMessageIsMeasured(t *testing.T) {
+	limits, err := oob.Limits()
+	require.NoError(t, err)
+	if limits.NoFileUnlimited {
+		assert.Equal(t, math.MaxInt, limits.Headroom)
+	}
+
+	send := func(n int) error {
+		pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		require.NoError(t, err)
+		defer func() {
+			_ = syscall.Close(pair[0])
+			_ = syscall.Close(pair[1])
+		}()
+		rights := make([]int, n)
+		for i := range rights {
+			rights[i] = pair[1]
+		}
+		return syscall.Sendmsg(pair[0], []byte{0}, syscall.UnixRights(rights...), nil, 0)
+	}
+	assert.NoError(t, send(limits.MaxFDsPerMessage))
+	assert.Error(t, send(limits.MaxFDsPerMessage+1))
+}
+
+func TestNoFileLimit(t *testing.T) {
+	require.NoError(t, oob.RaiseNoFileLimit())
+	limits, err := oob.Limits()
+	require.NoError(t, err)
+	if limits.NoFileUnlimited {
+		t.Skip("RLIMIT_NOFILE is unlimited, there is no margin to approach")
+	}
+	if runtime.GOOS != "darwin" {
+		assert.Equal(t, limits.NoFileHard, limits.NoFileSoft)
+	}
+
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	// Within the margin, the receive is refused and the fd left unread
+	sender, receiver := newUnixConnPair(t, oob.WithNoFileLimit(limits.Headroom))
+	require.NoError(t, sender.SendFile(f))
+	_, err = receiver.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrNoFileHeadroom), "%+v", err)
+
+	// With room to spare, it is received
+	sender, receiver = newUnixConnPair(t, oob.WithNoFileLimit(16))
+	require.NoError(t, sender.SendFile(f))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+}
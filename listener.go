@@ -18,25 +18,122 @@ package oob
 
 import (
 	"net"
+	"sync"
+
+	"github.com/pkg/errors"
 )
 
 type oobListener struct {
 	net.Listener
+	opts []Option
+	// conns - a slot for each accepted conn not yet closed, nil without WithMaxConns
+	conns     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// Listen - wraps the result of net.Listen such that Accept() returns a oob.UnixConn if applicable
-func Listen(network, address string) (net.Listener, error) {
-	listener, err := net.Listen(network, address)
+// Listen - wraps the result of net.Listen such that Accept() returns a oob.UnixConn (with opts) if applicable
+func Listen(network, address string, opts ...Option) (net.Listener, error) {
+	o := newOptions(opts...)
+	listener, err := listen(network, address, &o)
 	if err != nil {
 		return nil, err
 	}
-	return &oobListener{listener}, nil
+	return newListener(listener, opts...), nil
+}
+
+// newListener - wraps listener, with opts for the conns it accepts
+func newListener(listener net.Listener, opts ...Option) *oobListener {
+	l := &oobListener{Listener: listener, opts: opts, done: make(chan struct{})}
+	if o := newOptions(opts...); o.maxConns > 0 {
+		l.conns = make(chan struct{}, o.maxConns)
+	}
+	return l
+}
+
+// WithMaxConns - have Accept wait while n of the conns it returned are still open, leaving further clients in the
+//                listen backlog, so a misbehaving client can't open unbounded connections against a broker
+func WithMaxConns(n int) Option {
+	return func(o *options) {
+		o.maxConns = n
+	}
+}
+
+// WithMaxPendingFDsPerConn - never hold more than n fds received on a conn but not yet handed over: WithPrefetch
+//                            queues at most n, a bundle manifest listing more than n items is refused (its fds are
+//                            closed as they arrive) and Ping fails rather than set aside frames carrying more than n
+func WithMaxPendingFDsPerConn(n int) Option {
+	return func(o *options) {
+		o.maxPendingFDs = n
+	}
+}
+
+// checkPendingFDs - an error if n fds pending on a conn would exceed WithMaxPendingFDsPerConn
+func (o *options) checkPendingFDs(n int) error {
+	if o.maxPendingFDs > 0 && n > o.maxPendingFDs {
+		return errors.Errorf("%d fds would be pending on the connection, more than the %d allowed", n, o.maxPendingFDs)
+	}
+	return nil
+}
+
+// Unwrap - the wrapped net.Listener, so that ToFd and friends can see through oobListener
+func (c *oobListener) Unwrap() interface{} {
+	return c.Listener
 }
 
 func (c *oobListener) Accept() (net.Conn, error) {
+	if c.conns != nil {
+		select {
+		case c.conns <- struct{}{}:
+		case <-c.done:
+			return nil, net.ErrClosed
+		}
+	}
 	conn, err := c.Listener.Accept()
-	if unixConn, ok := conn.(*net.UnixConn); ok && err == nil {
-		return NewUnixConn(unixConn), nil
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		return acceptedUnixConn(unixConn, c.release, c.opts...), nil
+	}
+	if c.conns != nil {
+		return &limitedConn{Conn: conn, release: c.release}, nil
 	}
-	return conn, err
+	return conn, nil
+}
+
+// Close - closes the listener, waking any Accept waiting for a conn to be closed
+func (c *oobListener) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Listener.Close()
+}
+
+// release - frees the slot of a conn, WithMaxConns
+func (c *oobListener) release() {
+	if c.conns != nil {
+		<-c.conns
+	}
+}
+
+// limitedConn - a conn other than a *net.UnixConn accepted WithMaxConns, which frees its slot when closed
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// closed - runs the onClose of the listener which accepted s, once
+func (s *UnixConn) closed() {
+	s.closeOnce.Do(func() {
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
 }
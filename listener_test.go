@@ -0,0 +1,227 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestMaxConns(t *testing.T) {
+	listener, err := oob.Listen("unix", filepath.Join(t.TempDir(), "socket"), oob.WithMaxConns(1))
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	for i := 0; i < 2; i++ {
+		client, dialErr := net.Dial("unix", listener.Addr().String())
+		require.NoError(t, dialErr)
+		defer func() { _ = client.Close() }()
+	}
+	first, err := listener.Accept()
+	require.NoError(t, err)
+	require.IsType(t, &oob.UnixConn{}, first)
+
+	// The second client waits in the backlog until the first conn is closed
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		second, acceptErr := listener.Accept()
+		assert.NoError(t, acceptErr)
+		accepted <- second
+	}()
+	select {
+	case <-accepted:
+		t.Fatal("accepted more than WithMaxConns conns")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, first.Close())
+	select {
+	case second := <-accepted:
+		require.NoError(t, second.Close())
+	case <-time.After(time.Second):
+		t.Fatal("closing a conn did not free its slot")
+	}
+}
+
+func TestMaxConnsListenerClose(t *testing.T) {
+	listener, err := oob.Listen("unix", filepath.Join(t.TempDir(), "socket"), oob.WithMaxConns(1))
+	require.NoError(t, err)
+	client, err := net.Dial("unix", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, acceptErr := listener.Accept()
+		errCh <- acceptErr
+	}()
+	require.NoError(t, listener.Close())
+	select {
+	case err = <-errCh:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close did not wake a waiting Accept")
+	}
+}
+
+func TestMaxPendingFDsPrefetch(t *testing.T) {
+	sender, receiver := newUnixConnPair(t, oob.WithPrefetch(8), oob.WithMaxPendingFDsPerConn(2))
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sender.SendFile(f))
+	}
+	prefetched := func() int {
+		depths, depthsErr := receiver.QueueDepths()
+		require.NoError(t, depthsErr)
+		return depths.Prefetched
+	}
+	require.Eventually(t, func() bool { return prefetched() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, prefetched())
+}
+
+func TestMaxPendingFDsBundle(t *testing.T) {
+	sender, receiver := newUnixConnPair(t, oob.WithMaxPendingFDsPerConn(2))
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	big, small := oob.NewBundle(), oob.NewBundle()
+	defer func() { _ = big.Close() }()
+	defer func() { _ = small.Close() }()
+	for _, label := range []string{"a", "b", "c"} {
+		require.NoError(t, big.Add(label, f, nil))
+	}
+	require.NoError(t, small.Add("d", f, nil))
+	errCh := make(chan error, 1)
+	go func() {
+		sendErr := sender.SendBundle(big)
+		if sendErr == nil {
+			sendErr = sender.SendBundle(small)
+		}
+		errCh <- sendErr
+	}()
+
+	_, err = receiver.RecvBundle()
+	assert.Error(t, err)
+	// The refused bundle's fds were discarded, the next one still arrives intact
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	require.NotNil(t, received.Get("d"))
+	require.NoError(t, <-errCh)
+}
+
+func TestListenSocketFileMode(t *testing.T) {
+	dir := t.TempDir()
+	address := filepath.Join(dir, "socket")
+	listener, err := oob.Listen("unix", address, oob.WithSocketMode(0o600), oob.WithSocketOwner(os.Getuid(), -1))
+	require.NoError(t, err)
+	assert.Equal(t, address, listener.Addr().String())
+
+	info, err := os.Stat(address)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSocket, info.Mode().Type())
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	// Nothing is left of where it was bound
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	client, err := net.Dial("unix", address)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	require.IsType(t, &oob.UnixConn{}, conn)
+	require.NoError(t, conn.Close())
+
+	// A second listener can't take the address over
+	_, err = oob.Listen("unix", address, oob.WithSocketMode(0o600))
+	assert.Error(t, err)
+
+	require.NoError(t, listener.Close())
+	_, err = os.Stat(address)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListenRemoveStaleSocket(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "socket")
+	leaveStaleSocket(t, address)
+
+	_, err := oob.Listen("unix", address)
+	require.Error(t, err)
+	listener, err := oob.Listen("unix", address, oob.WithRemoveStaleSocket())
+	require.NoError(t, err)
+
+	// A socket which is still being listened on is not stale
+	_, err = oob.Listen("unix", address, oob.WithRemoveStaleSocket())
+	assert.Error(t, err)
+	client, err := net.Dial("unix", address)
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+	require.NoError(t, listener.Close())
+
+	// Nor is anything other than a socket
+	notASocket := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notASocket, nil, 0o600))
+	_, err = oob.Listen("unix", notASocket, oob.WithRemoveStaleSocket())
+	assert.Error(t, err)
+	_, err = os.Stat(notASocket)
+	assert.NoError(t, err)
+}
+
+func TestListenLockFile(t *testing.T) {
+	dir := t.TempDir()
+	address := filepath.Join(dir, "socket")
+	lock := address + ".lock"
+	first, err := oob.Listen("unix", address, oob.WithLockFile(lock))
+	require.NoError(t, err)
+
+	_, err = oob.Listen("unix", filepath.Join(dir, "other"), oob.WithLockFile(lock))
+	assert.Error(t, err)
+
+	// Holding the lock, whatever is left at address is stale
+	require.NoError(t, first.Close())
+	leaveStaleSocket(t, address)
+	second, err := oob.Listen("unix", address, oob.WithLockFile(lock))
+	require.NoError(t, err)
+	require.NoError(t, second.Close())
+}
+
+// leaveStaleSocket - leaves a socket file at address which nothing listens on, as a crashed listener would
+func leaveStaleSocket(t *testing.T, address string) {
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: address, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// WithSocketMode - on Listen, give the socket file mode (regardless of the umask) before any client can connect to it
+func WithSocketMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.socketMode = mode
+	}
+}
+
+// WithSocketOwner - on Listen, give the socket file the owner uid and group gid (-1 leaves either unchanged) before any
+//                   client can connect to it, which needs the privileges chown(2) does
+func WithSocketOwner(uid, gid int) Option {
+	return func(o *options) {
+		o.socketOwner = true
+		o.socketUID = uid
+		o.socketGID = gid
+	}
+}
+
+// WithRemoveStaleSocket - on Listen, remove a socket file left behind at address by a listener which has gone away
+//                         (connecting to it is refused) rather than fail to bind, anything which is not a socket or
+//                         is still being listened on is left alone
+func WithRemoveStaleSocket() Option {
+	return func(o *options) {
+		o.removeStaleSocket = true
+	}
+}
+
+// WithLockFile - on Listen, take an exclusive flock(2) on path (created if need be, address + ".lock" is customary)
+//                and hold it until the listener is closed, so only one instance can bind the address, failing if
+//                another holds it. Holding the lock, any socket file left at address is stale and removed
+func WithLockFile(path string) Option {
+	return func(o *options) {
+		o.lockFile = path
+	}
+}
+
+// listen - net.Listen with the socket file options: the lock file, stale socket removal, mode and owner
+func listen(network, address string, o *options) (net.Listener, error) {
+	var lock *os.File
+	if o.lockFile != "" {
+		var err error
+		if lock, err = lockFile(o.lockFile); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := listenUnlocked(network, address, o, lock != nil)
+	if err != nil {
+		if lock != nil {
+			_ = lock.Close()
+		}
+		return nil, err
+	}
+	if lock != nil {
+		return &lockedListener{Listener: listener, lock: lock}, nil
+	}
+	return listener, nil
+}
+
+func listenUnlocked(network, address string, o *options, locked bool) (net.Listener, error) {
+	if o.removeStaleSocket || locked {
+		if err := removeStaleSocket(network, address, locked); err != nil {
+			return nil, err
+		}
+	}
+	if o.socketMode != 0 || o.socketOwner {
+		return listenSocketFile(network, address, o)
+	}
+	return net.Listen(network, address)
+}
+
+// lockFile - path, opened and exclusively locked
+func lockFile(path string) (*os.File, error) {
+	lock, err := os.OpenFile(filepath.Clean(path), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open the lock file")
+	}
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		_ = lock.Close()
+		if err == unix.EWOULDBLOCK {
+			return nil, errors.Errorf("another instance holds the lock file %s", path)
+		}
+		return nil, errors.Wrapf(err, "unable to lock %s", path)
+	}
+	return lock, nil
+}
+
+// removeStaleSocket - removes the socket file at address if it is stale: locked (the caller holds the lock file) or
+//                     connecting to it is refused
+func removeStaleSocket(network, address string, locked bool) error {
+	if (network != "unix" && network != "unixpacket") || strings.HasPrefix(address, "@") {
+		return nil
+	}
+	info, err := os.Lstat(address)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to check %s", address)
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return errors.Errorf("%s exists and is not a socket", address)
+	}
+	if !locked {
+		conn, dialErr := net.Dial(network, address)
+		if dialErr == nil {
+			_ = conn.Close()
+			return errors.Errorf("%s is in use by another listener", address)
+		}
+		if !errors.Is(dialErr, syscall.ECONNREFUSED) {
+			return errors.Wrapf(dialErr, "unable to tell whether %s is stale", address)
+		}
+	}
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to remove the stale socket %s", address)
+	}
+	return nil
+}
+
+// lockedListener - a listener holding its lock file until it is closed
+type lockedListener struct {
+	net.Listener
+	lock *os.File
+}
+
+// Unwrap - the wrapped net.Listener, so that ToFd and friends can see through lockedListener
+func (l *lockedListener) Unwrap() interface{} {
+	return l.Listener
+}
+
+// Close - closes the listener and then releases the lock file
+func (l *lockedListener) Close() error {
+	err := l.Listener.Close()
+	_ = l.lock.Close()
+	return err
+}
+
+// listenSocketFile - net.Listen, binding the socket in a private directory beside address where its mode and owner
+//                    are set before it is linked into place, so there is never a moment when it can be connected to
+//                    with the wrong permissions (as there would be with a chmod after the bind)
+func listenSocketFile(network, address string, o *options) (net.Listener, error) {
+	if (network != "unix" && network != "unixpacket") || strings.HasPrefix(address, "@") {
+		return nil, errors.Errorf("socket file mode and owner need a unix socket file, not %s %s", network, address)
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(address), ".oob-bind-")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create a private directory to bind in")
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	bound := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix(network, &net.UnixAddr{Name: bound, Net: network})
+	if err != nil {
+		return nil, err
+	}
+	// Closing the listener removes address, not the path it was bound to
+	listener.SetUnlinkOnClose(false)
+	if err = setSocketFileAttrs(bound, o); err == nil {
+		// Unlike rename, link fails rather than replace a socket already at address, just as bind would
+		err = os.Link(bound, address)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return &socketFileListener{UnixListener: listener, addr: &net.UnixAddr{Name: address, Net: network}}, nil
+}
+
+func setSocketFileAttrs(path string, o *options) error {
+	if o.socketMode != 0 {
+		if err := os.Chmod(path, o.socketMode); err != nil {
+			return errors.Wrap(err, "unable to set the socket file mode")
+		}
+	}
+	if o.socketOwner {
+		if err := os.Lchown(path, o.socketUID, o.socketGID); err != nil {
+			return errors.Wrap(err, "unable to set the socket file owner")
+		}
+	}
+	return nil
+}
+
+// socketFileListener - a listener bound by listenSocketFile, at addr rather than where it was bound
+type socketFileListener struct {
+	*net.UnixListener
+	addr *net.UnixAddr
+	// keepFile - whether Close leaves the socket file alone, see SetUnlinkOnClose
+	keepFile bool
+}
+
+// Unwrap - the wrapped *net.UnixListener, so that ToFd and friends can see through socketFileListener
+func (l *socketFileListener) Unwrap() interface{} {
+	return l.UnixListener
+}
+
+func (l *socketFileListener) Addr() net.Addr {
+	return l.addr
+}
+
+// SetUnlinkOnClose - sets whether Close removes the socket file, as (*net.UnixListener).SetUnlinkOnClose does
+func (l *socketFileListener) SetUnlinkOnClose(unlink bool) {
+	l.keepFile = !unlink
+}
+
+// Close - closes the listener and removes its socket file, unless SetUnlinkOnClose(false)
+func (l *socketFileListener) Close() error {
+	err := l.UnixListener.Close()
+	if err == nil && !l.keepFile {
+		_ = os.Remove(l.addr.Name)
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// WithSocketMode - on Listen, give the socket file mode before any client can connect to it, unsupported on windows
+func WithSocketMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.socketMode = mode
+	}
+}
+
+// WithSocketOwner - on Listen, give the socket file an owner and group, unsupported on windows
+func WithSocketOwner(uid, gid int) Option {
+	return func(o *options) {
+		o.socketOwner = true
+		o.socketUID = uid
+		o.socketGID = gid
+	}
+}
+
+// WithRemoveStaleSocket - on Listen, remove a socket file nobody is listening on, unsupported on windows
+func WithRemoveStaleSocket() Option {
+	return func(o *options) {
+		o.removeStaleSocket = true
+	}
+}
+
+// WithLockFile - on Listen, hold a lock on path so only one instance binds the address, unsupported on windows
+func WithLockFile(path string) Option {
+	return func(o *options) {
+		o.lockFile = path
+	}
+}
+
+// listen - net.Listen, none of the socket file options are supported on windows
+func listen(network, address string, o *options) (net.Listener, error) {
+	if o.socketMode != 0 || o.socketOwner || o.removeStaleSocket || o.lockFile != "" {
+		return nil, errors.New("socket file options are not supported on windows")
+	}
+	return net.Listen(network, address)
+}
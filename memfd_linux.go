@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Seals - the F_SEAL_* seals applied to a memfd
+type Seals int
+
+// Seals which can be applied to a memfd, see memfd_create(2)
+const (
+	SealSeal        = Seals(unix.F_SEAL_SEAL)
+	SealShrink      = Seals(unix.F_SEAL_SHRINK)
+	SealGrow        = Seals(unix.F_SEAL_GROW)
+	SealWrite       = Seals(unix.F_SEAL_WRITE)
+	SealFutureWrite = Seals(unix.F_SEAL_FUTURE_WRITE)
+)
+
+// String - the seals by name, such as "shrink|grow"
+func (s Seals) String() string {
+	var names []string
+	for _, seal := range []struct {
+		seal Seals
+		name string
+	}{
+		{SealSeal, "seal"},
+		{SealShrink, "shrink"},
+		{SealGrow, "grow"},
+		{SealWrite, "write"},
+		{SealFutureWrite, "future-write"},
+	} {
+		if s&seal.seal != 0 {
+			names = append(names, seal.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// MemfdCreate - creates a memfd named name which can be sealed, ready to be sized and sent
+func MemfdCreate(name string) (*os.File, error) {
+	fd, err := unix.MemfdCreate(name, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, errors.Wrapf(err, "memfd_create %q", name)
+	}
+	return os.NewFile(uintptr(fd), "memfd:"+name), nil
+}
+
+// MemfdSeals - the seals applied to the memfd (anything ToFd accepts), fails if it isn't a memfd
+func MemfdSeals(memfd interface{}) (Seals, error) {
+	fd, err := ToFd(memfd)
+	if err != nil {
+		return 0, err
+	}
+	seals, err := unix.FcntlInt(fd, unix.F_GET_SEALS, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "fd %d is not a memfd", fd)
+	}
+	return Seals(seals), nil
+}
+
+// MemfdAddSeals - applies seals to the memfd, which only ever adds to those already applied
+func MemfdAddSeals(memfd interface{}, seals Seals) error {
+	fd, err := ToFd(memfd)
+	if err != nil {
+		return err
+	}
+	if _, err = unix.FcntlInt(fd, unix.F_ADD_SEALS, int(seals)); err != nil {
+		return errors.Wrapf(err, "cannot add seals %s to fd %d", seals, fd)
+	}
+	return nil
+}
+
+// MemfdSize - the size of the memfd
+func MemfdSize(memfd interface{}) (int64, error) {
+	fd, err := ToFd(memfd)
+	if err != nil {
+		return 0, err
+	}
+	var stat unix.Stat_t
+	if err = unix.Fstat(int(fd), &stat); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return stat.Size, nil
+}
+
+// MemfdResize - grows or shrinks the memfd to size (ftruncate(2)), failing with an error naming the seal if its seals
+//               don't permit it rather than with a bare EPERM
+func MemfdResize(memfd interface{}, size int64) error {
+	fd, err := ToFd(memfd)
+	if err != nil {
+		return err
+	}
+	if err = checkResize(fd, size, true); err != nil {
+		return err
+	}
+	if err = unix.Ftruncate(int(fd), size); err != nil {
+		return errors.Wrapf(err, "cannot resize fd %d to %d bytes", fd, size)
+	}
+	return nil
+}
+
+// MemfdPreallocate - allocates the memory backing the first size bytes of the memfd now (fallocate(2)), growing it if
+//                    it's smaller, so that later writes can't fail for lack of memory
+func MemfdPreallocate(memfd interface{}, size int64) error {
+	fd, err := ToFd(memfd)
+	if err != nil {
+		return err
+	}
+	if err = checkResize(fd, size, false); err != nil {
+		return err
+	}
+	if err = unix.Fallocate(int(fd), 0, 0, size); err != nil {
+		return errors.Wrapf(err, "cannot preallocate %d bytes of fd %d", size, fd)
+	}
+	return nil
+}
+
+// checkResize - whether fd's seals allow it to become size bytes (or at least size bytes if it won't be shrunk)
+func checkResize(fd uintptr, size int64, shrink bool) error {
+	seals, err := MemfdSeals(fd)
+	if err != nil {
+		return err
+	}
+	current, err := MemfdSize(fd)
+	if err != nil {
+		return err
+	}
+	switch {
+	case size > current && seals&SealGrow != 0:
+		return errors.Errorf("cannot grow fd %d from %d to %d bytes, it is sealed against growing (%s)", fd, current, size, seals)
+	case shrink && size < current && seals&SealShrink != 0:
+		return errors.Errorf("cannot shrink fd %d from %d to %d bytes, it is sealed against shrinking (%s)", fd, current, size, seals)
+	}
+	return nil
+}
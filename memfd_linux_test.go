@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestMemfd(t *testing.T) {
+	memfd, err := oob.MemfdCreate("test")
+	require.NoError(t, err)
+	defer func() { _ = memfd.Close() }()
+	require.NoError(t, oob.MemfdResize(memfd, 4096))
+	require.NoError(t, oob.MemfdAddSeals(memfd, oob.SealShrink))
+
+	// As a peer would receive it
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFile(memfd))
+	received, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+
+	seals, err := oob.MemfdSeals(received)
+	require.NoError(t, err)
+	assert.Equal(t, oob.SealShrink, seals)
+	assert.Equal(t, "shrink", seals.String())
+
+	require.NoError(t, oob.MemfdResize(received, 8192))
+	err = oob.MemfdResize(received, 1024)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sealed against shrinking")
+	// Preallocating less than there is doesn't shrink it
+	require.NoError(t, oob.MemfdPreallocate(received, 1024))
+	require.NoError(t, oob.MemfdPreallocate(received, 16384))
+	size, err := oob.MemfdSize(received)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16384), size)
+
+	require.NoError(t, oob.MemfdAddSeals(received, oob.SealGrow|oob.SealSeal))
+	err = oob.MemfdPreallocate(received, 32768)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sealed against growing")
+	assert.Error(t, oob.MemfdAddSeals(received, oob.SealWrite))
+	seals, err = oob.MemfdSeals(memfd)
+	require.NoError(t, err)
+	assert.Equal(t, "seal|shrink|grow", seals.String())
+
+	// Not a memfd
+	_, err = oob.MemfdSeals(uintptr(0))
+	assert.Error(t, err)
+}
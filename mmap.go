@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Mapped - a file (usually a received memfd or dma-buf) mapped into memory by Mmap
+//          the memory is only reachable through its methods, which fail once it has been closed, rather than as a
+//          []byte which would fault (or worse, alias a later mapping) if used after the unmap
+type Mapped struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+// Mmap - maps all of the file fd (anything ToFd accepts) into memory with prot (unix.PROT_*) and flags (unix.MAP_*,
+//        usually unix.MAP_SHARED to see and make changes shared with the peer)
+func Mmap(fd interface{}, prot, flags int) (*Mapped, error) {
+	rawFd, err := ToFd(fd)
+	if err != nil {
+		return nil, err
+	}
+	var stat unix.Stat_t
+	if err = unix.Fstat(int(rawFd), &stat); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if stat.Size <= 0 {
+		return nil, errors.Errorf("cannot map fd %d, it is empty", rawFd)
+	}
+	data, err := unix.Mmap(int(rawFd), 0, int(stat.Size), prot, flags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot map %d bytes of fd %d", stat.Size, rawFd)
+	}
+	return &Mapped{data: data}, nil
+}
+
+// Len - the length of the mapping, 0 once closed
+func (m *Mapped) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.data)
+}
+
+// With - calls f with the mapped memory, which stays mapped until f returns (Close waits for it), f must not keep b
+func (m *Mapped) With(f func(b []byte) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return ErrMappedClosed
+	}
+	return f(m.data)
+}
+
+// ReadAt - io.ReaderAt for the mapped memory
+func (m *Mapped) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return 0, ErrMappedClosed
+	}
+	if off < 0 || off > int64(len(m.data)) {
+		return 0, errors.Errorf("offset %d is outside of the %d byte mapping", off, len(m.data))
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt - io.WriterAt for the mapped memory, which can't grow, so writing past its end fails
+func (m *Mapped) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return 0, ErrMappedClosed
+	}
+	if off < 0 || off+int64(len(p)) > int64(len(m.data)) {
+		return 0, errors.Errorf("cannot write %d bytes at offset %d of the %d byte mapping", len(p), off, len(m.data))
+	}
+	return copy(m.data[off:], p), nil
+}
+
+// Sync - flushes changes to the mapped memory back to the file (msync(2) with MS_SYNC)
+func (m *Mapped) Sync() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return ErrMappedClosed
+	}
+	return errors.WithStack(unix.Msync(m.data, unix.MS_SYNC))
+}
+
+// Close - unmaps the memory once every With running has returned, closing more than once is a no-op
+func (m *Mapped) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return errors.WithStack(unix.Munmap(data))
+}
+
+// ErrMappedClosed - returned by the methods of a Mapped once it has been closed
+var ErrMappedClosed = errors.New("mapping is closed")
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestMmap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mapped")
+	require.NoError(t, ioutil.WriteFile(filename, make([]byte, 4096), 0o600))
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	require.NoError(t, err)
+
+	// Map it as a peer which received it would
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFile(file))
+	require.NoError(t, file.Close())
+	received, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	mapped, err := oob.Mmap(received, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, mapped.Len())
+
+	_, err = mapped.WriteAt([]byte("mapped"), 100)
+	require.NoError(t, err)
+	_, err = mapped.WriteAt([]byte("too far"), 4093)
+	assert.Error(t, err)
+	require.NoError(t, mapped.With(func(b []byte) error {
+		assert.Equal(t, "mapped", string(b[100:106]))
+		return nil
+	}))
+	require.NoError(t, mapped.Sync())
+	contents, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "mapped", string(contents[100:106]))
+
+	require.NoError(t, mapped.Close())
+	require.NoError(t, mapped.Close())
+	assert.Equal(t, 0, mapped.Len())
+	_, err = mapped.ReadAt(make([]byte, 1), 0)
+	assert.Equal(t, oob.ErrMappedClosed, err)
+	assert.Equal(t, oob.ErrMappedClosed, mapped.With(func(b []byte) error {
+		t.Fatal("With called f after Close")
+		return nil
+	}))
+	assert.Equal(t, oob.ErrMappedClosed, mapped.Sync())
+}
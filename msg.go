@@ -0,0 +1,198 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// sizeofFD - fds are C ints in SCM_RIGHTS messages, which are 4 bytes on every architecture Go supports
+const sizeofFD = 4
+
+// RightsBufferSize - the exact size of control message buffer needed to receive n fds in a single SCM_RIGHTS message
+//                    on the current platform (cmsg header size and alignment vary between GOARCHes)
+//                    every cmsg buffer in oob is sized with it, none of them hardcode 24 (linux/amd64's
+//                    CMSG_SPACE(sizeof(int))), which is too small wherever the header or alignment differ (darwin,
+//                    32 bit linux, netbsd/arm64, ...), truncating the message (MSG_CTRUNC) and leaking the fds
+func RightsBufferSize(n int) int {
+	return syscall.CmsgSpace(n * sizeofFD)
+}
+
+// ErrControlTruncated - returned (wrapped) by every receive when the peer sent more fds in a message than there was
+//                       room for (MSG_CTRUNC), so some were lost, in which case none of them are returned
+//                       RecvFD makes room for WithMaxFDsPerMessage fds, the receives of batches for as many as a
+//                       message can carry
+var ErrControlTruncated = errors.New("control message truncated, fds were lost")
+
+// WithMaxFDsPerMessage - the most fds RecvFD makes room for in a single message, a message carrying more fails with
+//                        ErrControlTruncated rather than having its extras closed, by default as many as the kernel
+//                        allows in one message (SCM_MAX_FD)
+func WithMaxFDsPerMessage(n int) Option {
+	return func(o *options) {
+		o.maxFDsPerMessage = n
+	}
+}
+
+// recvFDRoom - how many fds RecvFD makes room for in a message
+func (o *options) recvFDRoom() int {
+	if o.maxFDsPerMessage <= 0 || o.maxFDsPerMessage > maxFDsPerMessage {
+		return maxFDsPerMessage
+	}
+	return o.maxFDsPerMessage
+}
+
+// sendmsg - sendmsg(2) on the transport of the conn, which honors write deadlines
+func (s *UnixConn) sendmsg(p, oob []byte) (int, error) {
+	return s.sendmsgTo(p, oob, nil)
+}
+
+// sendmsgTo - sendmsg to the address to, which is only needed on unconnected (unixgram) sockets
+//             retried when interrupted (EINTR), as the standard library does, so callers never see it
+//             and when too many fds are in flight (ETOOMANYREFS) if WithTooManyRefsBackoff or WithOnTooManyRefs say so
+func (s *UnixConn) sendmsgTo(p, oob []byte, to syscall.Sockaddr) (int, error) {
+	if err := s.authorizeFDs(oob); err != nil {
+		return 0, err
+	}
+	p, placeholder := s.opts.withPayloadByte(p, oob)
+	var tooManyRefs int
+	var tooManyRefsSince time.Time
+	for {
+		n, err := s.sendmsgOnce(p, oob, to)
+		if placeholder {
+			// As sendmsg(2) on stream sockets, the caller sent no data
+			n = 0
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.ETOOMANYREFS {
+			if tooManyRefs++; tooManyRefs == 1 {
+				tooManyRefsSince = time.Now()
+			}
+			if s.opts.retryTooManyRefs(tooManyRefs, tooManyRefsSince) {
+				continue
+			}
+			err = errors.Wrapf(ErrTooManyRefs, "sending %d bytes of control message failed %d times", len(oob), tooManyRefs)
+		}
+		s.stats.sent(oob, err)
+		return n, err
+	}
+}
+
+// sendmsgOnce - a single attempt at sendmsgTo
+func (s *UnixConn) sendmsgOnce(p, oob []byte, to syscall.Sockaddr) (int, error) {
+	p, oob, err := s.opts.faults.beforeSend(p, oob)
+	if err != nil {
+		return 0, err
+	}
+	return s.transport.sendmsg(p, oob, to)
+}
+
+// recvmsg - recvmsg(2) on the transport of the conn, which honors read deadlines
+func (s *UnixConn) recvmsg(p, oob []byte, flags int) (n, oobn, recvflags int, err error) {
+	n, oobn, recvflags, _, err = s.recvmsgFrom(p, oob, flags)
+	return n, oobn, recvflags, err
+}
+
+// recvmsgFrom - recvmsg, also returning the address the message came from (nil on connected sockets)
+//               retried when interrupted (EINTR), as the standard library does, so callers never see it
+func (s *UnixConn) recvmsgFrom(p, oob []byte, flags int) (n, oobn, recvflags int, from syscall.Sockaddr, err error) {
+	p, _ = s.opts.withPayloadByte(p, oob)
+	for {
+		n, oobn, recvflags, from, err = s.recvmsgOnce(p, oob, flags)
+		if err != syscall.EINTR {
+			if flags&syscall.MSG_PEEK == 0 {
+				s.stats.received(oob[:oobn], err)
+			}
+			return n, oobn, recvflags, from, err
+		}
+	}
+}
+
+// recvmsgOnce - a single attempt at recvmsgFrom
+func (s *UnixConn) recvmsgOnce(p, oob []byte, flags int) (n, oobn, recvflags int, from syscall.Sockaddr, err error) {
+	if oob, err = s.opts.faults.beforeRecv(oob); err != nil {
+		return 0, 0, 0, nil, err
+	}
+	if flags&syscall.MSG_PEEK == 0 {
+		if err = s.opts.checkNoFileHeadroom(oob); err != nil {
+			return 0, 0, 0, nil, err
+		}
+	}
+	if !s.opts.inheritableFDs {
+		flags |= msgCmsgCloexec
+	}
+	if s.opts.passCredentials {
+		// Room for the credentials too, which are taken out again before anything else sees them
+		received := make([]byte, len(oob)+credentialsSpace)
+		n, oobn, recvflags, from, err = s.transport.recvmsg(p, received, flags)
+		oobn = s.takeCredentials(oob, received[:oobn])
+	} else {
+		n, oobn, recvflags, from, err = s.transport.recvmsg(p, oob, flags)
+	}
+	if !s.opts.inheritableFDs && msgCmsgCloexec == 0 {
+		closeOnExecRights(oob[:oobn])
+	}
+	if err == nil && flags&syscall.MSG_PEEK == 0 && recvflags&syscall.MSG_CTRUNC != 0 {
+		// The kernel has already discarded whatever didn't fit, so close what did rather than hand over half
+		fds, _ := parseRights(oob[:oobn])
+		closeFDs(fds)
+		return n, 0, recvflags, from, errors.Wrapf(ErrControlTruncated, "%d bytes of control message buffer were not enough", len(oob))
+	}
+	if err == nil && flags&syscall.MSG_PEEK == 0 {
+		if err = s.authorizeFDs(oob[:oobn]); err != nil {
+			fds, _ := parseRights(oob[:oobn])
+			closeFDs(fds)
+			return n, 0, recvflags, from, err
+		}
+	}
+	if err == nil {
+		err = s.opts.checkControl(oob[:oobn])
+	}
+	return n, oobn, recvflags, from, err
+}
+
+// waitReadable - waits up to timeout for the socket of the *net.UnixConn to become readable (which includes the peer
+//                closing it), without reading anything
+func (s *UnixConn) waitReadable(timeout time.Duration) (bool, error) {
+	rawConn, err := s.UnixConn.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+	var n int
+	var opErr error
+	err = rawConn.Control(func(fd uintptr) {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		for {
+			n, opErr = unix.Poll(fds, int(timeout/time.Millisecond))
+			if opErr != unix.EINTR {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, opErr
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// cmsgLayout - the size of struct cmsghdr and the alignment of control messages, per the C headers of each GOOS
+//              rather than per syscall, so that TestRightsBufferSize checks RightsBufferSize against the ABI
+type cmsgLayout struct {
+	hdr   int
+	align int
+}
+
+func expectedCmsgLayout(t *testing.T) cmsgLayout {
+	ptrSize := int(unsafe.Sizeof(uintptr(0)))
+	switch runtime.GOOS {
+	case "linux":
+		// struct cmsghdr { size_t cmsg_len; int cmsg_level; int cmsg_type; }, aligned to sizeof(long)
+		return cmsgLayout{hdr: ptrSize + 8, align: ptrSize}
+	case "darwin", "ios":
+		// struct cmsghdr { socklen_t cmsg_len; int cmsg_level; int cmsg_type; }, aligned to 4 even on 64 bit
+		return cmsgLayout{hdr: 12, align: 4}
+	case "freebsd", "dragonfly":
+		// socklen_t cmsg_len, aligned to sizeof(long)
+		return cmsgLayout{hdr: 12, align: ptrSize}
+	case "netbsd", "openbsd":
+		// socklen_t cmsg_len, aligned to sizeof(long), except armv7 (8) and netbsd aarch64 (16)
+		align := ptrSize
+		switch {
+		case runtime.GOARCH == "arm":
+			align = 8
+		case runtime.GOOS == "netbsd" && runtime.GOARCH == "arm64":
+			align = 16
+		}
+		return cmsgLayout{hdr: 12, align: align}
+	}
+	t.Skipf("no known cmsghdr layout for %s/%s", runtime.GOOS, runtime.GOARCH)
+	return cmsgLayout{}
+}
+
+func TestRightsBufferSize(t *testing.T) {
+	layout := expectedCmsgLayout(t)
+	roundUp := func(n int) int { return (n + layout.align - 1) &^ (layout.align - 1) }
+	for n := 1; n <= 16; n++ {
+		assert.Equal(t, roundUp(layout.hdr)+roundUp(4*n), oob.RightsBufferSize(n), "n = %d", n)
+	}
+	if runtime.GOOS == "linux" && unsafe.Sizeof(uintptr(0)) == 8 {
+		// The numbers every linux/amd64 C programmer knows: CMSG_SPACE(sizeof(int)) == 24
+		assert.Equal(t, 24, oob.RightsBufferSize(1))
+		assert.Equal(t, 24, oob.RightsBufferSize(2))
+		assert.Equal(t, 32, oob.RightsBufferSize(3))
+	}
+}
+
+func TestRightsBufferSizeIsEnough(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	for _, n := range []int{1, 2, 3, 7, 64, 253} {
+		pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		require.NoError(t, err)
+		rights := make([]int, n)
+		for i := range rights {
+			rights[i] = int(r.Fd())
+		}
+		require.NoError(t, syscall.Sendmsg(pair[0], []byte{0}, syscall.UnixRights(rights...), nil, 0))
+
+		buf := make([]byte, oob.RightsBufferSize(n))
+		_, oobn, flags, _, err := syscall.Recvmsg(pair[1], make([]byte, 1), buf, 0)
+		require.NoError(t, err)
+		assert.Zero(t, flags&syscall.MSG_CTRUNC, "n = %d", n)
+		msgs, err := syscall.ParseSocketControlMessage(buf[:oobn])
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		require.NoError(t, err)
+		assert.Len(t, fds, n)
+		for _, fd := range append(fds, pair[:]...) {
+			_ = syscall.Close(fd)
+		}
+	}
+}
+
+func TestControlTruncated(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	// By default RecvFD has room for every fd, and closes the extras
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFDs(r.Fd(), w.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+
+	// With less room, the message is truncated, and none of its fds leak
+	sender, receiver = newUnixConnPair(t, oob.WithMaxFDsPerMessage(1))
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFDs(r.Fd(), w.Fd()))
+	_, err = receiver.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrControlTruncated), "%+v", err)
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs, after.OpenFDs)
+
+	// As RecvFDsWithData does when it is given less room than was sent
+	sender, receiver = newUnixConnPair(t)
+	require.NoError(t, sender.SendFDs(r.Fd(), w.Fd()))
+	_, _, err = receiver.RecvFDsWithData(make([]byte, 1), 1)
+	assert.True(t, errors.Is(err, oob.ErrControlTruncated), "%+v", err)
+}
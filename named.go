@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NamedFD - an fd with a short name, like systemd's FDNAME, so fds (say an "http", a "grpc" and a "metrics" listener)
+//           can be handed over by name rather than by position
+type NamedFD struct {
+	Name string
+	FD   uintptr
+}
+
+// maxFDNameLen - the longest name a NamedFD may have, as systemd allows for FDNAME
+const maxFDNameLen = 255
+
+// SendNamedFDs - sends fds along with their names, in a single frame whose payload is the names, separated by colons
+//                as systemd's LISTEN_FDNAMES are, so names must be at most 255 printable characters other than ':',
+//                at most 253 fds
+func (s *UnixConn) SendNamedFDs(fds ...NamedFD) (err error) {
+	defer s.opts.profile("SendNamedFDs")()
+	if len(fds) > maxFDsPerMessage {
+		return errors.Errorf("cannot send %d named fds in one frame, the limit is %d", len(fds), maxFDsPerMessage)
+	}
+	names := make([]string, len(fds))
+	rights := make([]int, len(fds))
+	items := make([]uintptr, len(fds))
+	for i, fd := range fds {
+		if err := checkFDName(fd.Name); err != nil {
+			return err
+		}
+		names[i] = fd.Name
+		rights[i] = int(fd.FD)
+		items[i] = fd.FD
+	}
+	s.checkDuplicateSend(items...)
+	defer func() { s.record("SendNamedFDs", err, items...) }()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.writeFrame(&frame{typ: frameNamedFDs, payload: []byte(strings.Join(names, ":")), fds: rights})
+}
+
+// RecvNamedFDs - receives fds sent with SendNamedFDs, in the order they were sent, along with their names
+func (s *UnixConn) RecvNamedFDs() (fds []NamedFD, err error) {
+	defer s.opts.profile("RecvNamedFDs")()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	f, err := s.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if f.typ != frameNamedFDs {
+		closeFDs(f.fds)
+		return nil, errors.Errorf("received unexpected frame type %d while waiting for named fds", f.typ)
+	}
+	var names []string
+	if len(f.payload) > 0 {
+		names = strings.Split(string(f.payload), ":")
+	}
+	if len(names) != len(f.fds) {
+		closeFDs(f.fds)
+		return nil, errors.Errorf("received %d names for %d fds", len(names), len(f.fds))
+	}
+	items := make([]uintptr, len(f.fds))
+	for i, fd := range f.fds {
+		fds = append(fds, NamedFD{Name: names[i], FD: uintptr(fd)})
+		items[i] = uintptr(fd)
+	}
+	s.record("RecvNamedFDs", nil, items...)
+	return fds, nil
+}
+
+// checkFDName - an error if name can't be sent with SendNamedFDs
+func checkFDName(name string) error {
+	if name == "" || len(name) > maxFDNameLen {
+		return errors.Errorf("fd name %q must be 1 to %d characters long", name, maxFDNameLen)
+	}
+	for _, r := range name {
+		if r == ':' || r < ' ' || r == 0x7f {
+			return errors.Errorf("fd name %q may only contain printable characters other than ':'", name)
+		}
+	}
+	return nil
+}
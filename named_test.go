@@ -0,0 +1,49 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestNamedFDs(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+
+	assert.Error(t, sender.SendNamedFDs(oob.NamedFD{Name: "http:8080", FD: os.Stdin.Fd()}))
+	require.NoError(t, sender.SendNamedFDs(
+		oob.NamedFD{Name: "http", FD: os.Stdin.Fd()},
+		oob.NamedFD{Name: "grpc", FD: os.Stdout.Fd()},
+		oob.NamedFD{Name: "metrics", FD: os.Stderr.Fd()},
+	))
+	fds, err := receiver.RecvNamedFDs()
+	require.NoError(t, err)
+	require.Len(t, fds, 3)
+	for i, name := range []string{"http", "grpc", "metrics"} {
+		assert.Equal(t, name, fds[i].Name)
+		assert.NoError(t, syscall.Close(int(fds[i].FD)))
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// SendConn - send the socket of conn (a *net.TCPConn, *net.UnixConn, ... or something wrapping one) to the process on
+//            the other end of the *net.UnixConn, taking its fd through SyscallConn, which (unlike Fd()) leaves conn in
+//            non-blocking mode, so the caller's deadlines keep working, the caller keeps its copy of conn
+func (s *UnixConn) SendConn(conn net.Conn) error {
+	return s.sendSocket("conn", conn)
+}
+
+// SendListener - send the socket of listener to the process on the other end of the *net.UnixConn, as SendConn does
+//                the caller keeps its copy of listener (a *net.UnixListener removes its socket file when closed, see
+//                SetUnlinkOnClose)
+func (s *UnixConn) SendListener(listener net.Listener) error {
+	return s.sendSocket("listener", listener)
+}
+
+// sendSocket - sends the fd of thing, which is a what
+func (s *UnixConn) sendSocket(what string, thing interface{}) error {
+	fd, err := ToFd(thing)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get the fd of the %s", what)
+	}
+	err = s.SendFD(fd)
+	// thing must not be closed (and its fd reused) by a finalizer before it is sent
+	runtime.KeepAlive(thing)
+	return err
+}
+
+// RecvConn - recv a connected stream (or seqpacket) socket of any family as a net.Conn, failing with an error
+//            describing what arrived instead (a listening socket, a datagram socket, a pipe, ...), which is closed
+func (s *UnixConn) RecvConn() (net.Conn, error) {
+	defer s.opts.profile("RecvConn")()
+	file, err := s.recvSocket("a connected stream socket", false, unix.SOCK_STREAM, unix.SOCK_SEQPACKET)
+	if err != nil {
+		return nil, err
+	}
+	// net.FileConn makes its own dup
+	defer func() { _ = file.Close() }()
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "received socket is not a connection")
+	}
+	return conn, nil
+}
+
+// RecvListener - recv a listening socket of any family as a net.Listener, failing with an error describing what
+//                arrived instead (a connected socket, a datagram socket, a pipe, ...), which is closed
+func (s *UnixConn) RecvListener() (net.Listener, error) {
+	defer s.opts.profile("RecvListener")()
+	file, err := s.recvSocket("a listening socket", true, unix.SOCK_STREAM, unix.SOCK_SEQPACKET)
+	if err != nil {
+		return nil, err
+	}
+	// net.FileListener makes its own dup
+	defer func() { _ = file.Close() }()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "received socket is not a listener")
+	}
+	return listener, nil
+}
+
+// RecvPacketConn - recv a datagram socket of any family as a net.PacketConn, failing with an error describing what
+//                  arrived instead (a stream socket, a pipe, ...), which is closed
+func (s *UnixConn) RecvPacketConn() (net.PacketConn, error) {
+	defer s.opts.profile("RecvPacketConn")()
+	file, err := s.recvSocket("a datagram socket", false, unix.SOCK_DGRAM)
+	if err != nil {
+		return nil, err
+	}
+	// net.FilePacketConn makes its own dup
+	defer func() { _ = file.Close() }()
+	conn, err := net.FilePacketConn(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "received socket is not a packet conn")
+	}
+	return conn, nil
+}
+
+// recvSocket - recv an fd, checking that it is a socket of one of types which is (or isn't) listening, closing it
+//              and describing it in the error if not, want describes what was expected
+func (s *UnixConn) recvSocket(want string, listening bool, types ...int) (*os.File, error) {
+	fd, err := s.RecvFD()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSocket(fd, "received", want, listening, types...); err != nil {
+		_ = unix.Close(int(fd))
+		return nil, err
+	}
+	return os.NewFile(fd, fdName(fd)), nil
+}
+
+// checkSocket - an error describing fd unless it is a socket of one of types which is (or isn't) listening, subject
+//               saying where fd came from ("received", "fd 3 is")
+func checkSocket(fd uintptr, subject, want string, listening bool, types ...int) error {
+	kind, err := fdKind(fd)
+	if err != nil {
+		return errors.Wrapf(err, "unable to stat fd %d", fd)
+	}
+	if kind != KindSocket {
+		return errors.Errorf("%s a %s rather than %s", subject, kind, want)
+	}
+	typ, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TYPE)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get the type of socket %d", fd)
+	}
+	accepting, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ACCEPTCONN)
+	if err != nil {
+		return errors.Wrapf(err, "unable to tell whether socket %d is listening", fd)
+	}
+	for _, t := range types {
+		if typ == t && (accepting != 0) == listening {
+			return nil
+		}
+	}
+	description := socketFamilyName(fd) + " " + socketTypeName(typ) + " socket"
+	if accepting != 0 {
+		description = "listening " + description
+	}
+	return errors.Errorf("%s a %s rather than %s", subject, description, want)
+}
+
+// socketFamilyName - the address family of the socket fd, for error messages
+func socketFamilyName(fd uintptr) string {
+	sa, err := unix.Getsockname(int(fd))
+	if err != nil {
+		return "unknown family"
+	}
+	switch sa.(type) {
+	case *unix.SockaddrUnix:
+		return "unix"
+	case *unix.SockaddrInet4:
+		return "inet"
+	case *unix.SockaddrInet6:
+		return "inet6"
+	}
+	return "unknown family"
+}
+
+// socketTypeName - the name of the socket type typ (SO_TYPE), for error messages
+func socketTypeName(typ int) string {
+	switch typ {
+	case unix.SOCK_STREAM:
+		return "stream"
+	case unix.SOCK_DGRAM:
+		return "datagram"
+	case unix.SOCK_SEQPACKET:
+		return "seqpacket"
+	case unix.SOCK_RAW:
+		return "raw"
+	}
+	return "unknown type"
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestRecvTyped(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	fd, err := oob.ToFd(listener)
+	require.NoError(t, err)
+
+	// A listener is a listener
+	require.NoError(t, sender.SendFD(fd))
+	received, err := receiver.RecvListener()
+	require.NoError(t, err)
+	assert.Equal(t, listener.Addr().String(), received.Addr().String())
+	require.NoError(t, received.Close())
+
+	// And not a conn, which is closed rather than leaked
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFD(fd))
+	_, err = receiver.RecvConn()
+	assert.EqualError(t, err, "received a listening inet stream socket rather than a connected stream socket")
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs, after.OpenFDs)
+
+	// A conn is a conn
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	fd, err = oob.ToFd(client)
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFD(fd))
+	conn, err := receiver.RecvConn()
+	require.NoError(t, err)
+	assert.Equal(t, client.LocalAddr().String(), conn.LocalAddr().String())
+	require.NoError(t, conn.Close())
+
+	// A datagram socket is a packet conn
+	packetConn, err := net.ListenPacket("unixgram", filepath.Join(t.TempDir(), "packet"))
+	require.NoError(t, err)
+	defer func() { _ = packetConn.Close() }()
+	fd, err = oob.ToFd(packetConn)
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFD(fd))
+	receivedPacketConn, err := receiver.RecvPacketConn()
+	require.NoError(t, err)
+	assert.Equal(t, packetConn.LocalAddr().String(), receivedPacketConn.LocalAddr().String())
+	require.NoError(t, receivedPacketConn.Close())
+
+	// A pipe is none of them
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	require.NoError(t, sender.SendFile(r))
+	_, err = receiver.RecvPacketConn()
+	assert.EqualError(t, err, "received a fifo rather than a datagram socket")
+}
+
+func TestSendConn(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	require.NoError(t, sender.SendListener(listener))
+	received, err := receiver.RecvListener()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	require.NoError(t, sender.SendConn(client))
+	conn, err := receiver.RecvConn()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.Equal(t, client.LocalAddr().String(), conn.LocalAddr().String())
+
+	// The conn sent is still non-blocking, so its deadlines still work
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = client.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "%+v", err)
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// notifyBufferMax - NOTIFY_BUFFER_MAX, the largest state systemd reads from a notification (PIPE_BUF)
+	notifyBufferMax = 4096
+	// notifyFDMax - NOTIFY_FD_MAX, the most fds systemd accepts with a notification
+	notifyFDMax = 768
+)
+
+// SdNotifyWithFDs - sends state along with fds over $NOTIFY_SOCKET in the datagram sd_pid_notify_with_fds(3) sends
+//                   (the state as its data, the fds in one SCM_RIGHTS message), typically "FDSTORE=1\nFDNAME=name"
+//                   to park fds in systemd's fd store, returning false without error if NOTIFY_SOCKET is not set
+func SdNotifyWithFDs(state string, fds ...uintptr) (bool, error) {
+	return SdPidNotifyWithFDs(0, state, fds...)
+}
+
+// SdPidNotifyWithFDs - SdNotifyWithFDs on behalf of pid, whose credentials are attached (SCM_CREDENTIALS) as
+//                      sd_pid_notify_with_fds(3) does, so the service manager attributes the message to pid (which
+//                      needs privileges unless it is our own), 0 for no credentials, on linux only
+func SdPidNotifyWithFDs(pid int, state string, fds ...uintptr) (bool, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return false, nil
+	}
+	if len(fds) > notifyFDMax {
+		return false, errors.Errorf("cannot send %d fds with a notification, the limit is %d", len(fds), notifyFDMax)
+	}
+	var oob []byte
+	if pid != 0 {
+		creds, err := notifyCredentials(pid)
+		if err != nil {
+			return false, err
+		}
+		oob = append(oob, creds...)
+	}
+	if len(fds) > 0 {
+		rights := make([]int, len(fds))
+		for i, fd := range fds {
+			rights[i] = int(fd)
+		}
+		oob = append(oob, syscall.UnixRights(rights...)...)
+	}
+	// Addressed per message rather than dialed, WriteMsgUnix refuses a dialed unixgram conn
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to create a socket to notify with")
+	}
+	defer func() { _ = unix.Close(fd) }()
+	unix.CloseOnExec(fd)
+	// A leading @ is an abstract socket, which unix.SockaddrUnix already understands
+	if err := unix.Sendmsg(fd, []byte(state), oob, &unix.SockaddrUnix{Name: addr}, 0); err != nil {
+		return false, errors.Wrapf(err, "unable to notify %q on NOTIFY_SOCKET %s", state, addr)
+	}
+	return true, nil
+}
+
+// Notification - a message received on a NotifySocket, as sd_notify(3) and sd_pid_notify_with_fds(3) send them
+type Notification struct {
+	// State - the newline separated VARIABLE=value assignments, as sent
+	State string
+	// Fields - the assignments of State
+	Fields map[string]string
+	// Files - the fds sent with the notification, named for its FDNAME (if any), owned by the caller
+	Files []*os.File
+	// Pid - the pid of the sender, from its credentials (linux only), 0 if unknown
+	Pid int
+}
+
+// NotifySocket - a NOTIFY_SOCKET to receive notifications on, for emulating the service manager (and its fd store)
+//                for the children of a Go supervisor, or in tests
+type NotifySocket struct {
+	*net.UnixConn
+}
+
+// ListenNotify - a NotifySocket bound to address, to be passed to the services notifying it as NOTIFY_SOCKET, which
+//                (like systemd's) asks for the credentials of senders on linux
+func ListenNotify(address string) (*NotifySocket, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: address, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	var opErr error
+	if err = rawConn.Control(func(fd uintptr) { opErr = passCredentials(int(fd)) }); err == nil {
+		err = opErr
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "unable to ask for the credentials of senders")
+	}
+	return &NotifySocket{UnixConn: conn}, nil
+}
+
+// Recv - receives the next notification, a notification with more state or fds than systemd would accept is
+//        discarded (closing its fds) and an error returned
+func (n *NotifySocket) Recv() (*Notification, error) {
+	buf := make([]byte, notifyBufferMax)
+	oob := make([]byte, RightsBufferSize(notifyFDMax)+credentialsSpace)
+	length, oobn, flags, _, err := n.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, errors.Wrap(err, "received malformed control messages")
+	}
+	notification := &Notification{}
+	var fds []int
+	for i := range msgs {
+		if rights, rightsErr := syscall.ParseUnixRights(&msgs[i]); rightsErr == nil {
+			fds = append(fds, rights...)
+			continue
+		}
+		if pid, ok := parseCredentials(&msgs[i]); ok {
+			notification.Pid = pid
+		}
+	}
+	if flags&(syscall.MSG_TRUNC|syscall.MSG_CTRUNC) != 0 {
+		closeFDs(fds)
+		return nil, errors.New("received a notification too big for the service manager, discarded it")
+	}
+	notification.State = string(buf[:length])
+	notification.Fields = make(map[string]string)
+	for _, line := range strings.Split(notification.State, "\n") {
+		if i := strings.IndexByte(line, '='); i > 0 {
+			notification.Fields[line[:i]] = line[i+1:]
+		}
+	}
+	name := notification.Fields["FDNAME"]
+	for _, fd := range fds {
+		notification.Files = append(notification.Files, os.NewFile(uintptr(fd), name))
+	}
+	return notification, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// credentialsSpace - room for the SCM_CREDENTIALS of a sender
+var credentialsSpace = syscall.CmsgSpace(syscall.SizeofUcred)
+
+// notifyCredentials - the SCM_CREDENTIALS naming pid as the sender, with our own uid and gid
+func notifyCredentials(pid int) ([]byte, error) {
+	return unix.UnixCredentials(&unix.Ucred{Pid: int32(pid), Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}), nil
+}
+
+// passCredentials - has the kernel attach the credentials of the sender to every message received on fd
+func passCredentials(fd int) error {
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+}
+
+// parseCredentials - the pid of the sender, if msg is its SCM_CREDENTIALS
+func parseCredentials(msg *syscall.SocketControlMessage) (int, bool) {
+	if msg.Header.Level != syscall.SOL_SOCKET || msg.Header.Type != syscall.SCM_CREDENTIALS {
+		return 0, false
+	}
+	cred, err := syscall.ParseUnixCredentials(msg)
+	if err != nil {
+		return 0, false
+	}
+	return int(cred.Pid), true
+}
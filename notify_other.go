@@ -0,0 +1,44 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package oob
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// credentialsSpace - senders' credentials are only received on linux
+const credentialsSpace = 0
+
+// notifyCredentials - sending credentials (SCM_CREDENTIALS) is linux only
+func notifyCredentials(pid int) ([]byte, error) {
+	return nil, errors.New("notifying on behalf of a pid is only supported on linux")
+}
+
+// passCredentials - the credentials of senders are only received on linux
+func passCredentials(fd int) error {
+	return nil
+}
+
+// parseCredentials - the credentials of senders are only received on linux
+func parseCredentials(msg *syscall.SocketControlMessage) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSdNotifyWithFDs(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "notify")
+	notifySocket, err := oob.ListenNotify(address)
+	require.NoError(t, err)
+	defer func() { _ = notifySocket.Close() }()
+	t.Setenv("NOTIFY_SOCKET", address)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	notified, err := oob.SdNotifyWithFDs("FDSTORE=1\nFDNAME=pipe", r.Fd())
+	require.NoError(t, err)
+	require.True(t, notified)
+
+	notification, err := notifySocket.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "FDSTORE=1\nFDNAME=pipe", notification.State)
+	assert.Equal(t, "1", notification.Fields["FDSTORE"])
+	require.Len(t, notification.Files, 1)
+	stored := notification.Files[0]
+	defer func() { _ = stored.Close() }()
+	assert.Equal(t, "pipe", stored.Name())
+	_, err = w.Write([]byte("x"))
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = stored.Read(buf)
+	require.NoError(t, err)
+	if runtime.GOOS == "linux" {
+		assert.Equal(t, os.Getpid(), notification.Pid)
+	}
+}
+
+func TestSdPidNotifyWithFDs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("credentials are only sent on linux")
+	}
+	address := filepath.Join(t.TempDir(), "notify")
+	notifySocket, err := oob.ListenNotify(address)
+	require.NoError(t, err)
+	defer func() { _ = notifySocket.Close() }()
+	t.Setenv("NOTIFY_SOCKET", address)
+
+	notified, err := oob.SdPidNotifyWithFDs(os.Getpid(), "READY=1")
+	require.NoError(t, err)
+	require.True(t, notified)
+	notification, err := notifySocket.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "1", notification.Fields["READY"])
+	assert.Empty(t, notification.Files)
+	assert.Equal(t, os.Getpid(), notification.Pid)
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	notified, err = oob.SdNotifyWithFDs("READY=1")
+	require.NoError(t, err)
+	assert.False(t, notified)
+}
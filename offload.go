@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"encoding/binary"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// maxOffloadLen - the largest payload a frame may offload into a memfd
+const maxOffloadLen = 1 << 30
+
+// WithMemfdOffload - frame payloads (bundle manifests, ...) of more than threshold bytes are written into a sealed
+//                    memfd which is sent in place of the bytes, and transparently read back by the receiver, so
+//                    multi-megabyte messages (up to 1GiB) don't have to be streamed through the socket
+//                    receivers always accept offloaded payloads, only senders need the option, and only on linux
+//                    (elsewhere payloads are always sent inline)
+func WithMemfdOffload(threshold int) Option {
+	return func(o *options) {
+		o.memfdOffload = threshold
+	}
+}
+
+// offload - if f's payload is over the WithMemfdOffload threshold, a copy of f with its payload offloaded into a
+//           sealed memfd, which the caller must close once the frame is sent
+//           f itself if the payload stays inline
+func (s *UnixConn) offload(f *frame) (*frame, error) {
+	if s.opts.memfdOffload <= 0 || len(f.payload) <= s.opts.memfdOffload || len(f.fds) >= maxFDsPerMessage {
+		return f, nil
+	}
+	if len(f.payload) > maxOffloadLen {
+		return nil, errors.Errorf("cannot send a %d byte frame, the limit is %d", len(f.payload), maxOffloadLen)
+	}
+	memfd, ok, err := sealedMemfd(f.payload)
+	if err != nil || !ok {
+		return f, err
+	}
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(f.payload)))
+	return &frame{
+		typ:     f.typ,
+		flags:   f.flags | frameFlagMemfd,
+		payload: length,
+		fds:     append(append([]int{}, f.fds...), memfd),
+	}, nil
+}
+
+// reassemble - replaces the offloaded payload of a received frame with the contents of its memfd, closing the memfd
+func reassemble(f *frame) error {
+	if f.flags&frameFlagMemfd == 0 {
+		return nil
+	}
+	if len(f.fds) == 0 || len(f.payload) != 8 {
+		return errors.Errorf("received an offloaded frame with a %d byte payload and %d fds", len(f.payload), len(f.fds))
+	}
+	memfd := f.fds[len(f.fds)-1]
+	f.fds = f.fds[:len(f.fds)-1]
+	f.flags &^= frameFlagMemfd
+	defer func() { _ = syscall.Close(memfd) }()
+	length := binary.LittleEndian.Uint64(f.payload)
+	if length > maxOffloadLen {
+		return errors.Errorf("received an offloaded frame announcing %d bytes, the limit is %d", length, maxOffloadLen)
+	}
+	// The sender must not be able to change the payload while (or after) it is read
+	if err := checkSealed(memfd); err != nil {
+		return err
+	}
+	payload := make([]byte, length)
+	for off := 0; off < len(payload); {
+		n, err := unix.Pread(memfd, payload[off:], int64(off))
+		if err != nil {
+			return errors.Wrap(err, "reading offloaded payload")
+		}
+		if n == 0 {
+			return errors.Errorf("offloaded payload ended after %d of %d bytes", off, length)
+		}
+		off += n
+	}
+	f.payload = payload
+	return nil
+}
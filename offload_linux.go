@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// offloadSeals - the seals which make a memfd's contents immutable
+const offloadSeals = SealWrite | SealShrink | SealGrow | SealSeal
+
+// sealedMemfd - a memfd holding payload, sealed against any change
+func sealedMemfd(payload []byte) (fd int, ok bool, err error) {
+	fd, err = unix.MemfdCreate("oob-payload", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return -1, false, errors.Wrap(err, "memfd_create")
+	}
+	for off := 0; off < len(payload); {
+		n, writeErr := unix.Pwrite(fd, payload[off:], int64(off))
+		if writeErr != nil {
+			_ = unix.Close(fd)
+			return -1, false, errors.Wrap(writeErr, "writing offloaded payload")
+		}
+		off += n
+	}
+	if err = MemfdAddSeals(uintptr(fd), offloadSeals); err != nil {
+		_ = unix.Close(fd)
+		return -1, false, err
+	}
+	return fd, true, nil
+}
+
+// checkSealed - fails unless memfd is sealed against any change
+func checkSealed(memfd int) error {
+	seals, err := MemfdSeals(uintptr(memfd))
+	if err != nil {
+		return err
+	}
+	if seals&offloadSeals != offloadSeals {
+		return errors.Errorf("received an offloaded payload whose memfd is only sealed against %s", seals)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestMemfdOffload(t *testing.T) {
+	// A manifest bigger than a frame can carry inline
+	state := strings.Repeat("x", 20<<20)
+	newBundle := func() *oob.Bundle {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = r.Close()
+			_ = w.Close()
+		})
+		b := oob.NewBundle()
+		require.NoError(t, b.Add("pipe", r, map[string]string{"state": state}))
+		return b
+	}
+
+	sender, _ := newUnixConnPair(t)
+	assert.Error(t, sender.SendBundle(newBundle()))
+
+	opts := []oob.Option{oob.WithMemfdOffload(1 << 20)}
+	a, b := newConnPairWithOptions(t, opts, opts)
+	bundle := newBundle()
+	errCh := make(chan error, 1)
+	go func() { errCh <- a.SendBundle(bundle) }()
+	received, err := b.RecvBundle()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	item := received.Get("pipe")
+	require.NotNil(t, item)
+	assert.Equal(t, state, item.Metadata["state"])
+	require.NoError(t, received.Close())
+
+	// Neither end kept the memfd
+	entries, err := os.ReadDir("/proc/self/fd")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		target, _ := os.Readlink("/proc/self/fd/" + entry.Name())
+		assert.NotContains(t, target, "oob-payload")
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package oob
+
+// sealedMemfd - there are no sealable memfds, so payloads stay inline
+func sealedMemfd(payload []byte) (fd int, ok bool, err error) {
+	return -1, false, nil
+}
+
+// checkSealed - only linux peers offload, into memfds sealed (and checked) on their end
+func checkSealed(memfd int) error {
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oobtest
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// conformanceMessages - how many fds the ordering and flow control cases send, each the read end of its own pipe
+const conformanceMessages = 100
+
+// conformanceBatch - the size of the batch the batching case sends, more than fit in one SCM_RIGHTS message
+const conformanceBatch = 300
+
+// conformanceTimeout - how long each case may take before RunConformance closes its pair, so that a transport which
+//                      loses an fd fails the case rather than hanging it
+const conformanceTimeout = 10 * time.Second
+
+// Factory - a connected pair of the transport under test, fds sent by a are received by b, RunConformance closes both
+type Factory func(t *testing.T) (a, b oob.FDTransceiver)
+
+// RunConformance - runs the conformance suite against the transport whose pairs factory makes: fds arrive intact and
+//                  in order, a sender running ahead of its receiver neither loses fds nor fails, batches bigger than
+//                  one message (if it is a BatchFDTransceiver) and bundles (if it is a BundleTransceiver) arrive whole,
+//                  and receiving from a closed peer or sending on a closed conn fails rather than hangs
+//                  each case gets its own pair from factory
+func RunConformance(t *testing.T, factory Factory) {
+	pair := func(t *testing.T) (a, b oob.FDTransceiver) {
+		a, b = factory(t)
+		closePair := func() {
+			_ = a.Close()
+			_ = b.Close()
+		}
+		timeout := time.AfterFunc(conformanceTimeout, closePair)
+		t.Cleanup(func() {
+			timeout.Stop()
+			closePair()
+		})
+		return a, b
+	}
+	t.Run("Ordering", func(t *testing.T) {
+		a, b := pair(t)
+		checkOrdered(t, a, b, 0)
+	})
+	t.Run("FlowControl", func(t *testing.T) {
+		a, b := pair(t)
+		// The receiver starts late, so the sender runs as far ahead as the transport lets it
+		checkOrdered(t, a, b, 50*time.Millisecond)
+	})
+	t.Run("Batch", func(t *testing.T) {
+		a, b := pair(t)
+		sender, ok := a.(oob.BatchFDTransceiver)
+		receiver, ok2 := b.(oob.BatchFDTransceiver)
+		if !ok || !ok2 {
+			t.Skip("not a BatchFDTransceiver")
+		}
+		r, w := newPipe(t)
+		fds := make([]uintptr, conformanceBatch)
+		for i := range fds {
+			fds[i] = r.Fd()
+		}
+		errCh := make(chan error, 1)
+		go func() { errCh <- sender.SendFDs(fds...) }()
+		received, err := receiver.RecvFDs(conformanceBatch)
+		require.NoError(t, err)
+		require.NoError(t, <-errCh)
+		require.Len(t, received, conformanceBatch)
+		for i, fd := range received {
+			file := os.NewFile(fd, "received")
+			if i == 0 {
+				checkSamePipe(t, file, w)
+			}
+			require.NoError(t, file.Close())
+		}
+	})
+	t.Run("Bundle", func(t *testing.T) {
+		a, b := pair(t)
+		sender, ok := a.(oob.BundleTransceiver)
+		receiver, ok2 := b.(oob.BundleTransceiver)
+		if !ok || !ok2 {
+			t.Skip("not a BundleTransceiver")
+		}
+		r, w := newPipe(t)
+		bundle := oob.NewBundle()
+		defer func() { _ = bundle.Close() }()
+		require.NoError(t, bundle.Add("pipe", r, map[string]string{"end": "read"}))
+		require.NoError(t, bundle.Add("other", w, nil))
+		errCh := make(chan error, 1)
+		go func() { errCh <- sender.SendBundle(bundle) }()
+		received, err := receiver.RecvBundle()
+		require.NoError(t, err)
+		require.NoError(t, <-errCh)
+		defer func() { _ = received.Close() }()
+		require.Len(t, received.Items, 2)
+		pipe := received.Get("pipe")
+		require.NotNil(t, pipe)
+		assert.Equal(t, oob.KindFifo, pipe.Kind)
+		assert.Equal(t, "read", pipe.Metadata["end"])
+		checkSamePipe(t, pipe.File, w)
+	})
+	t.Run("PeerClosed", func(t *testing.T) {
+		a, b := pair(t)
+		require.NoError(t, a.Close())
+		_, err := b.RecvFD()
+		assert.Error(t, err)
+	})
+	t.Run("SendAfterClose", func(t *testing.T) {
+		a, _ := pair(t)
+		r, _ := newPipe(t)
+		require.NoError(t, a.Close())
+		assert.Error(t, a.SendFD(r.Fd()))
+	})
+}
+
+// checkOrdered - sends conformanceMessages pipes from a to b, b starting to receive after delay, and checks each
+//                arrives, in order, as the pipe it was sent as
+func checkOrdered(t *testing.T, a, b oob.FDTransceiver, delay time.Duration) {
+	writers := make([]*os.File, conformanceMessages)
+	readers := make([]*os.File, conformanceMessages)
+	for i := range writers {
+		readers[i], writers[i] = newPipe(t)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		for _, r := range readers {
+			if err := a.SendFD(r.Fd()); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- nil
+	}()
+	time.Sleep(delay)
+	for i := range writers {
+		fd, err := b.RecvFD()
+		require.NoError(t, err, "receiving fd %d", i)
+		file := os.NewFile(fd, "received")
+		checkSamePipe(t, file, writers[i])
+		require.NoError(t, file.Close())
+	}
+	require.NoError(t, <-errCh)
+}
+
+// checkSamePipe - checks that r is the read end of the pipe w writes to
+func checkSamePipe(t *testing.T, r, w *os.File) {
+	_, err := w.Write([]byte{'x'})
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, byte('x'), buf[0])
+}
+
+func newPipe(t *testing.T) (r, w *os.File) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = r.Close()
+		_ = w.Close()
+	})
+	return r, w
+}
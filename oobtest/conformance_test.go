@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oobtest_test
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+	"github.com/edwarnicke/oob/oobtest"
+)
+
+func TestRunConformance(t *testing.T) {
+	oobtest.RunConformance(t, func(t *testing.T) (a, b oob.FDTransceiver) {
+		return socketpair(t)
+	})
+}
+
+func socketpair(t *testing.T) (a, b *oob.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	conns := make([]*oob.UnixConn, 2)
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), "socketpair")
+		conn, connErr := net.FileConn(file)
+		require.NoError(t, connErr)
+		// net.FileConn has its own dup of the fd
+		require.NoError(t, file.Close())
+		conns[i] = oob.NewUnixConn(conn.(*net.UnixConn))
+	}
+	return conns[0], conns[1]
+}
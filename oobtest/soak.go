@@ -0,0 +1,267 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+// Package oobtest - load generation for oob, for the package's own CI and for validating deployments
+package oobtest
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/edwarnicke/oob"
+)
+
+// headerLen - the header in front of each payload: when it was sent (unix nanoseconds) and its length
+const headerLen = 12
+
+// Config - what Soak should pump, and between what
+type Config struct {
+	// Duration - how long to pump for
+	Duration time.Duration
+	// Rate - messages per second, 0 for as fast as possible
+	Rate int
+	// FDsPerMessage - fds sent with each message (with SendFDs), at least 1
+	FDsPerMessage int
+	// PayloadBytes - bytes of payload written after the fds of each message
+	PayloadBytes int
+	// Sender and Receiver - the endpoints to pump between, a socketpair if either is nil
+	//                       nothing else may use them while Soak is running
+	Sender   *oob.UnixConn
+	Receiver *oob.UnixConn
+}
+
+// Result - what happened during a Soak
+type Result struct {
+	Messages      int
+	FDsSent       int
+	FDsReceived   int
+	BytesSent     int64
+	BytesReceived int64
+	// P50, P90, P99 and Max - latency from sending a message to having received all of it
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+	// LeakedFDs - how many more fds the process had open afterwards than before
+	LeakedFDs int
+	// Errors - every error either end hit, the first of which stopped the soak
+	Errors []error
+}
+
+// Soak - pumps messages of fds and payload bytes from cfg.Sender to cfg.Receiver for cfg.Duration (or until ctx is
+//        done), the receiver closes every fd it receives, so any fds the process has open afterwards which it did not
+//        have before were leaked
+func Soak(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.FDsPerMessage < 1 {
+		cfg.FDsPerMessage = 1
+	}
+	before, err := oob.Limits()
+	if err != nil {
+		return nil, err
+	}
+	result, err := soak(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	after, err := oob.Limits()
+	if err != nil {
+		return nil, err
+	}
+	result.LeakedFDs = after.OpenFDs - before.OpenFDs
+	return result, nil
+}
+
+func soak(ctx context.Context, cfg Config) (*Result, error) {
+	sender, receiver := cfg.Sender, cfg.Receiver
+	if sender == nil || receiver == nil {
+		var err error
+		if sender, receiver, err = socketpair(); err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+		}()
+	}
+	// What gets sent, over and over
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		_ = r.Close()
+		_ = w.Close()
+	}()
+	fds := make([]uintptr, cfg.FDsPerMessage)
+	for i := range fds {
+		fds[i] = r.Fd()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+	result := &Result{}
+	var mu sync.Mutex
+	fail := func(err error) {
+		mu.Lock()
+		result.Errors = append(result.Errors, err)
+		mu.Unlock()
+		cancel()
+	}
+
+	sent := make(chan struct{}, 1024)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(sent)
+		if err := pump(ctx, sender, fds, cfg, result, &mu, sent); err != nil {
+			fail(err)
+			// The receiver is waiting on a message which will never arrive in full
+			_ = receiver.SetReadDeadline(time.Now())
+		}
+	}()
+	var latencies []time.Duration
+	failed := false
+	for range sent {
+		if failed {
+			continue
+		}
+		latency, recvErr := receive(receiver, cfg, result, &mu)
+		if recvErr != nil {
+			fail(recvErr)
+			failed = true
+			continue
+		}
+		latencies = append(latencies, latency)
+	}
+	wg.Wait()
+
+	result.Messages = len(latencies)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if n := len(latencies); n > 0 {
+		result.P50 = latencies[n*50/100]
+		result.P90 = latencies[n*90/100]
+		result.P99 = latencies[n*99/100]
+		result.Max = latencies[n-1]
+	}
+	return result, nil
+}
+
+// pump - sends a message every 1/cfg.Rate seconds until ctx is done, signaling each one on sent before sending it
+func pump(ctx context.Context, sender *oob.UnixConn, fds []uintptr, cfg Config, result *Result, mu *sync.Mutex, sent chan<- struct{}) error {
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	payload := make([]byte, headerLen+cfg.PayloadBytes)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		default:
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-tick:
+				}
+			}
+		}
+		// Signal first, payloads bigger than the socket buffer only get through while the receiver is reading
+		sent <- struct{}{}
+		binary.LittleEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+		binary.LittleEndian.PutUint32(payload[8:], uint32(cfg.PayloadBytes))
+		if err := sender.SendFDs(fds...); err != nil {
+			return err
+		}
+		mu.Lock()
+		result.FDsSent += len(fds)
+		mu.Unlock()
+		if _, err := sender.Write(payload); err != nil {
+			return errors.WithStack(err)
+		}
+		mu.Lock()
+		result.BytesSent += int64(cfg.PayloadBytes)
+		mu.Unlock()
+	}
+}
+
+// receive - receives one message, closing its fds, and returns how long it took to arrive
+func receive(receiver *oob.UnixConn, cfg Config, result *Result, mu *sync.Mutex) (time.Duration, error) {
+	fds, err := receiver.RecvFDs(cfg.FDsPerMessage)
+	if err != nil {
+		return 0, err
+	}
+	for _, fd := range fds {
+		_ = syscall.Close(int(fd))
+	}
+	header := make([]byte, headerLen)
+	if _, err = io.ReadFull(receiver, header); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(receiver, int64(binary.LittleEndian.Uint32(header[8:]))))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	latency := time.Since(time.Unix(0, int64(binary.LittleEndian.Uint64(header))))
+	mu.Lock()
+	result.FDsReceived += len(fds)
+	result.BytesReceived += n
+	mu.Unlock()
+	return latency, nil
+}
+
+func socketpair() (sender, receiver *oob.UnixConn, err error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	var conns [2]*oob.UnixConn
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), "socketpair")
+		conn, connErr := net.FileConn(file)
+		_ = file.Close()
+		if connErr != nil {
+			err = errors.WithStack(connErr)
+			continue
+		}
+		conns[i] = oob.NewUnixConn(conn.(*net.UnixConn))
+	}
+	if err != nil {
+		for _, conn := range conns {
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+		return nil, nil, err
+	}
+	return conns[0], conns[1], nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oobtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob/oobtest"
+)
+
+func TestSoak(t *testing.T) {
+	result, err := oobtest.Soak(context.Background(), oobtest.Config{
+		Duration:      200 * time.Millisecond,
+		Rate:          500,
+		FDsPerMessage: 3,
+		PayloadBytes:  4096,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Greater(t, result.Messages, 0)
+	assert.Equal(t, result.FDsSent, result.FDsReceived)
+	assert.Equal(t, result.BytesSent, result.BytesReceived)
+	assert.Equal(t, int64(result.Messages*4096), result.BytesReceived)
+	assert.True(t, result.P50 <= result.P99)
+	assert.True(t, result.P99 <= result.Max)
+	assert.Equal(t, 0, result.LeakedFDs)
+}
+
+func TestSoakFlatOut(t *testing.T) {
+	result, err := oobtest.Soak(context.Background(), oobtest.Config{Duration: 100 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Greater(t, result.Messages, 0)
+	assert.Equal(t, 0, result.LeakedFDs)
+}
+
+func TestSoakPayloadBiggerThanSocketBuffer(t *testing.T) {
+	result, err := oobtest.Soak(context.Background(), oobtest.Config{
+		Duration:     100 * time.Millisecond,
+		Rate:         50,
+		PayloadBytes: 4 << 20,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Greater(t, result.Messages, 0)
+	assert.Equal(t, result.BytesSent, result.BytesReceived)
+}
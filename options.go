@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Logger - the logging hook oob reports diagnostics through, satisfied by *log.Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option - an option for NewUnixConn, Listen or Dialer
+type Option func(*options)
+
+type options struct {
+	// all - every Option these options were built from, to pass on to the conns and listeners a conn receives
+	all []Option
+
+	logger             Logger
+	duplicateSendCheck bool
+	prefetch           int
+	watchdog           time.Duration
+	idleTimeout        time.Duration
+	sendQueue          int
+	eventRing          int
+	memfdOffload       int
+	compression        *compression
+	checksums          bool
+	faults             *faultInjector
+	maxConns           int
+	maxPendingFDs      int
+	socketMode         os.FileMode
+	socketOwner        bool
+	socketUID          int
+	socketGID          int
+	removeStaleSocket  bool
+	lockFile           string
+	noFileLimit        bool
+	noFileMargin       int
+	fdQuota            int
+	strict             bool
+	inheritableFDs     bool
+	maxFDsPerMessage   int
+	payloadByte        bool
+	passCredentials    bool
+	authorize          func(peer Credentials) error
+	tooManyRefsWait    time.Duration
+	onTooManyRefs      func(attempts int) bool
+	unclaimedFDTimeout time.Duration
+	shutdownFrame      bool
+	// labels - the pprof labels of the calling goroutines, for WithPprofLabels
+	labels context.Context
+}
+
+func newOptions(opts ...Option) options {
+	o := options{all: opts}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// logf - logs through the Logger set with WithLogger, if any
+func (o *options) logf(format string, v ...interface{}) {
+	if o.logger != nil {
+		o.logger.Printf(format, v...)
+	}
+}
+
+// WithLogger - report diagnostics to logger
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithDuplicateSendCheck - warn (via the Logger set with WithLogger) whenever the same file is sent more than once
+//                          on a connection, which usually means a retry bug that will exhaust the receiver's fd table
+func WithDuplicateSendCheck() Option {
+	return func(o *options) {
+		o.duplicateSendCheck = true
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// *UnixConn wrapping a unixgram socket is a net.PacketConn (ReadFrom and WriteTo come from the *net.UnixConn), so
+// datagram based control protocols keep the standard interfaces alongside fd passing
+var _ net.PacketConn = (*UnixConn)(nil)
+
+// ListenPacket - wraps the result of net.ListenPacket such that unixgram sockets are returned as a oob.UnixConn
+//                (with opts), which can send and receive fds alongside ReadFrom and WriteTo
+func ListenPacket(network, address string, opts ...Option) (net.PacketConn, error) {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		return NewUnixConn(unixConn, opts...), nil
+	}
+	return conn, nil
+}
+
+// SendFDTo - send the file descriptor fd in a datagram to addr, for unconnected unixgram sockets
+func (s *UnixConn) SendFDTo(fd uintptr, addr *net.UnixAddr) error {
+	if addr == nil {
+		return errors.New("SendFDTo needs an address, use SendFD on connected sockets")
+	}
+	s.checkDuplicateSend(fd)
+	defer s.opts.profile("SendFDTo")()
+	defer s.watch("SendFDTo", true)()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	_, err := s.sendmsgTo(nil, syscall.UnixRights(int(fd)), &syscall.SockaddrUnix{Name: addr.Name})
+	s.record("SendFDTo", err, fd)
+	return err
+}
+
+// RecvFDFrom - recv a file descriptor in a datagram, along with the address of its sender, which is nil if the
+//              sender's socket is unbound (or this socket is connected)
+// Note: If you call s.RecvFDFrom() when no fd is available, it will return an error errors.Is ErrNoFD
+func (s *UnixConn) RecvFDFrom() (fd uintptr, addr *net.UnixAddr, err error) {
+	defer s.opts.profile("RecvFDFrom")()
+	defer s.watch("RecvFDFrom", false)()
+	defer func() { s.recordRecv("RecvFDFrom", fd, err) }()
+	if s.prefetch != nil {
+		return 0, nil, errors.New("RecvFDFrom cannot be used WithPrefetch, the prefetcher does not keep the sender's address")
+	}
+	fd, from, err := s.recvFDFrom()
+	if err != nil {
+		return 0, nil, err
+	}
+	if sa, ok := from.(*syscall.SockaddrUnix); ok && sa.Name != "" {
+		addr = &net.UnixAddr{Name: sa.Name, Net: "unixgram"}
+	}
+	return fd, addr, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestPacketConn(t *testing.T) {
+	dir := t.TempDir()
+	serverAddr := &net.UnixAddr{Name: filepath.Join(dir, "server"), Net: "unixgram"}
+	clientAddr := &net.UnixAddr{Name: filepath.Join(dir, "client"), Net: "unixgram"}
+	serverConn, err := oob.ListenPacket("unixgram", serverAddr.Name)
+	require.NoError(t, err)
+	defer func() { _ = serverConn.Close() }()
+	clientConn, err := oob.ListenPacket("unixgram", clientAddr.Name)
+	require.NoError(t, err)
+	defer func() { _ = clientConn.Close() }()
+	server := serverConn.(*oob.UnixConn)
+	client := clientConn.(*oob.UnixConn)
+
+	// Plain datagrams keep working through net.PacketConn
+	_, err = client.WriteTo([]byte("hello"), serverAddr)
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, from, err := server.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	assert.Equal(t, clientAddr.Name, from.String())
+
+	// As do fds, with the sender's address
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	require.NoError(t, client.SendFDTo(r.Fd(), serverAddr))
+	fd, addr, err := server.RecvFDFrom()
+	require.NoError(t, err)
+	received := os.NewFile(fd, "received")
+	defer func() { _ = received.Close() }()
+	require.NotNil(t, addr)
+	assert.Equal(t, clientAddr.Name, addr.Name)
+	_, err = w.Write([]byte("through the fd"))
+	require.NoError(t, err)
+	n, err = received.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "through the fd", string(buf[:n]))
+
+	// A datagram without fds is not an fd
+	_, err = client.WriteTo([]byte("x"), serverAddr)
+	require.NoError(t, err)
+	_, _, err = server.RecvFDFrom()
+	assert.True(t, errors.Is(err, oob.ErrNoFD), "%+v", err)
+
+	assert.Error(t, client.SendFDTo(r.Fd(), nil))
+}
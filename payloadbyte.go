@@ -0,0 +1,39 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+// WithPayloadByte - send a single zero byte of data with every message of fds which has no data of its own, and make
+//                   room to receive one, whatever the socket and transport, for peers which insist on at least one
+//                   byte of real payload with SCM_RIGHTS (Python's socket.send_fds and recv_fds, many Rust crates,
+//                   several C daemons), stream sockets already do so, datagram sockets otherwise send none
+func WithPayloadByte() Option {
+	return func(o *options) {
+		o.payloadByte = true
+	}
+}
+
+// withPayloadByte - p, or the placeholder byte when WithPayloadByte, p is empty and oob carries fds, and whether the
+//                   placeholder was substituted
+func (o *options) withPayloadByte(p, oob []byte) ([]byte, bool) {
+	if !o.payloadByte || len(p) > 0 || len(oob) == 0 {
+		return p, false
+	}
+	return make([]byte, 1), true
+}
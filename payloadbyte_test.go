@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestWithPayloadByte(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	// Datagram sockets are where a message of fds otherwise goes without a byte of payload
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	require.NoError(t, err)
+	peer := fds[1]
+	defer func() { _ = syscall.Close(peer) }()
+	file := os.NewFile(uintptr(fds[0]), "socketpair")
+	conn, err := net.FileConn(file)
+	_ = file.Close()
+	require.NoError(t, err)
+	s := oob.NewUnixConn(conn.(*net.UnixConn), oob.WithPayloadByte())
+	defer func() { _ = s.Close() }()
+
+	require.NoError(t, s.SendFD(r.Fd()))
+	p := make([]byte, 16)
+	buf := make([]byte, oob.RightsBufferSize(1))
+	n, oobn, _, _, err := syscall.Recvmsg(peer, p, buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0}, p[:n])
+	msgs, err := syscall.ParseSocketControlMessage(buf[:oobn])
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	rights, err := syscall.ParseUnixRights(&msgs[0])
+	require.NoError(t, err)
+	require.Len(t, rights, 1)
+	require.NoError(t, syscall.Close(rights[0]))
+
+	// And the byte a peer sends with its fds is consumed along with them
+	require.NoError(t, syscall.Sendmsg(peer, []byte{0}, syscall.UnixRights(int(r.Fd())), nil, 0))
+	fd, err := s.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// PeerCred - the pid, uid and gid of the process on the other end of the conn (SO_PEERCRED), as of when it connected,
+//            so servers can identify who connected before accepting any fds
+func (s *UnixConn) PeerCred() (pid, uid, gid int, err error) {
+	cred, err := s.peerCredentials()
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "unable to get the credentials of the peer")
+	}
+	return cred.Pid, cred.Uid, cred.Gid, nil
+}
+
+// peerPid - the pid of the process on the other end of the socket (SO_PEERCRED), as of when it connected
+func (s *UnixConn) peerPid() (uint32, error) {
+	cred, err := s.peerCredentials()
+	if err != nil {
+		return 0, err
+	}
+	return uint32(cred.Pid), nil
+}
+
+// peerCredentials - the credentials of the process on the other end of the socket (SO_PEERCRED), as of when it
+//                   connected
+func (s *UnixConn) peerCredentials() (Credentials, error) {
+	var cred *unix.Ucred
+	if err := s.peerControl(func(fd int) (err error) {
+		cred, err = unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+		return err
+	}); err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{Pid: int(cred.Pid), Uid: int(cred.Uid), Gid: int(cred.Gid)}, nil
+}
+
+// PeerSecurityLabel - the LSM security label (SELinux context, AppArmor profile...) of the process on the other end
+//                     of the conn (SO_PEERSEC), as of when it connected, for services to log and enforce on
+//                     fails if no LSM which labels sockets is active
+func (s *UnixConn) PeerSecurityLabel() (string, error) {
+	var label string
+	if err := s.peerControl(func(fd int) (err error) {
+		label, err = unix.GetsockoptString(fd, unix.SOL_SOCKET, unix.SO_PEERSEC)
+		return err
+	}); err != nil {
+		return "", errors.Wrap(err, "unable to get the security label of the peer")
+	}
+	return label, nil
+}
+
+// PeerGroups - the supplementary groups of the process on the other end of the conn (SO_PEERGROUPS, linux 4.13 or
+//              later), as of when it connected
+func (s *UnixConn) PeerGroups() ([]int, error) {
+	var groups []uint32
+	if err := s.peerControl(func(fd int) error {
+		buf := make([]uint32, 32)
+		for {
+			size := uint32(len(buf) * 4)
+			_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_SOCKET, unix.SO_PEERGROUPS,
+				uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0)
+			switch errno {
+			case 0:
+				groups = buf[:size/4]
+				return nil
+			case unix.ERANGE:
+				// size is now the room needed
+				buf = make([]uint32, size/4)
+			default:
+				return errno
+			}
+		}
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to get the groups of the peer")
+	}
+	gids := make([]int, len(groups))
+	for i, gid := range groups {
+		gids[i] = int(gid)
+	}
+	return gids, nil
+}
+
+// peerControl - calls f with the fd of the socket
+func (s *UnixConn) peerControl(f func(fd int) error) error {
+	rawConn, err := s.UnixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var opErr error
+	if err := rawConn.Control(func(fd uintptr) { opErr = f(int(fd)) }); err != nil {
+		return err
+	}
+	return opErr
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerCred(t *testing.T) {
+	// A socketpair's peer is this process
+	_, receiver := newUnixConnPair(t)
+	pid, uid, gid, err := receiver.PeerCred()
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+	assert.Equal(t, os.Getuid(), uid)
+	assert.Equal(t, os.Getgid(), gid)
+}
+
+func TestPeerGroups(t *testing.T) {
+	// A socketpair's peer is this process
+	_, receiver := newUnixConnPair(t)
+	groups, err := receiver.PeerGroups()
+	require.NoError(t, err)
+	want, err := os.Getgroups()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, groups)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+)
+
+// peerPid - the pid of the process on the other end of the socket, which is only known on linux (and windows)
+func (s *UnixConn) peerPid() (uint32, error) {
+	return 0, errors.New("the peer pid is not available on this platform")
+}
+
+// PeerCred - the pid, uid and gid of the peer (SO_PEERCRED), which are only known on linux
+func (s *UnixConn) PeerCred() (pid, uid, gid int, err error) {
+	return 0, 0, 0, errors.New("the credentials of the peer are not available on this platform")
+}
+
+// peerCredentials - the credentials of the process on the other end of the socket, which are only known on linux
+func (s *UnixConn) peerCredentials() (Credentials, error) {
+	return Credentials{}, errors.New("the credentials of the peer are not available on this platform")
+}
+
+// PeerSecurityLabel - the LSM security label of the peer (SO_PEERSEC), which is only available on linux
+func (s *UnixConn) PeerSecurityLabel() (string, error) {
+	return "", errors.New("the security label of the peer is not available on this platform")
+}
+
+// PeerGroups - the supplementary groups of the peer (SO_PEERGROUPS), which are only available on linux
+func (s *UnixConn) PeerGroups() ([]int, error) {
+	return nil, errors.New("the groups of the peer are not available on this platform")
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+// PeerExit - the exit of the process on the other end of a conn, reported by OnPeerExit
+type PeerExit struct {
+	// Pid - the pid of the peer, as of when it connected (SO_PEERCRED)
+	Pid int
+	// FDs - the fds received from the peer with RecvManagedFD(s) (including those in a Group) which are still open
+	FDs []*FD
+}
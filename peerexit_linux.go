@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package oob
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// OnPeerExit - calls callback, once, when the process on the other end of the conn exits, with the fds received from
+//              it with RecvManagedFD(s) which are still open, so a supervisor or broker can revoke or clean up after a
+//              client straight away rather than when it next notices the conn has gone
+//              the peer is watched through a pidfd for the pid it had when it connected, so a peer which handed its
+//              end of the socket to another process and exited is reported as soon as it exits
+//              the watch stops when the conn is closed
+func (s *UnixConn) OnPeerExit(callback func(exit PeerExit)) error {
+	pid, err := s.peerPid()
+	if err != nil {
+		return errors.Wrap(err, "unable to get the pid of the peer")
+	}
+	pidfd, err := unix.PidfdOpen(int(pid), 0)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open a pidfd for the peer (pid %d)", pid)
+	}
+	if err = unix.SetNonblock(pidfd, true); err != nil {
+		_ = unix.Close(pidfd)
+		return errors.Wrapf(err, "unable to make the pidfd of the peer (pid %d) non blocking", pid)
+	}
+	watch := os.NewFile(uintptr(pidfd), fmt.Sprintf("pidfd:%d", pid))
+	rawConn, err := watch.SyscallConn()
+	if err != nil {
+		_ = watch.Close()
+		return errors.WithStack(err)
+	}
+	if err = s.managed.setWatch(watch); err != nil {
+		_ = watch.Close()
+		return err
+	}
+	go func() {
+		// A pidfd becomes readable when the process exits
+		err := rawConn.Read(func(fd uintptr) bool {
+			n, err := unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, 0)
+			return err == nil && n > 0
+		})
+		if err != nil {
+			// The conn was closed first
+			return
+		}
+		callback(PeerExit{Pid: int(pid), FDs: s.managed.list()})
+	}()
+	return nil
+}
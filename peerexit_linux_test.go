@@ -0,0 +1,97 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// peerExitEnv - set in the environment of the child TestOnPeerExitChild runs in, to the socket it connects to
+const peerExitEnv = "OOB_TEST_PEER_EXIT_SOCKET"
+
+// TestOnPeerExitChild - runs only in the child started by TestOnPeerExit, playing a client which sends two fds and
+//                       exits
+func TestOnPeerExitChild(t *testing.T) {
+	path, ok := os.LookupEnv(peerExitEnv)
+	if !ok {
+		t.Skip("only runs as a child of TestOnPeerExit")
+	}
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	client := oob.NewUnixConn(conn.(*net.UnixConn))
+	defer func() { _ = client.Close() }()
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	require.NoError(t, client.SendFDs(f.Fd(), f.Fd()))
+}
+
+func TestOnPeerExit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestOnPeerExitChild$", "-test.v")
+	cmd.Env = append(os.Environ(), peerExitEnv+"="+path)
+	require.NoError(t, cmd.Start())
+	conn, err := listener.AcceptUnix()
+	require.NoError(t, err)
+	server := oob.NewUnixConn(conn)
+	defer func() { _ = server.Close() }()
+
+	fds, err := server.RecvManagedFDs(2)
+	require.NoError(t, err)
+	// Closed by the application, so not reported
+	require.NoError(t, fds[0].Close())
+
+	exits := make(chan oob.PeerExit, 1)
+	require.NoError(t, server.OnPeerExit(func(exit oob.PeerExit) { exits <- exit }))
+	assert.Error(t, server.OnPeerExit(func(oob.PeerExit) {}))
+	select {
+	case exit := <-exits:
+		assert.Equal(t, cmd.Process.Pid, exit.Pid)
+		require.Len(t, exit.FDs, 1)
+		assert.Same(t, fds[1], exit.FDs[0])
+		require.NoError(t, exit.FDs[0].Close())
+	case <-time.After(10 * time.Second):
+		t.Fatal("the exit of the peer was not reported")
+	}
+	require.NoError(t, cmd.Wait())
+	assert.Equal(t, 0, server.LiveFDs())
+}
+
+func TestOnPeerExitStopsWithConn(t *testing.T) {
+	// A socketpair's peer is this process, which doesn't exit
+	_, receiver := newUnixConnPair(t)
+	require.NoError(t, receiver.OnPeerExit(func(oob.PeerExit) { t.Error("reported the exit of this process") }))
+	require.NoError(t, receiver.Close())
+	assert.Error(t, receiver.OnPeerExit(func(oob.PeerExit) {}))
+}
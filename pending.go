@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+)
+
+// PendingFDs - how many fds the next receive would return, found without receiving anything, so an event loop can
+//              choose between reading data and receiving fds: the fds sent with the next byte waiting on the socket,
+//              0 if it carries none or nothing is waiting, or WithPrefetch the fds already prefetched
+//              fails rather than wait if another goroutine is receiving
+//              peeking at fds needs linux, elsewhere only WithPrefetch is supported
+func (s *UnixConn) PendingFDs() (int, error) {
+	if s.prefetch != nil {
+		return s.prefetch.len(), nil
+	}
+	if !s.recvMu.TryLock() {
+		return 0, errors.New("cannot peek at the fds pending while receiving")
+	}
+	defer s.recvMu.Unlock()
+	readable, err := s.waitReadable(0)
+	if err != nil || !readable {
+		return 0, err
+	}
+	return s.peekRights()
+}
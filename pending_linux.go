@@ -0,0 +1,37 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oob
+
+import (
+	"syscall"
+)
+
+// peekRights - the number of fds sent with the next byte waiting on the socket, received with MSG_PEEK
+//              linux installs the fds of a peeked message as it does those of a received one, so they are closed
+//              straight away, leaving them queued on the socket for the next receive
+func (s *UnixConn) peekRights() (int, error) {
+	oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+	_, oobn, _, err := s.recvmsg(make([]byte, 1), oob, syscall.MSG_PEEK)
+	if err != nil {
+		return 0, err
+	}
+	fds, err := parseRights(oob[:oobn])
+	closeFDs(fds)
+	if err != nil {
+		return 0, err
+	}
+	return len(fds), nil
+}
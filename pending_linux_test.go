@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestPendingFDs(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	sender, receiver := newUnixConnPair(t)
+
+	// Nothing waiting
+	n, err := receiver.PendingFDs()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// Peeking leaves the fds queued, and doesn't leak the copies the kernel installs
+	require.NoError(t, sender.SendFDs(r.Fd(), w.Fd()))
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		n, err = receiver.PendingFDs()
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+	}
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs, after.OpenFDs)
+	fds, err := receiver.RecvFDs(2)
+	require.NoError(t, err)
+	for _, fd := range fds {
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+
+	// Data is not fds
+	_, err = sender.Write([]byte("x"))
+	require.NoError(t, err)
+	n, err = receiver.PendingFDs()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pings - the Pings waiting for their pong
+type pings struct {
+	mu      sync.Mutex
+	nonce   uint64
+	waiters map[uint64]chan struct{}
+}
+
+func (p *pings) register() (uint64, chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.waiters == nil {
+		p.waiters = make(map[uint64]chan struct{})
+	}
+	p.nonce++
+	ch := make(chan struct{})
+	p.waiters[p.nonce] = ch
+	return p.nonce, ch
+}
+
+func (p *pings) unregister(nonce uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiters, nonce)
+}
+
+func (p *pings) pong(nonce uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch, ok := p.waiters[nonce]; ok {
+		close(ch)
+		delete(p.waiters, nonce)
+	}
+}
+
+// pingPollInterval - how often a Ping waiting for its pong checks whether it is done, or can become the reader
+const pingPollInterval = 10 * time.Millisecond
+
+// Ping - checks that the peer is alive and reading by sending it a ping and waiting (until ctx is done) for its pong
+//        pongs are sent automatically by whichever goroutine on the other end is reading frames (RecvTree,
+//        RecvBundle, ... or its own Ping), so brokers and supervisors can detect dead peers holding their fds
+//        if nothing else is reading frames on this end, Ping reads them itself, one whole frame at a time and only
+//        once one has started to arrive, setting aside any frames which aren't its pong for the next receive, so ctx
+//        being done never interrupts a frame part way through and the read deadline is never touched
+func (s *UnixConn) Ping(ctx context.Context) error {
+	defer s.opts.profile("Ping")()
+	nonce, ponged := s.pings.register()
+	defer s.pings.unregister(nonce)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(payload, nonce)
+	s.sendMu.Lock()
+	err := s.writeFrame(&frame{typ: framePing, payload: payload})
+	s.sendMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ponged:
+			return nil
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "no pong from peer")
+		default:
+		}
+		// Either someone else is reading frames and will see our pong, or we become the reader for a while
+		if s.recvMu.TryLock() {
+			err := s.readUntilPong(ponged, pingPollInterval)
+			s.recvMu.Unlock()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		select {
+		case <-ponged:
+		case <-ctx.Done():
+		case <-time.After(pingPollInterval):
+		}
+	}
+}
+
+// readUntilPong - reads whole frames until ponged is closed or none has started to arrive for timeout, callers must
+//                 hold s.recvMu
+func (s *UnixConn) readUntilPong(ponged chan struct{}, timeout time.Duration) error {
+	for {
+		select {
+		case <-ponged:
+			return nil
+		default:
+		}
+		readable, err := s.waitReadable(timeout)
+		if err != nil || !readable {
+			return err
+		}
+		f, err := s.readAnyFrame()
+		if err != nil {
+			return err
+		}
+		handled, err := s.handleControlFrame(f)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			if err := s.opts.checkPendingFDs(s.pendingFDs() + len(f.fds)); err != nil {
+				closeFDs(f.fds)
+				return err
+			}
+			s.pending = append(s.pending, f)
+		}
+	}
+}
+
+// pendingFDs - how many fds the frames set aside by Ping carry
+func (s *UnixConn) pendingFDs() int {
+	n := 0
+	for _, f := range s.pending {
+		n += len(f.fds)
+	}
+	return n
+}
+
+// handleControlFrame - answers pings, delivers pongs, records the codecs the peer advertised and notes a peer shutting
+//                      down, returning false for any other frame
+func (s *UnixConn) handleControlFrame(f *frame) (bool, error) {
+	switch f.typ {
+	case framePing:
+		closeFDs(f.fds)
+		s.sendMu.Lock()
+		defer s.sendMu.Unlock()
+		return true, s.writeFrame(&frame{typ: framePong, payload: f.payload})
+	case framePong:
+		closeFDs(f.fds)
+		if len(f.payload) == 8 {
+			s.pings.pong(binary.LittleEndian.Uint64(f.payload))
+		}
+		return true, nil
+	case frameCodecs:
+		closeFDs(f.fds)
+		s.codecs.setPeer(strings.Split(string(f.payload), "\n"))
+		return true, nil
+	case frameShutdown:
+		closeFDs(f.fds)
+		atomic.StoreInt32(&s.peerShutdown, 1)
+		return true, nil
+	}
+	return false, nil
+}
+
+// PeerShuttingDown - whether the peer (a Server) has said it is shutting down, which is noticed by whatever next
+//                    receives frames (RecvBundle, RecvTree, Ping, ...) on the conn
+func (s *UnixConn) PeerShuttingDown() bool {
+	return atomic.LoadInt32(&s.peerShutdown) == 1
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestPing(t *testing.T) {
+	a, b := newUnixConnPair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Both ends pinging answer each other's pings
+	errCh := make(chan error, 1)
+	go func() { errCh <- b.Ping(ctx) }()
+	require.NoError(t, a.Ping(ctx))
+	require.NoError(t, <-errCh)
+}
+
+func TestPingWhileReceivingBundle(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	b := oob.NewBundle()
+	require.NoError(t, b.Add("file", file, nil))
+	defer func() { _ = b.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The receiver answers the ping while waiting for the bundle, and the sender sets the bundle aside while
+	// waiting for the pong
+	bundleCh := make(chan *oob.Bundle, 1)
+	go func() {
+		received, err := receiver.RecvBundle()
+		assert.NoError(t, err)
+		bundleCh <- received
+	}()
+	require.NoError(t, sender.Ping(ctx))
+	require.NoError(t, sender.SendBundle(b))
+	received := <-bundleCh
+	require.NotNil(t, received)
+	_ = received.Close()
+
+	// A Ping from the receiver side reads the bundle the sender sent in the meantime and leaves it for RecvBundle
+	require.NoError(t, sender.SendBundle(b))
+	go func() { _ = sender.Ping(ctx) }()
+	require.NoError(t, receiver.Ping(ctx))
+	received, err = receiver.RecvBundle()
+	require.NoError(t, err)
+	_ = received.Close()
+}
+
+func TestPingDeadPeer(t *testing.T) {
+	a, _ := newUnixConnPair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, a.Ping(ctx))
+}
+
+func TestPingTimeoutLeavesConnUsable(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	b := oob.NewBundle()
+	require.NoError(t, b.Add("file", file, nil))
+	defer func() { _ = b.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		assert.Error(t, receiver.Ping(ctx))
+		cancel()
+	}
+	// No goroutine is left behind per timed out Ping
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+
+	// Nor a read deadline in the past for the next receive
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, sender.SendBundle(b))
+	}()
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	_ = received.Close()
+}
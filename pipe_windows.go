@@ -0,0 +1,317 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32                     = windows.NewLazySystemDLL("kernel32.dll")
+	procGetNamedPipeClientProcessID = modkernel32.NewProc("GetNamedPipeClientProcessId")
+	procGetNamedPipeServerProcessID = modkernel32.NewProc("GetNamedPipeServerProcessId")
+	procPeekNamedPipe               = modkernel32.NewProc("PeekNamedPipe")
+)
+
+const pipeBufferSize = 64 << 10
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn - a net.Conn over one end of a named pipe
+//            all I/O is overlapped, so that Close and deadlines can interrupt blocked Reads and Writes
+type pipeConn struct {
+	handle    windows.Handle
+	addr      pipeAddr
+	server    bool
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func (p *pipeConn) Read(b []byte) (int, error) {
+	n, err := p.io(b, false)
+	switch {
+	case err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED || err == windows.ERROR_NO_DATA:
+		return n, io.EOF
+	case err == nil && n == 0 && len(b) > 0:
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (p *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := p.io(b[written:], true)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// io - one overlapped ReadFile or WriteFile, waiting for it to complete or for the deadline
+func (p *pipeConn) io(b []byte, write bool) (int, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = windows.CloseHandle(event) }()
+	o := &windows.Overlapped{HEvent: event}
+	var done uint32
+	if write {
+		err = windows.WriteFile(p.handle, b, &done, o)
+	} else {
+		err = windows.ReadFile(p.handle, b, &done, o)
+	}
+	if err != nil && err != windows.ERROR_IO_PENDING {
+		return int(done), err
+	}
+
+	p.mu.Lock()
+	deadline := p.readDeadline
+	if write {
+		deadline = p.writeDeadline
+	}
+	p.mu.Unlock()
+	timeout := uint32(windows.INFINITE)
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d < 0 {
+			d = 0
+		}
+		timeout = uint32(d / time.Millisecond)
+	}
+	if event, _ := windows.WaitForSingleObject(event, timeout); event == uint32(windows.WAIT_TIMEOUT) {
+		_ = windows.CancelIoEx(p.handle, o)
+		_ = windows.GetOverlappedResult(p.handle, o, &done, true)
+		return int(done), os.ErrDeadlineExceeded
+	}
+	err = windows.GetOverlappedResult(p.handle, o, &done, true)
+	if err == windows.ERROR_OPERATION_ABORTED {
+		return int(done), net.ErrClosed
+	}
+	return int(done), err
+}
+
+// available - how many bytes are waiting to be read
+func (p *pipeConn) available() (int, error) {
+	var avail uint32
+	r, _, err := procPeekNamedPipe.Call(uintptr(p.handle), 0, 0, 0, uintptr(unsafe.Pointer(&avail)), 0)
+	if r == 0 {
+		return 0, err
+	}
+	return int(avail), nil
+}
+
+// peerPid - the pid of the process on the other end of the pipe
+func (p *pipeConn) peerPid() (uint32, error) {
+	proc := procGetNamedPipeClientProcessID
+	if !p.server {
+		proc = procGetNamedPipeServerProcessID
+	}
+	var pid uint32
+	if r, _, err := proc.Call(uintptr(p.handle), uintptr(unsafe.Pointer(&pid))); r == 0 {
+		return 0, errors.Wrap(err, "unable to get peer pid")
+	}
+	return pid, nil
+}
+
+func (p *pipeConn) Close() error {
+	err := net.ErrClosed
+	p.closeOnce.Do(func() {
+		// Wake up anyone blocked in Read or Write first
+		_ = windows.CancelIoEx(p.handle, nil)
+		err = windows.CloseHandle(p.handle)
+	})
+	return err
+}
+
+func (p *pipeConn) LocalAddr() net.Addr  { return p.addr }
+func (p *pipeConn) RemoteAddr() net.Addr { return p.addr }
+
+func (p *pipeConn) SetDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readDeadline, p.writeDeadline = t, t
+	return nil
+}
+
+func (p *pipeConn) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readDeadline = t
+	return nil
+}
+
+func (p *pipeConn) SetWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writeDeadline = t
+	return nil
+}
+
+// pipeListener - accepts connections on a named pipe, one pipe instance per connection
+type pipeListener struct {
+	name string
+	opts []Option
+
+	acceptMu sync.Mutex
+	mu       sync.Mutex
+	pending  windows.Handle
+	closed   bool
+}
+
+// ListenPipe - listens on the named pipe name (\\.\pipe\...), Accept() returns an oob.UnixConn whose SendFD/RecvFD
+//              (and bundles) pass handles by duplicating them into the peer, whose pid is learned from the pipe
+//              remote clients are rejected, since handles can only be duplicated into local processes
+func ListenPipe(name string, opts ...Option) (net.Listener, error) {
+	// The first instance is created now, so the name is ours (FILE_FLAG_FIRST_PIPE_INSTANCE) and clients can connect
+	// before the first Accept
+	handle, err := createPipeInstance(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeListener{name: name, opts: opts, pending: handle}, nil
+}
+
+func createPipeInstance(name string, first bool) (windows.Handle, error) {
+	name16, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	handle, err := windows.CreateNamedPipe(name16, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to create named pipe %s", name)
+	}
+	return handle, nil
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.acceptMu.Lock()
+	defer l.acceptMu.Unlock()
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if l.pending == 0 {
+		handle, err := createPipeInstance(l.name, false)
+		if err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+		l.pending = handle
+	}
+	handle := l.pending
+	l.mu.Unlock()
+
+	err := connectPipe(handle)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = 0
+	if err != nil {
+		_ = windows.CloseHandle(handle)
+		if l.closed {
+			return nil, net.ErrClosed
+		}
+		return nil, err
+	}
+	conn := &pipeConn{handle: handle, addr: pipeAddr(l.name), server: true}
+	return newUnixConn(conn, l.opts...), nil
+}
+
+// connectPipe - waits for a client to connect to the pipe instance handle
+func connectPipe(handle windows.Handle) error {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = windows.CloseHandle(event) }()
+	o := &windows.Overlapped{HEvent: event}
+	switch err = windows.ConnectNamedPipe(handle, o); err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+		return nil
+	case windows.ERROR_IO_PENDING:
+		var done uint32
+		return windows.GetOverlappedResult(handle, o, &done, true)
+	}
+	return err
+}
+
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+	l.closed = true
+	if l.pending != 0 {
+		// Wakes up Accept, which closes the instance, or if nobody is accepting, there's nobody to wake
+		_ = windows.CancelIoEx(l.pending, nil)
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.name)
+}
+
+// DialPipe - connects to the named pipe name (\\.\pipe\...), waiting for a free instance until ctx is done
+func DialPipe(ctx context.Context, name string, opts ...Option) (*UnixConn, error) {
+	name16, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for {
+		handle, err := windows.CreateFile(name16, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+			windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return newUnixConn(&pipeConn{handle: handle, addr: pipeAddr(name)}, opts...), nil
+		}
+		if err != windows.ERROR_PIPE_BUSY {
+			return nil, errors.Wrapf(err, "unable to dial named pipe %s", name)
+		}
+		// Every instance is busy, try again shortly
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "unable to dial named pipe %s", name)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func newPipePair(t *testing.T) (server, client *oob.UnixConn) {
+	name := fmt.Sprintf(`\\.\pipe\oob-test-%d-%d`, os.Getpid(), time.Now().UnixNano())
+	listener, err := oob.ListenPipe(name)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err = oob.DialPipe(ctx, name)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	server, ok := conn.(*oob.UnixConn)
+	require.True(t, ok)
+	t.Cleanup(func() { _ = server.Close() })
+	return server, client
+}
+
+func TestPipeSendFile(t *testing.T) {
+	server, client := newPipePair(t)
+	file, err := ioutil.TempFile(t.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	_, err = file.WriteString("contents")
+	require.NoError(t, err)
+
+	require.NoError(t, client.SendFile(file))
+	received, err := server.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	contents := make([]byte, len("contents"))
+	_, err = received.ReadAt(contents, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(contents))
+}
+
+func TestPipeBundle(t *testing.T) {
+	server, client := newPipePair(t)
+	file, err := ioutil.TempFile(t.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	_, err = file.WriteString("contents")
+	require.NoError(t, err)
+
+	b := oob.NewBundle()
+	require.NoError(t, b.AddHashed("config", file, map[string]string{"version": "1"}))
+	defer func() { _ = b.Close() }()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.SendBundle(b) }()
+	received, err := client.RecvBundle()
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	defer func() { _ = received.Close() }()
+
+	config := received.Get("config")
+	require.NotNil(t, config)
+	assert.Equal(t, oob.KindFile, config.Kind)
+	assert.Equal(t, "1", config.Metadata["version"])
+}
+
+func TestPipeDeadline(t *testing.T) {
+	server, _ := newPipePair(t)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err := server.RecvFD()
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded), "%+v", err)
+}
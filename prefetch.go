@@ -0,0 +1,232 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// WithPrefetch - receive fds eagerly on a background goroutine into a queue, so that RecvFD (and RecvFDs) become a
+//                fast dequeue and a bursty sender isn't stalled by a slow consumer
+//                flow control is by explicit credits: the receiver starts with n, each fd queued spends one and each
+//                fd dequeued returns one, and the goroutine only reads from the socket while it has credit left, so
+//                the sender sees backpressure from the socket buffers rather than the receiver piling up fds without
+//                bound (a single message of up to 253 fds can overdraw the credits, so at most n+252 fds are queued)
+//                the receive side of the connection then belongs to the queue: only use RecvFD, RecvFile and
+//                RecvFDs on it, not Read or the frame based protocols (trees, bundles, ...)
+func WithPrefetch(n int) Option {
+	return func(o *options) {
+		o.prefetch = n
+	}
+}
+
+type prefetched struct {
+	fd  uintptr
+	err error
+	// queued - when the fd was queued, for WithWatchdog
+	queued time.Time
+}
+
+type prefetcher struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// credits - how many more fds may be queued before the goroutine stops reading, guarded by mu
+	credits int
+	queue   []prefetched
+	closed  bool
+	exited  chan struct{}
+}
+
+func (s *UnixConn) startPrefetch(n int) {
+	if err := s.checkNonblocking(); err != nil {
+		// Close could never wake the goroutine out of a blocking recvmsg
+		s.opts.logf("oob: not prefetching: %s", err)
+		return
+	}
+	if s.opts.maxPendingFDs > 0 && n > s.opts.maxPendingFDs {
+		n = s.opts.maxPendingFDs
+	}
+	p := &prefetcher{credits: n, exited: make(chan struct{})}
+	p.cond = sync.NewCond(&p.mu)
+	s.prefetch = p
+	goLabeled("prefetch", func() {
+		defer close(p.exited)
+		for {
+			if !p.waitForCredit() {
+				return
+			}
+			fds, err := s.recvRights()
+			if !p.enqueue(fds, err) || err != nil {
+				return
+			}
+		}
+	})
+}
+
+// checkNonblocking - returns an error if the socket is in blocking mode, which it is left in by anything that
+//                    uses it through an *os.File from (*net.UnixConn).File()
+func (s *UnixConn) checkNonblocking() error {
+	rawConn, err := s.UnixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var flags int
+	var opErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		flags, opErr = unix.FcntlInt(fd, unix.F_GETFL, 0)
+	}); err != nil {
+		return err
+	}
+	if opErr != nil {
+		return opErr
+	}
+	if flags&unix.O_NONBLOCK == 0 {
+		return errors.New("socket is in blocking mode")
+	}
+	return nil
+}
+
+// waitForCredit - waits until there is credit to receive more fds, returning false if the prefetcher was closed
+func (p *prefetcher) waitForCredit() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.credits <= 0 && !p.closed {
+		p.cond.Wait()
+	}
+	return !p.closed
+}
+
+// enqueue - queues fds (and err, if any) spending a credit for each fd, returning false if the prefetcher was closed
+//           in which case fds are closed instead
+func (p *prefetcher) enqueue(fds []int, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		closeFDs(fds)
+		return false
+	}
+	now := time.Now()
+	for _, fd := range fds {
+		p.queue = append(p.queue, prefetched{fd: uintptr(fd), queued: now})
+	}
+	p.credits -= len(fds)
+	if err != nil {
+		p.queue = append(p.queue, prefetched{err: err})
+	}
+	p.cond.Broadcast()
+	return true
+}
+
+// next - the next fd in the queue, waiting for one if it is empty, returning its credit
+func (p *prefetcher) next() (uintptr, error) {
+	return p.nextContext(context.Background())
+}
+
+// nextContext - next, giving up when ctx is done
+func (p *prefetcher) nextContext(ctx context.Context) (uintptr, error) {
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				p.mu.Lock()
+				p.cond.Broadcast()
+				p.mu.Unlock()
+			case <-done:
+			}
+		}()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queue) == 0 && !p.closed {
+		if err := ctx.Err(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		p.cond.Wait()
+	}
+	if len(p.queue) == 0 {
+		return 0, io.EOF
+	}
+	item := p.queue[0]
+	if item.err != nil {
+		// Errors stay at the head of the queue, there is nothing after them
+		return 0, item.err
+	}
+	p.queue = p.queue[1:]
+	p.credits++
+	p.cond.Broadcast()
+	return item.fd, nil
+}
+
+// len - how many fds are queued
+func (p *prefetcher) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.queue)
+	if n > 0 && p.queue[n-1].err != nil {
+		n--
+	}
+	return n
+}
+
+// oldest - when the fd at the head of the queue was queued, false if there isn't one
+func (p *prefetcher) oldest() (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 || p.queue[0].err != nil {
+		return time.Time{}, false
+	}
+	return p.queue[0].queued, true
+}
+
+// close - closes any fds left in the queue and waits for the prefetching goroutine, whose conn must already be closed
+//         (which wakes it up if it is receiving), to exit
+func (p *prefetcher) close() {
+	p.mu.Lock()
+	p.closed = true
+	for _, item := range p.queue {
+		if item.err == nil {
+			closeFDs([]int{int(item.fd)})
+		}
+	}
+	p.queue = nil
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	<-p.exited
+}
+
+// nextRights - the next fds to arrive, from the prefetch queue if there is one
+func (s *UnixConn) nextRights() ([]int, error) {
+	if s.prefetch == nil {
+		return s.recvRights()
+	}
+	fd, err := s.prefetch.next()
+	if err != nil {
+		return nil, err
+	}
+	return []int{int(fd)}, nil
+}
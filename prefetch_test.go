@@ -0,0 +1,123 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestPrefetch(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	sender, receiver := newUnixConnPair(t, oob.WithPrefetch(4))
+
+	require.NoError(t, sender.SendFD(r.Fd()))
+	require.NoError(t, sender.SendFDs(r.Fd(), w.Fd(), r.Fd(), w.Fd(), r.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	assert.NoError(t, syscall.Close(int(fd)))
+	received, err := receiver.RecvFDs(3)
+	require.NoError(t, err)
+	for _, fd := range received {
+		assert.NoError(t, syscall.Close(int(fd)))
+	}
+
+	// The last two are left in the queue, for Close to clean up
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	require.NoError(t, receiver.Close())
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs-3, after.OpenFDs)
+}
+
+func TestPrefetchCredits(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	sender, receiver := newUnixConnPair(t, oob.WithPrefetch(2))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sender.SendFD(r.Fd()))
+	}
+	// The socketpair, and the two fds there is credit for
+	queued := func() int {
+		limits, err := oob.Limits()
+		require.NoError(t, err)
+		return limits.OpenFDs - before.OpenFDs - 2
+	}
+	require.Eventually(t, func() bool { return queued() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, queued())
+
+	// Dequeuing one returns its credit, so one more is received
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+	require.Eventually(t, func() bool { return queued() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, queued())
+}
+
+func TestPrefetchCloseAfterSendFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	_, receiver := newUnixConnPair(t, oob.WithPrefetch(4))
+	// Sending on the conn must not leave it in a state where Close can't stop the prefetching goroutine
+	require.NoError(t, receiver.SendFD(r.Fd()))
+	closed := make(chan error, 1)
+	go func() { closed <- receiver.Close() }()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hung")
+	}
+}
+
+func TestUnclaimedFDTimeout(t *testing.T) {
+	sender, receiver := newUnixConnPair(t, oob.WithPrefetch(4), oob.WithUnclaimedFDTimeout(50*time.Millisecond))
+
+	require.NoError(t, sender.SendFDs(os.Stdin.Fd(), os.Stdout.Fd()))
+	assert.Eventually(t, func() bool { return receiver.Stats().FDsExpired == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// Fds received in time are still handed over
+	require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	assert.NoError(t, syscall.Close(int(fd)))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profileLabel - the pprof label key oob operations (and oob's own goroutines) are tagged with
+const profileLabel = "oob"
+
+// WithPprofLabels - tag the goroutine running each oob operation (SendFD, RecvBundle, SendListenerHandoff, ...) with
+//                   the pprof label oob=<operation> for its duration, so CPU profiles attribute time to oob activity
+//                   pprof has no way to read a goroutine's labels back, so ctx must carry the labels the calling
+//                   goroutines run with (context.Background() if none), they are restored from it afterwards
+//                   oob's own goroutines (WithPrefetch, WithWatchdog, ...) are always labeled
+//                   runtime/trace regions named oob.<operation> are emitted either way
+func WithPprofLabels(ctx context.Context) Option {
+	return func(o *options) {
+		o.labels = ctx
+	}
+}
+
+// profile - starts a trace region for op, and labels the goroutine with it if WithPprofLabels was given, until the
+//           returned func is called
+func (o *options) profile(op string) func() {
+	region := trace.StartRegion(context.Background(), "oob."+op)
+	if o.labels == nil {
+		return region.End
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(o.labels, pprof.Labels(profileLabel, op)))
+	return func() {
+		pprof.SetGoroutineLabels(o.labels)
+		region.End()
+	}
+}
+
+// goLabeled - runs f on a new goroutine labeled oob=<name>
+func goLabeled(name string, f func()) {
+	go pprof.Do(context.Background(), pprof.Labels(profileLabel, name), func(context.Context) { f() })
+}
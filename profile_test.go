@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func goroutineProfile(t *testing.T) string {
+	buf := &bytes.Buffer{}
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(buf, 1))
+	return buf.String()
+}
+
+func TestPprofLabels(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	labels := pprof.WithLabels(context.Background(), pprof.Labels("caller", "test"))
+	sender, receiver := newUnixConnPair(t, oob.WithPprofLabels(labels))
+	fdCh := make(chan uintptr, 1)
+	go func() {
+		pprof.SetGoroutineLabels(labels)
+		fd, err := receiver.RecvFD()
+		assert.NoError(t, err)
+		fdCh <- fd
+	}()
+	require.Eventually(t, func() bool {
+		return strings.Contains(goroutineProfile(t), `"oob":"RecvFD"`)
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, goroutineProfile(t), `"caller":"test"`)
+
+	require.NoError(t, sender.SendFD(r.Fd()))
+	require.NoError(t, syscall.Close(int(<-fdCh)))
+	assert.NotContains(t, goroutineProfile(t), `"oob":"RecvFD"`)
+}
+
+func TestPprofLabelsPrefetch(t *testing.T) {
+	_, _ = newUnixConnPair(t, oob.WithPrefetch(1))
+	assert.Eventually(t, func() bool {
+		return strings.Contains(goroutineProfile(t), `"oob":"prefetch"`)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTraceRegions(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, trace.Start(buf))
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFD(r.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Close(int(fd)))
+	trace.Stop()
+	assert.Contains(t, buf.String(), "oob.SendFD")
+	assert.Contains(t, buf.String(), "oob.RecvFD")
+}
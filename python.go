@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"runtime"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// reductionAck - the byte multiprocessing.reduction acknowledges each batch of fds with on darwin
+const reductionAck = 'A'
+
+// reductionAcks - whether multiprocessing.reduction acknowledges each batch of fds (its ACKNOWLEDGE), which it only
+//                 does on darwin
+var reductionAcks = runtime.GOOS == "darwin"
+
+// SendFDsWithData - sends p along with fds, all of them in a single SCM_RIGHTS control message, exactly as CPython's
+//                   socket.send_fds(sock, [p], fds) does, so a Python peer can receive them with socket.recv_fds
+//                   (or a Go one with RecvFDsWithData), at most 253 fds
+func (s *UnixConn) SendFDsWithData(p []byte, fds ...uintptr) (err error) {
+	s.checkDuplicateSend(fds...)
+	defer s.opts.profile("SendFDsWithData")()
+	defer s.watch("SendFDsWithData", true)()
+	defer func() { s.record("SendFDsWithData", err, fds...) }()
+	if len(fds) > maxFDsPerMessage {
+		return errors.Errorf("cannot send %d fds in one message, the limit is %d", len(fds), maxFDsPerMessage)
+	}
+	rights := make([]int, len(fds))
+	for i, fd := range fds {
+		rights[i] = int(fd)
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	n, err := s.sendmsg(p, syscall.UnixRights(rights...))
+	if err != nil {
+		return err
+	}
+	// The fds went with the first byte, a stream socket may take the rest separately
+	for n < len(p) {
+		m, err := s.UnixConn.Write(p[n:])
+		if err != nil {
+			return err
+		}
+		n += m
+	}
+	return nil
+}
+
+// RecvFDsWithData - receives a single message into p along with up to maxFDs fds, as CPython's
+//                   socket.recv_fds(sock, len(p), maxFDs) does, returning how much of p was filled
+//                   if more than maxFDs fds arrived, every one of them is closed and an error returned
+func (s *UnixConn) RecvFDsWithData(p []byte, maxFDs int) (n int, fds []uintptr, err error) {
+	defer s.opts.profile("RecvFDsWithData")()
+	defer s.watch("RecvFDsWithData", false)()
+	defer func() { s.record("RecvFDsWithData", err, fds...) }()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	return s.recvFDsWithData(p, maxFDs)
+}
+
+// recvFDsWithData - RecvFDsWithData, callers must hold s.recvMu
+func (s *UnixConn) recvFDsWithData(p []byte, maxFDs int) (n int, fds []uintptr, err error) {
+	oob := make([]byte, RightsBufferSize(maxFDs))
+	n, oobn, _, err := s.recvmsg(p, oob, 0)
+	if errors.Is(err, ErrControlTruncated) {
+		return 0, nil, errors.Wrapf(err, "received more than the %d fds asked for", maxFDs)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	rights, err := parseRights(oob[:oobn])
+	if err == nil && len(rights) > maxFDs {
+		// CmsgSpace rounds the buffer up, so it can fit more than asked for without the kernel truncating anything
+		err = errors.Wrapf(ErrControlTruncated, "received %d fds, more than the %d asked for", len(rights), maxFDs)
+	}
+	if err != nil {
+		closeFDs(rights)
+		return 0, nil, err
+	}
+	for _, fd := range rights {
+		fds = append(fds, uintptr(fd))
+	}
+	return n, fds, nil
+}
+
+// SendFDsReduction - sends fds as multiprocessing.reduction.sendfds(sock, fds) does - a single byte (the number of fds
+//                    modulo 256) with all of them in one SCM_RIGHTS message - and on darwin waits for the receiver's
+//                    acknowledgement as it does, so a Python peer can receive them with
+//                    multiprocessing.reduction.recvfds, at most 253 fds
+func (s *UnixConn) SendFDsReduction(fds ...uintptr) error {
+	if err := s.SendFDsWithData([]byte{byte(len(fds) % 256)}, fds...); err != nil {
+		return err
+	}
+	if !reductionAcks {
+		return nil
+	}
+	ack := make([]byte, 1)
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if _, err := s.UnixConn.Read(ack); err != nil {
+		return errors.Wrap(err, "unable to receive the acknowledgement of the fds")
+	}
+	if ack[0] != reductionAck {
+		return errors.Errorf("received %q rather than the acknowledgement of the fds", ack[0])
+	}
+	return nil
+}
+
+// RecvFDsReduction - receives up to n fds sent by multiprocessing.reduction.sendfds (or SendFDsReduction) as
+//                    multiprocessing.reduction.recvfds(sock, n) does, acknowledging them on darwin as it does
+//                    if the count sent does not match what arrived, the fds are closed and an error returned
+func (s *UnixConn) RecvFDsReduction(n int) ([]uintptr, error) {
+	count := make([]byte, 1)
+	m, fds, err := s.RecvFDsWithData(count, n)
+	if err != nil {
+		return nil, err
+	}
+	if m == 0 && len(fds) == 0 {
+		return nil, errors.New("received EOF rather than fds")
+	}
+	if reductionAcks {
+		s.sendMu.Lock()
+		_, err = s.UnixConn.Write([]byte{reductionAck})
+		s.sendMu.Unlock()
+		if err != nil {
+			closeUintptrs(fds)
+			return nil, errors.Wrap(err, "unable to acknowledge the fds")
+		}
+	}
+	if m != 1 || len(fds)%256 != int(count[0]) {
+		closeUintptrs(fds)
+		return nil, errors.Errorf("%d fds were sent but %d were received", count[0], len(fds))
+	}
+	return fds, nil
+}
+
+func closeUintptrs(fds []uintptr) {
+	for _, fd := range fds {
+		_ = syscall.Close(int(fd))
+	}
+}
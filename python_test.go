@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// pythonPeer - receives a pipe with socket.recv_fds, writes the data it came with into it, sends it back with
+//              socket.send_fds, then returns two fds received with multiprocessing.reduction.recvfds with
+//              multiprocessing.reduction.sendfds
+const pythonPeer = `
+import os, socket
+from multiprocessing import reduction
+sock = socket.socket(fileno=3)
+msg, fds, flags, addr = socket.recv_fds(sock, 16, 4)
+os.write(fds[0], msg)
+socket.send_fds(sock, [b"back"], fds)
+reduction.sendfds(sock, reduction.recvfds(sock, 2))
+`
+
+func TestPythonInterop(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 is not installed")
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	peerEnd := os.NewFile(uintptr(fds[1]), "python")
+	ourEnd := os.NewFile(uintptr(fds[0]), "go")
+	conn, err := net.FileConn(ourEnd)
+	require.NoError(t, err)
+	require.NoError(t, ourEnd.Close())
+	s := oob.NewUnixConn(conn.(*net.UnixConn))
+	defer func() { _ = s.Close() }()
+
+	cmd := exec.Command(python, "-c", pythonPeer)
+	cmd.ExtraFiles = []*os.File{peerEnd}
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+	require.NoError(t, peerEnd.Close())
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	require.NoError(t, s.SendFDsWithData([]byte("hello"), w.Fd()))
+	require.NoError(t, w.Close())
+	buf := make([]byte, 5)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	n, back, err := s.RecvFDsWithData(buf, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "back", string(buf[:n]))
+	require.Len(t, back, 1)
+	returned := os.NewFile(back[0], "returned")
+	defer func() { _ = returned.Close() }()
+
+	require.NoError(t, s.SendFDsReduction(r.Fd(), returned.Fd()))
+	fds2, err := s.RecvFDsReduction(2)
+	require.NoError(t, err)
+	require.Len(t, fds2, 2)
+	for _, fd := range fds2 {
+		require.NoError(t, os.NewFile(fd, "reduction").Close())
+	}
+	require.NoError(t, cmd.Wait())
+}
+
+func TestRecvFDsWithDataTooMany(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	require.NoError(t, sender.SendFDsWithData([]byte("x"), f.Fd(), f.Fd(), f.Fd()))
+	_, _, err = receiver.RecvFDsWithData(make([]byte, 1), 1)
+	assert.Error(t, err)
+}
+
+func TestSendFDsWithDataAttached(t *testing.T) {
+	// As runc's console socket and vhost-user expect, the fd arrives with the message it was sent with and no other
+	sender, receiver := newUnixConnPair(t)
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	_, err = sender.Write([]byte("header"))
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFDsWithData([]byte("console"), f.Fd()))
+
+	// On a stream socket a read which reaches the fds gets them, so fixed size headers are read on their own
+	p := make([]byte, 16)
+	n, fds, err := receiver.RecvFDsWithData(p[:len("header")], 1)
+	require.NoError(t, err)
+	assert.Equal(t, "header", string(p[:n]))
+	assert.Empty(t, fds)
+	n, fds, err = receiver.RecvFDsWithData(p, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "console", string(p[:n]))
+	require.Len(t, fds, 1)
+	assert.NoError(t, syscall.Close(int(fds[0])))
+}
+
+func TestFDsReduction(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendFDsReduction(f.Fd(), f.Fd()) }()
+	fds, err := receiver.RecvFDsReduction(2)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	require.Len(t, fds, 2)
+	for _, fd := range fds {
+		require.NoError(t, os.NewFile(fd, "received").Close())
+	}
+}
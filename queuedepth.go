@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+// QueueDepths - how far behind the two ends of a connection are, for backpressure and monitoring
+type QueueDepths struct {
+	// Unread - bytes (including the one byte carrying each SendFD's fd) waiting in the receive buffer of the socket,
+	//          SIOCINQ on linux and SO_NREAD on darwin
+	Unread int
+	// Unsent - bytes written to the socket which the peer has not yet read, SIOCOUTQ on linux and SO_NWRITE on darwin
+	Unsent int
+	// Prefetched - fds already received by WithPrefetch which RecvFD has not yet dequeued
+	Prefetched int
+	// QueuedSends - Writes and SendFDs waiting in WithSendQueue's queue, not yet handed to the socket
+	QueuedSends int
+}
+
+// QueueDepths - the current QueueDepths of the connection, a receiver falling behind shows up as a growing Unsent on
+//               the sending end and a growing Unread (or Prefetched) on the receiving end
+//               The kernel does not count the SCM_RIGHTS messages in a stream socket's queues, so fds in flight are
+//               only known once they have made it into one of oob's own queues
+func (s *UnixConn) QueueDepths() (*QueueDepths, error) {
+	rawConn, err := s.UnixConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	depths := &QueueDepths{}
+	var opErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		depths.Unread, depths.Unsent, opErr = socketQueues(int(fd))
+	}); err != nil {
+		return nil, err
+	}
+	if opErr != nil {
+		return nil, opErr
+	}
+	if s.prefetch != nil {
+		depths.Prefetched = s.prefetch.len()
+	}
+	if s.sendQueue != nil {
+		depths.QueuedSends = len(s.sendQueue.items)
+	}
+	return depths, nil
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// socketQueues - the bytes waiting in fd's receive buffer and those sent but not yet read by the peer
+func socketQueues(fd int) (unread, unsent int, err error) {
+	if unread, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_NREAD); err != nil {
+		return 0, 0, err
+	}
+	if unsent, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_NWRITE); err != nil {
+		return 0, 0, err
+	}
+	return unread, unsent, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package oob_test
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestQueueDepths(t *testing.T) {
+	receiver, sender := newUnixConnPair(t)
+	_, err := sender.Write([]byte("0123456789"))
+	require.NoError(t, err)
+
+	depths, err := receiver.QueueDepths()
+	require.NoError(t, err)
+	assert.Equal(t, 10, depths.Unread)
+	depths, err = sender.QueueDepths()
+	require.NoError(t, err)
+	assert.True(t, depths.Unsent >= 10, "unsent %d", depths.Unsent)
+
+	_, err = io.ReadFull(receiver, make([]byte, 10))
+	require.NoError(t, err)
+	depths, err = receiver.QueueDepths()
+	require.NoError(t, err)
+	assert.Zero(t, depths.Unread)
+	depths, err = sender.QueueDepths()
+	require.NoError(t, err)
+	assert.Zero(t, depths.Unsent)
+}
+
+func TestQueueDepthsPrefetched(t *testing.T) {
+	sender, receiver := newUnixConnPair(t, oob.WithPrefetch(4))
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	require.NoError(t, sender.SendFile(f))
+	require.NoError(t, sender.SendFile(f))
+
+	prefetched := func(n int) func() bool {
+		return func() bool {
+			depths, depthsErr := receiver.QueueDepths()
+			return depthsErr == nil && depths.Prefetched == n
+		}
+	}
+	require.Eventually(t, prefetched(2), time.Second, time.Millisecond)
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, os.NewFile(fd, "received").Close())
+	assert.True(t, prefetched(1)())
+}
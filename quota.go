@@ -0,0 +1,167 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFDQuota - returned by RecvManagedFD and RecvManagedFDs when receiving would exceed the conn's WithFDQuota
+var ErrFDQuota = errors.New("fd quota of the connection is used up")
+
+// WithFDQuota - allow at most n fds received with RecvManagedFD and RecvManagedFDs to be open at once per conn, so
+//               one client of a broker cannot consume the whole descriptor budget of the process
+//               each conn (including every conn accepted by a listener WithFDQuota) has a quota of its own, a receive
+//               which would exceed it is refused with ErrFDQuota and reads nothing, so can be retried once some of
+//               the FDs it delivered have been closed
+func WithFDQuota(n int) Option {
+	return func(o *options) {
+		o.fdQuota = n
+	}
+}
+
+// FD - a received fd, counted against the quota of the conn it came from until it is closed
+type FD struct {
+	fd      uintptr
+	release func()
+	once    sync.Once
+}
+
+// Fd - the fd, which remains owned by the FD, close the FD rather than the fd
+func (f *FD) Fd() uintptr {
+	return f.fd
+}
+
+// Close - closes the fd, and returns it to the quota of its conn
+func (f *FD) Close() error {
+	err := errors.WithStack(os.ErrClosed)
+	f.once.Do(func() {
+		err = errors.WithStack(syscall.Close(int(f.fd)))
+		f.release()
+	})
+	return err
+}
+
+// LiveFDs - how many fds received with RecvManagedFD and RecvManagedFDs are still open
+func (s *UnixConn) LiveFDs() int {
+	return int(atomic.LoadInt32(&s.liveFDs))
+}
+
+// RecvManagedFD - like RecvFD, but returns an FD counted against WithFDQuota until it is closed
+func (s *UnixConn) RecvManagedFD() (*FD, error) {
+	fds, err := s.recvManagedFDs(1, func(int) ([]uintptr, error) {
+		fd, err := s.RecvFD()
+		if err != nil {
+			return nil, err
+		}
+		return []uintptr{fd}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fds[0], nil
+}
+
+// RecvManagedFDs - like RecvFDs, but returns FDs counted against WithFDQuota until they are closed
+func (s *UnixConn) RecvManagedFDs(n int) ([]*FD, error) {
+	return s.recvManagedFDs(n, s.RecvFDs)
+}
+
+// recvManagedFDs - reserves n fds of the quota, then receives them with recv
+func (s *UnixConn) recvManagedFDs(n int, recv func(n int) ([]uintptr, error)) ([]*FD, error) {
+	live := atomic.AddInt32(&s.liveFDs, int32(n))
+	if s.opts.fdQuota > 0 && int(live) > s.opts.fdQuota {
+		atomic.AddInt32(&s.liveFDs, -int32(n))
+		return nil, errors.Wrapf(ErrFDQuota, "%d fds are open, receiving %d more would exceed the quota of %d", int(live)-n, n, s.opts.fdQuota)
+	}
+	fds, err := recv(n)
+	if err != nil {
+		atomic.AddInt32(&s.liveFDs, -int32(n))
+		return nil, err
+	}
+	managed := make([]*FD, len(fds))
+	s.managed.mu.Lock()
+	defer s.managed.mu.Unlock()
+	if s.managed.live == nil {
+		s.managed.live = make(map[*FD]struct{})
+	}
+	for i, fd := range fds {
+		f := &FD{fd: fd}
+		f.release = func() {
+			atomic.AddInt32(&s.liveFDs, -1)
+			s.managed.mu.Lock()
+			delete(s.managed.live, f)
+			s.managed.mu.Unlock()
+		}
+		s.managed.live[f] = struct{}{}
+		managed[i] = f
+	}
+	return managed, nil
+}
+
+// managedFDs - the FDs received with RecvManagedFD(s) which are still open, and the watch (OnPeerExit) which reports
+//              them when the peer exits
+type managedFDs struct {
+	mu     sync.Mutex
+	live   map[*FD]struct{}
+	watch  io.Closer
+	closed bool
+}
+
+// setWatch - sets the watch, which is closed along with the conn
+func (m *managedFDs) setWatch(watch io.Closer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.WithStack(os.ErrClosed)
+	}
+	if m.watch != nil {
+		return errors.New("the exit of the peer is already being watched")
+	}
+	m.watch = watch
+	return nil
+}
+
+// close - stops the watch, when the conn is closed
+func (m *managedFDs) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	if m.watch != nil {
+		_ = m.watch.Close()
+	}
+}
+
+// list - the FDs which are still open
+func (m *managedFDs) list() []*FD {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fds := make([]*FD, 0, len(m.live))
+	for fd := range m.live {
+		fds = append(fds, fd)
+	}
+	return fds
+}
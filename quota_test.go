@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestFDQuota(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	sender, receiver := newUnixConnPair(t, oob.WithFDQuota(3))
+	require.NoError(t, sender.SendFDs(f.Fd(), f.Fd()))
+	require.NoError(t, sender.SendFile(f))
+	require.NoError(t, sender.SendFile(f))
+
+	fds, err := receiver.RecvManagedFDs(2)
+	require.NoError(t, err)
+	require.Len(t, fds, 2)
+	fd, err := receiver.RecvManagedFD()
+	require.NoError(t, err)
+	assert.Equal(t, 3, receiver.LiveFDs())
+
+	// The quota is used up, and nothing is read
+	_, err = receiver.RecvManagedFD()
+	assert.True(t, errors.Is(err, oob.ErrFDQuota), "%+v", err)
+	assert.Equal(t, 3, receiver.LiveFDs())
+
+	// Closing an FD returns it to the quota, once
+	require.NoError(t, fd.Close())
+	assert.Error(t, fd.Close())
+	assert.Equal(t, 2, receiver.LiveFDs())
+	fd, err = receiver.RecvManagedFD()
+	require.NoError(t, err)
+	assert.NotZero(t, fd.Fd())
+
+	for _, fd := range append(fds, fd) {
+		require.NoError(t, fd.Close())
+	}
+	assert.Equal(t, 0, receiver.LiveFDs())
+
+	// Each conn has a quota of its own
+	other, otherReceiver := newUnixConnPair(t, oob.WithFDQuota(1))
+	require.NoError(t, other.SendFile(f))
+	fd, err = otherReceiver.RecvManagedFD()
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// readerBufferSize - how much a Reader reads at once
+const readerBufferSize = 4096
+
+// ErrFDNotReached - returned by Reader.ReadFD when the bytes the next fd came with haven't all been read yet
+var ErrFDNotReached = errors.New("the bytes the next fd arrived with have not been read yet")
+
+// queuedFD - an fd received by a Reader, and the offset in the stream just past the bytes it arrived with
+type queuedFD struct {
+	fd  uintptr
+	end int64
+}
+
+// Reader - a buffered reader of a UnixConn which, unlike a bufio.Reader wrapped around it, keeps the fds that arrive
+//          with the bytes it buffers, in order, rather than silently discarding them
+//          an fd becomes available to ReadFD once the bytes sent with it have been read, so a protocol of headers
+//          each sent along with an fd reads a header, then its fd
+//          don't mix it with other receives on the same conn, and CloseFDs any fds left unread when done with it
+type Reader struct {
+	conn *UnixConn
+	buf  []byte
+	r, w int
+	// off - the offset in the stream of buf[r]
+	off int64
+	fds []queuedFD
+	err error
+}
+
+// NewReader - a Reader of conn
+func NewReader(conn *UnixConn) *Reader {
+	return &Reader{conn: conn, buf: make([]byte, readerBufferSize)}
+}
+
+// fill - reads the next message into the buffer, queueing its fds
+func (b *Reader) fill() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.r > 0 {
+		copy(b.buf, b.buf[b.r:b.w])
+		b.w -= b.r
+		b.r = 0
+	}
+	oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+	b.conn.recvMu.Lock()
+	n, oobn, _, err := b.conn.recvmsg(b.buf[b.w:], oob, 0)
+	b.conn.recvMu.Unlock()
+	if oobn > 0 {
+		rights, parseErr := parseRights(oob[:oobn])
+		for _, fd := range rights {
+			// A read ends with the message the fds came with, though it may have begun with earlier ones
+			b.fds = append(b.fds, queuedFD{fd: uintptr(fd), end: b.off + int64(b.w-b.r+n)})
+		}
+		if parseErr != nil && err == nil {
+			err = parseErr
+		}
+	}
+	if n > 0 {
+		b.w += n
+	}
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+	if err != nil {
+		b.err = err
+		return err
+	}
+	return nil
+}
+
+// Buffered - how many bytes can be read without receiving any more
+func (b *Reader) Buffered() int {
+	return b.w - b.r
+}
+
+// Read - reads into p, io.Reader
+func (b *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.r == b.w {
+		if err := b.fill(); err != nil && b.r == b.w {
+			return 0, err
+		}
+	}
+	n := copy(p, b.buf[b.r:b.w])
+	b.consume(n)
+	return n, nil
+}
+
+// ReadByte - reads a single byte, io.ByteReader
+func (b *Reader) ReadByte() (byte, error) {
+	for b.r == b.w {
+		if err := b.fill(); err != nil && b.r == b.w {
+			return 0, err
+		}
+	}
+	c := b.buf[b.r]
+	b.consume(1)
+	return c, nil
+}
+
+// ReadBytes - reads up to and including the first delim, like bufio.Reader.ReadBytes
+func (b *Reader) ReadBytes(delim byte) ([]byte, error) {
+	var line []byte
+	for {
+		if i := bytes.IndexByte(b.buf[b.r:b.w], delim); i >= 0 {
+			line = append(line, b.buf[b.r:b.r+i+1]...)
+			b.consume(i + 1)
+			return line, nil
+		}
+		line = append(line, b.buf[b.r:b.w]...)
+		b.consume(b.w - b.r)
+		if err := b.fill(); err != nil && b.r == b.w {
+			return line, err
+		}
+	}
+}
+
+// ReadString - reads up to and including the first delim, like bufio.Reader.ReadString
+func (b *Reader) ReadString(delim byte) (string, error) {
+	line, err := b.ReadBytes(delim)
+	return string(line), err
+}
+
+// ReadFD - the next fd, once the bytes it was sent with have been read, receiving more if none are queued and no
+//          bytes are buffered, ErrFDNotReached if bytes up to it are still to be read
+func (b *Reader) ReadFD() (uintptr, error) {
+	for {
+		if len(b.fds) > 0 {
+			if b.fds[0].end > b.off {
+				return 0, errors.Wrapf(ErrFDNotReached, "%d bytes are still to be read", b.fds[0].end-b.off)
+			}
+			fd := b.fds[0].fd
+			b.fds = b.fds[1:]
+			return fd, nil
+		}
+		if b.r != b.w {
+			return 0, errors.Wrap(ErrFDNotReached, "bytes are buffered before any fd")
+		}
+		if err := b.fill(); err != nil && len(b.fds) == 0 {
+			return 0, err
+		}
+	}
+}
+
+// CloseFDs - closes every fd received but not read with ReadFD
+func (b *Reader) CloseFDs() error {
+	var err error
+	for _, queued := range b.fds {
+		if closeErr := syscall.Close(int(queued.fd)); closeErr != nil && err == nil {
+			err = errors.WithStack(closeErr)
+		}
+	}
+	b.fds = nil
+	return err
+}
+
+func (b *Reader) consume(n int) {
+	b.r += n
+	b.off += int64(n)
+}
+
+var _ io.Reader = (*Reader)(nil)
+var _ io.ByteReader = (*Reader)(nil)
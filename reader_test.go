@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestReader(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFDsWithData([]byte("hello\n"), f.Fd()))
+	_, err = sender.Write([]byte("plain\n"))
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFDsWithData([]byte("world\n"), f.Fd(), f.Fd()))
+	require.NoError(t, sender.Close())
+
+	r := oob.NewReader(receiver)
+	defer func() { _ = r.CloseFDs() }()
+
+	// The fd is only reached once its line has been read
+	b, err := r.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte('h'), b)
+	_, err = r.ReadFD()
+	assert.True(t, errors.Is(err, oob.ErrFDNotReached), "%+v", err)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ello\n", line)
+	fd, err := r.ReadFD()
+	require.NoError(t, err)
+	require.NoError(t, os.NewFile(fd, "hello").Close())
+
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "plain\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "world\n", line)
+	for i := 0; i < 2; i++ {
+		fd, err = r.ReadFD()
+		require.NoError(t, err)
+		require.NoError(t, os.NewFile(fd, "world").Close())
+	}
+
+	_, err = r.ReadString('\n')
+	assert.Equal(t, io.EOF, errors.Cause(err))
+	_, err = r.ReadFD()
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// lengthPrefixLen - the u32 little endian length in front of each length prefixed message
+const lengthPrefixLen = 4
+
+// SendLengthPrefixed - sends p behind its length (u32 little endian) with fds attached to the same sendmsg, the
+//                      framing commonly layered over the Rust sendfd crate's send_with_fd (and what RecvLengthPrefixed
+//                      and recv_with_fd on the other end expect), at most 253 fds
+//                      the passfd crate's send_fd and recv_fd are SendFD and RecvFD, which already match them
+func (s *UnixConn) SendLengthPrefixed(p []byte, fds ...uintptr) error {
+	if uint64(len(p)) > 1<<32-1 {
+		return errors.Errorf("cannot send %d bytes behind a u32 length", len(p))
+	}
+	msg := make([]byte, lengthPrefixLen+len(p))
+	binary.LittleEndian.PutUint32(msg, uint32(len(p)))
+	copy(msg[lengthPrefixLen:], p)
+	return s.SendFDsWithData(msg, fds...)
+}
+
+// RecvLengthPrefixed - receives a message sent with SendLengthPrefixed (or its Rust equivalent) along with the fds
+//                      sent with it, refusing (and closing the fds of) one longer than maxLen or with more than
+//                      maxFDs fds, after which the conn is out of step with its peer and should be closed
+func (s *UnixConn) RecvLengthPrefixed(maxLen, maxFDs int) (p []byte, fds []uintptr, err error) {
+	defer s.opts.profile("RecvLengthPrefixed")()
+	defer s.watch("RecvLengthPrefixed", false)()
+	defer func() { s.record("RecvLengthPrefixed", err, fds...) }()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	prefix := make([]byte, lengthPrefixLen)
+	rights, err := s.readFull(prefix, nil)
+	if err == nil {
+		if n := binary.LittleEndian.Uint32(prefix); uint64(n) > uint64(maxLen) {
+			err = errors.Errorf("received a %d byte message, more than the %d allowed", n, maxLen)
+		} else {
+			p = make([]byte, n)
+			rights, err = s.readFull(p, rights)
+		}
+	}
+	if err == nil && len(rights) > maxFDs {
+		err = errors.Errorf("received %d fds, more than the %d allowed", len(rights), maxFDs)
+	}
+	if err != nil {
+		closeFDs(rights)
+		return nil, nil, err
+	}
+	for _, fd := range rights {
+		fds = append(fds, uintptr(fd))
+	}
+	return p, fds, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestRustInterop(t *testing.T) {
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("the rust fixture is written for 64 bit linux")
+	}
+	rustc, err := exec.LookPath("rustc")
+	if err != nil {
+		t.Skip("rustc is not installed")
+	}
+	fixture := filepath.Join(t.TempDir(), "rustfd")
+	out, err := exec.Command(rustc, "-O", "-o", fixture, filepath.Join("internal", "rustfd", "main.rs")).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	peerEnd := os.NewFile(uintptr(fds[1]), "rust")
+	ourEnd := os.NewFile(uintptr(fds[0]), "go")
+	conn, err := net.FileConn(ourEnd)
+	require.NoError(t, err)
+	require.NoError(t, ourEnd.Close())
+	s := oob.NewUnixConn(conn.(*net.UnixConn))
+	defer func() { _ = s.Close() }()
+
+	cmd := exec.Command(fixture)
+	cmd.ExtraFiles = []*os.File{peerEnd}
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+	require.NoError(t, peerEnd.Close())
+
+	// Length prefixed, as over the sendfd crate
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	require.NoError(t, s.SendLengthPrefixed([]byte("hello"), w.Fd()))
+	require.NoError(t, w.Close())
+	buf := make([]byte, 5)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	p, back, err := s.RecvLengthPrefixed(16, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "back", string(p))
+	require.Len(t, back, 1)
+	require.NoError(t, os.NewFile(back[0], "returned").Close())
+
+	// As the passfd crate's send_fd and recv_fd
+	require.NoError(t, s.SendFile(r))
+	fd, err := s.RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, os.NewFile(fd, "returned").Close())
+	require.NoError(t, cmd.Wait())
+}
+
+func TestLengthPrefixed(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	require.NoError(t, sender.SendLengthPrefixed([]byte("payload"), f.Fd(), f.Fd()))
+	p, fds, err := receiver.RecvLengthPrefixed(16, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(p))
+	require.Len(t, fds, 2)
+	for _, fd := range fds {
+		require.NoError(t, os.NewFile(fd, "received").Close())
+	}
+
+	require.NoError(t, sender.SendLengthPrefixed([]byte("too long")))
+	_, _, err = receiver.RecvLengthPrefixed(4, 0)
+	assert.Error(t, err)
+}
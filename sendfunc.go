@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"os"
+)
+
+// SendFDFunc - like SendFD, but calls onSent exactly once after the kernel has queued fd for the peer, which makes it
+//              the right place to close the caller's copy of fd or update bookkeeping
+//              onSent is not called if the send fails
+//              WithSendQueue, onSent is called by the sender goroutine once fd has made it through the queue
+func (s *UnixConn) SendFDFunc(fd uintptr, onSent func()) error {
+	return s.sendFDFunc(fd, onSent)
+}
+
+// SendFileAndClose - like SendFile, but hands file over to the peer: file is closed once the kernel has queued its fd
+//                    (WithSendQueue, once it has made it through the queue), so the sender doesn't keep it open
+//                    file is left open if the send fails
+func (s *UnixConn) SendFileAndClose(file *os.File) error {
+	fd, err := ToFd(file)
+	if err != nil {
+		return err
+	}
+	return s.sendFDFunc(fd, func() { _ = file.Close() })
+}
+
+// SendBundleFunc - like SendBundle, but calls onSent exactly once after the kernel has queued every frame of b, which
+//                  makes it the right place to close b (or the things added to it)
+//                  onSent is not called if the send fails
+func (s *UnixConn) SendBundleFunc(b *Bundle, onSent func()) error {
+	if err := s.SendBundle(b); err != nil {
+		return err
+	}
+	if onSent != nil {
+		onSent()
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// WithSendQueue - Write and SendFD (and SendFDFunc) enqueue, up to n deep, onto a single sender goroutine instead of
+//                 sending directly, so interleaved calls from many goroutines reach the peer in exactly the order they
+//                 were made without the callers mutexing
+//                 Write copies p and SendFD dups fd, so the caller may reuse p or close fd as soon as they return, and
+//                 a failed send is returned by the next Write, SendFD or Flush (after which nothing more is sent)
+//                 other sends (frames, bundles, SendFDs, ...) don't go through the queue, Flush before them to order
+//                 them after what was queued
+func WithSendQueue(n int) Option {
+	return func(o *options) {
+		o.sendQueue = n
+	}
+}
+
+type queuedSend struct {
+	data []byte
+	// fd - a dup of the fd to send (which the queue closes), -1 for data
+	fd     int
+	onSent func()
+}
+
+type sendQueue struct {
+	items chan queuedSend
+	done  chan struct{}
+
+	// closeMu - held (for reading) by enqueues, so that once closed is set nothing more can be queued
+	closeMu sync.RWMutex
+	closed  bool
+
+	mu  sync.Mutex
+	err error
+	// pending - how many items are queued but not yet sent (or discarded), guarded by mu, with drained signalled
+	//           whenever it drops to zero (a sync.WaitGroup can't be waited on while enqueues Add to it from zero)
+	pending int
+	drained *sync.Cond
+}
+
+func (s *UnixConn) startSendQueue(n int) {
+	q := &sendQueue{items: make(chan queuedSend, n), done: make(chan struct{})}
+	q.drained = sync.NewCond(&q.mu)
+	s.sendQueue = q
+	goLabeled("sendqueue", func() {
+		for {
+			select {
+			case item := <-q.items:
+				q.send(s, item)
+			case <-q.done:
+				// Whatever is still queued is never going to be sent
+				for {
+					select {
+					case item := <-q.items:
+						q.discard(item)
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+// Write - writes p to the *net.UnixConn, or WithSendQueue enqueues a copy of it
+func (s *UnixConn) Write(p []byte) (int, error) {
+	if s.sendQueue == nil {
+		return s.UnixConn.Write(p)
+	}
+	if err := s.sendQueue.enqueue(queuedSend{data: append([]byte{}, p...), fd: -1}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush - waits for everything queued (WithSendQueue) to be sent, returning the first error any of it hit
+func (s *UnixConn) Flush() error {
+	if s.sendQueue == nil {
+		return nil
+	}
+	q := s.sendQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.pending > 0 {
+		q.drained.Wait()
+	}
+	return q.err
+}
+
+func (q *sendQueue) enqueueFD(fd uintptr, onSent func()) error {
+	dup, err := unix.FcntlInt(fd, unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrapf(err, "unable to dup fd %d to queue it", fd)
+	}
+	if err = q.enqueue(queuedSend{fd: dup, onSent: onSent}); err != nil {
+		_ = unix.Close(dup)
+	}
+	return err
+}
+
+func (q *sendQueue) enqueue(item queuedSend) error {
+	if err := q.failed(); err != nil {
+		return err
+	}
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return errors.WithStack(net.ErrClosed)
+	}
+	q.mu.Lock()
+	q.pending++
+	q.mu.Unlock()
+	q.items <- item
+	return nil
+}
+
+func (q *sendQueue) send(s *UnixConn, item queuedSend) {
+	if q.failed() != nil {
+		q.discard(item)
+		return
+	}
+	var err error
+	if item.fd < 0 {
+		s.sendMu.Lock()
+		_, err = s.UnixConn.Write(item.data)
+		s.sendMu.Unlock()
+	} else {
+		err = s.sendFD(uintptr(item.fd))
+		_ = unix.Close(item.fd)
+	}
+	if err != nil {
+		q.mu.Lock()
+		if q.err == nil {
+			q.err = err
+		}
+		q.mu.Unlock()
+	} else if item.onSent != nil {
+		item.onSent()
+	}
+	q.sent()
+}
+
+func (q *sendQueue) discard(item queuedSend) {
+	if item.fd >= 0 {
+		_ = unix.Close(item.fd)
+	}
+	q.sent()
+}
+
+// sent - one item fewer pending, waking Flush once none are
+func (q *sendQueue) sent() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending--; q.pending == 0 {
+		q.drained.Broadcast()
+	}
+}
+
+func (q *sendQueue) failed() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+func (q *sendQueue) close() {
+	q.closeMu.Lock()
+	defer q.closeMu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSendQueueOrdering(t *testing.T) {
+	receiver, sender := newUnixConnPair(t, oob.WithSendQueue(4))
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = w.Close() }()
+
+	// Interleaved Writes and SendFDs, the fd closed as soon as SendFD returns
+	_, err = sender.Write([]byte("before"))
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFile(r))
+	require.NoError(t, r.Close())
+	_, err = sender.Write([]byte("after"))
+	require.NoError(t, err)
+	require.NoError(t, sender.Flush())
+
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(receiver, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "before", string(buf))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	received := os.NewFile(fd, "received")
+	defer func() { _ = received.Close() }()
+	buf = buf[:5]
+	_, err = io.ReadFull(receiver, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "after", string(buf))
+}
+
+func TestSendQueueConcurrent(t *testing.T) {
+	receiver, sender := newUnixConnPair(t, oob.WithSendQueue(16))
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	const goroutines, each = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				_, writeErr := sender.Write([]byte{id})
+				assert.NoError(t, writeErr)
+				assert.NoError(t, sender.SendFD(r.Fd()))
+			}
+		}(byte(i + 1))
+	}
+
+	// Every Write is one non zero byte, every SendFD a zero byte carrying an fd
+	data, fds := 0, 0
+	buf := make([]byte, 1)
+	oobBuf := make([]byte, syscall.CmsgSpace(4))
+	for data+fds < 2*goroutines*each {
+		n, oobn, _, _, readErr := receiver.ReadMsgUnix(buf, oobBuf)
+		require.NoError(t, readErr)
+		require.Equal(t, 1, n)
+		if oobn == 0 {
+			assert.NotZero(t, buf[0])
+			data++
+			continue
+		}
+		msgs, parseErr := syscall.ParseSocketControlMessage(oobBuf[:oobn])
+		require.NoError(t, parseErr)
+		rights, parseErr := syscall.ParseUnixRights(&msgs[0])
+		require.NoError(t, parseErr)
+		for _, fd := range rights {
+			_ = syscall.Close(fd)
+		}
+		fds++
+	}
+	wg.Wait()
+	require.NoError(t, sender.Flush())
+	assert.Equal(t, goroutines*each, data)
+	assert.Equal(t, goroutines*each, fds)
+}
+
+func TestSendQueueFlushWhileWriting(t *testing.T) {
+	receiver, sender := newUnixConnPair(t, oob.WithSendQueue(2))
+	go func() { _, _ = io.Copy(io.Discard, receiver) }()
+
+	// Flushes racing with Writes enqueued while nothing is pending
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, err := sender.Write([]byte("x"))
+				assert.NoError(t, err)
+				assert.NoError(t, sender.Flush())
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, sender.Flush())
+}
+
+func TestSendQueueError(t *testing.T) {
+	receiver, sender := newUnixConnPair(t, oob.WithSendQueue(4))
+	require.NoError(t, receiver.Close())
+	// Eventually a queued send fails, and says so
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = sender.Write([]byte("x"))
+		if err == nil {
+			err = sender.Flush()
+		}
+	}
+	assert.Error(t, err)
+	require.NoError(t, sender.Close())
+	_, err = sender.Write([]byte("x"))
+	assert.Error(t, err)
+}
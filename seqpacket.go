@@ -0,0 +1,155 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// isPacketConn - whether conn preserves message boundaries (unixpacket, unixgram) rather than being a byte stream,
+//                so that every recvmsg consumes exactly one message, however much of it fits
+func isPacketConn(conn *net.UnixConn) bool {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	typ := syscall.SOCK_STREAM
+	_ = rawConn.Control(func(fd uintptr) {
+		if t, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TYPE); err == nil {
+			typ = t
+		}
+	})
+	return typ != syscall.SOCK_STREAM
+}
+
+// SendPacket - on a conn which preserves message boundaries (unixpacket or unixgram), sends p as a single message with
+//              fds attached to it, at most 253 fds
+//              a message bigger than the socket allows fails (EMSGSIZE) rather than being split
+func (s *UnixConn) SendPacket(p []byte, fds ...uintptr) (err error) {
+	if !s.packets {
+		return errors.New("SendPacket needs a unixpacket or unixgram conn, use SendFDsWithData on a stream")
+	}
+	s.checkDuplicateSend(fds...)
+	defer s.opts.profile("SendPacket")()
+	defer s.watch("SendPacket", true)()
+	defer func() { s.record("SendPacket", err, fds...) }()
+	if len(fds) > maxFDsPerMessage {
+		return errors.Errorf("cannot send %d fds in one packet, the limit is %d", len(fds), maxFDsPerMessage)
+	}
+	var oob []byte
+	if len(fds) > 0 {
+		rights := make([]int, len(fds))
+		for i, fd := range fds {
+			rights[i] = int(fd)
+		}
+		oob = syscall.UnixRights(rights...)
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	_, err = s.sendmsg(p, oob)
+	return err
+}
+
+// RecvPacket - on a conn which preserves message boundaries (unixpacket or unixgram), receives exactly one message
+//              into p along with the fds sent with it, returning how much of p was filled
+//              a message bigger than p, or with more than maxFDs fds, is discarded (closing its fds) and an error
+//              returned, rather than handed over in part, an empty message is returned as such, not as EOF
+func (s *UnixConn) RecvPacket(p []byte, maxFDs int) (n int, fds []uintptr, err error) {
+	if !s.packets {
+		return 0, nil, errors.New("RecvPacket needs a unixpacket or unixgram conn, use RecvFDsWithData on a stream")
+	}
+	defer s.opts.profile("RecvPacket")()
+	defer s.watch("RecvPacket", false)()
+	defer func() { s.record("RecvPacket", err, fds...) }()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	oob := make([]byte, RightsBufferSize(maxFDs))
+	n, oobn, recvflags, err := s.recvmsg(p, oob, 0)
+	if errors.Is(err, ErrControlTruncated) {
+		return 0, nil, errors.Wrapf(err, "received a packet with more than the %d fds asked for", maxFDs)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	rights, err := parseRights(oob[:oobn])
+	if err == nil && len(rights) > maxFDs {
+		// CmsgSpace rounds the buffer up, so it can fit more than asked for without the kernel truncating anything
+		err = errors.Wrapf(ErrControlTruncated, "received a packet with %d fds, more than the %d asked for", len(rights), maxFDs)
+	}
+	if err == nil && recvflags&syscall.MSG_TRUNC != 0 {
+		err = errors.Errorf("received a packet bigger than the %d bytes asked for", len(p))
+	}
+	if err != nil {
+		closeFDs(rights)
+		return 0, nil, err
+	}
+	for _, fd := range rights {
+		fds = append(fds, uintptr(fd))
+	}
+	return n, fds, nil
+}
+
+// readFramePacket - receives the next frame from a conn which preserves message boundaries, where it is a single
+//                   message, which has to be received whole: its header is peeked at first, to size the buffer
+func (s *UnixConn) readFramePacket() (header []byte, payload []byte, fds []int, err error) {
+	header = make([]byte, frameHeaderLen)
+	n, _, _, err := s.recvmsg(header, nil, syscall.MSG_PEEK)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if n == 0 {
+		return nil, nil, nil, io.EOF
+	}
+	length := binary.LittleEndian.Uint32(header[4:])
+	if n < frameHeaderLen || length > maxFrameLen {
+		// Discard it, rather than leave it in the way of every frame after it
+		buf := make([]byte, 1)
+		oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+		_, oobn, _, _ := s.recvmsg(buf, oob, 0)
+		discarded, _ := parseRights(oob[:oobn])
+		closeFDs(discarded)
+		if n < frameHeaderLen {
+			return nil, nil, nil, errors.Errorf("received a %d byte packet, too short for a frame header", n)
+		}
+		return nil, nil, nil, errors.Errorf("received a frame header announcing %d bytes, the limit is %d", length, maxFrameLen)
+	}
+	buf := make([]byte, frameHeaderLen+int(length))
+	oob := make([]byte, RightsBufferSize(maxFDsPerMessage))
+	n, oobn, recvflags, err := s.recvmsg(buf, oob, 0)
+	if oobn > 0 {
+		var parseErr error
+		fds, parseErr = parseRights(oob[:oobn])
+		if parseErr != nil && err == nil {
+			err = parseErr
+		}
+	}
+	if err == nil && (n < len(buf) || recvflags&syscall.MSG_TRUNC != 0) {
+		err = errors.Errorf("received a %d byte packet for a frame of %d bytes", n, len(buf))
+	}
+	if err != nil {
+		return nil, nil, fds, err
+	}
+	return buf[:frameHeaderLen], buf[frameHeaderLen:], fds, nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package oob_test
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// newSeqpacketPair - a connected pair of *oob.UnixConn backed by a SOCK_SEQPACKET socketpair
+func newSeqpacketPair(t *testing.T) (a, b *oob.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	require.NoError(t, err)
+	toUnixConn := func(fd int) *oob.UnixConn {
+		file := os.NewFile(uintptr(fd), "seqpacket")
+		defer func() { _ = file.Close() }()
+		conn, err := net.FileConn(file)
+		require.NoError(t, err)
+		return oob.NewUnixConn(conn.(*net.UnixConn))
+	}
+	a, b = toUnixConn(fds[0]), toUnixConn(fds[1])
+	t.Cleanup(func() {
+		_ = a.Close()
+		_ = b.Close()
+	})
+	return a, b
+}
+
+func TestSeqpacket(t *testing.T) {
+	sender, receiver := newSeqpacketPair(t)
+
+	// Each packet arrives whole, with its own fds
+	require.NoError(t, sender.SendPacket([]byte("first"), os.Stdin.Fd()))
+	require.NoError(t, sender.SendPacket([]byte("second"), os.Stdin.Fd(), os.Stdout.Fd()))
+	require.NoError(t, sender.SendPacket([]byte("third")))
+	buf := make([]byte, 16)
+	for _, expected := range []struct {
+		data string
+		fds  int
+	}{{"first", 1}, {"second", 2}, {"third", 0}} {
+		n, fds, err := receiver.RecvPacket(buf, 2)
+		require.NoError(t, err)
+		assert.Equal(t, expected.data, string(buf[:n]))
+		assert.Len(t, fds, expected.fds)
+		for _, fd := range fds {
+			require.NoError(t, syscall.Close(int(fd)))
+		}
+	}
+
+	// A packet too big for the buffer is refused, not handed over in part, without disturbing the next
+	before, err := oob.Limits()
+	require.NoError(t, err)
+	require.NoError(t, sender.SendPacket([]byte("too big for the buffer"), os.Stdin.Fd()))
+	require.NoError(t, sender.SendPacket([]byte("next")))
+	_, _, err = receiver.RecvPacket(buf[:4], 1)
+	assert.Error(t, err)
+	after, err := oob.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenFDs, after.OpenFDs)
+	n, _, err := receiver.RecvPacket(buf, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "next", string(buf[:n]))
+
+	// As is a packet with more fds than asked for
+	require.NoError(t, sender.SendPacket([]byte("two"), os.Stdin.Fd(), os.Stdout.Fd()))
+	_, _, err = receiver.RecvPacket(buf, 1)
+	assert.True(t, errors.Is(err, oob.ErrControlTruncated), "%+v", err)
+
+	// Frames, which are a packet each, work too
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	require.NoError(t, b.Add("stdin", os.Stdin, map[string]string{"role": "input"}))
+	require.NoError(t, sender.SendBundle(b))
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	require.Len(t, received.Items, 1)
+	assert.Equal(t, "input", received.Items[0].Metadata["role"])
+
+	// Streams have no packets
+	streamSender, _ := newUnixConnPair(t)
+	assert.Error(t, streamSender.SendPacket([]byte("x")))
+}
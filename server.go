@@ -0,0 +1,399 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrServerClosed - returned by Serve once Shutdown or Close has been called
+var ErrServerClosed = errors.New("oob: server closed")
+
+// shutdownPollInterval - how often Shutdown looks for conns which have drained
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Server - serves the conns accepted from one or more listeners, each passed to Handler on its own goroutine, and
+//          shuts down gracefully, letting descriptors in flight reach the peer before closing its conns
+type Server struct {
+	// Handler - called with each conn accepted, which is closed once it returns
+	Handler func(*UnixConn)
+	// Options - for the *net.UnixConns accepted from listeners other than those from Listen, which apply their own
+	Options []Option
+	// MaxHandlers - the most handlers running at once across every listener, a conn accepted beyond it waits for
+	//               one to return, 0 for no limit
+	MaxHandlers int
+	// Healthy - if not nil, consulted before each systemd watchdog ping (see Ready), which is skipped while it returns
+	//           false so that systemd restarts a wedged server
+	Healthy func() bool
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*UnixConn]struct{}
+	handlers  sync.WaitGroup
+	closed    bool
+	// done - closed once the server is shut down, waking serve waiting for a worker
+	done chan struct{}
+	// workers - a slot per running handler, MaxHandlers
+	workers chan struct{}
+	// notified - whether Ready told systemd, which is then told STOPPING=1 when the server shuts down
+	notified bool
+	// stopWatchdog - stops the systemd watchdog pings started by Ready
+	stopWatchdog chan struct{}
+}
+
+// Ready - tells systemd (READY=1 via NOTIFY_SOCKET, if set) that the server is ready, to be called once its listeners
+//         are bound and any handoff (RecvListenerHandoff) has completed, and if systemd's watchdog is enabled
+//         (WATCHDOG_USEC) sends WATCHDOG=1 every half interval while Healthy, until Shutdown or Close
+func (srv *Server) Ready() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return ErrServerClosed
+	}
+	if srv.notified {
+		return nil
+	}
+	notified, err := SdNotify("READY=1")
+	if err != nil || !notified {
+		return err
+	}
+	srv.notified = true
+	if interval, ok := sdWatchdogInterval(); ok {
+		srv.stopWatchdog = make(chan struct{})
+		stop := srv.stopWatchdog
+		goLabeled("sdwatchdog", func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+				if srv.Healthy == nil || srv.Healthy() {
+					_, _ = SdNotify("WATCHDOG=1")
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// Serve - accepts conns from l, calling Handler for each, until l fails or the server is shut down (when it returns
+//         ErrServerClosed), conns which are not unix sockets are closed as soon as they are accepted
+func (srv *Server) Serve(l net.Listener) error {
+	return srv.serve(l, srv.Handler, srv.Options)
+}
+
+// ServeListener - like Serve, but the conns accepted from l are passed to handler (Handler if nil) and l gets opts
+//                 rather than Options, so that each listener (one per tenant, per privilege level, ...) has its own
+//                 policy (WithMaxConns, WithMaxPendingFDsPerConn, WithIdleTimeout, ...) while sharing MaxHandlers and
+//                 Shutdown with the others
+//                 a listener from Listen already has its options, so opts must be empty for one
+func (srv *Server) ServeListener(l net.Listener, handler func(*UnixConn), opts ...Option) error {
+	if _, ok := l.(*oobListener); ok && len(opts) > 0 {
+		return errors.New("the listener already has the options it was given by Listen")
+	}
+	if handler == nil {
+		handler = srv.Handler
+	}
+	return srv.serve(l, handler, opts)
+}
+
+func (srv *Server) serve(l net.Listener, handler func(*UnixConn), opts []Option) error {
+	if _, ok := l.(*oobListener); !ok {
+		l = newListener(l, opts...)
+	}
+	if !srv.trackListener(l) {
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	defer srv.untrackListener(l)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s, ok := conn.(*UnixConn)
+		if !ok {
+			_ = conn.Close()
+			continue
+		}
+		// Waiting here rather than before Accept, an idle listener must not hold on to a worker
+		if !srv.acquireWorker() {
+			_ = s.Close()
+			return ErrServerClosed
+		}
+		if !srv.trackConn(s) {
+			_ = s.Close()
+			srv.releaseWorker()
+			return ErrServerClosed
+		}
+		goLabeled("serve", func() {
+			defer srv.untrackConn(s)
+			if handler != nil {
+				handler(s)
+			}
+		})
+	}
+}
+
+// WithShutdownFrame - have Server.Shutdown tell the peer of the conn that the server is shutting down (see
+//                     PeerShuttingDown) with a frame, for conns whose peers speak the frame based protocols (bundles,
+//                     trees, Ping, ...), a peer using plain Read or RecvFD would take the frame for data
+func WithShutdownFrame() Option {
+	return func(o *options) {
+		o.shutdownFrame = true
+	}
+}
+
+// Shutdown - stops accepting, tells every connected peer WithShutdownFrame that the server is shutting down (see
+//            PeerShuttingDown), then closes each conn once it is drained - its handler is waiting to receive, nothing is being sent
+//            and nothing sent (or queued to send) is still waiting for the peer to receive it - and returns once
+//            every handler has returned
+//            if ctx expires first, every conn is closed regardless and ctx.Err() is returned, like http.Server's
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	srv.closeLocked()
+	srv.stoppingLocked()
+	err := srv.closeListenersLocked()
+	var notifying sync.WaitGroup
+	for s := range srv.conns {
+		if !s.opts.shutdownFrame {
+			continue
+		}
+		s := s
+		notifying.Add(1)
+		goLabeled("shutdown", func() {
+			defer notifying.Done()
+			s.sendMu.Lock()
+			defer s.sendMu.Unlock()
+			_ = s.writeFrame(&frame{typ: frameShutdown})
+		})
+	}
+	srv.mu.Unlock()
+
+	// No conn is drained before its peer has been told
+	notified := make(chan struct{})
+	go func() {
+		notifying.Wait()
+		close(notified)
+	}()
+	select {
+	case <-notified:
+	case <-ctx.Done():
+		srv.closeConns()
+		return ctx.Err()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		srv.handlers.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		srv.closeDrained()
+		select {
+		case <-done:
+			return err
+		case <-ctx.Done():
+			srv.closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close - closes every listener and conn immediately, without waiting for anything in flight
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	srv.closeLocked()
+	srv.stoppingLocked()
+	err := srv.closeListenersLocked()
+	srv.mu.Unlock()
+	srv.closeConns()
+	return err
+}
+
+// closeLocked - marks the server shut down, waking serve if it is waiting for a worker
+func (srv *Server) closeLocked() {
+	if srv.closed {
+		return
+	}
+	srv.closed = true
+	close(srv.doneLocked())
+}
+
+func (srv *Server) doneLocked() chan struct{} {
+	if srv.done == nil {
+		srv.done = make(chan struct{})
+	}
+	return srv.done
+}
+
+// acquireWorker - waits for a handler to be allowed to run (MaxHandlers), false if the server is shut down first
+func (srv *Server) acquireWorker() bool {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		return false
+	}
+	if srv.MaxHandlers <= 0 {
+		srv.mu.Unlock()
+		return true
+	}
+	if srv.workers == nil {
+		srv.workers = make(chan struct{}, srv.MaxHandlers)
+	}
+	workers, done := srv.workers, srv.doneLocked()
+	srv.mu.Unlock()
+	select {
+	case workers <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (srv *Server) releaseWorker() {
+	srv.mu.Lock()
+	workers := srv.workers
+	srv.mu.Unlock()
+	if workers != nil {
+		<-workers
+	}
+}
+
+// stoppingLocked - stops the systemd watchdog pings and tells systemd STOPPING=1, if Ready told it READY=1
+func (srv *Server) stoppingLocked() {
+	if !srv.notified {
+		return
+	}
+	srv.notified = false
+	if srv.stopWatchdog != nil {
+		close(srv.stopWatchdog)
+		srv.stopWatchdog = nil
+	}
+	_, _ = SdNotify("STOPPING=1")
+}
+
+func (srv *Server) shuttingDown() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+func (srv *Server) trackListener(l net.Listener) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return false
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[net.Listener]struct{})
+	}
+	srv.listeners[l] = struct{}{}
+	return true
+}
+
+func (srv *Server) untrackListener(l net.Listener) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.listeners, l)
+}
+
+// trackConn - adds s to the conns being served, counting its handler, false if the server is already shut down
+func (srv *Server) trackConn(s *UnixConn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return false
+	}
+	if srv.conns == nil {
+		srv.conns = make(map[*UnixConn]struct{})
+	}
+	srv.conns[s] = struct{}{}
+	srv.handlers.Add(1)
+	return true
+}
+
+// untrackConn - closes s once its handler has returned, freeing its worker
+func (srv *Server) untrackConn(s *UnixConn) {
+	_ = s.Close()
+	srv.mu.Lock()
+	delete(srv.conns, s)
+	srv.mu.Unlock()
+	srv.releaseWorker()
+	srv.handlers.Done()
+}
+
+func (srv *Server) closeListenersLocked() error {
+	var err error
+	for l := range srv.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(srv.listeners, l)
+	}
+	return err
+}
+
+func (srv *Server) closeConns() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for s := range srv.conns {
+		_ = s.Close()
+	}
+}
+
+// closeDrained - closes the conns which are drained, which wakes their handlers out of receiving
+func (srv *Server) closeDrained() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for s := range srv.conns {
+		if s.drained() {
+			_ = s.Close()
+		}
+	}
+}
+
+// drained - whether s is only waiting for the peer, with nothing of its own still in flight in either direction
+func (s *UnixConn) drained() bool {
+	if atomic.LoadInt32(&s.receiving) == 0 || atomic.LoadInt32(&s.sending) != 0 {
+		return false
+	}
+	depths, err := s.QueueDepths()
+	if err != nil {
+		// Most likely already closed
+		return true
+	}
+	return depths.Unread == 0 && depths.Unsent == 0 && depths.Prefetched == 0 && depths.QueuedSends == 0
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// newServer - a Server with handler serving a fresh listener, and a client conn to it
+func newServer(t *testing.T, handler func(*oob.UnixConn), opts ...oob.Option) (srv *oob.Server, client *oob.UnixConn, served <-chan error) {
+	listener, err := oob.Listen("unix", filepath.Join(t.TempDir(), "socket"), opts...)
+	require.NoError(t, err)
+	srv = &oob.Server{Handler: handler}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(listener) }()
+	conn, err := net.Dial("unix", listener.Addr().String())
+	require.NoError(t, err)
+	client = oob.NewUnixConn(conn.(*net.UnixConn))
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, client, errCh
+}
+
+func TestServerShutdown(t *testing.T) {
+	received := make(chan int, 1)
+	srv, client, served := newServer(t, func(s *oob.UnixConn) {
+		for {
+			b, err := s.RecvBundle()
+			if err != nil {
+				return
+			}
+			received <- len(b.Items)
+			_ = b.Close()
+		}
+	}, oob.WithShutdownFrame())
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	require.NoError(t, b.Add("null", f, nil))
+	require.NoError(t, client.SendBundle(b))
+	assert.Equal(t, 1, <-received)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(ctx) }()
+
+	// The client hears about the shutdown, and the conn is closed once it has nothing in flight
+	_, err = client.RecvBundle()
+	assert.Error(t, err)
+	assert.True(t, client.PeerShuttingDown())
+	require.NoError(t, <-shutdown)
+	assert.Equal(t, oob.ErrServerClosed, <-served)
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv, client, served := newServer(t, func(s *oob.UnixConn) {
+		// Busy with something other than receiving, so never drained
+		<-release
+	}, oob.WithShutdownFrame())
+	require.Eventually(t, func() bool {
+		_, err := client.Write(nil)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, srv.Shutdown(ctx))
+	assert.Equal(t, oob.ErrServerClosed, <-served)
+	// Everything was closed regardless
+	_, err := client.RecvBundle()
+	assert.Error(t, err)
+	assert.True(t, client.PeerShuttingDown())
+}
+
+func TestServerShutdownWithoutFrame(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv, client, served := newServer(t, func(s *oob.UnixConn) { <-release })
+	require.Eventually(t, func() bool {
+		_, err := client.Write(nil)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, srv.Shutdown(ctx))
+	assert.Equal(t, oob.ErrServerClosed, <-served)
+	// A peer reading plain data sees the conn close, not a frame
+	n, err := client.Read(make([]byte, 16))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServerSdNotify(t *testing.T) {
+	notifySocket := filepath.Join(t.TempDir(), "notify")
+	notifications, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifySocket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer func() { _ = notifications.Close() }()
+	t.Setenv("NOTIFY_SOCKET", notifySocket)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	next := func() string {
+		buf := make([]byte, 64)
+		require.NoError(t, notifications.SetReadDeadline(time.Now().Add(time.Second)))
+		n, readErr := notifications.Read(buf)
+		require.NoError(t, readErr)
+		return string(buf[:n])
+	}
+
+	var unhealthy int32
+	srv, _, served := newServer(t, func(s *oob.UnixConn) {})
+	srv.Healthy = func() bool { return atomic.LoadInt32(&unhealthy) == 0 }
+	require.NoError(t, srv.Ready())
+	assert.Equal(t, "READY=1", next())
+	assert.Equal(t, "WATCHDOG=1", next())
+
+	// No pings while unhealthy
+	atomic.StoreInt32(&unhealthy, 1)
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		// Pings sent before Healthy was consulted
+		require.NoError(t, notifications.SetReadDeadline(time.Now().Add(time.Millisecond)))
+		_, _ = notifications.Read(make([]byte, 64))
+	}
+	require.NoError(t, notifications.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = notifications.Read(make([]byte, 64))
+	assert.Error(t, err)
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.Equal(t, "STOPPING=1", next())
+	assert.Equal(t, oob.ErrServerClosed, <-served)
+}
+
+func TestServerListeners(t *testing.T) {
+	srv := &oob.Server{MaxHandlers: 1}
+	release := make(chan struct{})
+	serve := func(name string, opts ...oob.Option) (net.Conn, <-chan error) {
+		listener, err := net.Listen("unix", filepath.Join(t.TempDir(), name))
+		require.NoError(t, err)
+		served := make(chan error, 1)
+		go func() {
+			served <- srv.ServeListener(listener, func(s *oob.UnixConn) {
+				_, _ = s.Write([]byte(name))
+				<-release
+			}, opts...)
+		}()
+		client, err := net.Dial("unix", listener.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = client.Close() })
+		return client, served
+	}
+	read := func(client net.Conn, timeout time.Duration) (string, error) {
+		buf := make([]byte, 16)
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(timeout)))
+		n, err := client.Read(buf)
+		return string(buf[:n]), err
+	}
+
+	tenant, tenantServed := serve("tenant", oob.WithMaxConns(1))
+	name, err := read(tenant, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant", name)
+
+	// The admin listener shares the single worker, so its conn waits for the tenant's handler to return
+	admin, adminServed := serve("admin")
+	_, err = read(admin, 100*time.Millisecond)
+	assert.Error(t, err)
+	close(release)
+	name, err = read(admin, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", name)
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.Equal(t, oob.ErrServerClosed, <-tenantServed)
+	assert.Equal(t, oob.ErrServerClosed, <-adminServed)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// FDInfo - what SnapshotFDs found out about one open fd
+type FDInfo struct {
+	FD       uintptr
+	Kind     string
+	Identity Identity
+	// Path - what the fd refers to, its /proc link target ("/etc/hosts", "socket:[1234]", ...), linux only
+	Path string
+	// Peer - for connected sockets, the address of the other end, "" if unnamed or unknown
+	Peer string
+}
+
+// FDSnapshot - the open fds of the process, ordered by fd
+type FDSnapshot []FDInfo
+
+// SnapshotFDs - an inventory of the open fds of the process, to compare with another (see FDSnapshot.Diff) before and
+//               after a handoff, or to find fds leaked by fd passing
+//               fds opened or closed by other goroutines while it is taken may or may not be included
+func SnapshotFDs() (FDSnapshot, error) {
+	fds, err := openFDs()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(FDSnapshot, 0, len(fds))
+	for _, fd := range fds {
+		// Closed since it was listed, like the fd which listed /proc/self/fd
+		id, err := fileIdentity(fd)
+		if err != nil {
+			continue
+		}
+		info := FDInfo{FD: fd, Identity: id, Path: fdPath(fd)}
+		info.Kind, _ = fdKind(fd)
+		if info.Kind == KindSocket {
+			if sa, err := unix.Getpeername(int(fd)); err == nil {
+				info.Peer = sockaddrString(sa)
+			}
+		}
+		snapshot = append(snapshot, info)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].FD < snapshot[j].FD })
+	return snapshot, nil
+}
+
+// FDSnapshotDiff - how the fds of the process changed from one FDSnapshot to another
+type FDSnapshotDiff struct {
+	// Opened - fds in the second snapshot but not the first
+	Opened []FDInfo
+	// Closed - fds in the first snapshot but not the second
+	Closed []FDInfo
+	// Replaced - fds in both, but referring to a different file (closed and reused), as they were in the second
+	Replaced []FDInfo
+}
+
+// Empty - whether nothing changed
+func (d *FDSnapshotDiff) Empty() bool {
+	return len(d.Opened) == 0 && len(d.Closed) == 0 && len(d.Replaced) == 0
+}
+
+// Diff - how the fds changed from a to b
+func (a FDSnapshot) Diff(b FDSnapshot) *FDSnapshotDiff {
+	before := make(map[uintptr]FDInfo, len(a))
+	for _, info := range a {
+		before[info.FD] = info
+	}
+	diff := &FDSnapshotDiff{}
+	for _, info := range b {
+		was, ok := before[info.FD]
+		switch {
+		case !ok:
+			diff.Opened = append(diff.Opened, info)
+		case was.Identity != info.Identity || was.Kind != info.Kind:
+			diff.Replaced = append(diff.Replaced, info)
+		}
+		delete(before, info.FD)
+	}
+	for _, info := range a {
+		if _, ok := before[info.FD]; ok {
+			diff.Closed = append(diff.Closed, info)
+		}
+	}
+	return diff
+}
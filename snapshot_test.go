@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSnapshotFDs(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	before, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFile(f))
+	received, err := receiver.RecvFile()
+	require.NoError(t, err)
+	after, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+
+	// Both ends of the passing show up as opened, as the same file
+	diff := before.Diff(after)
+	opened := map[uintptr]oob.FDInfo{}
+	for _, info := range diff.Opened {
+		opened[info.FD] = info
+	}
+	require.Contains(t, opened, f.Fd())
+	require.Contains(t, opened, received.Fd())
+	assert.Equal(t, oob.KindChar, opened[f.Fd()].Kind)
+	assert.Equal(t, opened[f.Fd()].Identity, opened[received.Fd()].Identity)
+	if runtime.GOOS == "linux" {
+		assert.Equal(t, os.DevNull, opened[received.Fd()].Path)
+	}
+
+	// Until they are closed again
+	fd := received.Fd()
+	require.NoError(t, received.Close())
+	closed, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+	diff = after.Diff(closed)
+	var closedFDs []uintptr
+	for _, info := range diff.Closed {
+		closedFDs = append(closedFDs, info.FD)
+	}
+	assert.Contains(t, closedFDs, fd)
+	require.NoError(t, f.Close())
+	assert.False(t, diff.Empty())
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSpliceChunk - the most bytes moved by a single splice(2) (the default pipe capacity is 64KiB, more than that
+//                  only ever moves what is in the pipe anyway)
+const maxSpliceChunk = 1 << 20
+
+// SpliceN - move n bytes from src (usually a received pipe) to dst (a file, socket or pipe) without copying them
+//           through userspace, using splice(2) where available (linux) and read/write elsewhere
+//           like io.CopyN it returns io.EOF if src reaches its end before n bytes were moved
+func SpliceN(dst, src *os.File, n int64) (int64, error) {
+	return Splice(dst, src, n)
+}
+
+// Splice - SpliceN for anything ToFd accepts (an *os.File, a net.Conn, a received fd, ...) as dst and src
+func Splice(dst, src interface{}, n int64) (int64, error) {
+	dstFd, err := ToFd(dst)
+	if err != nil {
+		return 0, err
+	}
+	srcFd, err := ToFd(src)
+	if err != nil {
+		return 0, err
+	}
+	return spliceN(int(dstFd), int(srcFd), n)
+}
+
+// TeeN - copy up to n bytes of what is in the pipe src to the pipe dst without consuming them from src, using tee(2),
+//        so the same data can still be spliced on to somewhere else, only supported on linux
+func TeeN(dst, src *os.File, n int64) (int64, error) {
+	dstFd, err := ToFd(dst)
+	if err != nil {
+		return 0, err
+	}
+	srcFd, err := ToFd(src)
+	if err != nil {
+		return 0, err
+	}
+	return teeN(int(dstFd), int(srcFd), n)
+}
+
+// RecvSplice - recv a fd (usually the read end of a pipe) and splice n bytes from it into dst (anything ToFd
+//              accepts), closing the received fd afterwards
+func (s *UnixConn) RecvSplice(dst interface{}, n int64) (int64, error) {
+	fd, err := s.RecvFD()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = unix.Close(int(fd)) }()
+	return Splice(dst, fd, n)
+}
+
+// waitFD - waits for fd to be ready for events, for fds which are in non-blocking mode
+func waitFD(fd int, events int16) error {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: events}}
+	for {
+		if _, err := unix.Poll(fds, -1); err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// copyN - moves n bytes from srcFd to dstFd with read(2) and write(2)
+func copyN(dstFd, srcFd int, n int64) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for written < n {
+		chunk := buf
+		if remaining := n - written; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		nr, err := unix.Read(srcFd, chunk)
+		switch {
+		case err == unix.EAGAIN:
+			if err = waitFD(srcFd, unix.POLLIN); err != nil {
+				return written, err
+			}
+			continue
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return written, err
+		case nr == 0:
+			return written, io.EOF
+		}
+		for off := 0; off < nr; {
+			nw, err := unix.Write(dstFd, chunk[off:nr])
+			switch {
+			case err == unix.EAGAIN:
+				if err = waitFD(dstFd, unix.POLLOUT); err != nil {
+					return written, err
+				}
+				continue
+			case err == unix.EINTR:
+				continue
+			case err != nil:
+				return written, err
+			}
+			off += nw
+			written += int64(nw)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// spliceN - moves n bytes from srcFd to dstFd with splice(2), which needs one of them to be a pipe, falling back to
+//           read/write if neither is
+func spliceN(dstFd, srcFd int, n int64) (int64, error) {
+	var written int64
+	for written < n {
+		chunk := n - written
+		if chunk > maxSpliceChunk {
+			chunk = maxSpliceChunk
+		}
+		m, err := unix.Splice(srcFd, nil, dstFd, nil, int(chunk), unix.SPLICE_F_MOVE|unix.SPLICE_F_NONBLOCK)
+		switch {
+		case err == unix.EINVAL && written == 0:
+			return copyN(dstFd, srcFd, n)
+		case err == unix.EAGAIN:
+			// Either the source is empty or the destination is full
+			if err = waitBoth(srcFd, dstFd); err != nil {
+				return written, err
+			}
+			continue
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return written, err
+		case m == 0:
+			return written, io.EOF
+		}
+		written += int64(m)
+	}
+	return written, nil
+}
+
+// teeN - copies up to n bytes from the pipe srcFd to the pipe dstFd with tee(2), without consuming them
+func teeN(dstFd, srcFd int, n int64) (int64, error) {
+	for {
+		m, err := tee(srcFd, dstFd, int(n), unix.SPLICE_F_NONBLOCK)
+		switch {
+		case err == unix.EAGAIN:
+			if err = waitBoth(srcFd, dstFd); err != nil {
+				return 0, err
+			}
+		case err == unix.EINTR:
+		case err != nil:
+			return 0, err
+		case m == 0:
+			return 0, io.EOF
+		default:
+			return int64(m), nil
+		}
+	}
+}
+
+// tee - tee(2), called directly as unix.Tee on 386 and arm ORs garbage into the high word of the count it returns
+func tee(srcFd, dstFd, n, flags int) (int, error) {
+	r0, _, errno := unix.Syscall6(unix.SYS_TEE, uintptr(srcFd), uintptr(dstFd), uintptr(n), uintptr(flags), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r0), nil
+}
+
+// waitBoth - waits until srcFd is readable and dstFd is writable, as EAGAIN from splice(2) or tee(2) doesn't say
+//            which of them wasn't
+func waitBoth(srcFd, dstFd int) error {
+	if err := waitFD(srcFd, unix.POLLIN); err != nil {
+		return err
+	}
+	return waitFD(dstFd, unix.POLLOUT)
+}
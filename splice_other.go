@@ -0,0 +1,34 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+)
+
+// spliceN - there is no splice(2), so moves n bytes from srcFd to dstFd with read/write
+func spliceN(dstFd, srcFd int, n int64) (int64, error) {
+	return copyN(dstFd, srcFd, n)
+}
+
+// teeN - there is no tee(2), and no way to read a pipe without consuming what is read
+func teeN(dstFd, srcFd int, n int64) (int64, error) {
+	return 0, errors.New("TeeN is only supported on linux")
+}
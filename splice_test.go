@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSpliceN(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	dst, err := os.Create(filepath.Join(t.TempDir(), "dst"))
+	require.NoError(t, err)
+	defer func() { _ = dst.Close() }()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+	go func() {
+		_, _ = w.Write(data)
+		_ = w.Close()
+	}()
+	n, err := oob.SpliceN(dst, r, int64(len(data)-16))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)-16), n)
+	// Only 16 bytes are left, so asking for more ends at io.EOF like io.CopyN
+	n, err = oob.SpliceN(dst, r, 32)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, int64(16), n)
+
+	contents, err := ioutil.ReadFile(dst.Name())
+	require.NoError(t, err)
+	assert.Equal(t, data, contents)
+}
+
+func TestRecvSplice(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	require.NoError(t, sender.SendFile(r))
+	require.NoError(t, r.Close())
+	_, err = w.Write([]byte("spliced"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Splice into a socket this time
+	out, in := newUnixConnPair(t)
+	n, err := receiver.RecvSplice(out, 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(in, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "spliced", string(buf))
+}
+
+func TestSpliceWithoutPipe(t *testing.T) {
+	// splice(2) needs a pipe on one end, without one Splice falls back to read/write
+	a, b := newUnixConnPair(t)
+	dst, err := os.Create(filepath.Join(t.TempDir(), "dst"))
+	require.NoError(t, err)
+	defer func() { _ = dst.Close() }()
+	_, err = a.Write([]byte("no pipe"))
+	require.NoError(t, err)
+	n, err := oob.Splice(dst, b, 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	contents, err := ioutil.ReadFile(dst.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "no pipe", string(contents))
+}
+
+func TestTeeN(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("tee(2) is linux only")
+	}
+	r1, w1, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r1.Close() }()
+	defer func() { _ = w1.Close() }()
+	r2, w2, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r2.Close() }()
+	defer func() { _ = w2.Close() }()
+
+	_, err = w1.Write([]byte("teed"))
+	require.NoError(t, err)
+	n, err := oob.TeeN(w2, r1, 16)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	for _, r := range []*os.File{r1, r2} {
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(r, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "teed", string(buf))
+	}
+}
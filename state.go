@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxInlineStateLen - the largest state entry kept in the manifest of a bundle, larger ones are offloaded into a
+	//                     sealed memfd (on linux) so the manifest stays small
+	maxInlineStateLen = 64 << 10
+	// stateItemPrefix - the label prefix of the items holding offloaded state
+	stateItemPrefix = "oob.state/"
+)
+
+// StateCodec - how application state carried in a Bundle is serialized, for instance a wrapper around encoding/json
+//              or encoding/gob
+type StateCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// SetState - adds v to b as the state labeled label, encoded with codec, labeling it like an item associates the
+//            state with that item's descriptor
+//            state of more than 64KiB is offloaded into a sealed memfd sent along with the bundle (on linux,
+//            elsewhere it stays in the manifest, which is limited to 16MiB), up to 1GiB
+func (b *Bundle) SetState(label string, codec StateCodec, v interface{}) error {
+	if _, ok := b.State[label]; ok {
+		return errors.Errorf("bundle already has state labeled %q", label)
+	}
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal state %q", label)
+	}
+	if len(data) > maxOffloadLen {
+		return errors.Errorf("state %q is %d bytes, the limit is %d", label, len(data), maxOffloadLen)
+	}
+	entry := &BundleState{Data: data, Length: len(data)}
+	if len(data) > maxInlineStateLen {
+		memfd, ok, err := sealedMemfd(data)
+		if err != nil {
+			return err
+		}
+		if ok {
+			// The bundle keeps its own dup
+			err = b.Add(stateItemPrefix+label, uintptr(memfd), nil)
+			_ = unix.Close(memfd)
+			if err != nil {
+				return err
+			}
+			entry.Data, entry.Item = nil, stateItemPrefix+label
+		}
+	}
+	if b.State == nil {
+		b.State = make(map[string]*BundleState)
+	}
+	b.State[label] = entry
+	return nil
+}
+
+// DecodeState - decodes the state labeled label into v with codec, returning false if b has no such state
+func (b *Bundle) DecodeState(label string, codec StateCodec, v interface{}) (bool, error) {
+	entry, ok := b.State[label]
+	if !ok {
+		return false, nil
+	}
+	data := entry.Data
+	if entry.Item != "" {
+		var err error
+		if data, err = b.offloadedState(entry); err != nil {
+			return true, err
+		}
+	}
+	if len(data) != entry.Length {
+		return true, errors.Errorf("state %q should be %d bytes but is %d", label, entry.Length, len(data))
+	}
+	return true, errors.Wrapf(codec.Unmarshal(data, v), "unable to unmarshal state %q", label)
+}
+
+// offloadedState - reads the state of entry back out of the sealed memfd it was offloaded into
+func (b *Bundle) offloadedState(entry *BundleState) ([]byte, error) {
+	item := b.Get(entry.Item)
+	if item == nil || item.File == nil {
+		return nil, errors.Errorf("bundle has no item %q holding its state", entry.Item)
+	}
+	if entry.Length < 0 || entry.Length > maxOffloadLen {
+		return nil, errors.Errorf("state announces %d bytes, the limit is %d", entry.Length, maxOffloadLen)
+	}
+	fd := int(item.File.Fd())
+	// The sender must not be able to change the state while (or after) it is read
+	if err := checkSealed(fd); err != nil {
+		return nil, err
+	}
+	data := make([]byte, entry.Length)
+	for off := 0; off < len(data); {
+		n, err := unix.Pread(fd, data[off:], int64(off))
+		if err != nil {
+			return nil, errors.Wrap(err, "reading offloaded state")
+		}
+		if n == 0 {
+			return nil, errors.Errorf("offloaded state ended after %d of %d bytes", off, len(data))
+		}
+		off += n
+	}
+	return data, nil
+}
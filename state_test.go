@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func TestBundleState(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	large := strings.Repeat("x", 1<<20)
+
+	b := oob.NewBundle()
+	defer func() { _ = b.Close() }()
+	require.NoError(t, b.Add("null", f, nil))
+	require.NoError(t, b.SetState("null", jsonCodec{}, map[string]int{"reads": 3}))
+	require.NoError(t, b.SetState("large", jsonCodec{}, large))
+	assert.Error(t, b.SetState("large", jsonCodec{}, large))
+	if runtime.GOOS == "linux" {
+		// Offloaded into a memfd
+		assert.Len(t, b.Items, 2)
+	}
+
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendBundle(b))
+	received, err := receiver.RecvBundle()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+
+	var counts map[string]int
+	ok, err := received.DecodeState("null", jsonCodec{}, &counts)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, counts["reads"])
+	var s string
+	ok, err = received.DecodeState("large", jsonCodec{}, &s)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, large, s)
+	ok, err = received.DecodeState("missing", jsonCodec{}, &s)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestListenerHandoffWithState(t *testing.T) {
+	socketfilename := filepath.Join(t.TempDir(), "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	type session struct {
+		User string
+	}
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- sender.SendListenerHandoffWithState(listener, jsonCodec{}, map[string]interface{}{
+			"listener": map[string]string{"config": "v2"},
+			"sessions": []session{{User: "alice"}},
+		})
+	}()
+	var config map[string]string
+	var sessions []session
+	received, conns, err := receiver.RecvListenerHandoffWithState(jsonCodec{}, map[string]interface{}{
+		"listener": &config,
+		"sessions": &sessions,
+	})
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	require.NoError(t, listener.Close())
+	defer func() { _ = received.Close() }()
+	require.Len(t, conns, 1)
+	_ = conns[0].Close()
+	assert.Equal(t, "v2", config["config"])
+	assert.Equal(t, []session{{User: "alice"}}, sessions)
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats - what has passed over a connection, for debugging stuck peers without strace
+type Stats struct {
+	// FDsSent and FDsReceived - fds passed in SCM_RIGHTS messages, by every API (SendFD, bundles, frames, ...)
+	FDsSent     uint64
+	FDsReceived uint64
+	// FDsExpired - received fds closed because the application didn't receive them in time, WithUnclaimedFDTimeout
+	FDsExpired uint64
+	// ControlBytesSent and ControlBytesReceived - bytes of ancillary data (control messages) passed
+	ControlBytesSent     uint64
+	ControlBytesReceived uint64
+	// LastErr - the last error a send or receive on the connection failed with, nil if none has
+	LastErr error
+	// LastActivity - when a message was last sent or received, zero if none has been
+	LastActivity time.Time
+}
+
+// connStats - the Stats of a connection, counted by sendmsgTo and recvmsgFrom
+type connStats struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Stats - a copy of the Stats of the connection so far
+func (s *UnixConn) Stats() Stats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return s.stats.stats
+}
+
+// sent - counts a sendmsg of the control message oob, which failed with err if not nil
+func (c *connStats) sent(oob []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.stats.LastErr = err
+		return
+	}
+	fds, _ := parseRights(oob)
+	c.stats.FDsSent += uint64(len(fds))
+	c.stats.ControlBytesSent += uint64(len(oob))
+	c.stats.LastActivity = time.Now()
+}
+
+// received - counts a recvmsg of the control message oob, which failed with err if not nil
+func (c *connStats) received(oob []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.stats.LastErr = err
+		return
+	}
+	fds, _ := parseRights(oob)
+	c.stats.FDsReceived += uint64(len(fds))
+	c.stats.ControlBytesReceived += uint64(len(oob))
+	c.stats.LastActivity = time.Now()
+}
+
+// expired - counts n received fds closed unclaimed
+func (c *connStats) expired(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.FDsExpired += uint64(n)
+}
+
+// fdsExpired - counts n received fds closed because they weren't claimed in time
+func (s *UnixConn) fdsExpired(n int) {
+	s.stats.expired(n)
+}
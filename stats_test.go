@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestStats(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+	assert.Equal(t, oob.Stats{}, receiver.Stats())
+
+	start := time.Now()
+	require.NoError(t, sender.SendFDs(os.Stdin.Fd(), os.Stdout.Fd()))
+	fds, err := receiver.RecvFDs(2)
+	require.NoError(t, err)
+	for _, fd := range fds {
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+
+	sent := sender.Stats()
+	assert.Equal(t, uint64(2), sent.FDsSent)
+	assert.Equal(t, uint64(oob.RightsBufferSize(2)), sent.ControlBytesSent)
+	assert.NoError(t, sent.LastErr)
+	assert.False(t, sent.LastActivity.Before(start))
+	received := receiver.Stats()
+	assert.Equal(t, uint64(2), received.FDsReceived)
+	assert.Equal(t, uint64(oob.RightsBufferSize(2)), received.ControlBytesReceived)
+	assert.False(t, received.LastActivity.Before(start))
+
+	// Failures are remembered
+	require.NoError(t, receiver.SetReadDeadline(time.Now()))
+	_, err = receiver.RecvFD()
+	require.Error(t, err)
+	assert.Error(t, receiver.Stats().LastErr)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStrict - wrapped by the errors WithStrict returns in place of something oob would otherwise have silently ignored
+var ErrStrict = errors.New("strict mode")
+
+// WithStrict - for development: turn situations oob otherwise handles silently into errors wrapping ErrStrict, so
+//              protocol authors find latent bugs before their peers do
+//              - a message received with RecvFD carrying more than one fd (the extras are otherwise closed)
+//              - inline bytes received with an fd by RecvFD, other than the single byte a sender with no data of its
+//                own sends with the fd (they are otherwise discarded, or left behind for the next read)
+//              - control messages other than SCM_RIGHTS (such as SCM_CREDENTIALS), which are otherwise skipped
+//              the fds of the offending message are closed
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// strictInlineLen - how much inline data RecvFD reads WithStrict, to tell a sender's own data from the placeholder byte
+const strictInlineLen = 64
+
+// checkControl - WithStrict, an error if oob holds anything but SCM_RIGHTS, closing every fd in it
+func (o *options) checkControl(oob []byte) error {
+	if !o.strict || len(oob) == 0 {
+		return nil
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for i := range msgs {
+		if msgs[i].Header.Level != syscall.SOL_SOCKET || msgs[i].Header.Type != syscall.SCM_RIGHTS {
+			fds, _ := parseRights(oob)
+			closeFDs(fds)
+			return errors.Wrapf(ErrStrict, "received a control message of level %d type %d alongside the fds", msgs[i].Header.Level, msgs[i].Header.Type)
+		}
+	}
+	return nil
+}
+
+// checkRecvFD - WithStrict, an error if the message RecvFD received (n bytes of inline data into p, and nfds fds)
+//               carried more than one fd or more inline data than the placeholder byte sent when there is none
+func (o *options) checkRecvFD(p []byte, n, recvflags, nfds int) error {
+	if !o.strict {
+		return nil
+	}
+	if nfds > 1 {
+		return errors.Wrapf(ErrStrict, "received %d fds in a message read by RecvFD", nfds)
+	}
+	truncated := recvflags&syscall.MSG_TRUNC != 0
+	if truncated || n > 1 || (n == 1 && p[0] != 0) {
+		return errors.Wrapf(ErrStrict, "received %q (truncated: %t) inline with the fd", p[:n], truncated)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestStrict(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	sender, receiver := newUnixConnPair(t, oob.WithStrict())
+
+	// A plain SendFD is fine
+	require.NoError(t, sender.SendFD(f.Fd()))
+	fd, err := receiver.RecvFD()
+	require.NoError(t, err)
+	assert.NoError(t, syscall.Close(int(fd)))
+
+	// More than one fd
+	require.NoError(t, sender.SendFDs(f.Fd(), f.Fd()))
+	_, err = receiver.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrStrict), "%+v", err)
+
+	// Data of the sender's own
+	require.NoError(t, sender.SendFDsWithData([]byte("hello"), f.Fd()))
+	_, err = receiver.RecvFD()
+	assert.True(t, errors.Is(err, oob.ErrStrict), "%+v", err)
+
+	// Without WithStrict, both are quietly dealt with
+	sender, receiver = newUnixConnPair(t)
+	require.NoError(t, sender.SendFDs(f.Fd(), f.Fd()))
+	require.NoError(t, sender.SendFDsWithData([]byte("x"), f.Fd()))
+	for i := 0; i < 2; i++ {
+		fd, err = receiver.RecvFD()
+		require.NoError(t, err)
+		assert.NoError(t, syscall.Close(int(fd)))
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Sizes of the shared memory a Mutex and a Semaphore live in, both must be 4 byte aligned
+const (
+	SizeofMutex     = 4
+	SizeofSemaphore = 8
+)
+
+const (
+	futexWait = 0
+	futexWake = 1
+	// futexWaiters, futexOwnerDied and futexTIDMask - the layout of a robust futex's lock word, which Mutex shares
+	// (with the owner's pid where the kernel keeps a tid, as goroutines aren't tied to threads)
+	futexWaiters   = 0x80000000
+	futexOwnerDied = 0x40000000
+	futexTIDMask   = 0x3fffffff
+	// sharedPollInterval - how often a waiter checks that the owner of a Mutex is still alive, or whether the ctx
+	// of a Semaphore.Acquire is done
+	sharedPollInterval = 100 * time.Millisecond
+)
+
+// ErrOwnerDied - returned by Mutex.Lock when the process holding the Mutex died (or the lock word had
+//                FUTEX_OWNER_DIED set), the Mutex is now held by the caller but what it protected may be inconsistent
+var ErrOwnerDied = errors.New("the owner of the mutex died holding it")
+
+// Mutex - a mutex in shared memory (usually a memfd sent with oob and mapped with Mmap by each process), held by a
+//         process rather than a goroutine, like a sync.Mutex
+//         if the holder dies the next Lock notices (within 100ms) and takes it over, returning
+//         ErrOwnerDied, holders are identified by pid so every process must be in the same pid namespace
+//         the zero value of its memory is an unlocked Mutex
+type Mutex struct {
+	mapped *Mapped
+	offset int
+}
+
+// NewMutex - the Mutex living at offset in mapped
+func NewMutex(mapped *Mapped, offset int) (*Mutex, error) {
+	if err := checkShared(mapped, offset, SizeofMutex); err != nil {
+		return nil, err
+	}
+	return &Mutex{mapped: mapped, offset: offset}, nil
+}
+
+// Lock - locks the Mutex, waiting for it if need be, the mapping can't be closed while waiting
+func (m *Mutex) Lock() error {
+	return m.mapped.With(func(b []byte) error {
+		return lockWord(sharedWord(b, m.offset), uint32(os.Getpid()))
+	})
+}
+
+// Unlock - unlocks the Mutex, which must be held by this process
+func (m *Mutex) Unlock() error {
+	return m.mapped.With(func(b []byte) error {
+		return unlockWord(sharedWord(b, m.offset), uint32(os.Getpid()))
+	})
+}
+
+func lockWord(word *uint32, pid uint32) error {
+	waited := false
+	for {
+		v := atomic.LoadUint32(word)
+		owner := v & futexTIDMask
+		switch {
+		case owner == 0 && v&futexOwnerDied == 0:
+			// Having waited, there may be other waiters, which the next Unlock must wake
+			next := pid | v&futexWaiters
+			if waited {
+				next |= futexWaiters
+			}
+			if atomic.CompareAndSwapUint32(word, v, next) {
+				return nil
+			}
+			continue
+		case v&futexOwnerDied != 0 || !processAlive(owner):
+			if atomic.CompareAndSwapUint32(word, v, pid|v&futexWaiters) {
+				return ErrOwnerDied
+			}
+			continue
+		case v&futexWaiters == 0:
+			if !atomic.CompareAndSwapUint32(word, v, v|futexWaiters) {
+				continue
+			}
+			v |= futexWaiters
+		}
+		waited = true
+		if _, err := futex(word, futexWait, v, sharedPollInterval); err != nil &&
+			err != unix.EAGAIN && err != unix.ETIMEDOUT && err != unix.EINTR {
+			return errors.Wrap(err, "futex wait")
+		}
+	}
+}
+
+func unlockWord(word *uint32, pid uint32) error {
+	if owner := atomic.LoadUint32(word) & futexTIDMask; owner != pid {
+		return errors.Errorf("cannot unlock a mutex held by pid %d from pid %d", owner, pid)
+	}
+	if atomic.SwapUint32(word, 0)&futexWaiters != 0 {
+		if _, err := futex(word, futexWake, 1, 0); err != nil {
+			return errors.Wrap(err, "futex wake")
+		}
+	}
+	return nil
+}
+
+// Semaphore - a counting semaphore in shared memory (usually a memfd sent with oob and mapped with Mmap by each
+//             process), a count followed by the number of waiters
+//             a Semaphore has no owner, so a process dying between Acquire and Release loses that unit for good
+//             the zero value of its memory is a Semaphore with nothing to acquire, Release it up to its initial count
+type Semaphore struct {
+	mapped *Mapped
+	offset int
+}
+
+// NewSemaphore - the Semaphore living at offset in mapped
+func NewSemaphore(mapped *Mapped, offset int) (*Semaphore, error) {
+	if err := checkShared(mapped, offset, SizeofSemaphore); err != nil {
+		return nil, err
+	}
+	return &Semaphore{mapped: mapped, offset: offset}, nil
+}
+
+// Acquire - takes one unit, waiting for one to be released until ctx is done
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	return s.mapped.With(func(b []byte) error {
+		count, waiters := sharedWord(b, s.offset), sharedWord(b, s.offset+4)
+		for {
+			if tryAcquire(count) {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			atomic.AddUint32(waiters, 1)
+			_, err := futex(count, futexWait, 0, sharedPollInterval)
+			atomic.AddUint32(waiters, ^uint32(0))
+			if err != nil && err != unix.EAGAIN && err != unix.ETIMEDOUT && err != unix.EINTR {
+				return errors.Wrap(err, "futex wait")
+			}
+		}
+	})
+}
+
+// TryAcquire - takes one unit if one is available, without waiting
+func (s *Semaphore) TryAcquire() (bool, error) {
+	var acquired bool
+	err := s.mapped.With(func(b []byte) error {
+		acquired = tryAcquire(sharedWord(b, s.offset))
+		return nil
+	})
+	return acquired, err
+}
+
+// Release - returns one unit, waking a waiter if there is one
+func (s *Semaphore) Release() error {
+	return s.mapped.With(func(b []byte) error {
+		count, waiters := sharedWord(b, s.offset), sharedWord(b, s.offset+4)
+		atomic.AddUint32(count, 1)
+		if atomic.LoadUint32(waiters) > 0 {
+			if _, err := futex(count, futexWake, 1, 0); err != nil {
+				return errors.Wrap(err, "futex wake")
+			}
+		}
+		return nil
+	})
+}
+
+func tryAcquire(count *uint32) bool {
+	for {
+		c := atomic.LoadUint32(count)
+		if c == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(count, c, c-1) {
+			return true
+		}
+	}
+}
+
+func checkShared(mapped *Mapped, offset, size int) error {
+	if offset < 0 || offset%4 != 0 || offset+size > mapped.Len() {
+		return errors.Errorf("offset %d is not 4 byte aligned with room for %d bytes in the %d byte mapping", offset, size, mapped.Len())
+	}
+	return nil
+}
+
+// sharedWord - the uint32 at offset in b, which is mapped memory that the garbage collector never moves
+func sharedWord(b []byte, offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&b[offset])) // #nosec G103
+}
+
+// futex - futex(2) on a word which may be shared with other processes (so not FUTEX_PRIVATE_FLAG)
+func futex(word *uint32, op int, val uint32, timeout time.Duration) (int, error) {
+	var ts *unix.Timespec
+	if timeout > 0 {
+		t := unix.NsecToTimespec(int64(timeout))
+		ts = &t
+	}
+	// #nosec G103
+	r, _, errno := unix.Syscall6(unix.SYS_FUTEX, uintptr(unsafe.Pointer(word)), uintptr(op), uintptr(val),
+		uintptr(unsafe.Pointer(ts)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+// processAlive - whether the process pid exists (EPERM means it does, but belongs to someone else)
+func processAlive(pid uint32) bool {
+	return unix.Kill(int(pid), 0) != unix.ESRCH
+}
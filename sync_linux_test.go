@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/edwarnicke/oob"
+)
+
+// newSharedMappings - two mappings of the same memfd, one of them through a peer which received it, as two processes
+// sharing memory would have
+func newSharedMappings(t *testing.T) (a, b *oob.Mapped) {
+	memfd, err := oob.MemfdCreate("shared")
+	require.NoError(t, err)
+	defer func() { _ = memfd.Close() }()
+	require.NoError(t, oob.MemfdResize(memfd, 4096))
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFile(memfd))
+	received, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+
+	a, err = oob.Mmap(memfd, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	require.NoError(t, err)
+	b, err = oob.Mmap(received, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = a.Close()
+		_ = b.Close()
+	})
+	return a, b
+}
+
+func TestMutex(t *testing.T) {
+	a, b := newSharedMappings(t)
+	muA, err := oob.NewMutex(a, 0)
+	require.NoError(t, err)
+	muB, err := oob.NewMutex(b, 0)
+	require.NoError(t, err)
+	_, err = oob.NewMutex(a, 2)
+	assert.Error(t, err)
+
+	// A counter in the shared memory, incremented without atomics under the Mutex through either mapping
+	var wg sync.WaitGroup
+	for i, mu := range []*oob.Mutex{muA, muB, muA, muB} {
+		mapped := a
+		if i%2 == 1 {
+			mapped = b
+		}
+		wg.Add(1)
+		go func(mu *oob.Mutex, mapped *oob.Mapped) {
+			defer wg.Done()
+			buf := make([]byte, 4)
+			for j := 0; j < 1000; j++ {
+				assert.NoError(t, mu.Lock())
+				_, rwErr := mapped.ReadAt(buf, 64)
+				assert.NoError(t, rwErr)
+				binary.LittleEndian.PutUint32(buf, binary.LittleEndian.Uint32(buf)+1)
+				_, rwErr = mapped.WriteAt(buf, 64)
+				assert.NoError(t, rwErr)
+				assert.NoError(t, mu.Unlock())
+			}
+		}(mu, mapped)
+	}
+	wg.Wait()
+	buf := make([]byte, 4)
+	_, err = a.ReadAt(buf, 64)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4000), binary.LittleEndian.Uint32(buf))
+
+	// Not locked, so not ours to unlock
+	assert.Error(t, muA.Unlock())
+}
+
+func TestMutexOwnerDied(t *testing.T) {
+	a, b := newSharedMappings(t)
+	mu, err := oob.NewMutex(b, 0)
+	require.NoError(t, err)
+
+	// Held by a process which has since exited
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	word := make([]byte, 4)
+	binary.LittleEndian.PutUint32(word, uint32(cmd.Process.Pid))
+	_, err = a.WriteAt(word, 0)
+	require.NoError(t, err)
+	assert.Equal(t, oob.ErrOwnerDied, mu.Lock())
+	require.NoError(t, mu.Unlock())
+
+	// FUTEX_OWNER_DIED set by someone else
+	binary.LittleEndian.PutUint32(word, 0x40000000)
+	_, err = a.WriteAt(word, 0)
+	require.NoError(t, err)
+	assert.Equal(t, oob.ErrOwnerDied, mu.Lock())
+	require.NoError(t, mu.Unlock())
+	require.NoError(t, mu.Lock())
+	require.NoError(t, mu.Unlock())
+}
+
+func TestSemaphore(t *testing.T) {
+	a, b := newSharedMappings(t)
+	semA, err := oob.NewSemaphore(a, 0)
+	require.NoError(t, err)
+	semB, err := oob.NewSemaphore(b, 0)
+	require.NoError(t, err)
+
+	acquired, err := semB.TryAcquire()
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, semB.Acquire(ctx))
+
+	done := make(chan error, 1)
+	go func() { done <- semB.Acquire(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, semA.Release())
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("Release didn't wake the waiter")
+	}
+
+	require.NoError(t, semA.Release())
+	require.NoError(t, semA.Release())
+	for i := 0; i < 2; i++ {
+		acquired, err = semB.TryAcquire()
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	}
+	acquired, err = semB.TryAcquire()
+	require.NoError(t, err)
+	assert.False(t, acquired)
+}
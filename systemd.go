@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// listenFDsStart - SD_LISTEN_FDS_START, the first fd systemd passes to a socket activated service
+const listenFDsStart = 3
+
+// FromAcceptedStdio - the oob.UnixConn for a daemon started per connection, either by systemd with Accept=yes (the
+//                     connection is fd 3, announced with LISTEN_PID/LISTEN_FDS) or inetd style (the connection is
+//                     fd 0)
+//                     returns an error if that fd is not a connected unix socket
+func FromAcceptedStdio(opts ...Option) (*UnixConn, error) {
+	fd := 0
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err == nil && pid == os.Getpid() {
+		if n, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); err == nil && n >= 1 {
+			fd = listenFDsStart
+		}
+		// Like sd_listen_fds(1), so that our children don't think these are meant for them
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}
+
+	sa, err := unix.Getsockname(fd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fd %d is not a socket", fd)
+	}
+	if _, ok := sa.(*unix.SockaddrUnix); !ok {
+		return nil, errors.Errorf("fd %d is not a unix socket", fd)
+	}
+	if listening, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ACCEPTCONN); err == nil && listening != 0 {
+		return nil, errors.Errorf("fd %d is a listening socket, not an accepted connection (is Accept=yes set?)", fd)
+	}
+
+	file := os.NewFile(uintptr(fd), "accepted")
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to use fd %d as a connection", fd)
+	}
+	// net.FileConn has its own dup of the fd
+	_ = file.Close()
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.Errorf("fd %d is not a unix connection", fd)
+	}
+	return NewUnixConn(unixConn, opts...), nil
+}
+
+// SdNotify - sends state (READY=1, WATCHDOG=1, STOPPING=1, ...) to the service manager over $NOTIFY_SOCKET, like
+//            sd_notify(3), returning false without error if NOTIFY_SOCKET is not set
+func SdNotify(state string) (bool, error) {
+	return SdPidNotifyWithFDs(0, state)
+}
+
+// sdWatchdogInterval - how often to send WATCHDOG=1, half of WATCHDOG_USEC like sd_watchdog_enabled(3) recommends,
+//                      false if the watchdog is not enabled for this process
+func sdWatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestFromAcceptedStdioNotASocket(t *testing.T) {
+	// LISTEN_PID for some other process means stdin is the candidate, which under go test is not a unix socket
+	require.NoError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1)))
+	require.NoError(t, os.Setenv("LISTEN_FDS", "1"))
+	defer func() { _ = os.Unsetenv("LISTEN_PID") }()
+	defer func() { _ = os.Unsetenv("LISTEN_FDS") }()
+
+	conn, err := oob.FromAcceptedStdio()
+	assert.Error(t, err)
+	assert.Nil(t, conn)
+	// Not ours, so left alone
+	assert.Equal(t, "1", os.Getenv("LISTEN_FDS"))
+}
+
+// acceptedStdioEnv - set in the environment of the child TestFromAcceptedStdioChild runs in, to how many fds systemd
+//                    would announce in LISTEN_FDS
+const acceptedStdioEnv = "OOB_TEST_ACCEPTED_STDIO_LISTEN_FDS"
+
+// TestFromAcceptedStdioChild - runs only in the child started by startAcceptedStdioChild, playing the daemon
+func TestFromAcceptedStdioChild(t *testing.T) {
+	listenFDs, ok := os.LookupEnv(acceptedStdioEnv)
+	if !ok {
+		t.Skip("only runs as a child of TestFromAcceptedStdio*")
+	}
+	// systemd sets LISTEN_PID after forking, which a test can't, so the child claims the fds itself
+	require.NoError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())))
+	require.NoError(t, os.Setenv("LISTEN_FDS", listenFDs))
+
+	conn, err := oob.FromAcceptedStdio()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_, set := os.LookupEnv(key)
+		require.False(t, set, "%s is still set", key)
+	}
+	_, err = conn.Write([]byte("accepted"))
+	require.NoError(t, err)
+}
+
+// startAcceptedStdioChild - runs TestFromAcceptedStdioChild with one end of a socketpair as fd 3 (systemd Accept=yes)
+//                           or as stdin (inetd), returning what the child wrote on it
+func startAcceptedStdioChild(t *testing.T, asStdin bool) string {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	ours := os.NewFile(uintptr(pair[0]), "ours")
+	theirs := os.NewFile(uintptr(pair[1]), "theirs")
+	defer func() { _ = ours.Close() }()
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestFromAcceptedStdioChild$", "-test.v")
+	if asStdin {
+		cmd.Stdin = theirs
+		cmd.Env = append(os.Environ(), acceptedStdioEnv+"=0")
+	} else {
+		cmd.ExtraFiles = []*os.File{theirs}
+		cmd.Env = append(os.Environ(), acceptedStdioEnv+"=1")
+	}
+	output, err := cmd.CombinedOutput()
+	_ = theirs.Close()
+	require.NoError(t, err, "%s", output)
+	received, err := ioutil.ReadAll(ours)
+	require.NoError(t, err)
+	return string(received)
+}
+
+func TestFromAcceptedStdioSystemd(t *testing.T) {
+	assert.Equal(t, "accepted", startAcceptedStdioChild(t, false))
+}
+
+func TestFromAcceptedStdioInetd(t *testing.T) {
+	assert.Equal(t, "accepted", startAcceptedStdioChild(t, true))
+}
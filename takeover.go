@@ -0,0 +1,267 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The phases of a takeover, sent as the payloads of takeover frames
+const (
+	takeoverPrepare  = "prepare"
+	takeoverTransfer = "transfer"
+	takeoverConfirm  = "confirm"
+	takeoverRelease  = "release"
+	takeoverDone     = "done"
+	takeoverCommit   = "commit"
+	takeoverAbort    = "abort"
+)
+
+// defaultTakeoverTimeout - the timeout of any phase of a takeover left zero in TakeoverTimeouts
+const defaultTakeoverTimeout = 5 * time.Second
+
+// ErrTakeoverAborted - returned by OfferTakeover and AcceptTakeover when the takeover was rolled back, leaving the
+//                      listener with the old process
+var ErrTakeoverAborted = errors.New("takeover aborted")
+
+// TakeoverTimeouts - how long each phase of a takeover may take before it is rolled back, zero for 5 seconds
+type TakeoverTimeouts struct {
+	// Prepare - for the new process to answer that it is ready to take over
+	Prepare time.Duration
+	// Transfer - for the listener to be sent to the new process
+	Transfer time.Duration
+	// Confirm - for the new process to confirm it received a working listener
+	Confirm time.Duration
+	// Release - for the new process to be released the listener (and sent the connections queued on it), and to
+	//           acknowledge that it has taken over, and then for the old process to commit to it
+	Release time.Duration
+}
+
+func (t TakeoverTimeouts) orDefault(d time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultTakeoverTimeout
+	}
+	return d
+}
+
+// OfferTakeover - hands listener over to a new process calling AcceptTakeover, negotiating each phase in turn:
+//                 PREPARE (the new process is ready), TRANSFER (the listener is sent), CONFIRM (the new process has a
+//                 working listener) and RELEASE (the connections waiting in the accept queue are sent, and the new
+//                 process acknowledges that it has them and starts accepting)
+//                 the caller should stop calling Accept on listener first, if OfferTakeover returns nil the new
+//                 process owns listener (closing it no longer removes its socket file), otherwise it was rolled back
+//                 and the caller should carry on serving listener, along with the connections taken off its accept
+//                 queue, which are given back in a *HandoffError if there were any
+//                 once the new process acknowledges RELEASE (it has everything) OfferTakeover sends it COMMIT and
+//                 returns nil, and the new process only starts serving once it receives that COMMIT, so the listener
+//                 and its connections are never served by both processes
+//                 a COMMIT which is lost, or arrives after the Release timeout of the new process, leaves them with
+//                 neither: the new process closes everything, yet OfferTakeover has already returned nil
+func (s *UnixConn) OfferTakeover(listener net.Listener, timeouts TakeoverTimeouts) (err error) {
+	defer s.opts.profile("OfferTakeover")()
+	fd, err := ToFd(listener)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && !errors.Is(err, ErrTakeoverAborted) {
+			_ = s.sendTakeoverPhase(takeoverAbort)
+		}
+	}()
+
+	if err = s.sendTakeoverPhase(takeoverPrepare); err != nil {
+		return err
+	}
+	if err = s.expectTakeoverPhase(takeoverPrepare, timeouts.orDefault(timeouts.Prepare)); err != nil {
+		return err
+	}
+
+	b := NewBundle()
+	defer func() { _ = b.Close() }()
+	if err = b.Add(handoffListenerLabel, listener, nil); err != nil {
+		return err
+	}
+	if err = s.withWriteDeadline(timeouts.orDefault(timeouts.Transfer), func() error {
+		if err := s.sendTakeoverPhase(takeoverTransfer); err != nil {
+			return err
+		}
+		return s.SendBundle(b)
+	}); err != nil {
+		return err
+	}
+	if err = s.expectTakeoverPhase(takeoverConfirm, timeouts.orDefault(timeouts.Confirm)); err != nil {
+		return err
+	}
+
+	conns := NewBundle()
+	defer func() { _ = conns.Close() }()
+	release := timeouts.orDefault(timeouts.Release)
+	if err = drainAcceptQueue(fd, conns); err == nil {
+		err = s.withWriteDeadline(release, func() error {
+			if err := s.sendTakeoverPhase(takeoverRelease); err != nil {
+				return err
+			}
+			return s.SendBundle(conns)
+		})
+	}
+	if err == nil {
+		err = s.expectTakeoverPhase(takeoverDone, release)
+	}
+	if err == nil {
+		err = s.withWriteDeadline(release, func() error { return s.sendTakeoverPhase(takeoverCommit) })
+	}
+	if err != nil {
+		// The new process closes whatever it received unless we committed, so the connections are still ours
+		if queued := drainedConns(conns); len(queued) > 0 {
+			return &HandoffError{Conns: queued, Err: err}
+		}
+		return err
+	}
+	keepSocketFile(listener)
+	return nil
+}
+
+// AcceptTakeover - takes over a listener from an old process calling OfferTakeover, returning it along with the
+//                  connections which were waiting in its accept queue, which should be served before calling Accept
+//                  it only returns them once the old process has committed to the takeover (after giving up the
+//                  listener), if any phase fails or times out, or the old process aborts, everything received is
+//                  closed and the old process keeps the listener
+func (s *UnixConn) AcceptTakeover(timeouts TakeoverTimeouts) (_ net.Listener, _ []net.Conn, err error) {
+	defer s.opts.profile("AcceptTakeover")()
+	defer func() {
+		if err != nil && !errors.Is(err, ErrTakeoverAborted) {
+			_ = s.sendTakeoverPhase(takeoverAbort)
+		}
+	}()
+
+	if err = s.expectTakeoverPhase(takeoverPrepare, timeouts.orDefault(timeouts.Prepare)); err != nil {
+		return nil, nil, err
+	}
+	if err = s.sendTakeoverPhase(takeoverPrepare); err != nil {
+		return nil, nil, err
+	}
+
+	var b *Bundle
+	if err = s.withReadDeadline(timeouts.orDefault(timeouts.Transfer), func() error {
+		if err := s.expectTakeoverPhase(takeoverTransfer, 0); err != nil {
+			return err
+		}
+		b, err = s.RecvBundle()
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = b.Close() }()
+	item := b.Get(handoffListenerLabel)
+	if item == nil {
+		return nil, nil, errors.New("received a takeover without a listener")
+	}
+	listener, err := net.FileListener(item.File)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "received listener is not a listening socket")
+	}
+
+	if err = s.sendTakeoverPhase(takeoverConfirm); err != nil {
+		_ = listener.Close()
+		return nil, nil, err
+	}
+	var conns []net.Conn
+	if err = s.withReadDeadline(timeouts.orDefault(timeouts.Release), func() error {
+		if err := s.expectTakeoverPhase(takeoverRelease, 0); err != nil {
+			return err
+		}
+		queued, err := s.RecvBundle()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = queued.Close() }()
+		conns, err = s.handoffConns(queued)
+		return err
+	}); err != nil {
+		_ = listener.Close()
+		return nil, nil, err
+	}
+	if err = s.sendTakeoverPhase(takeoverDone); err == nil {
+		err = s.expectTakeoverPhase(takeoverCommit, timeouts.orDefault(timeouts.Release))
+	}
+	if err != nil {
+		_ = listener.Close()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		return nil, nil, err
+	}
+	return newListener(listener, s.opts.all...), conns, nil
+}
+
+// sendTakeoverPhase - tells the peer the takeover has reached phase
+func (s *UnixConn) sendTakeoverPhase(phase string) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.writeFrame(&frame{typ: frameTakeover, payload: []byte(phase)})
+}
+
+// expectTakeoverPhase - waits up to timeout (or the read deadline already set, if zero) for the peer to reach phase,
+//                       ErrTakeoverAborted if it aborts instead
+func (s *UnixConn) expectTakeoverPhase(phase string, timeout time.Duration) error {
+	read := func() error {
+		s.recvMu.Lock()
+		f, err := s.readFrame()
+		s.recvMu.Unlock()
+		if err != nil {
+			return errors.Wrapf(err, "takeover failed waiting for %s", phase)
+		}
+		closeFDs(f.fds)
+		switch {
+		case f.typ != frameTakeover:
+			return errors.Errorf("received unexpected frame type %d while waiting for takeover %s", f.typ, phase)
+		case string(f.payload) == takeoverAbort:
+			return errors.Wrapf(ErrTakeoverAborted, "peer aborted while waiting for %s", phase)
+		case string(f.payload) != phase:
+			return errors.Errorf("takeover expected %s but the peer sent %s", phase, f.payload)
+		}
+		return nil
+	}
+	if timeout == 0 {
+		return read()
+	}
+	return s.withReadDeadline(timeout, read)
+}
+
+// withReadDeadline - runs f with a read deadline timeout from now, clearing it again afterwards
+func (s *UnixConn) withReadDeadline(timeout time.Duration, f func() error) error {
+	if err := s.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = s.SetReadDeadline(time.Time{}) }()
+	return f()
+}
+
+// withWriteDeadline - runs f with a write deadline timeout from now, clearing it again afterwards
+func (s *UnixConn) withWriteDeadline(timeout time.Duration, f func() error) error {
+	if err := s.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = s.SetWriteDeadline(time.Time{}) }()
+	return f()
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestTakeover(t *testing.T) {
+	socketfilename := filepath.Join(t.TempDir(), "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+
+	// A client waiting in the accept queue
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	old, taker := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- old.OfferTakeover(listener, oob.TakeoverTimeouts{}) }()
+	received, conns, err := taker.AcceptTakeover(oob.TakeoverTimeouts{})
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	require.NoError(t, listener.Close())
+	defer func() { _ = received.Close() }()
+
+	require.Len(t, conns, 1)
+	_, err = client.Write([]byte{1})
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(conns[0], buf)
+	require.NoError(t, err)
+	_ = conns[0].Close()
+
+	// The socket file stayed, and the new process accepts on it
+	client, err = net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := received.Accept()
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestTakeoverRollsBackWithoutConfirm(t *testing.T) {
+	socketfilename := filepath.Join(t.TempDir(), "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	// A new process which is too slow to confirm
+	old, taker := newUnixConnPair(t)
+	takerErr := make(chan error, 1)
+	go func() {
+		_, _, err := taker.AcceptTakeover(oob.TakeoverTimeouts{})
+		takerErr <- err
+	}()
+	err = old.OfferTakeover(listener, oob.TakeoverTimeouts{Confirm: time.Nanosecond})
+	require.Error(t, err)
+
+	// The new process hears of the abort, and closes what it received
+	err = <-takerErr
+	assert.True(t, errors.Is(err, oob.ErrTakeoverAborted), "%+v", err)
+
+	// The old process keeps serving
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestTakeoverRollsBackWithoutDone(t *testing.T) {
+	socketfilename := filepath.Join(t.TempDir(), "socket")
+	listener, err := oob.Listen("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	// A client waiting in the accept queue
+	client, err := net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	// A new process which confirms, then fails to receive what is released to it
+	old, taker := newUnixConnPair(t)
+	takerErr := make(chan error, 1)
+	go func() {
+		_, _, err := taker.AcceptTakeover(oob.TakeoverTimeouts{Release: time.Nanosecond})
+		takerErr <- err
+	}()
+	err = old.OfferTakeover(listener, oob.TakeoverTimeouts{})
+	assert.True(t, errors.Is(err, oob.ErrTakeoverAborted), "%+v", err)
+	assert.Error(t, <-takerErr)
+
+	// The old process gets the queued client back, and keeps serving
+	var handoffErr *oob.HandoffError
+	require.True(t, errors.As(err, &handoffErr), "%+v", err)
+	require.Len(t, handoffErr.Conns, 1)
+	_, err = client.Write([]byte{1})
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(handoffErr.Conns[0], buf)
+	require.NoError(t, err)
+	_ = handoffErr.Conns[0].Close()
+
+	client, err = net.Dial("unix", socketfilename)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestTakeoverNewProcessTimesOut(t *testing.T) {
+	// No old process ever offers
+	_, taker := newUnixConnPair(t)
+	start := time.Now()
+	_, _, err := taker.AcceptTakeover(oob.TakeoverTimeouts{Prepare: 50 * time.Millisecond})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) <= 5*time.Second)
+}
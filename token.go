@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"encoding/binary"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// fdTokenLen - the u64 little endian token sent as the data of each SendFDWithToken
+const fdTokenLen = 8
+
+// SendFDWithToken - send fd along with a token, numbering the fds sent this way on the conn from 1, which the caller
+//                   can write into its own stream data to tell the peer which message fd belongs to, and which the
+//                   peer receives along with fd with RecvFDWithToken
+func (s *UnixConn) SendFDWithToken(fd uintptr) (token uint64, err error) {
+	s.checkDuplicateSend(fd)
+	defer s.opts.profile("SendFDWithToken")()
+	defer s.watch("SendFDWithToken", true)()
+	defer func() { s.record("SendFDWithToken", err, fd) }()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.fdTokens++
+	token = s.fdTokens
+	p := make([]byte, fdTokenLen)
+	binary.LittleEndian.PutUint64(p, token)
+	n, err := s.sendmsg(p, syscall.UnixRights(int(fd)))
+	// The fd went with the first byte, a stream socket may take the rest separately
+	for err == nil && n < len(p) {
+		var m int
+		m, err = s.UnixConn.Write(p[n:])
+		n += m
+	}
+	if err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+// RecvFDWithToken - recv an fd sent with SendFDWithToken, along with its token
+// Note: If the message received carries no fd, it will return an error errors.Is ErrNoFD
+func (s *UnixConn) RecvFDWithToken() (fd uintptr, token uint64, err error) {
+	defer s.opts.profile("RecvFDWithToken")()
+	defer s.watch("RecvFDWithToken", false)()
+	defer func() { s.recordRecv("RecvFDWithToken", fd, err) }()
+	if s.prefetch != nil {
+		return 0, 0, errors.New("RecvFDWithToken cannot be used WithPrefetch, the prefetcher does not keep the token")
+	}
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	p := make([]byte, fdTokenLen)
+	rights, err := s.readFull(p, nil)
+	if err == nil && len(rights) == 0 {
+		err = errors.WithStack(ErrNoFD)
+	}
+	if err == nil && len(rights) > 1 {
+		err = errors.Errorf("received %d fds with a token, rather than 1", len(rights))
+	}
+	if err != nil {
+		closeFDs(rights)
+		return 0, 0, err
+	}
+	return uintptr(rights[0]), binary.LittleEndian.Uint64(p), nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFDTokens(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+	sender, receiver := newUnixConnPair(t)
+
+	// Tokens count up, interleaved with stream data
+	for i, f := range []*os.File{r, w} {
+		_, err = sender.Write([]byte{byte('a' + i)})
+		require.NoError(t, err)
+		token, err := sender.SendFDWithToken(f.Fd())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), token)
+	}
+	for i := range []*os.File{r, w} {
+		buf := make([]byte, 1)
+		_, err = receiver.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, byte('a'+i), buf[0])
+		fd, token, err := receiver.RecvFDWithToken()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), token)
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+}
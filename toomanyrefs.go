@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"syscall"
+	"time"
+)
+
+// ErrTooManyRefs - returned (wrapped) by sends failing because too many fds sent by this user are in flight, not yet
+//                  received (ETOOMANYREFS), which is temporary: it passes as the receiver catches up
+//                  errors.Is(err, syscall.ETOOMANYREFS) holds for it too
+//                  WithTooManyRefsBackoff and WithOnTooManyRefs retry such sends rather than fail them
+var ErrTooManyRefs error = tooManyRefsError{}
+
+type tooManyRefsError struct{}
+
+func (tooManyRefsError) Error() string {
+	return "too many fds in flight to receivers (ETOOMANYREFS), retry once they have caught up"
+}
+
+// Is - ErrTooManyRefs is also syscall.ETOOMANYREFS
+func (tooManyRefsError) Is(target error) bool { return target == syscall.ETOOMANYREFS }
+
+// Temporary - ErrTooManyRefs is worth retrying
+func (tooManyRefsError) Temporary() bool { return true }
+
+// Backoff between retries of sends failing with ETOOMANYREFS, WithTooManyRefsBackoff
+const (
+	tooManyRefsMinBackoff = time.Millisecond
+	tooManyRefsMaxBackoff = 100 * time.Millisecond
+)
+
+// WithTooManyRefsBackoff - retry sends failing because too many fds are in flight (ETOOMANYREFS), backing off from 1ms
+//                          to 100ms between attempts, for up to maxWait before failing with ErrTooManyRefs, so
+//                          senders pushing thousands of fds wait for a slow receiver rather than fail
+func WithTooManyRefsBackoff(maxWait time.Duration) Option {
+	return func(o *options) {
+		o.tooManyRefsWait = maxWait
+	}
+}
+
+// WithOnTooManyRefs - call retry when a send fails because too many fds are in flight (ETOOMANYREFS), with the number
+//                     of attempts which have failed so far, retrying the send if it returns true (after waiting,
+//                     draining the receiver, ...) and failing with ErrTooManyRefs if not, takes precedence over
+//                     WithTooManyRefsBackoff
+func WithOnTooManyRefs(retry func(attempts int) bool) Option {
+	return func(o *options) {
+		o.onTooManyRefs = retry
+	}
+}
+
+// retryTooManyRefs - whether to retry a send which has failed with ETOOMANYREFS attempts times, the first of them at
+//                    start, waiting before it if WithTooManyRefsBackoff
+func (o *options) retryTooManyRefs(attempts int, start time.Time) bool {
+	if o.onTooManyRefs != nil {
+		return o.onTooManyRefs(attempts)
+	}
+	if o.tooManyRefsWait <= 0 {
+		return false
+	}
+	backoff := tooManyRefsMaxBackoff
+	if attempts < 8 {
+		backoff = tooManyRefsMinBackoff << (attempts - 1)
+	}
+	if backoff > tooManyRefsMaxBackoff {
+		backoff = tooManyRefsMaxBackoff
+	}
+	if time.Since(start)+backoff > o.tooManyRefsWait {
+		return false
+	}
+	time.Sleep(backoff)
+	return true
+}
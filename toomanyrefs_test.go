@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestTooManyRefs(t *testing.T) {
+	tooManyRefs := oob.WithFaultInjection(oob.FaultInjection{TooManyRefs: 1})
+
+	// By default the send fails, with an error saying so
+	_, sender := newUnixConnPair(t, tooManyRefs)
+	err := sender.SendFD(os.Stdin.Fd())
+	assert.True(t, errors.Is(err, oob.ErrTooManyRefs), "%+v", err)
+	assert.True(t, errors.Is(err, syscall.ETOOMANYREFS), "%+v", err)
+
+	// The callback decides whether to retry
+	var attempts []int
+	_, sender = newUnixConnPair(t, tooManyRefs, oob.WithOnTooManyRefs(func(n int) bool {
+		attempts = append(attempts, n)
+		return n < 3
+	}))
+	err = sender.SendFD(os.Stdin.Fd())
+	assert.True(t, errors.Is(err, oob.ErrTooManyRefs), "%+v", err)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+
+	// Backing off gives up after maxWait
+	_, sender = newUnixConnPair(t, tooManyRefs, oob.WithTooManyRefsBackoff(50*time.Millisecond))
+	start := time.Now()
+	err = sender.SendFD(os.Stdin.Fd())
+	assert.True(t, errors.Is(err, oob.ErrTooManyRefs), "%+v", err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// And succeeds once the fds are no longer too many
+	receiver, sender := newUnixConnPair(t,
+		oob.WithFaultInjection(oob.FaultInjection{TooManyRefs: 0.5, Seed: 1}),
+		oob.WithTooManyRefsBackoff(time.Second))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sender.SendFD(os.Stdin.Fd()))
+		fd, err := receiver.RecvFD()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+// FDTransceiver - sends and receives fds as *UnixConn does (on every platform), what oobtest.RunConformance checks
+//                 alternative transports (SEQPACKET, fakes, ...) against
+type FDTransceiver interface {
+	SendFD(fd uintptr) error
+	RecvFD() (uintptr, error)
+	Close() error
+}
+
+// BatchFDTransceiver - an FDTransceiver which also sends and receives batches of fds, as SendFDs and RecvFDs do
+type BatchFDTransceiver interface {
+	FDTransceiver
+	SendFDs(fds ...uintptr) error
+	RecvFDs(n int) ([]uintptr, error)
+}
+
+// BundleTransceiver - an FDTransceiver which also sends and receives Bundles, as SendBundle and RecvBundle do
+type BundleTransceiver interface {
+	FDTransceiver
+	SendBundle(b *Bundle) error
+	RecvBundle() (*Bundle, error)
+}
+
+var _ BundleTransceiver = (*UnixConn)(nil)
@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"net"
+	"syscall"
+)
+
+// transport - the sendmsg, recvmsg and close UnixConn is built on
+//             everything above it (SendFD, bundles, frames, handoff, ...) reaches the socket through UnixConn's
+//             sendmsgTo and recvmsgFrom, so another backend (SOCK_SEQPACKET, an in memory fake, io_uring, ...) only
+//             has to implement these three to sit underneath all of it
+type transport interface {
+	// sendmsg - sends p with the control message oob, to to on unconnected sockets (nil otherwise), honoring write
+	//           deadlines
+	sendmsg(p, oob []byte, to syscall.Sockaddr) (int, error)
+	// recvmsg - receives into p and its control message into oob, honoring read deadlines
+	recvmsg(p, oob []byte, flags int) (n, oobn, recvflags int, from syscall.Sockaddr, err error)
+	// close - closes the transport, failing any sendmsg or recvmsg in progress
+	close() error
+}
+
+// socketTransport - the transport of a *net.UnixConn, which goes through its syscall.RawConn so that the socket stays
+//                   in non-blocking mode and deadlines are honored
+type socketTransport struct {
+	conn *net.UnixConn
+}
+
+func (t *socketTransport) sendmsg(p, oob []byte, to syscall.Sockaddr) (int, error) {
+	rawConn, err := t.conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var opErr error
+	err = rawConn.Write(func(fd uintptr) bool {
+		n, opErr = syscall.SendmsgN(int(fd), p, oob, to, 0)
+		return opErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, opErr
+}
+
+func (t *socketTransport) recvmsg(p, oob []byte, flags int) (n, oobn, recvflags int, from syscall.Sockaddr, err error) {
+	rawConn, err := t.conn.SyscallConn()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	var opErr error
+	err = rawConn.Read(func(fd uintptr) bool {
+		n, oobn, recvflags, from, opErr = syscall.Recvmsg(int(fd), p, oob, flags)
+		return opErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return n, oobn, recvflags, from, err
+	}
+	return n, oobn, recvflags, from, opErr
+}
+
+func (t *socketTransport) close() error {
+	return t.conn.Close()
+}
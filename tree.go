@@ -0,0 +1,144 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package oob
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// TreeHandler - called by RecvTree for each entry of a tree sent with SendTree
+//               path is relative to the root of the tree, file is a live fd for the entry (O_PATH for symlinks and
+//               special files) which the handler is responsible for closing
+type TreeHandler func(path string, mode os.FileMode, file *os.File) error
+
+// SendTree - walks the directory dirfd and sends each entry in it as a (relative path, mode, fd) record
+//            the walk only uses openat relative to already open directories, so renames or symlink swaps elsewhere
+//            in the filesystem cannot redirect it outside of dirfd
+//            if the walk fails partway, the peer's RecvTree fails with the error too
+func (s *UnixConn) SendTree(dirfd uintptr) error {
+	defer s.opts.profile("SendTree")()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err := s.sendTree(int(dirfd), ""); err != nil {
+		// Tell the peer, so RecvTree fails rather than waiting for the rest of the tree
+		_ = s.writeFrame(&frame{typ: frameTreeAbort, payload: []byte(err.Error())})
+		return err
+	}
+	return s.writeFrame(&frame{typ: frameTreeEnd})
+}
+
+func (s *UnixConn) sendTree(dirfd int, dir string) error {
+	// Read the directory through our own fd so the callers fd offset is left alone
+	fd, err := unix.Openat(dirfd, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open directory %q", dir)
+	}
+	d := os.NewFile(uintptr(fd), dir)
+	defer func() { _ = d.Close() }()
+	entries, err := d.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.sendTreeEntry(fd, path.Join(dir, entry.Name()), entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *UnixConn) sendTreeEntry(dirfd int, relPath string, entry fs.DirEntry) error {
+	flags := unix.O_CLOEXEC | unix.O_NOFOLLOW
+	switch {
+	case entry.IsDir():
+		flags |= unix.O_RDONLY | unix.O_DIRECTORY
+	case entry.Type().IsRegular():
+		// O_NONBLOCK so that an entry swapped for a fifo after we read the directory can't hang the walk
+		flags |= unix.O_RDONLY | unix.O_NONBLOCK
+	default:
+		flags |= unix.O_PATH
+	}
+	fd, err := unix.Openat(dirfd, entry.Name(), flags, 0)
+	if err == unix.ELOOP || err == unix.ENXIO {
+		// Not what readdir said it was anymore, send whatever is there now
+		fd, err = unix.Openat(dirfd, entry.Name(), unix.O_CLOEXEC|unix.O_NOFOLLOW|unix.O_PATH, 0)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to open %q", relPath)
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	// Trust what we actually opened, not what readdir told us
+	stat := &unix.Stat_t{}
+	if err = unix.Fstat(fd, stat); err != nil {
+		return errors.Wrapf(err, "unable to stat %q", relPath)
+	}
+	payload := make([]byte, 4+len(relPath))
+	binary.LittleEndian.PutUint32(payload, stat.Mode)
+	copy(payload[4:], relPath)
+	if err = s.writeFrame(&frame{typ: frameTreeEntry, payload: payload, fds: []int{fd}}); err != nil {
+		return err
+	}
+	if stat.Mode&unix.S_IFMT == unix.S_IFDIR {
+		return s.sendTree(fd, relPath)
+	}
+	return nil
+}
+
+// RecvTree - receives a tree sent with SendTree, calling handler for each entry, parents before their children
+//            if handler returns an error RecvTree stops and returns it, leaving the rest of the tree unread
+func (s *UnixConn) RecvTree(handler TreeHandler) error {
+	defer s.opts.profile("RecvTree")()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	for {
+		f, err := s.readFrame()
+		if err != nil {
+			return err
+		}
+		switch f.typ {
+		case frameTreeEnd:
+			closeFDs(f.fds)
+			return nil
+		case frameTreeAbort:
+			closeFDs(f.fds)
+			return errors.Errorf("sender aborted the tree: %s", f.payload)
+		case frameTreeEntry:
+			if len(f.fds) != 1 || len(f.payload) < 4 || !fs.ValidPath(string(f.payload[4:])) {
+				closeFDs(f.fds)
+				return errors.New("received malformed tree entry")
+			}
+			relPath := string(f.payload[4:])
+			mode := toFileMode(binary.LittleEndian.Uint32(f.payload))
+			if err := handler(relPath, mode, os.NewFile(uintptr(f.fds[0]), relPath)); err != nil {
+				return err
+			}
+		default:
+			closeFDs(f.fds)
+			return errors.Errorf("received unexpected frame type %d while receiving tree", f.typ)
+		}
+	}
+}
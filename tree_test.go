@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package oob_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendTree(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dirname) }()
+	require.NoError(t, os.Mkdir(filepath.Join(dirname, "sub"), 0o700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirname, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirname, "sub", "b.txt"), []byte("b"), 0o600))
+	require.NoError(t, os.Symlink("../a.txt", filepath.Join(dirname, "sub", "link")))
+
+	dirfd, err := syscall.Open(dirname, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer func() { _ = syscall.Close(dirfd) }()
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendTree(uintptr(dirfd)) }()
+
+	modes := make(map[string]os.FileMode)
+	contents := make(map[string]string)
+	err = receiver.RecvTree(func(path string, mode os.FileMode, file *os.File) error {
+		defer func() { _ = file.Close() }()
+		modes[path] = mode
+		if mode.IsRegular() {
+			buf, readErr := ioutil.ReadAll(file)
+			contents[path] = string(buf)
+			return readErr
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+
+	assert.Len(t, modes, 4)
+	assert.True(t, modes["sub"].IsDir())
+	assert.Equal(t, os.ModeSymlink, modes["sub/link"].Type())
+	assert.Equal(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"}, contents)
+}
+
+func TestSendTreeAbort(t *testing.T) {
+	file, err := ioutil.TempFile(t.TempDir(), "not-a-dir")
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- sender.SendTree(file.Fd()) }()
+
+	err = receiver.RecvTree(func(path string, mode os.FileMode, file *os.File) error {
+		_ = file.Close()
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sender aborted the tree")
+	assert.Error(t, <-errCh)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"sync"
+)
+
+// tryMutex - a mutex which can also be tried without waiting (sync.Mutex only gained TryLock in go1.18), the zero
+//            value is unlocked
+type tryMutex struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (m *tryMutex) init() {
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+}
+
+func (m *tryMutex) Lock() {
+	m.init()
+	m.ch <- struct{}{}
+}
+
+// TryLock - locks m if it is unlocked, returning whether it did
+func (m *tryMutex) TryLock() bool {
+	m.init()
+	select {
+	case m.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *tryMutex) Unlock() {
+	select {
+	case <-m.ch:
+	default:
+		panic("oob: unlock of unlocked tryMutex")
+	}
+}
@@ -14,6 +14,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows
+// +build !windows
+
 // Package oob - Simple out of band file descriptor passing over Unix File Sockets
 // Linux allows the passing of file descriptors out of band over unix file sockets
 // This does not interfere with the normal byte stream passing over the unix file socket
@@ -22,33 +25,172 @@ package oob
 import (
 	"net"
 	"os"
+	"sync"
 	"syscall"
+
+	"github.com/pkg/errors"
 )
 
+// ErrNoFD - returned (wrapped) by RecvFD, RecvFile, RecvFDFrom and RecvFDMessage when the message received carried
+//           no fd, errors.Is(err, syscall.EINVAL) holds for it too, which is what was returned before it
+var ErrNoFD error = noFDError{}
+
+type noFDError struct{}
+
+func (noFDError) Error() string { return "no fd in the message received" }
+
+// Is - ErrNoFD is also syscall.EINVAL, for callers which checked for that
+func (noFDError) Is(target error) bool { return target == syscall.EINVAL }
+
 // UnixConn - net.UnixConn + SendFD and RecvFD methods for sending and receiving file descriptors
 type UnixConn struct {
 	*net.UnixConn
+
+	// sendMu and recvMu keep multi-message exchanges (frames, trees, ...) from interleaving
+	sendMu sync.Mutex
+	recvMu tryMutex
+
+	// transport - the sendmsg and recvmsg everything else is built on
+	transport transport
+	opts      options
+	sent      sentFiles
+	prefetch  *prefetcher
+	watchdog  *watchdog
+	idle      *idleReaper
+	pings     pings
+	codecs    codecs
+	events    eventRing
+	stats     connStats
+	// sendQueue - the single sender of Write and SendFD, WithSendQueue
+	sendQueue *sendQueue
+	// pending - frames read by Ping while waiting for its pong, for the next readFrame, guarded by recvMu
+	pending []*frame
+	// sending and receiving - how many operations are in progress in each direction, for Server.Shutdown
+	sending   int32
+	receiving int32
+	// peerShutdown - set once the peer has said it is shutting down
+	peerShutdown int32
+	// credentials - of the sender of the last message received WithPassCredentials, guarded by recvMu
+	credentials *Credentials
+	// fdTokens - the token of the last fd sent with SendFDWithToken, guarded by sendMu
+	fdTokens uint64
+	// liveFDs - how many fds received with RecvManagedFD(s) are still open, WithFDQuota
+	liveFDs int32
+	// managed - the fds received with RecvManagedFD(s) which are still open, and the OnPeerExit watch reporting them
+	managed managedFDs
+	// groups - the cleanup groups of fds received on the conn, closed along with it
+	groups groups
+	// packets - whether the socket preserves message boundaries (unixpacket, unixgram) rather than being a byte stream
+	packets bool
+	// onClose - of the listener which accepted the conn, WithMaxConns, set before any goroutine of the conn starts
+	onClose   func()
+	closeOnce sync.Once
 }
 
 // NewUnixConn - wrap a *net.UnixConn providing it additional methods to SendFD and RecvFD
-func NewUnixConn(s *net.UnixConn) *UnixConn {
-	return &UnixConn{s}
+//               configured with opts (WithLogger, WithMaxFDsPerMessage, WithPayloadByte, WithInheritableFDs, ...)
+func NewUnixConn(s *net.UnixConn, opts ...Option) *UnixConn {
+	return acceptedUnixConn(s, nil, opts...)
+}
+
+// acceptedUnixConn - NewUnixConn, with the onClose of the listener which accepted s set before the idle reaper (or
+//                    anything else which might close the conn) is started
+func acceptedUnixConn(s *net.UnixConn, onClose func(), opts ...Option) *UnixConn {
+	conn := &UnixConn{UnixConn: s, transport: &socketTransport{conn: s}, opts: newOptions(opts...), packets: isPacketConn(s)}
+	conn.onClose = onClose
+	if conn.opts.passCredentials {
+		conn.startPassCredentials(s)
+	}
+	if conn.opts.watchdog > 0 {
+		conn.startWatchdog(conn.opts.watchdog)
+	}
+	if conn.opts.prefetch > 0 {
+		conn.startPrefetch(conn.opts.prefetch)
+		if conn.prefetch != nil && conn.opts.unclaimedFDTimeout > 0 {
+			conn.startJanitor(conn.opts.unclaimedFDTimeout)
+		}
+	}
+	if conn.opts.idleTimeout > 0 {
+		conn.startIdleReaper(conn.opts.idleTimeout)
+	}
+	if conn.opts.sendQueue > 0 {
+		conn.startSendQueue(conn.opts.sendQueue)
+	}
+	if conn.opts.compression != nil {
+		conn.sendMu.Lock()
+		if err := conn.advertiseCodecs(); err != nil {
+			conn.opts.logf("oob: unable to advertise codecs, retrying with the first frame: %s", err)
+		}
+		conn.sendMu.Unlock()
+	}
+	return conn
+}
+
+// Close - closes the connection, along with every fd oob received on it but has not handed over: those received in
+//         the background (WithPrefetch) but not yet dequeued, those in frames set aside by Ping, and those in cleanup
+//         groups, leaving no fds of oob's own behind (SendFD and RecvFD never dup the socket)
+func (s *UnixConn) Close() error {
+	err := s.transport.close()
+	if s.watchdog != nil {
+		s.watchdog.close()
+	}
+	if s.idle != nil {
+		s.idle.close()
+	}
+	if s.sendQueue != nil {
+		s.sendQueue.close()
+	}
+	if s.prefetch != nil {
+		s.prefetch.close()
+	}
+	s.groups.closeAll()
+	s.managed.close()
+	s.closePending()
+	s.closed()
+	return err
+}
+
+// closePending - closes the fds of the frames set aside by Ping, which nothing can receive any more
+func (s *UnixConn) closePending() {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	for _, f := range s.pending {
+		closeFDs(f.fds)
+	}
+	s.pending = nil
 }
 
 // SendFD - send the file descriptor fd to the process on the other end of the *net.UnixConn
 func (s *UnixConn) SendFD(fd uintptr) error {
-	socketFile, err := s.UnixConn.File()
-	if err != nil {
-		return err
+	return s.sendFDFunc(fd, nil)
+}
+
+// sendFDFunc - SendFD, calling onSent (if not nil) once the kernel has queued fd
+func (s *UnixConn) sendFDFunc(fd uintptr, onSent func()) error {
+	s.checkDuplicateSend(fd)
+	if s.sendQueue != nil {
+		return s.sendQueue.enqueueFD(fd, onSent)
 	}
-	rights := syscall.UnixRights(int(fd))
-	err = syscall.Sendmsg(int(socketFile.Fd()), nil, rights, nil, 0)
-	if err != nil {
+	if err := s.sendFD(fd); err != nil {
 		return err
 	}
+	if onSent != nil {
+		onSent()
+	}
 	return nil
 }
 
+// sendFD - sends fd right away
+func (s *UnixConn) sendFD(fd uintptr) error {
+	defer s.opts.profile("SendFD")()
+	defer s.watch("SendFD", true)()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	_, err := s.sendmsg(nil, syscall.UnixRights(int(fd)))
+	s.record("SendFD", err, fd)
+	return err
+}
+
 // SendFile - send the *os.File to the process on the other end of the *net.UnixConn
 func (s *UnixConn) SendFile(file *os.File) error {
 	fd, err := ToFd(file)
@@ -60,40 +202,64 @@ func (s *UnixConn) SendFile(file *os.File) error {
 
 // RecvFD - recv a file descriptor over a *net.UnixConn
 // Note: You usually can't os.Link it to another file location due to cross device errors
-// Note: If you  call s.RecvFD() when no fd is available, it will return error syscall.Errno == syscall.EINVAL
+// Note: If you  call s.RecvFD() when no fd is available, it will return an error errors.Is ErrNoFD
+// Note: Every fd of the message is parsed, however many control messages the kernel coalesced them into, and those
+//       after the first are closed rather than leaked, use RecvFDs or RecvFDsWithData to receive all of them
 func (s *UnixConn) RecvFD() (fd uintptr, err error) {
-	socketFile, err := s.UnixConn.File()
-	if err != nil {
-		return 0, err
+	defer s.opts.profile("RecvFD")()
+	defer s.watch("RecvFD", false)()
+	defer func() { s.recordRecv("RecvFD", fd, err) }()
+	if s.prefetch != nil {
+		return s.prefetch.next()
 	}
-	buf := make([]byte, syscall.CmsgSpace(4))
-	_, _, _, _, err = syscall.Recvmsg(int(socketFile.Fd()), nil, buf, 0)
-	if err != nil {
-		return 0, err
+	fd, _, err = s.recvFDFrom()
+	return fd, err
+}
+
+// recvFDFrom - recvmsg of a single fd, and the address it came from (nil on connected sockets)
+func (s *UnixConn) recvFDFrom() (uintptr, syscall.Sockaddr, error) {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	buf := make([]byte, RightsBufferSize(s.opts.recvFDRoom()))
+	var p []byte
+	if s.opts.strict {
+		// Room for any data, so strict can report it rather than lose it
+		p = make([]byte, strictInlineLen)
+	}
+	n, oobn, recvflags, from, err := s.recvmsgFrom(p, buf, 0)
+	if errno, ok := err.(syscall.Errno); ok {
+		return 0, nil, errors.Wrap(errno, "unable to receive an fd")
 	}
-	var msgs []syscall.SocketControlMessage
-	msgs, err = syscall.ParseSocketControlMessage(buf)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+	fds, err := parseRights(buf[:oobn])
+	if err == nil && len(fds) > s.opts.recvFDRoom() {
+		// CmsgSpace rounds the buffer up, so it can fit more than asked for without the kernel truncating anything
+		err = errors.Wrapf(ErrControlTruncated, "received %d fds, more than the %d made room for", len(fds), s.opts.recvFDRoom())
+	}
+	if err == nil && len(fds) > 0 {
+		err = s.opts.checkRecvFD(p, n, recvflags, len(fds))
 	}
-	fds, err := syscall.ParseUnixRights(&msgs[0])
 	if err != nil {
-		return 0, err
+		closeFDs(fds)
+		return 0, nil, err
+	}
+	if len(fds) == 0 {
+		return 0, nil, errors.WithStack(ErrNoFD)
 	}
-	return uintptr(fds[0]), nil
+	closeFDs(fds[1:])
+	return uintptr(fds[0]), from, nil
 }
 
 // RecvFile - recv an *os.File over a *net.UnixConn
 // Note: You usually can't os.Link it to another file location due to cross device errors
-// Note: If you  call s.RecvFile() when no fd is available, it will return error syscall.Errno == syscall.EINVAL
+// Note: If you  call s.RecvFile() when no fd is available, it will return an error errors.Is ErrNoFD
 func (s *UnixConn) RecvFile() (*os.File, error) {
 	fd, err := s.RecvFD()
 	if err != nil {
 		return nil, err
 	}
-	file, err := ToFile(fd)
-	if err != nil {
-		return nil, err
-	}
-	return file, nil
+	// The fd is ours, so it's safe for the *os.File to own it
+	return os.NewFile(fd, fdName(fd)), nil
 }
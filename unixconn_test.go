@@ -14,6 +14,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows
+// +build !windows
+
 // Package oob - Simple out of band file descriptor passing over Unix File Sockets
 // Linux allows the passing of file descriptors out of band over unix file sockets
 // This does not interfere with the normal byte stream passing over the unix file socketv
@@ -32,6 +35,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -69,8 +73,8 @@ func TestUnixsocket_RecvFile(t *testing.T) {
 	o := conn.(*oob.UnixConn)
 	for i := 0; i < 3; i++ {
 		file, err := o.RecvFile()
-		// Only 2 file descriptors are sent, so on the third, we expect EINVAL
-		if i == 2 && err != nil && err.(syscall.Errno) == syscall.EINVAL {
+		// Only 2 file descriptors are sent, so on the third, we expect ErrNoFD
+		if i == 2 && errors.Is(err, oob.ErrNoFD) {
 			continue
 		}
 		require.NoError(t, err)
@@ -181,3 +185,166 @@ func TestUnixsocket_SendSocket(t *testing.T) {
 		assert.Zero(t, err.(*exec.ExitError).ExitCode())
 	}
 }
+
+// newUnixConnPair - a connected pair of *oob.UnixConn backed by a socketpair, with opts applied to b (the receiver)
+func newUnixConnPair(t *testing.T, opts ...oob.Option) (a, b *oob.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	toUnixConn := func(fd int, opts ...oob.Option) *oob.UnixConn {
+		file := os.NewFile(uintptr(fd), "socketpair")
+		defer func() { _ = file.Close() }()
+		conn, err := net.FileConn(file)
+		require.NoError(t, err)
+		return oob.NewUnixConn(conn.(*net.UnixConn), opts...)
+	}
+	a, b = toUnixConn(fds[0]), toUnixConn(fds[1], opts...)
+	t.Cleanup(func() {
+		_ = a.Close()
+		_ = b.Close()
+	})
+	return a, b
+}
+
+func TestSendFDFunc(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = w.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	called := 0
+	require.NoError(t, sender.SendFDFunc(r.Fd(), func() {
+		called++
+		// The kernel holds its own reference once queued, so our copy can go
+		assert.NoError(t, r.Close())
+	}))
+	assert.Equal(t, 1, called)
+
+	file, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	_, err = w.WriteString("hi")
+	require.NoError(t, err)
+	buf := make([]byte, 2)
+	_, err = file.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(buf))
+
+	_ = sender.Close()
+	assert.Error(t, sender.SendFDFunc(w.Fd(), func() { called++ }))
+	assert.Equal(t, 1, called)
+}
+
+func TestSendFileAndClose(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = w.Close() }()
+
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendFileAndClose(r))
+	// Our copy is gone
+	assert.Error(t, r.Close())
+
+	file, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	_, err = w.WriteString("hi")
+	require.NoError(t, err)
+	buf := make([]byte, 2)
+	_, err = file.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(buf))
+
+	// A failed send leaves the file open
+	_ = sender.Close()
+	assert.Error(t, sender.SendFileAndClose(w))
+	assert.NoError(t, w.Close())
+}
+
+func TestFDDeadlines(t *testing.T) {
+	sender, receiver := newUnixConnPair(t)
+
+	// Nothing is ever sent, the read deadline ends the wait
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err := receiver.RecvFD()
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "%+v", err)
+	require.NoError(t, receiver.SetReadDeadline(time.Time{}))
+
+	// Nothing is ever read, so once the socket buffer is full the write deadline ends the wait
+	for _, size := range []int{64 * 1024, 1} {
+		require.NoError(t, sender.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+		for err = nil; err == nil; {
+			_, err = sender.Write(make([]byte, size))
+		}
+		require.True(t, errors.Is(err, os.ErrDeadlineExceeded), "%+v", err)
+	}
+	require.NoError(t, sender.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	err = sender.SendFD(os.Stdin.Fd())
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "%+v", err)
+}
+
+func TestSendRecvFDNoLeak(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	sender, receiver := newUnixConnPair(t)
+
+	before, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, sender.SendFD(f.Fd()))
+		fd, err := receiver.RecvFD()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Close(int(fd)))
+	}
+	after, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+	// Neither end dups its socket to send or receive (fds closed meanwhile by the finalizers of earlier tests are fine)
+	diff := before.Diff(after)
+	assert.Empty(t, diff.Opened, "%+v", diff)
+}
+
+func TestCloseReleasesFDs(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The runtime's poller is set up with the first conn, and stays
+	newUnixConnPair(t)
+
+	before, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+
+	// fds prefetched but never received
+	sender, prefetching := newUnixConnPair(t, oob.WithPrefetch(4))
+	require.NoError(t, sender.SendFDs(f.Fd(), f.Fd()))
+	require.Eventually(t, func() bool {
+		depths, err := prefetching.QueueDepths()
+		return err == nil && depths.Prefetched == 2
+	}, time.Second, time.Millisecond)
+	require.NoError(t, prefetching.Close())
+	require.NoError(t, sender.Close())
+
+	// A bundle set aside by Ping, whose own dup is closed again below
+	b := oob.NewBundle()
+	require.NoError(t, b.Add("null", f, nil))
+	sender, pinging := newUnixConnPair(t)
+	require.NoError(t, sender.SendBundle(b))
+	go func() { _ = sender.Ping(ctx) }()
+	require.NoError(t, pinging.Ping(ctx))
+	require.NoError(t, pinging.Close())
+	require.NoError(t, sender.Close())
+
+	// fds received into a cleanup group
+	sender, grouping := newUnixConnPair(t)
+	require.NoError(t, sender.SendFD(f.Fd()))
+	_, err = grouping.Group("session").RecvFD()
+	require.NoError(t, err)
+	require.NoError(t, grouping.Close())
+	require.NoError(t, sender.Close())
+
+	require.NoError(t, b.Close())
+	after, err := oob.SnapshotFDs()
+	require.NoError(t, err)
+	assert.True(t, before.Diff(after).Empty(), "%+v", before.Diff(after))
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oob - Simple out of band file descriptor passing over Unix File Sockets
+// Windows has no SCM_RIGHTS, so there the sender duplicates the handle directly into the process on the other end of
+// the AF_UNIX socket or named pipe (whose pid it asks the socket or pipe for) and sends the value of the duplicated
+// handle in band
+package oob
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// sioAFUnixGetPeerPid - SIO_AF_UNIX_GETPEERPID, _WSAIOR(IOC_VENDOR, 256)
+	sioAFUnixGetPeerPid = 0x58000100
+	// fionread - FIONREAD, _IOR('f', 127, u_long), which golang.org/x/sys/windows doesn't define
+	fionread  = 0x4004667f
+	handleLen = 8
+)
+
+// faultInjector - WithFaultInjection is unix only
+type faultInjector struct{}
+
+// UnixConn - a *net.UnixConn (or, from ListenPipe and DialPipe, a named pipe) + SendFD and RecvFD methods for sending
+//            and receiving handles
+type UnixConn struct {
+	net.Conn
+
+	// sendMu and recvMu keep multi-message exchanges (frames, bundles, ...) from interleaving
+	sendMu sync.Mutex
+	recvMu tryMutex
+
+	opts   options
+	sent   sentFiles
+	pings  pings
+	codecs codecs
+	events eventRing
+	// pending - frames read by Ping while waiting for its pong, for the next readFrame, guarded by recvMu
+	pending []*frame
+	// peerShutdown - set once the peer has said it is shutting down
+	peerShutdown int32
+	// onClose - set by the listener which accepted the conn, WithMaxConns
+	onClose   func()
+	closeOnce sync.Once
+}
+
+// NewUnixConn - wrap a *net.UnixConn providing it additional methods to SendFD and RecvFD
+func NewUnixConn(s *net.UnixConn, opts ...Option) *UnixConn {
+	return newUnixConn(s, opts...)
+}
+
+// acceptedUnixConn - NewUnixConn, with the onClose of the listener which accepted s
+func acceptedUnixConn(s *net.UnixConn, onClose func(), opts ...Option) *UnixConn {
+	conn := newUnixConn(s, opts...)
+	conn.onClose = onClose
+	return conn
+}
+
+func newUnixConn(conn net.Conn, opts ...Option) *UnixConn {
+	s := &UnixConn{Conn: conn, opts: newOptions(opts...)}
+	if s.opts.compression != nil {
+		s.sendMu.Lock()
+		if err := s.advertiseCodecs(); err != nil {
+			s.opts.logf("oob: unable to advertise codecs, retrying with the first frame: %s", err)
+		}
+		s.sendMu.Unlock()
+	}
+	return s
+}
+
+// Close - closes the connection
+func (s *UnixConn) Close() error {
+	err := s.Conn.Close()
+	s.closed()
+	return err
+}
+
+// SendFD - duplicate the handle fd into the process on the other end of the conn and tell it the value of the
+//          duplicate
+func (s *UnixConn) SendFD(fd uintptr) error {
+	return s.sendFDFunc(fd, nil)
+}
+
+// sendFDFunc - SendFD, calling onSent (if not nil) once fd has been duplicated into the peer and its value sent
+func (s *UnixConn) sendFDFunc(fd uintptr, onSent func()) error {
+	if err := s.sendFD(fd); err != nil {
+		return err
+	}
+	if onSent != nil {
+		onSent()
+	}
+	return nil
+}
+
+func (s *UnixConn) sendFD(fd uintptr) (err error) {
+	defer s.opts.profile("SendFD")()
+	defer func() { s.record("SendFD", err, fd) }()
+	s.checkDuplicateSend(fd)
+	peer, err := s.openPeer()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = windows.CloseHandle(peer) }()
+
+	var dup windows.Handle
+	err = windows.DuplicateHandle(windows.CurrentProcess(), windows.Handle(fd), peer, &dup, 0, false, windows.DUPLICATE_SAME_ACCESS)
+	if err != nil {
+		return errors.Wrapf(err, "unable to duplicate handle %d into the peer", fd)
+	}
+	buf := make([]byte, handleLen)
+	binary.LittleEndian.PutUint64(buf, uint64(dup))
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if _, err := s.Conn.Write(buf); err != nil {
+		// The peer will never learn about the duplicate, so close it in the peer
+		_ = windows.DuplicateHandle(peer, dup, 0, nil, 0, false, windows.DUPLICATE_CLOSE_SOURCE)
+		return err
+	}
+	return nil
+}
+
+// SendFile - send the *os.File to the process on the other end of the conn
+func (s *UnixConn) SendFile(file *os.File) error {
+	return s.SendFD(file.Fd())
+}
+
+// RecvFD - recv a handle over the conn
+func (s *UnixConn) RecvFD() (fd uintptr, err error) {
+	defer s.opts.profile("RecvFD")()
+	defer func() { s.recordRecv("RecvFD", fd, err) }()
+	buf := make([]byte, handleLen)
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if _, err := io.ReadFull(s.Conn, buf); err != nil {
+		return 0, err
+	}
+	return uintptr(binary.LittleEndian.Uint64(buf)), nil
+}
+
+// RecvFile - recv an *os.File over the conn
+func (s *UnixConn) RecvFile() (*os.File, error) {
+	fd, err := s.RecvFD()
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(fd, ""), nil
+}
+
+// openPeer - a handle to the process on the other end of the conn, with which handles can be duplicated into it
+func (s *UnixConn) openPeer() (windows.Handle, error) {
+	pid, err := s.peerPid()
+	if err != nil {
+		return 0, err
+	}
+	peer, err := windows.OpenProcess(windows.PROCESS_DUP_HANDLE, false, pid)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to open peer process %d", pid)
+	}
+	return peer, nil
+}
+
+// peerPid - the pid of the process on the other end of the conn
+func (s *UnixConn) peerPid() (uint32, error) {
+	switch conn := s.Conn.(type) {
+	case *pipeConn:
+		return conn.peerPid()
+	case *net.UnixConn:
+		return unixPeerPid(conn)
+	}
+	return 0, errors.Errorf("cannot find the peer process of a %T", s.Conn)
+}
+
+func unixPeerPid(conn *net.UnixConn) (uint32, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var pid uint32
+	var opErr error
+	err = rawConn.Control(func(fd uintptr) {
+		var n uint32
+		opErr = windows.WSAIoctl(windows.Handle(fd), sioAFUnixGetPeerPid, nil, 0,
+			(*byte)(unsafe.Pointer(&pid)), uint32(unsafe.Sizeof(pid)), &n, nil, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if opErr != nil {
+		return 0, errors.Wrap(opErr, "unable to get peer pid")
+	}
+	return pid, nil
+}
+
+// waitReadable - waits up to timeout for data to be waiting on the conn, without reading anything
+//                unlike poll(2) on unix, Windows has no cheap way to wait for readability, so this checks and sleeps
+func (s *UnixConn) waitReadable(timeout time.Duration) (bool, error) {
+	n, err := s.available()
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+	time.Sleep(timeout)
+	n, err = s.available()
+	return n > 0, err
+}
+
+// available - how many bytes are waiting to be read on the conn
+func (s *UnixConn) available() (int, error) {
+	switch conn := s.Conn.(type) {
+	case *pipeConn:
+		return conn.available()
+	case *net.UnixConn:
+		rawConn, err := conn.SyscallConn()
+		if err != nil {
+			return 0, err
+		}
+		var avail uint32
+		var opErr error
+		err = rawConn.Control(func(fd uintptr) {
+			var n uint32
+			opErr = windows.WSAIoctl(windows.Handle(fd), fionread, nil, 0,
+				(*byte)(unsafe.Pointer(&avail)), uint32(unsafe.Sizeof(avail)), &n, nil, 0)
+		})
+		if err != nil {
+			return 0, err
+		}
+		return int(avail), opErr
+	}
+	return 0, errors.Errorf("cannot tell whether a %T is readable", s.Conn)
+}
+
+// fdsExpired - there are no Stats on windows
+func (s *UnixConn) fdsExpired(n int) {}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"io"
+	"net"
+)
+
+// maxUnwrapDepth - how many layers of wrapping ToFd and ToFile will look through before giving up
+const maxUnwrapDepth = 16
+
+// unwrap - returns whatever thing wraps, or nil if thing is not a wrapper we know how to look inside of
+func unwrap(thing interface{}) interface{} {
+	switch t := thing.(type) {
+	case interface{ Unwrap() interface{} }:
+		return t.Unwrap()
+	case interface{ Unwrap() io.Reader }:
+		return t.Unwrap()
+	case interface{ Unwrap() io.Writer }:
+		return t.Unwrap()
+	case interface{ NetConn() net.Conn }:
+		// *tls.Conn and friends
+		return t.NetConn()
+	case *io.LimitedReader:
+		return t.R
+	}
+	return nil
+}
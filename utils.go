@@ -14,45 +14,76 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows
+// +build !windows
+
 package oob
 
 import (
-	"fmt"
-	"io/ioutil"
 	"net"
 	"os"
-	"strconv"
 	"syscall"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
-// ToFile - *os.File from  anything which provides the SyscallConn() (syscall.RawConn, error), fd (uintptr), or inode (uint64)
+// ToFile - *os.File from  anything which provides the SyscallConn() (syscall.RawConn, error), Fd() uintptr, fd (uintptr), or inode (uint64)
+//          or which wraps (via Unwrap()) something that does
+//          if thing is (or wraps) an *os.File, that *os.File is returned, otherwise the returned *os.File shares the
+//          fd of thing, so closing it (or its finalizer) closes that fd, use DupFile for an *os.File of its own
 //          will return an error if there is no open fd or inode matching if requesting for fd or inode
 func ToFile(thing interface{}) (*os.File, error) {
-	// Is it a file?
-	if file, ok := thing.(*os.File); ok {
-		return file, nil
+	// Is it a file, or wrapping a file?
+	for i, inner := 0, thing; inner != nil && i < maxUnwrapDepth; i, inner = i+1, unwrap(inner) {
+		if file, ok := inner.(*os.File); ok {
+			return file, nil
+		}
 	}
 
 	// Can I get a fd from it?
 	if fd, err := ToFd(thing); err == nil {
-		return os.NewFile(fd, fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), fd)), nil
+		return os.NewFile(fd, fdName(fd)), nil
 	}
 	return nil, errors.Errorf("cannot create *os.File for %+v", thing)
 }
 
+// DupFile - *os.File of a dup of the fd of anything which ToFd accepts, which the caller owns and should close, so
+//           that thing's own fd is never closed out from under it (by the caller, or by the finalizer of the *os.File)
+func DupFile(thing interface{}) (*os.File, error) {
+	fd, err := ToFd(thing)
+	if err != nil {
+		return nil, errors.Errorf("cannot create *os.File for %+v", thing)
+	}
+	newFd, err := dupFd(fd)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(newFd, fdName(newFd)), nil
+}
+
+// dupFd - a close on exec dup of fd
+func dupFd(fd uintptr) (uintptr, error) {
+	newFd, err := unix.FcntlInt(fd, unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to dup fd %d", fd)
+	}
+	return uintptr(newFd), nil
+}
+
 // ToConn - net.Conn from  anything which provides the SyscallConn() (syscall.RawConn, error), fd (uintptr), or inode (uint64)
 //          will return an error if there is no open fd or inode matching if requesting for fd or inode
 func ToConn(thing interface{}) (net.Conn, error) {
 	if conn, ok := thing.(net.Conn); ok {
 		return conn, nil
 	}
-	file, err := ToFile(thing)
+	file, err := DupFile(thing)
 	if err != nil {
 		return nil, err
 	}
 	conn, err := net.FileConn(file)
+	// net.FileConn made its own dup
+	_ = file.Close()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -63,13 +94,32 @@ type syscallconner interface {
 	SyscallConn() (syscall.RawConn, error)
 }
 
-// ToFd - fd (file descriptor) from  anything which provides the SyscallConn() (syscall.RawConn, error), fd (uintptr), or inode (uint64)
+type fder interface {
+	Fd() uintptr
+}
+
+// ToFd - fd (file descriptor) from  anything which provides the SyscallConn() (syscall.RawConn, error), Fd() uintptr, fd (uintptr), or inode (uint64)
+//        or which wraps (via Unwrap()) something that does, so an fs.File or a wrapped net.Conn can be sent as easily as an *os.File
 //        will return an error if there is no open fd or inode matching if requesting for fd or inode
 func ToFd(thing interface{}) (uintptr, error) {
+	fd, err := toFd(thing)
+	if err == nil {
+		return fd, nil
+	}
+	// Is it wrapping something we can get an fd from?
+	for i, inner := 0, unwrap(thing); inner != nil && i < maxUnwrapDepth; i, inner = i+1, unwrap(inner) {
+		if fd, innerErr := toFd(inner); innerErr == nil {
+			return fd, nil
+		}
+	}
+	return 0, err
+}
+
+func toFd(thing interface{}) (uintptr, error) {
 	// Is it a uintptr (ie, a fd)
 	if fd, ok := thing.(uintptr); ok {
-		// Is it really an fd?
-		if file := os.NewFile(fd, ""); file == nil {
+		// Is it really an fd?  Ask with fcntl rather than os.NewFile, whose finalizer would close it
+		if _, err := unix.FcntlInt(fd, unix.F_GETFD, 0); err != nil {
 			return 0, errors.Errorf("fd %d is not a valid file descriptor", fd)
 		}
 		return fd, nil
@@ -77,24 +127,32 @@ func ToFd(thing interface{}) (uintptr, error) {
 
 	// Is it a uint64 (ie, an inode)
 	if inode, ok := thing.(uint64); ok {
-		fis, err := ioutil.ReadDir("/proc/self/fd/")
+		fds, err := openFDs()
 		if err != nil {
 			return 0, err
 		}
-		for _, fi := range fis {
-			// You may be asking yourself... why not just use fi.Sys().(*syscall.Stat_t).Ino, nil
-			// The answer is because /proc/self/fd/${fd} is a *link* to the file, with its own distinct Inode
-			fd64, err := strconv.ParseUint(fi.Name(), 10, 64)
-			if err != nil {
-				return 0, errors.WithStack(err)
+		for _, fd := range fds {
+			// An anonymous inode is shared by unrelated fds, so its number alone can't say which one is meant
+			id, err := fileIdentity(fd)
+			if err == nil && id.Inode == inode && !id.Anonymous() {
+				return fd, nil
 			}
-			fd := uintptr(fd64)
-			fdInode, err := ToInode(fd)
-			if err == nil && fdInode == inode {
+		}
+		return 0, errors.Errorf("cannot find an open fd in process %d for inode %d", os.Getpid(), inode)
+	}
+
+	// Is it an Identity
+	if id, ok := thing.(Identity); ok {
+		fds, err := openFDs()
+		if err != nil {
+			return 0, err
+		}
+		for _, fd := range fds {
+			if fdID, err := fileIdentity(fd); err == nil && fdID == id {
 				return fd, nil
 			}
 		}
-		return 0, errors.Errorf("cannot find fd in /proc/%d/fd/* for inode %d", os.Getpid(), inode)
+		return 0, errors.Errorf("cannot find an open fd in process %d for %+v", os.Getpid(), id)
 	}
 
 	// Does it provide a syscall.RawCall?
@@ -114,6 +172,11 @@ func ToFd(thing interface{}) (uintptr, error) {
 		return <-fdchan, nil
 	}
 
+	// Does it at least provide an Fd()?
+	if f, ok := thing.(fder); ok {
+		return f.Fd(), nil
+	}
+
 	return 0, errors.Errorf("cannot extract fd from %+v", thing)
 }
 
@@ -123,19 +186,12 @@ func ToInode(thing interface{}) (uint64, error) {
 	// Is it already a uint64 and thus presumably an inode?
 	if inode, ok := thing.(uint64); ok {
 		// Is it *really* an inode though?
-		fis, err := ioutil.ReadDir("/proc/self/fd/")
+		fds, err := openFDs()
 		if err != nil {
 			return 0, err
 		}
-		for _, fi := range fis {
-			// You may be asking yourself... why not just use fi.Sys().(*syscall.Stat_t).Ino, nil
-			// The answer is because /proc/self/fd/${fd} is a *link* to the file, with its own distinct Inode
-			fd64, err := strconv.ParseUint(fi.Name(), 10, 64)
-			if err != nil {
-				return 0, errors.WithStack(err)
-			}
-			fd := uintptr(fd64)
-			fdInode, err := ToInode(fd)
+		for _, fd := range fds {
+			fdInode, err := fdInode(fd)
 			if err == nil && fdInode == inode {
 				return inode, nil
 			}
@@ -143,13 +199,50 @@ func ToInode(thing interface{}) (uint64, error) {
 		return inode, nil
 	}
 
-	file, err := ToFile(thing)
+	// fstat the fd directly rather than wrapping it in an *os.File that would close it when garbage collected
+	fd, err := ToFd(thing)
 	if err != nil {
 		return 0, err
 	}
-	fi, err := file.Stat()
-	if err != nil {
+	return fdInode(fd)
+}
+
+// fileIdentity - the device and inode of fd, and its class if that inode is anonymous
+func fileIdentity(fd uintptr) (Identity, error) {
+	stat := &syscall.Stat_t{}
+	if err := syscall.Fstat(int(fd), stat); err != nil {
+		return Identity{}, err
+	}
+	return Identity{Dev: uint64(stat.Dev), Inode: stat.Ino, Class: anonInodeClass(fd)}, nil
+}
+
+// fdKind - what kind of file fd is, one of the Kind constants
+func fdKind(fd uintptr) (string, error) {
+	stat := &syscall.Stat_t{}
+	if err := syscall.Fstat(int(fd), stat); err != nil {
+		return "", err
+	}
+	switch uint32(stat.Mode) & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		return KindDir, nil
+	case syscall.S_IFLNK:
+		return KindSymlink, nil
+	case syscall.S_IFSOCK:
+		return KindSocket, nil
+	case syscall.S_IFIFO:
+		return KindFifo, nil
+	case syscall.S_IFCHR:
+		return KindChar, nil
+	case syscall.S_IFBLK:
+		return KindBlock, nil
+	}
+	return KindFile, nil
+}
+
+func fdInode(fd uintptr) (uint64, error) {
+	stat := &syscall.Stat_t{}
+	if err := syscall.Fstat(int(fd), stat); err != nil {
 		return 0, err
 	}
-	return fi.Sys().(*syscall.Stat_t).Ino, nil
+	return stat.Ino, nil
 }
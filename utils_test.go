@@ -14,14 +14,20 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows
+// +build !windows
+
 package oob_test
 
 import (
+	"bufio"
 	"context"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"syscall"
 	"testing"
 
@@ -100,6 +106,68 @@ func TestFileToFile(t *testing.T) {
 	assert.Equal(t, file, file2)
 }
 
+type unwrapReader struct {
+	*bufio.Reader
+	r io.Reader
+}
+
+func (u *unwrapReader) Unwrap() io.Reader {
+	return u.r
+}
+
+func TestWrappedFileToFd(t *testing.T) {
+	file, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	wrapped := &unwrapReader{Reader: bufio.NewReader(file), r: &io.LimitedReader{R: file, N: 1}}
+	fd, err := oob.ToFd(wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, file.Fd(), fd)
+	file2, err := oob.ToFile(wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, file, file2)
+}
+
+func TestFSFileToFd(t *testing.T) {
+	file, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	fsFile, err := os.DirFS(filepath.Dir(file.Name())).Open(filepath.Base(file.Name()))
+	require.NoError(t, err)
+	defer func() { _ = fsFile.Close() }()
+	inode, err := oob.ToInode(file)
+	require.NoError(t, err)
+	fd, err := oob.ToFd(fsFile)
+	require.NoError(t, err)
+	inode2, err := oob.ToInode(fd)
+	require.NoError(t, err)
+	assert.Equal(t, inode, inode2)
+
+	// Nothing along the way may have taken ownership of fsFile's fd and closed it when garbage collected
+	runtime.GC()
+	runtime.GC()
+	_, err = fsFile.Stat()
+	assert.NoError(t, err)
+}
+
+func TestDupFile(t *testing.T) {
+	conn := CreatTestConn(t)
+	defer func() { _ = conn.Close() }()
+	fd, err := oob.ToFd(conn)
+	require.NoError(t, err)
+	file, err := oob.DupFile(conn)
+	require.NoError(t, err)
+	assert.NotEqual(t, fd, file.Fd())
+	require.NoError(t, file.Close())
+
+	// Closing the dup leaves conn alone
+	inode, err := oob.ToInode(conn)
+	require.NoError(t, err)
+	assert.NotZero(t, inode)
+	_, err = conn.Write([]byte("still open"))
+	assert.NoError(t, err)
+}
+
 func CreatTestConn(t *testing.T) net.Conn {
 	// Create a test server
 	dirname, err := ioutil.TempDir(os.TempDir(), "oob_test")
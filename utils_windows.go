@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oob
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// ToFile - *os.File from anything which provides the SyscallConn() (syscall.RawConn, error), Fd() uintptr, or
+//          handle (uintptr), or which wraps (via Unwrap()) something that does
+//          if thing is (or wraps) an *os.File, that *os.File is returned, otherwise the returned *os.File shares the
+//          handle of thing, so closing it (or its finalizer) closes that handle, use DupFile for an *os.File of its own
+func ToFile(thing interface{}) (*os.File, error) {
+	for i, inner := 0, thing; inner != nil && i < maxUnwrapDepth; i, inner = i+1, unwrap(inner) {
+		if file, ok := inner.(*os.File); ok {
+			return file, nil
+		}
+	}
+	fd, err := ToFd(thing)
+	if err != nil {
+		return nil, errors.Errorf("cannot create *os.File for %+v", thing)
+	}
+	return os.NewFile(fd, ""), nil
+}
+
+// DupFile - *os.File of a duplicate of the handle of anything which ToFd accepts, which the caller owns and should
+//           close, so that thing's own handle is never closed out from under it
+func DupFile(thing interface{}) (*os.File, error) {
+	fd, err := ToFd(thing)
+	if err != nil {
+		return nil, errors.Errorf("cannot create *os.File for %+v", thing)
+	}
+	newFd, err := dupFd(fd)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(newFd, ""), nil
+}
+
+type syscallconner interface {
+	SyscallConn() (syscall.RawConn, error)
+}
+
+type fder interface {
+	Fd() uintptr
+}
+
+// ToFd - handle from anything which provides the SyscallConn() (syscall.RawConn, error), Fd() uintptr, or handle
+//        (uintptr), or which wraps (via Unwrap()) something that does
+func ToFd(thing interface{}) (uintptr, error) {
+	fd, err := toFd(thing)
+	if err == nil {
+		return fd, nil
+	}
+	for i, inner := 0, unwrap(thing); inner != nil && i < maxUnwrapDepth; i, inner = i+1, unwrap(inner) {
+		if fd, innerErr := toFd(inner); innerErr == nil {
+			return fd, nil
+		}
+	}
+	return 0, err
+}
+
+func toFd(thing interface{}) (uintptr, error) {
+	if fd, ok := thing.(uintptr); ok {
+		if _, err := windows.GetFileType(windows.Handle(fd)); err != nil {
+			return 0, errors.Errorf("handle %d is not a valid handle", fd)
+		}
+		return fd, nil
+	}
+	if scc, ok := thing.(syscallconner); ok {
+		rawconn, err := scc.SyscallConn()
+		if err != nil {
+			return 0, err
+		}
+		var fd uintptr
+		if err := rawconn.Control(func(f uintptr) { fd = f }); err != nil {
+			return 0, err
+		}
+		return fd, nil
+	}
+	if f, ok := thing.(fder); ok {
+		return f.Fd(), nil
+	}
+	return 0, errors.Errorf("cannot extract handle from %+v", thing)
+}
+
+// ToConn - net.Conn from thing, which must already be (or wrap) a net.Conn, since Windows can't make a net.Conn
+//          out of a handle
+func ToConn(thing interface{}) (net.Conn, error) {
+	for i, inner := 0, thing; inner != nil && i < maxUnwrapDepth; i, inner = i+1, unwrap(inner) {
+		if conn, ok := inner.(net.Conn); ok {
+			return conn, nil
+		}
+	}
+	return nil, errors.Errorf("cannot create net.Conn for %+v", thing)
+}
+
+// dupFd - a duplicate of the handle fd, in this process
+func dupFd(fd uintptr) (uintptr, error) {
+	self := windows.CurrentProcess()
+	var dup windows.Handle
+	if err := windows.DuplicateHandle(self, windows.Handle(fd), self, &dup, 0, false, windows.DUPLICATE_SAME_ACCESS); err != nil {
+		return 0, errors.Wrapf(err, "unable to duplicate handle %d", fd)
+	}
+	return uintptr(dup), nil
+}
+
+// fdKind - what kind of file the handle fd is, one of the Kind constants
+func fdKind(fd uintptr) (string, error) {
+	typ, err := windows.GetFileType(windows.Handle(fd))
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case windows.FILE_TYPE_PIPE:
+		return KindFifo, nil
+	case windows.FILE_TYPE_CHAR:
+		return KindChar, nil
+	}
+	return KindFile, nil
+}
+
+// fileIdentity - the volume and file index of the handle fd
+func fileIdentity(fd uintptr) (Identity, error) {
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(fd), &info); err != nil {
+		return Identity{}, err
+	}
+	return Identity{
+		Dev:   uint64(info.VolumeSerialNumber),
+		Inode: uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow),
+	}, nil
+}
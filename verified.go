@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ErrIdentityMismatch - returned by SendVerifiedPath when the file opened at the path is not the one expected
+var ErrIdentityMismatch = errors.New("opened file does not match the expected identity")
+
+// PathIdentity - the Identity of the file at path (following symlinks, as opening it does), to be checked later by
+//                SendVerifiedPath
+func PathIdentity(path string) (Identity, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Identity{}, errors.WithStack(err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Identity{}, errors.Errorf("no device and inode for %s", path)
+	}
+	return Identity{Dev: uint64(stat.Dev), Inode: stat.Ino}, nil
+}
+
+// SendVerifiedPath - opens path read only, and sends it only if the opened file is expected (by device and inode),
+//                    so a path swapped (say for a symlink) between deciding to serve it and opening it is refused with
+//                    ErrIdentityMismatch rather than sent
+//                    the check is made on the open fd, which is what is sent, so nothing can change in between
+func (s *UnixConn) SendVerifiedPath(path string, expected Identity) error {
+	file, err := os.Open(path) // #nosec G304 - the path is the caller's, and is verified before being sent
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = file.Close() }()
+	id, err := fileIdentity(file.Fd())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if id.Dev != expected.Dev || id.Inode != expected.Inode {
+		return errors.Wrapf(ErrIdentityMismatch, "%s is dev %d inode %d, expected dev %d inode %d", path, id.Dev, id.Inode, expected.Dev, expected.Inode)
+	}
+	return s.SendFile(file)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+func TestSendVerifiedPath(t *testing.T) {
+	dir := t.TempDir()
+	served := filepath.Join(dir, "served")
+	other := filepath.Join(dir, "other")
+	require.NoError(t, ioutil.WriteFile(served, []byte("served"), 0o600))
+	require.NoError(t, ioutil.WriteFile(other, []byte("other"), 0o600))
+	expected, err := oob.PathIdentity(served)
+	require.NoError(t, err)
+
+	sender, receiver := newUnixConnPair(t)
+	require.NoError(t, sender.SendVerifiedPath(served, expected))
+	received, err := receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	buf, err := ioutil.ReadAll(received)
+	require.NoError(t, err)
+	assert.Equal(t, "served", string(buf))
+
+	// Swapped for a symlink to something else after it was chosen
+	require.NoError(t, os.Remove(served))
+	require.NoError(t, os.Symlink(other, served))
+	err = sender.SendVerifiedPath(served, expected)
+	assert.True(t, errors.Is(err, oob.ErrIdentityMismatch), "%+v", err)
+
+	// Nothing was sent
+	require.NoError(t, sender.SendVerifiedPath(other, mustPathIdentity(t, other)))
+	received, err = receiver.RecvFile()
+	require.NoError(t, err)
+	defer func() { _ = received.Close() }()
+	buf, err = ioutil.ReadAll(received)
+	require.NoError(t, err)
+	assert.Equal(t, "other", string(buf))
+
+	assert.Error(t, sender.SendVerifiedPath(filepath.Join(dir, "missing"), expected))
+}
+
+func mustPathIdentity(t *testing.T, path string) oob.Identity {
+	id, err := oob.PathIdentity(path)
+	require.NoError(t, err)
+	return id
+}
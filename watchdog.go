@@ -0,0 +1,174 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob
+
+import (
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithWatchdog - watch the connection for pathological states and report them (with the stack of the operation
+//                involved) via the Logger set with WithLogger:
+//                 - a send blocked for longer than threshold, a send the peer isn't receiving
+//                 - a receive blocked for longer than threshold with nothing arriving, which if the peer is
+//                   receiving too means both ends are waiting on each other
+//                 - fds (or data) waiting on this end for longer than threshold with nothing receiving them, in the
+//                   socket or (WithPrefetch) in the prefetch queue
+func WithWatchdog(threshold time.Duration) Option {
+	return func(o *options) {
+		o.watchdog = threshold
+	}
+}
+
+type watchedOp struct {
+	name     string
+	send     bool
+	start    time.Time
+	stack    []byte
+	reported bool
+}
+
+type watchdog struct {
+	threshold time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	ops           map[*watchedOp]struct{}
+	waitingSince  time.Time
+	waitingLogged bool
+}
+
+func (s *UnixConn) startWatchdog(threshold time.Duration) {
+	w := &watchdog{
+		threshold: threshold,
+		done:      make(chan struct{}),
+		ops:       make(map[*watchedOp]struct{}),
+	}
+	s.watchdog = w
+	goLabeled("watchdog", func() {
+		ticker := time.NewTicker(threshold / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.checkWatchdog(time.Now())
+			case <-w.done:
+				return
+			}
+		}
+	})
+}
+
+// watch - records that the operation name is in progress until the returned func is called, which also counts as
+//         activity for WithIdleTimeout
+func (s *UnixConn) watch(name string, send bool) func() {
+	inProgress := &s.receiving
+	if send {
+		inProgress = &s.sending
+	}
+	atomic.AddInt32(inProgress, 1)
+	done := s.watchOp(name, send)
+	return func() {
+		done()
+		atomic.AddInt32(inProgress, -1)
+	}
+}
+
+// watchOp - registers the operation with the watchdog, if any
+func (s *UnixConn) watchOp(name string, send bool) func() {
+	w, idle := s.watchdog, s.idle
+	if w == nil {
+		if idle == nil {
+			return func() {}
+		}
+		return idle.touch
+	}
+	op := &watchedOp{name: name, send: send, start: time.Now(), stack: debug.Stack()}
+	w.mu.Lock()
+	w.ops[op] = struct{}{}
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		delete(w.ops, op)
+		w.mu.Unlock()
+		if idle != nil {
+			idle.touch()
+		}
+	}
+}
+
+func (s *UnixConn) checkWatchdog(now time.Time) {
+	w := s.watchdog
+	w.mu.Lock()
+	receiving := false
+	for op := range w.ops {
+		receiving = receiving || !op.send
+		blocked := now.Sub(op.start)
+		if op.reported || blocked < w.threshold {
+			continue
+		}
+		op.reported = true
+		if op.send {
+			s.opts.logf("oob watchdog: %s blocked for %s, the peer is not receiving\n%s", op.name, blocked, op.stack)
+			continue
+		}
+		s.opts.logf("oob watchdog: %s blocked for %s with nothing arriving, if the peer is receiving too both ends are waiting on each other\n%s", op.name, blocked, op.stack)
+	}
+	w.mu.Unlock()
+
+	since, waiting := s.waitingSince(now, receiving)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !waiting {
+		w.waitingSince = time.Time{}
+		w.waitingLogged = false
+		return
+	}
+	if w.waitingSince.IsZero() || since.Before(w.waitingSince) {
+		w.waitingSince = since
+	}
+	if waited := now.Sub(w.waitingSince); !w.waitingLogged && waited >= w.threshold {
+		w.waitingLogged = true
+		s.opts.logf("oob watchdog: fds (or data) have been waiting to be received on this end for %s, is anything receiving them (or has the peer closed)?", waited)
+	}
+}
+
+// waitingSince - whether something is waiting on this end to be received, and since when (as far as we know)
+func (s *UnixConn) waitingSince(now time.Time, receiving bool) (time.Time, bool) {
+	if s.prefetch != nil {
+		return s.prefetch.oldest()
+	}
+	if receiving {
+		// Whatever is there is being received right now
+		return time.Time{}, false
+	}
+	readable, err := s.waitReadable(0)
+	if err != nil || !readable {
+		return time.Time{}, false
+	}
+	return now, true
+}
+
+func (w *watchdog) close() {
+	w.closeOnce.Do(func() { close(w.done) })
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2020 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package oob_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edwarnicke/oob"
+)
+
+// syncBuffer - a bytes.Buffer safe to log to from the watchdog goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) contains(s string) func() bool {
+	return func() bool { return strings.Contains(b.String(), s) }
+}
+
+func TestWatchdog(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	out := &syncBuffer{}
+	sender, watched := newUnixConnPair(t, oob.WithLogger(log.New(out, "", 0)), oob.WithWatchdog(20*time.Millisecond))
+
+	// Sent but never received
+	require.NoError(t, sender.SendFD(r.Fd()))
+	assert.Eventually(t, out.contains("waiting to be received on this end"), time.Second, 10*time.Millisecond)
+	fd, err := watched.RecvFD()
+	require.NoError(t, err)
+	_ = syscall.Close(int(fd))
+
+	// Receiving with nothing arriving
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := watched.RecvFDs(1)
+		errCh <- err
+	}()
+	assert.Eventually(t, out.contains("both ends are waiting on each other"), time.Second, 10*time.Millisecond)
+	assert.Contains(t, out.String(), "TestWatchdog")
+	require.NoError(t, watched.Close())
+	assert.Error(t, <-errCh)
+}
+
+func TestWatchdogPrefetched(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	defer func() { _ = w.Close() }()
+
+	out := &syncBuffer{}
+	sender, _ := newUnixConnPair(t, oob.WithLogger(log.New(out, "", 0)), oob.WithWatchdog(20*time.Millisecond), oob.WithPrefetch(4))
+	require.NoError(t, sender.SendFD(r.Fd()))
+	assert.Eventually(t, out.contains("waiting to be received on this end"), time.Second, 10*time.Millisecond)
+}
+
+func TestWatchdogBlockedSend(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "oob_test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(file.Name()) }()
+	b := oob.NewBundle()
+	// A manifest far bigger than the socket buffers, which the peer never reads
+	require.NoError(t, b.Add("file", file, map[string]string{"padding": strings.Repeat("x", 4<<20)}))
+	defer func() { _ = b.Close() }()
+
+	out := &syncBuffer{}
+	_, watched := newUnixConnPair(t, oob.WithLogger(log.New(out, "", 0)), oob.WithWatchdog(20*time.Millisecond))
+	errCh := make(chan error, 1)
+	go func() { errCh <- watched.SendBundle(b) }()
+	assert.Eventually(t, out.contains("the peer is not receiving"), time.Second, 10*time.Millisecond)
+	require.NoError(t, watched.Close())
+	assert.Error(t, <-errCh)
+}